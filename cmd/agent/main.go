@@ -1,7 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,20 +17,28 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/your-server-support/podman-swarm/internal/api"
+	"github.com/your-server-support/podman-swarm/internal/audit"
 	"github.com/your-server-support/podman-swarm/internal/cluster"
 	"github.com/your-server-support/podman-swarm/internal/config"
+	"github.com/your-server-support/podman-swarm/internal/controller"
 	"github.com/your-server-support/podman-swarm/internal/discovery"
 	"github.com/your-server-support/podman-swarm/internal/dns"
 	"github.com/your-server-support/podman-swarm/internal/ingress"
 	"github.com/your-server-support/podman-swarm/internal/parser"
 	"github.com/your-server-support/podman-swarm/internal/podman"
+	"github.com/your-server-support/podman-swarm/internal/raft"
 	"github.com/your-server-support/podman-swarm/internal/scheduler"
 	"github.com/your-server-support/podman-swarm/internal/security"
 	"github.com/your-server-support/podman-swarm/internal/storage"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
 	cfg := config.Load()
 
@@ -36,17 +51,30 @@ func main() {
 
 	logger.Infof("Starting Podman Swarm agent: %s", cfg.NodeName)
 
-	// Initialize token manager
-	tokenManager := security.NewTokenManager([]byte(cfg.EncryptionKey))
+	// Get the gossip key and, on managers, the secret join tokens are signed
+	// with. A new node is handed them by a manager in exchange for its join token.
+	encryptionKey, joinSecret, err := clusterKeys(cfg, logger)
+	if err != nil {
+		logger.Fatalf("Failed to get cluster keys: %v", err)
+	}
+
+	// Managers admit nodes with join tokens
+	var tokenManager *security.TokenManager
+	if joinSecret != nil {
+		tokenManager = security.NewTokenManager(joinSecret)
+	}
 
-	// Generate join token if this is the first node and no token provided
-	if len(cfg.JoinAddrs) == 0 && cfg.JoinToken == "" {
-		token, err := tokenManager.GenerateToken()
-		if err != nil {
-			logger.Fatalf("Failed to generate join token: %v", err)
+	// Generate join tokens if this is the first node
+	if tokenManager != nil && len(cfg.JoinAddrs) == 0 {
+		ttl := time.Duration(cfg.JoinTokenTTL) * time.Hour
+		for _, role := range []string{security.JoinRoleWorker, security.JoinRoleManager} {
+			token, err := tokenManager.GenerateJoinToken(role, ttl)
+			if err != nil {
+				logger.Fatalf("Failed to generate join token: %v", err)
+			}
+			logger.Infof("Generated %s join token, valid for %v: %s", role, ttl, token)
 		}
-		logger.Infof("Generated join token: %s", token)
-		logger.Infof("Use this token to join other nodes: --join-token=%s", token)
+		logger.Infof("Use a token to join other nodes: --join=<address of this node> --join-token=<token>")
 	}
 
 	// Load TLS configuration if provided
@@ -70,40 +98,63 @@ func main() {
 		logger.Info("TLS encryption enabled")
 	}
 
-	// Prepare encryption key
-	var encryptionKey []byte
-	if cfg.EncryptionKey != "" {
-		encryptionKey = []byte(cfg.EncryptionKey)
-	} else if len(cfg.JoinAddrs) > 0 && cfg.JoinToken != "" {
-		// If joining, we need the encryption key from the cluster
-		// For now, derive from join token
-		encryptionKey = []byte(cfg.JoinToken)
-	} else {
-		// Generate a random key for the first node
-		encryptionKey = make([]byte, 32)
-		if _, err := os.ReadFile(cfg.DataDir + "/encryption.key"); err == nil {
-			// Load existing key if available
-			keyData, _ := os.ReadFile(cfg.DataDir + "/encryption.key")
-			if len(keyData) >= 32 {
-				encryptionKey = keyData[:32]
-			}
-		} else {
-			// Save generated key
-			os.MkdirAll(cfg.DataDir, 0755)
-			os.WriteFile(cfg.DataDir+"/encryption.key", encryptionKey, 0600)
+	// Detect node capacity, explicit values take precedence
+	capacity := cluster.DetectCapacity()
+	if cfg.NodeCPU != "" {
+		cpu, err := resource.ParseQuantity(cfg.NodeCPU)
+		if err != nil {
+			logger.Fatalf("Invalid node CPU capacity: %v", err)
 		}
+		capacity[corev1.ResourceCPU] = cpu
+	}
+	if cfg.NodeMemory != "" {
+		memory, err := resource.ParseQuantity(cfg.NodeMemory)
+		if err != nil {
+			logger.Fatalf("Invalid node memory capacity: %v", err)
+		}
+		capacity[corev1.ResourceMemory] = memory
+	}
+
+	labels, err := cluster.ParseLabels(cfg.NodeLabels, cfg.NodeRoles)
+	if err != nil {
+		logger.Fatalf("Invalid node labels: %v", err)
+	}
+
+	// Audit API requests and security events of the cluster
+	auditLog, err := audit.NewLogger(cfg.DataDir+"/audit.log", int64(cfg.AuditMaxSize)<<20, cfg.AuditMaxBackups, logger)
+	if err != nil {
+		logger.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	// The gossip keys installed through the API, the key of the cluster before
+	keyring, err := security.ReadKeyring(cfg.DataDir + "/keyring.json")
+	if err != nil {
+		logger.Fatalf("Failed to load keyring: %v", err)
+	}
+	// The secret the node fetches new gossip keys from managers with, if it was admitted
+	nodeSecret, err := os.ReadFile(cfg.DataDir + "/node.key")
+	if err != nil && !os.IsNotExist(err) {
+		logger.Fatalf("Failed to load node secret: %v", err)
 	}
 
 	// Initialize cluster
 	clusterConfig := &cluster.ClusterConfig{
-		NodeName:      cfg.NodeName,
-		BindAddr:      cfg.BindAddr,
-		JoinAddrs:     cfg.JoinAddrs,
-		JoinToken:     cfg.JoinToken,
-		EncryptionKey: encryptionKey,
-		TLSConfig:     tlsConfigLoaded,
-		TokenManager:  tokenManager,
-		Logger:        logger,
+		NodeName:          cfg.NodeName,
+		BindAddr:          cfg.BindAddr,
+		JoinAddrs:         cfg.JoinAddrs,
+		EncryptionKey:     encryptionKey,
+		Keyring:           keyring,
+		KeyringFile:       cfg.DataDir + "/keyring.json",
+		TLSConfig:         tlsConfigLoaded,
+		TokenManager:      tokenManager,
+		NodeSecret:        nodeSecret,
+		Capacity:          capacity,
+		Labels:            labels,
+		AgentVersion:      version,
+		FailedNodeTimeout: time.Duration(cfg.FailedNodeTimeout) * time.Minute,
+		AuditLog:          auditLog,
+		Logger:            logger,
 	}
 
 	clusterInstance, err := cluster.NewCluster(clusterConfig)
@@ -120,30 +171,79 @@ func main() {
 		logger.Fatalf("Failed to initialize Podman client: %v", err)
 	}
 
+	// Advertise the Podman version and the API address to the peers
+	podmanVersion, err := podmanClient.Version()
+	if err != nil {
+		logger.Warnf("Failed to get Podman version: %v", err)
+	}
+	apiAddress := advertisedAPIAddress(cfg.APIAddr, clusterInstance.GetLocalNodeAddress())
+	if err := clusterInstance.UpdateLocalMeta(func(meta *cluster.NodeMeta) {
+		meta.PodmanVersion = podmanVersion
+		meta.APIAddress = apiAddress
+	}); err != nil {
+		logger.Warnf("Failed to update node metadata: %v", err)
+	}
+
 	// Initialize storage
+	// Secrets are encrypted at rest with the cluster key
 	storageInstance, err := storage.NewStorage(storage.StorageConfig{
-		DataDir: cfg.DataDir,
-		Logger:  logger,
+		DataDir:   cfg.DataDir,
+		Encryptor: clusterInstance.GetEncryptor(),
+		NodeName:  cfg.NodeName,
+		Logger:    logger,
 	})
 	if err != nil {
 		logger.Fatalf("Failed to initialize storage: %v", err)
 	}
 	logger.Info("Storage initialized successfully")
 
+	// Revoked join tokens are part of the cluster state, so that every
+	// manager rejects them
+	if tokenManager != nil {
+		tokenManager.SetStore(storageInstance)
+	}
+
+	// Replicate the cluster state through a Raft log over the cluster transport.
+	// Every node receives the log, the voters are chosen among the members.
+	var raftNode *raft.Node
+	if cfg.EnableConsensus {
+		raftNode, err = raft.NewNode(raft.Config{
+			NodeName:  cfg.NodeName,
+			DataDir:   cfg.DataDir + "/raft",
+			Bootstrap: len(cfg.JoinAddrs) == 0,
+			MaxVoters: cfg.RaftVoters,
+			FSM:       storageInstance.FSM(),
+			Send: func(node string, msg []byte) error {
+				return clusterInstance.SendTo(cluster.MessageRaft, node, msg)
+			},
+			Members: func() []string {
+				var names []string
+				for _, node := range clusterInstance.GetNodes() {
+					names = append(names, node.Name)
+				}
+				return names
+			},
+			Logger: logger,
+		})
+		if err != nil {
+			logger.Fatalf("Failed to initialize consensus: %v", err)
+		}
+		storageInstance.SetReplicator(raftNode)
+		clusterInstance.SetLeaderFunc(raftNode.IsLeader)
+		raftNode.Start()
+		defer raftNode.Stop()
+		logger.Info("Consensus enabled, cluster state is replicated through Raft")
+	}
+
 	// Initialize service discovery
 	discoveryClient := discovery.NewDiscovery(clusterInstance, logger)
 
-	// Set message handler for cluster (handles both service discovery and state sync)
-	clusterInstance.SetMessageHandler(func(msg []byte) error {
-		// Try to handle as service discovery message first
-		discoveryClient.HandleServiceUpdate(msg)
-		
-		// Try to handle as state sync message
-		storageInstance.HandleStateSyncMessage(msg)
-		
-		// Always return nil - we handle both message types
-		return nil
-	})
+	// Route cluster messages to their handlers by type
+	clusterInstance.RegisterHandler(cluster.MessageServiceUpdate, discoveryClient.HandleServiceUpdate)
+	clusterInstance.RegisterHandler(cluster.MessageState, storageInstance.HandleStateSyncMessage)
+	if raftNode != nil {
+		clusterInstance.RegisterHandler(cluster.MessageRaft, raftNode.HandleMessage)
+	}
 
 	// Initialize DNS server
 	localNodeIP := clusterInstance.GetLocalNodeAddress()
@@ -158,17 +258,26 @@ func main() {
 	// Configure Podman client to use DNS server
 	podmanClient.SetDNS(dnsServer.GetDNSIP())
 
-	// Initialize API token manager
-	apiTokenManager := security.NewAPITokenManager(encryptionKey)
+	// ConfigMap and Secret volumes are written below the data directory
+	podmanClient.SetVolumeDir(cfg.DataDir + "/volumes")
+
+	// Initialize API token manager. The token hashes are part of the cluster
+	// state and salted with the cluster key, which admitted nodes are handed,
+	// so that a token is valid on every node.
+	apiTokenManager := security.NewAPITokenManager(clusterInstance.ClusterKey())
+	apiTokenManager.SetStore(storageInstance)
 	apiTokenManager.StartCleanupRoutine()
 
-	// Generate initial API token if provided in config
+	// Register the API token provided in config
 	if cfg.APIToken != "" {
-		// Use provided token
-		apiTokenManager.GenerateToken("default", nil)
-		logger.Infof("Using configured API token")
-	} else if cfg.EnableAPIAuth {
-		// Generate a new token
+		if err := apiTokenManager.AddToken("default", cfg.APIToken, nil); err != nil {
+			logger.Warnf("Failed to register API token: %v", err)
+		} else {
+			logger.Infof("Using configured API token")
+		}
+	} else if cfg.EnableAPIAuth && len(cfg.JoinAddrs) == 0 && len(apiTokenManager.ListTokens()) == 0 {
+		// Generate a new token for a new cluster, joining nodes receive the
+		// tokens with the cluster state
 		token, err := apiTokenManager.GenerateToken("default", nil)
 		if err != nil {
 			logger.Fatalf("Failed to generate API token: %v", err)
@@ -179,15 +288,45 @@ func main() {
 
 	// Initialize scheduler
 	schedulerInstance := scheduler.NewScheduler(clusterInstance, logger)
+	if err := schedulerInstance.SetStrategy(scheduler.Strategy(cfg.SchedulerStrategy)); err != nil {
+		logger.Fatalf("Failed to configure scheduler: %v", err)
+	}
 
 	// Initialize parser
 	parserInstance := parser.NewParser()
 
+	// Initialize controller and start the reconciliation loop (every 10 seconds)
+	controllerInstance := controller.NewController(
+		storageInstance,
+		schedulerInstance,
+		podmanClient,
+		clusterInstance,
+		discoveryClient,
+		parserInstance,
+		logger,
+	)
+	controllerInstance.Start(10 * time.Second)
+
+	// Place daemon set pods and reschedule pods as soon as nodes join or leave
+	clusterInstance.SetMembershipHandler(controllerInstance.HandleMembershipChange)
+
+	// Singleton work runs on the holders of the leases
+	clusterInstance.StartLease(cluster.LeaseLeader, cluster.DefaultLeaseTTL)
+	clusterInstance.StartLease(cluster.LeaseCronJobs, cluster.DefaultLeaseTTL)
+	clusterInstance.StartLease(cluster.LeaseBackup, cluster.DefaultLeaseTTL)
+
 	// Start periodic backup (every 1 hour)
-	storageInstance.StartPeriodicBackup(1 * time.Hour)
+	storageInstance.StartPeriodicBackup(1*time.Hour, func() bool {
+		return clusterInstance.HoldsLease(cluster.LeaseBackup)
+	})
 
-	// Start periodic state sync (every 30 seconds)
-	storageInstance.StartPeriodicSync(30*time.Second, clusterInstance.Broadcast, clusterInstance.GetLocalNodeName())
+	// Broadcast local writes as deltas every second, peers repair lost deltas
+	// in the periodic push-pull of memberlist
+	storageInstance.StartPeriodicSync(1*time.Second, clusterInstance.Broadcaster(cluster.MessageState), clusterInstance.GetLocalNodeName())
+	clusterInstance.SetStateHandlers(&cluster.StateHandlers{
+		Local: storageInstance.LocalState,
+		Merge: storageInstance.MergeRemoteState,
+	})
 
 	// Initialize ingress controller
 	var ingressController *ingress.IngressController
@@ -210,9 +349,12 @@ func main() {
 		clusterInstance,
 		dnsServer,
 		storageInstance,
+		controllerInstance,
 		apiTokenManager,
 		logger,
 	)
+	apiInstance.SetAuditLogger(auditLog)
+	apiInstance.SetJoinTokenManager(tokenManager)
 
 	// Setup API router
 	gin.SetMode(gin.ReleaseMode)
@@ -222,7 +364,7 @@ func main() {
 	// CORS
 	corsConfig := cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
 		AllowCredentials: true,
 	}
@@ -230,7 +372,7 @@ func main() {
 
 	// Setup routes
 	apiInstance.SetupRoutes(router, cfg.EnableAPIAuth)
-	
+
 	if cfg.EnableAPIAuth {
 		logger.Info("API authentication enabled")
 	} else {
@@ -241,9 +383,10 @@ func main() {
 	apiInstance.StartStateRecovery()
 
 	// Start API server
+	server := &http.Server{Addr: cfg.APIAddr, Handler: router}
 	go func() {
 		logger.Infof("Starting API server on %s", cfg.APIAddr)
-		if err := router.Run(cfg.APIAddr); err != nil {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Fatalf("Failed to start API server: %v", err)
 		}
 	}()
@@ -254,4 +397,109 @@ func main() {
 	<-sigChan
 
 	logger.Info("Shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	// Finish the running API requests, then stop scheduling to this node,
+	// deregister the endpoints of its pods and stop them gracefully
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warnf("Failed to shut down API server: %v", err)
+	}
+	controllerInstance.Shutdown(ctx, cfg.DrainOnShutdown)
+
+	// Send the last local writes before leaving the cluster
+	if err := storageInstance.Flush(clusterInstance.Broadcaster(cluster.MessageState), clusterInstance.GetLocalNodeName()); err != nil {
+		logger.Warnf("Failed to flush state: %v", err)
+	}
+	if err := dnsServer.Stop(); err != nil {
+		logger.Warnf("Failed to stop DNS server: %v", err)
+	}
+}
+
+// advertisedAPIAddress returns the address peers reach the API server at. An
+// unspecified host is replaced by the cluster address of the node.
+func advertisedAPIAddress(apiAddr, nodeAddr string) string {
+	host, port, err := net.SplitHostPort(apiAddr)
+	if err != nil {
+		return apiAddr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = nodeAddr
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// clusterKeys returns the gossip key and the secret join tokens are signed
+// with, nil on workers. The keys of the first node are generated, a joining
+// node is handed them by a manager in exchange for its join token. The keys
+// are kept in the data directory, so that a restarted node rejoins without a
+// token.
+func clusterKeys(cfg *config.Config, logger *logrus.Logger) ([]byte, []byte, error) {
+	keyFile := cfg.DataDir + "/encryption.key"
+	secretFile := cfg.DataDir + "/join.key"
+	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	var key []byte
+	if data, err := os.ReadFile(keyFile); err == nil && len(data) >= 32 {
+		key = data[:32]
+	}
+	secret, err := os.ReadFile(secretFile)
+	if err != nil {
+		secret = nil
+	}
+
+	switch {
+	case key == nil && len(cfg.JoinAddrs) > 0 && cfg.JoinToken != "":
+		admission, err := cluster.RequestAdmission(cfg.JoinAddrs, cfg.NodeName, cfg.JoinToken)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg.EncryptionKey != "" && !bytes.Equal(security.DeriveKey([]byte(cfg.EncryptionKey)), admission.ClusterKey) {
+			return nil, nil, fmt.Errorf("the configured encryption key differs from the key of the cluster")
+		}
+		logger.Infof("Admitted to the cluster as %s", admission.Role)
+
+		key, secret = admission.ClusterKey, admission.JoinSecret
+		if err := os.WriteFile(keyFile, key, 0600); err != nil {
+			return nil, nil, fmt.Errorf("failed to save encryption key: %w", err)
+		}
+		if err := security.WriteKeyring(cfg.DataDir+"/keyring.json", admission.Keys); err != nil {
+			return nil, nil, err
+		}
+		if secret != nil {
+			if err := os.WriteFile(secretFile, secret, 0600); err != nil {
+				return nil, nil, fmt.Errorf("failed to save join secret: %w", err)
+			}
+		}
+		if err := os.WriteFile(cfg.DataDir+"/node.key", admission.NodeSecret, 0600); err != nil {
+			return nil, nil, fmt.Errorf("failed to save node secret: %w", err)
+		}
+	case cfg.EncryptionKey != "":
+		key = []byte(cfg.EncryptionKey)
+	case key == nil && len(cfg.JoinAddrs) > 0:
+		return nil, nil, fmt.Errorf("a join token is required to join the cluster")
+	case key == nil:
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate encryption key: %w", err)
+		}
+		if err := os.WriteFile(keyFile, key, 0600); err != nil {
+			return nil, nil, fmt.Errorf("failed to save encryption key: %w", err)
+		}
+	}
+
+	// The first node signs join tokens
+	if secret == nil && len(cfg.JoinAddrs) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate join secret: %w", err)
+		}
+		if err := os.WriteFile(secretFile, secret, 0600); err != nil {
+			return nil, nil, fmt.Errorf("failed to save join secret: %w", err)
+		}
+	}
+
+	return key, secret, nil
 }
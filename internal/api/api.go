@@ -1,24 +1,30 @@
 package api
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 
+	"github.com/your-server-support/podman-swarm/internal/audit"
 	"github.com/your-server-support/podman-swarm/internal/cluster"
+	"github.com/your-server-support/podman-swarm/internal/controller"
 	"github.com/your-server-support/podman-swarm/internal/discovery"
 	"github.com/your-server-support/podman-swarm/internal/dns"
 	"github.com/your-server-support/podman-swarm/internal/ingress"
 	"github.com/your-server-support/podman-swarm/internal/parser"
 	"github.com/your-server-support/podman-swarm/internal/podman"
+	"github.com/your-server-support/podman-swarm/internal/rbac"
 	"github.com/your-server-support/podman-swarm/internal/scheduler"
 	"github.com/your-server-support/podman-swarm/internal/security"
 	"github.com/your-server-support/podman-swarm/internal/storage"
@@ -34,11 +40,14 @@ type API struct {
 	cluster      *cluster.Cluster
 	dns          *dns.Server
 	storage      *storage.Storage
+	controller   *controller.Controller
 	logger       *logrus.Logger
-	deployments  map[string]*types.Deployment // In-memory cache
-	services     map[string]*types.Service    // In-memory cache
-	ingresses    map[string]*types.Ingress    // In-memory cache
+	services     map[string]*types.Service // In-memory cache
+	ingresses    map[string]*types.Ingress // In-memory cache
 	tokenManager *security.APITokenManager
+	authorizer   *rbac.Authorizer
+	audit        *audit.Logger
+	joinTokens   *security.TokenManager // Issues join tokens, set on managers only
 }
 
 func NewAPI(
@@ -50,6 +59,7 @@ func NewAPI(
 	cluster *cluster.Cluster,
 	dns *dns.Server,
 	stor *storage.Storage,
+	controller *controller.Controller,
 	tokenManager *security.APITokenManager,
 	logger *logrus.Logger,
 ) *API {
@@ -62,9 +72,10 @@ func NewAPI(
 		cluster:      cluster,
 		dns:          dns,
 		storage:      stor,
+		controller:   controller,
 		tokenManager: tokenManager,
+		authorizer:   rbac.NewAuthorizer(stor),
 		logger:       logger,
-		deployments:  make(map[string]*types.Deployment),
 		services:     make(map[string]*types.Service),
 		ingresses:    make(map[string]*types.Ingress),
 	}
@@ -75,32 +86,96 @@ func NewAPI(
 	return api
 }
 
+// SetAuditLogger sets the audit log requests are written to
+func (a *API) SetAuditLogger(logger *audit.Logger) {
+	a.audit = logger
+}
+
+// SetJoinTokenManager sets the manager join tokens are issued by
+func (a *API) SetJoinTokenManager(tokenManager *security.TokenManager) {
+	a.joinTokens = tokenManager
+}
+
 func (a *API) SetupRoutes(router *gin.Engine, authEnabled bool) {
+	// Audit requests, including the ones rejected by authentication. Bodies
+	// are only read, and hashed, by the handlers behind authentication.
+	router.Use(a.auditRequests())
+
 	// Apply authentication middleware
 	router.Use(AuthMiddleware(a.tokenManager, authEnabled))
 
+	// Every route but health is authorized by verb, resource and namespace.
+	// Manifests are authorized per object by their handlers.
+	authz := a.authorize
 	v1 := router.Group("/api/v1")
 	{
 		v1.POST("/manifests", a.ApplyManifest)
 		v1.DELETE("/manifests/:namespace/:name", a.DeleteManifest)
-		v1.GET("/pods", a.ListPods)
-		v1.GET("/pods/:namespace/:name", a.GetPod)
-		v1.GET("/deployments", a.ListDeployments)
-		v1.GET("/deployments/:namespace/:name", a.GetDeployment)
-		v1.GET("/services", a.ListServices)
-		v1.GET("/services/:namespace/:name/endpoints", a.GetServiceEndpoints)
-		v1.GET("/services/:namespace/:name/addresses", a.GetServiceAddresses)
-		v1.GET("/nodes", a.ListNodes)
+		v1.GET("/pods", authz("list", "pods"), a.ListPods)
+		v1.GET("/pods/:namespace/:name", authz("get", "pods"), a.GetPod)
+		v1.GET("/deployments", authz("list", "deployments"), a.ListDeployments)
+		v1.GET("/deployments/:namespace/:name", authz("get", "deployments"), a.GetDeployment)
+		v1.GET("/deployments/:namespace/:name/rollout/status", authz("get", "deployments"), a.GetRolloutStatus)
+		v1.GET("/deployments/:namespace/:name/rollout/history", authz("get", "deployments"), a.GetRolloutHistory)
+		v1.POST("/deployments/:namespace/:name/rollout/pause", authz("update", "deployments"), a.PauseRollout)
+		v1.POST("/deployments/:namespace/:name/rollout/resume", authz("update", "deployments"), a.ResumeRollout)
+		v1.POST("/deployments/:namespace/:name/rollout/undo", authz("update", "deployments"), a.UndoRollout)
+		v1.GET("/statefulsets", authz("list", "statefulsets"), a.ListStatefulSets)
+		v1.GET("/statefulsets/:namespace/:name", authz("get", "statefulsets"), a.GetStatefulSet)
+		v1.GET("/daemonsets", authz("list", "daemonsets"), a.ListDaemonSets)
+		v1.GET("/daemonsets/:namespace/:name", authz("get", "daemonsets"), a.GetDaemonSet)
+		v1.GET("/jobs", authz("list", "jobs"), a.ListJobs)
+		v1.GET("/jobs/:namespace/:name", authz("get", "jobs"), a.GetJob)
+		v1.GET("/cronjobs", authz("list", "cronjobs"), a.ListCronJobs)
+		v1.GET("/cronjobs/:namespace/:name", authz("get", "cronjobs"), a.GetCronJob)
+		v1.GET("/services", authz("list", "services"), a.ListServices)
+		v1.GET("/services/:namespace/:name/endpoints", authz("get", "services"), a.GetServiceEndpoints)
+		v1.GET("/services/:namespace/:name/addresses", authz("get", "services"), a.GetServiceAddresses)
+		v1.GET("/configmaps", authz("list", "configmaps"), a.ListConfigMaps)
+		v1.GET("/configmaps/:namespace/:name", authz("get", "configmaps"), a.GetConfigMap)
+		v1.GET("/secrets", authz("list", "secrets"), a.ListSecrets)
+		v1.GET("/secrets/:namespace/:name", authz("get", "secrets"), a.GetSecret)
+		v1.GET("/persistentvolumeclaims", authz("list", "persistentvolumeclaims"), a.ListPersistentVolumeClaims)
+		v1.GET("/persistentvolumeclaims/:namespace/:name", authz("get", "persistentvolumeclaims"), a.GetPersistentVolumeClaim)
+		v1.GET("/nodes", authz("list", "nodes"), a.ListNodes)
+		v1.PATCH("/nodes/:name", authz("patch", "nodes"), a.PatchNode)
+		v1.DELETE("/nodes/:name", authz("delete", "nodes"), a.RemoveNode)
+		v1.POST("/nodes/:name/cordon", authz("patch", "nodes"), a.CordonNode)
+		v1.POST("/nodes/:name/uncordon", authz("patch", "nodes"), a.UncordonNode)
+		v1.POST("/nodes/:name/drain", authz("patch", "nodes"), a.DrainNode)
+		v1.GET("/poddisruptionbudgets", authz("list", "poddisruptionbudgets"), a.ListPodDisruptionBudgets)
+		v1.GET("/poddisruptionbudgets/:namespace/:name", authz("get", "poddisruptionbudgets"), a.GetPodDisruptionBudget)
+		v1.GET("/leases", authz("list", "leases"), a.ListLeases)
 		v1.GET("/health", a.Health)
+		// RBAC endpoints, roles and bindings are applied as manifests
+		v1.GET("/roles", authz("list", "roles"), a.ListRoles)
+		v1.GET("/rolebindings", authz("list", "rolebindings"), a.ListRoleBindings)
+		v1.GET("/serviceaccounts", authz("list", "serviceaccounts"), a.ListServiceAccounts)
+		v1.GET("/clusterroles", authz("list", "clusterroles"), a.ListClusterRoles)
+		v1.DELETE("/clusterroles/:name", authz("delete", "clusterroles"), a.DeleteClusterRole)
+		v1.GET("/clusterrolebindings", authz("list", "clusterrolebindings"), a.ListClusterRoleBindings)
+		v1.DELETE("/clusterrolebindings/:name", authz("delete", "clusterrolebindings"), a.DeleteClusterRoleBinding)
 		// DNS whitelist endpoints
-		v1.GET("/dns/whitelist", a.GetDNSWhitelist)
-		v1.PUT("/dns/whitelist", a.SetDNSWhitelist)
-		v1.POST("/dns/whitelist/hosts", a.AddDNSWhitelistHost)
-		v1.DELETE("/dns/whitelist/hosts/:host", a.RemoveDNSWhitelistHost)
+		v1.GET("/dns/whitelist", authz("get", "dnswhitelist"), a.GetDNSWhitelist)
+		v1.PUT("/dns/whitelist", authz("update", "dnswhitelist"), a.SetDNSWhitelist)
+		v1.POST("/dns/whitelist/hosts", authz("update", "dnswhitelist"), a.AddDNSWhitelistHost)
+		v1.DELETE("/dns/whitelist/hosts/:host", authz("update", "dnswhitelist"), a.RemoveDNSWhitelistHost)
 		// API Token management endpoints
-		v1.POST("/tokens", a.GenerateAPIToken)
-		v1.GET("/tokens", a.ListAPITokens)
-		v1.DELETE("/tokens/:token", a.RevokeAPIToken)
+		v1.POST("/tokens", authz("create", "tokens"), a.GenerateAPIToken)
+		v1.GET("/tokens", authz("list", "tokens"), a.ListAPITokens)
+		v1.DELETE("/tokens/:token", authz("delete", "tokens"), a.RevokeAPIToken)
+		// Join token endpoints, served by managers
+		v1.POST("/jointokens", authz("create", "jointokens"), a.GenerateJoinToken)
+		v1.GET("/jointokens", authz("list", "jointokens"), a.ListJoinTokens)
+		v1.DELETE("/jointokens/:token", authz("delete", "jointokens"), a.RevokeJoinToken)
+		// Gossip keyring endpoints
+		v1.GET("/keyring", authz("list", "keyring"), a.GetKeyring)
+		v1.POST("/keyring", authz("create", "keyring"), a.InstallKey)
+		v1.POST("/keyring/rotate", authz("update", "keyring"), a.RotateKey)
+		v1.POST("/keyring/:fingerprint/use", authz("update", "keyring"), a.UseKey)
+		v1.DELETE("/keyring/:fingerprint", authz("delete", "keyring"), a.RemoveKey)
+		// Audit log of this node
+		v1.GET("/audit", authz("list", "audit"), a.GetAuditLog)
 	}
 }
 
@@ -117,6 +192,13 @@ func (a *API) ApplyManifest(c *gin.Context) {
 		return
 	}
 
+	c.Set(objectKey, manifestObjects(objects))
+
+	// Nothing is applied unless the user may apply all objects
+	if !a.authorizeObjects(c, objects) {
+		return
+	}
+
 	for _, obj := range objects {
 		switch o := obj.(type) {
 		case *appsv1.Deployment:
@@ -125,6 +207,30 @@ func (a *API) ApplyManifest(c *gin.Context) {
 				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply deployment: %v", err)})
 				return
 			}
+		case *appsv1.StatefulSet:
+			if err := a.applyStatefulSet(o); err != nil {
+				a.logger.Errorf("Failed to apply stateful set: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply stateful set: %v", err)})
+				return
+			}
+		case *appsv1.DaemonSet:
+			if err := a.applyDaemonSet(o); err != nil {
+				a.logger.Errorf("Failed to apply daemon set: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply daemon set: %v", err)})
+				return
+			}
+		case *batchv1.Job:
+			if err := a.applyJob(o); err != nil {
+				a.logger.Errorf("Failed to apply job: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply job: %v", err)})
+				return
+			}
+		case *batchv1.CronJob:
+			if err := a.applyCronJob(o); err != nil {
+				a.logger.Errorf("Failed to apply cron job: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply cron job: %v", err)})
+				return
+			}
 		case *corev1.Service:
 			if err := a.applyService(o); err != nil {
 				a.logger.Errorf("Failed to apply service: %v", err)
@@ -137,6 +243,48 @@ func (a *API) ApplyManifest(c *gin.Context) {
 				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply ingress: %v", err)})
 				return
 			}
+		case *corev1.ConfigMap:
+			if err := a.applyConfigMap(o); err != nil {
+				a.logger.Errorf("Failed to apply config map: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply config map: %v", err)})
+				return
+			}
+		case *corev1.Secret:
+			if err := a.applySecret(o); err != nil {
+				a.logger.Errorf("Failed to apply secret: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply secret: %v", err)})
+				return
+			}
+		case *corev1.PersistentVolumeClaim:
+			if err := a.applyPersistentVolumeClaim(o); err != nil {
+				a.logger.Errorf("Failed to apply persistent volume claim: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply persistent volume claim: %v", err)})
+				return
+			}
+		case *policyv1.PodDisruptionBudget:
+			if err := a.applyPodDisruptionBudget(o); err != nil {
+				a.logger.Errorf("Failed to apply pod disruption budget: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply pod disruption budget: %v", err)})
+				return
+			}
+		case *corev1.ServiceAccount:
+			if err := a.applyServiceAccount(o); err != nil {
+				a.logger.Errorf("Failed to apply service account: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply service account: %v", err)})
+				return
+			}
+		case *rbacv1.Role, *rbacv1.ClusterRole:
+			if err := a.applyRole(o); err != nil {
+				a.logger.Errorf("Failed to apply role: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply role: %v", err)})
+				return
+			}
+		case *rbacv1.RoleBinding, *rbacv1.ClusterRoleBinding:
+			if err := a.applyRoleBinding(o); err != nil {
+				a.logger.Errorf("Failed to apply role binding: %v", err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply role binding: %v", err)})
+				return
+			}
 		}
 	}
 
@@ -150,50 +298,69 @@ func (a *API) applyDeployment(deployment *appsv1.Deployment) error {
 	}
 
 	key := fmt.Sprintf("%s/%s", dep.Namespace, dep.Name)
-	a.deployments[key] = dep
 
-	// Persist to storage
-	if err := a.storage.SaveDeployment(dep); err != nil {
-		a.logger.Warnf("Failed to persist deployment: %v", err)
-		// Continue anyway - in-memory state is updated
+	// The leader rolls it out in the reconciliation pass the controller requests
+	if err := a.controller.ApplyDeployment(dep); err != nil {
+		return err
 	}
 
-	// Create pods
-	for i := int32(0); i < dep.DesiredReplicas; i++ {
-		podName := fmt.Sprintf("%s-%d", dep.Name, i)
-		pod := a.parser.ExtractPodFromTemplate(dep.Template, dep.Namespace, podName)
+	a.logger.Infof("Applied deployment %s with %d replicas", key, dep.DesiredReplicas)
+	return nil
+}
 
-		// Generate pod ID
-		pod.ID = generateID()
-		pod.CreatedAt = time.Now().Unix()
+func (a *API) applyStatefulSet(statefulSet *appsv1.StatefulSet) error {
+	set, err := a.parser.ParseStatefulSet(statefulSet)
+	if err != nil {
+		return err
+	}
 
-		// Schedule pod
-		nodeName, err := a.scheduler.SchedulePod(pod)
-		if err != nil {
-			return fmt.Errorf("failed to schedule pod: %w", err)
-		}
+	if err := a.controller.ApplyStatefulSet(set); err != nil {
+		return err
+	}
 
-		// Only create pod on this node if it's scheduled here
-		if nodeName == a.cluster.GetLocalNodeName() {
-			containerID, err := a.podman.CreatePod(pod)
-			if err != nil {
-				return fmt.Errorf("failed to create pod: %w", err)
-			}
+	a.logger.Infof("Applied stateful set %s/%s with %d replicas", set.Namespace, set.Name, set.DesiredReplicas)
+	return nil
+}
 
-			pod.ID = containerID
-			if err := a.podman.StartPod(containerID); err != nil {
-				return fmt.Errorf("failed to start pod: %w", err)
-			}
+func (a *API) applyDaemonSet(daemonSet *appsv1.DaemonSet) error {
+	ds, err := a.parser.ParseDaemonSet(daemonSet)
+	if err != nil {
+		return err
+	}
 
-			// Update pod state
-			state, _ := a.podman.GetPodStatus(containerID)
-			a.scheduler.UpdatePodState(containerID, state)
-		}
+	if err := a.controller.ApplyDaemonSet(ds); err != nil {
+		return err
+	}
 
-		dep.Pods = append(dep.Pods, pod)
+	a.logger.Infof("Applied daemon set %s/%s on %d nodes", ds.Namespace, ds.Name, ds.DesiredReplicas)
+	return nil
+}
+
+func (a *API) applyJob(job *batchv1.Job) error {
+	j, err := a.parser.ParseJob(job)
+	if err != nil {
+		return err
 	}
 
-	a.logger.Infof("Applied deployment %s with %d replicas", key, dep.DesiredReplicas)
+	if err := a.controller.ApplyJob(j); err != nil {
+		return err
+	}
+
+	a.logger.Infof("Applied job %s/%s with %d completions", j.Namespace, j.Name, j.Completions)
+	return nil
+}
+
+func (a *API) applyCronJob(cronJob *batchv1.CronJob) error {
+	cj, err := a.parser.ParseCronJob(cronJob)
+	if err != nil {
+		return err
+	}
+
+	if err := a.controller.ApplyCronJob(cj); err != nil {
+		return err
+	}
+
+	a.logger.Infof("Applied cron job %s/%s with schedule %q", cj.Namespace, cj.Name, cj.Schedule)
 	return nil
 }
 
@@ -247,32 +414,136 @@ func (a *API) applyIngress(ingress *networkingv1.Ingress) error {
 	return nil
 }
 
+func (a *API) applyConfigMap(configMap *corev1.ConfigMap) error {
+	cm, err := a.parser.ParseConfigMap(configMap)
+	if err != nil {
+		return err
+	}
+	cm.CreatedAt = time.Now().Unix()
+
+	if err := a.storage.SaveConfigMap(cm); err != nil {
+		return err
+	}
+
+	a.logger.Infof("Applied config map %s/%s", cm.Namespace, cm.Name)
+	return nil
+}
+
+func (a *API) applySecret(secret *corev1.Secret) error {
+	sec, err := a.parser.ParseSecret(secret)
+	if err != nil {
+		return err
+	}
+	sec.CreatedAt = time.Now().Unix()
+
+	// Encrypted by storage before it is persisted or replicated
+	if err := a.storage.SaveSecret(sec); err != nil {
+		return err
+	}
+
+	a.logger.Infof("Applied secret %s/%s", sec.Namespace, sec.Name)
+	return nil
+}
+
+func (a *API) applyPersistentVolumeClaim(claim *corev1.PersistentVolumeClaim) error {
+	pvc, err := a.parser.ParsePersistentVolumeClaim(claim)
+	if err != nil {
+		return err
+	}
+	pvc.CreatedAt = time.Now().Unix()
+
+	// A bound claim keeps its volume and node
+	if existing, err := a.storage.GetPersistentVolumeClaim(pvc.Namespace, pvc.Name); err == nil {
+		pvc.Phase = existing.Phase
+		pvc.NodeName = existing.NodeName
+		pvc.VolumeName = existing.VolumeName
+		pvc.CreatedAt = existing.CreatedAt
+	}
+
+	if err := a.storage.SavePersistentVolumeClaim(pvc); err != nil {
+		return err
+	}
+
+	a.logger.Infof("Applied persistent volume claim %s/%s", pvc.Namespace, pvc.Name)
+	return nil
+}
+
+func (a *API) applyPodDisruptionBudget(budget *policyv1.PodDisruptionBudget) error {
+	pdb, err := a.parser.ParsePodDisruptionBudget(budget)
+	if err != nil {
+		return err
+	}
+	pdb.CreatedAt = time.Now().Unix()
+
+	if err := a.storage.SavePodDisruptionBudget(pdb); err != nil {
+		return err
+	}
+
+	a.logger.Infof("Applied pod disruption budget %s/%s", pdb.Namespace, pdb.Name)
+	return nil
+}
+
 func (a *API) DeleteManifest(c *gin.Context) {
 	namespace := c.Param("namespace")
 	name := c.Param("name")
 
 	key := fmt.Sprintf("%s/%s", namespace, name)
 
-	// Try to delete deployment
-	if dep, ok := a.deployments[key]; ok {
-		for _, pod := range dep.Pods {
-			if pod.NodeName == a.cluster.GetLocalNodeName() {
-				if err := a.podman.StopPod(pod.ID); err != nil {
-					a.logger.Warnf("Failed to stop pod %s: %v", pod.ID, err)
-				}
-				if err := a.podman.RemovePod(pod.ID); err != nil {
-					a.logger.Warnf("Failed to remove pod %s: %v", pod.ID, err)
-				}
-			}
-			a.scheduler.RemovePod(pod.ID)
+	// Nothing is deleted unless the user may delete all objects of the name
+	for _, resource := range a.manifestResources(namespace, name) {
+		if !a.allowed(c, &rbac.Request{Verb: "delete", Resource: resource, Namespace: namespace, Name: name}) {
+			return
 		}
-		delete(a.deployments, key)
+	}
+
+	// Try to delete deployment
+	if dep, err := a.storage.GetDeployment(namespace, name); err == nil {
+		a.removePods(dep.Pods)
 		// Delete from storage
 		if err := a.storage.DeleteDeployment(namespace, name); err != nil {
 			a.logger.Warnf("Failed to delete deployment from storage: %v", err)
 		}
 	}
 
+	// Try to delete stateful set, its volume claims are retained
+	if set, err := a.storage.GetStatefulSet(namespace, name); err == nil {
+		a.removePods(set.Pods)
+		if err := a.storage.DeleteStatefulSet(namespace, name); err != nil {
+			a.logger.Warnf("Failed to delete stateful set from storage: %v", err)
+		}
+	}
+
+	// Try to delete daemon set
+	if ds, err := a.storage.GetDaemonSet(namespace, name); err == nil {
+		a.removePods(ds.Pods)
+		if err := a.storage.DeleteDaemonSet(namespace, name); err != nil {
+			a.logger.Warnf("Failed to delete daemon set from storage: %v", err)
+		}
+	}
+
+	// Try to delete job
+	if job, err := a.storage.GetJob(namespace, name); err == nil {
+		a.removePods(job.Pods)
+		if err := a.storage.DeleteJob(namespace, name); err != nil {
+			a.logger.Warnf("Failed to delete job from storage: %v", err)
+		}
+	}
+
+	// Try to delete cron job together with its jobs
+	if _, err := a.storage.GetCronJob(namespace, name); err == nil {
+		for _, job := range a.storage.ListJobs() {
+			if job.Namespace == namespace && job.CronJob == name {
+				a.removePods(job.Pods)
+				if err := a.storage.DeleteJob(namespace, job.Name); err != nil {
+					a.logger.Warnf("Failed to delete job from storage: %v", err)
+				}
+			}
+		}
+		if err := a.storage.DeleteCronJob(namespace, name); err != nil {
+			a.logger.Warnf("Failed to delete cron job from storage: %v", err)
+		}
+	}
+
 	// Try to delete service
 	if svc, ok := a.services[key]; ok {
 		pods := a.scheduler.GetAllPods()
@@ -298,12 +569,74 @@ func (a *API) DeleteManifest(c *gin.Context) {
 		}
 	}
 
+	// Try to delete config map and secret
+	if _, err := a.storage.GetConfigMap(namespace, name); err == nil {
+		if err := a.storage.DeleteConfigMap(namespace, name); err != nil {
+			a.logger.Warnf("Failed to delete config map from storage: %v", err)
+		}
+	}
+	for _, secret := range a.storage.ListSecrets() {
+		if secret.Namespace == namespace && secret.Name == name {
+			if err := a.storage.DeleteSecret(namespace, name); err != nil {
+				a.logger.Warnf("Failed to delete secret from storage: %v", err)
+			}
+		}
+	}
+
+	// Try to delete persistent volume claim, its volume is retained on the node
+	if _, err := a.storage.GetPersistentVolumeClaim(namespace, name); err == nil {
+		if err := a.storage.DeletePersistentVolumeClaim(namespace, name); err != nil {
+			a.logger.Warnf("Failed to delete persistent volume claim from storage: %v", err)
+		}
+	}
+
+	// Try to delete pod disruption budget
+	if _, err := a.storage.GetPodDisruptionBudget(namespace, name); err == nil {
+		if err := a.storage.DeletePodDisruptionBudget(namespace, name); err != nil {
+			a.logger.Warnf("Failed to delete pod disruption budget from storage: %v", err)
+		}
+	}
+
+	// Try to delete service account together with its tokens, role and role binding
+	if _, err := a.storage.GetServiceAccount(namespace, name); err == nil {
+		if err := a.deleteServiceAccount(namespace, name); err != nil {
+			a.logger.Warnf("Failed to delete service account from storage: %v", err)
+		}
+	}
+	if _, err := a.storage.GetRole(namespace, name); err == nil {
+		if err := a.storage.DeleteRole(namespace, name); err != nil {
+			a.logger.Warnf("Failed to delete role from storage: %v", err)
+		}
+	}
+	if _, err := a.storage.GetRoleBinding(namespace, name); err == nil {
+		if err := a.storage.DeleteRoleBinding(namespace, name); err != nil {
+			a.logger.Warnf("Failed to delete role binding from storage: %v", err)
+		}
+	}
+
 	c.JSON(200, gin.H{"message": "Manifest deleted successfully"})
 }
 
+// removePods removes the local pods of a deleted workload right away.
+// Containers on other nodes are removed by their controllers once the
+// workload disappears from the cluster state.
+func (a *API) removePods(pods []*types.Pod) {
+	for _, pod := range pods {
+		if pod.NodeName == a.cluster.GetLocalNodeName() && pod.PodmanID != "" {
+			if err := a.podman.StopPod(pod.PodmanID); err != nil {
+				a.logger.Warnf("Failed to stop pod %s: %v", pod.Name, err)
+			}
+			if err := a.podman.RemovePod(pod.PodmanID); err != nil {
+				a.logger.Warnf("Failed to remove pod %s: %v", pod.Name, err)
+			}
+		}
+		a.scheduler.RemovePod(pod.ID)
+	}
+}
+
 func (a *API) ListPods(c *gin.Context) {
 	pods := a.scheduler.GetAllPods()
-	c.JSON(200, pods)
+	c.JSON(200, inNamespace(c, pods, func(p *types.Pod) string { return p.Namespace }))
 }
 
 func (a *API) GetPod(c *gin.Context) {
@@ -322,19 +655,14 @@ func (a *API) GetPod(c *gin.Context) {
 }
 
 func (a *API) ListDeployments(c *gin.Context) {
-	deployments := make([]*types.Deployment, 0, len(a.deployments))
-	for _, dep := range a.deployments {
-		deployments = append(deployments, dep)
-	}
-	c.JSON(200, deployments)
+	c.JSON(200, inNamespace(c, a.storage.ListDeployments(), func(d *types.Deployment) string { return d.Namespace }))
 }
 
 func (a *API) GetDeployment(c *gin.Context) {
 	namespace := c.Param("namespace")
 	name := c.Param("name")
 
-	key := fmt.Sprintf("%s/%s", namespace, name)
-	if dep, ok := a.deployments[key]; ok {
+	if dep, err := a.storage.GetDeployment(namespace, name); err == nil {
 		c.JSON(200, dep)
 		return
 	}
@@ -342,12 +670,218 @@ func (a *API) GetDeployment(c *gin.Context) {
 	c.JSON(404, gin.H{"error": "Deployment not found"})
 }
 
+func (a *API) ListStatefulSets(c *gin.Context) {
+	c.JSON(200, inNamespace(c, a.storage.ListStatefulSets(), func(s *types.StatefulSet) string { return s.Namespace }))
+}
+
+func (a *API) GetStatefulSet(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+
+	if set, err := a.storage.GetStatefulSet(namespace, name); err == nil {
+		c.JSON(200, set)
+		return
+	}
+
+	c.JSON(404, gin.H{"error": "Stateful set not found"})
+}
+
+func (a *API) ListDaemonSets(c *gin.Context) {
+	c.JSON(200, inNamespace(c, a.storage.ListDaemonSets(), func(ds *types.DaemonSet) string { return ds.Namespace }))
+}
+
+func (a *API) GetDaemonSet(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+
+	if ds, err := a.storage.GetDaemonSet(namespace, name); err == nil {
+		c.JSON(200, ds)
+		return
+	}
+
+	c.JSON(404, gin.H{"error": "Daemon set not found"})
+}
+
+func (a *API) ListJobs(c *gin.Context) {
+	c.JSON(200, inNamespace(c, a.storage.ListJobs(), func(j *types.Job) string { return j.Namespace }))
+}
+
+func (a *API) GetJob(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+
+	if job, err := a.storage.GetJob(namespace, name); err == nil {
+		c.JSON(200, job)
+		return
+	}
+
+	c.JSON(404, gin.H{"error": "Job not found"})
+}
+
+func (a *API) ListCronJobs(c *gin.Context) {
+	c.JSON(200, inNamespace(c, a.storage.ListCronJobs(), func(cj *types.CronJob) string { return cj.Namespace }))
+}
+
+func (a *API) GetCronJob(c *gin.Context) {
+	namespace := c.Param("namespace")
+	name := c.Param("name")
+
+	if cj, err := a.storage.GetCronJob(namespace, name); err == nil {
+		c.JSON(200, cj)
+		return
+	}
+
+	c.JSON(404, gin.H{"error": "Cron job not found"})
+}
+
+// Rollout endpoints
+
+// GetRolloutStatus returns the rollout progress of a deployment
+func (a *API) GetRolloutStatus(c *gin.Context) {
+	dep, err := a.storage.GetDeployment(c.Param("namespace"), c.Param("name"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Deployment not found"})
+		return
+	}
+
+	c.JSON(200, controller.GetRolloutStatus(dep))
+}
+
+// GetRolloutHistory returns the recorded revisions of a deployment
+func (a *API) GetRolloutHistory(c *gin.Context) {
+	dep, err := a.storage.GetDeployment(c.Param("namespace"), c.Param("name"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Deployment not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"revision":  dep.Revision,
+		"revisions": dep.Revisions,
+	})
+}
+
+// PauseRollout pauses the rollout of a deployment
+func (a *API) PauseRollout(c *gin.Context) {
+	namespace, name := c.Param("namespace"), c.Param("name")
+	if err := a.controller.PauseRollout(namespace, name); err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+
+	a.logger.Infof("Paused rollout of deployment %s/%s", namespace, name)
+	c.JSON(200, gin.H{"message": "Rollout paused"})
+}
+
+// ResumeRollout resumes a paused rollout
+func (a *API) ResumeRollout(c *gin.Context) {
+	namespace, name := c.Param("namespace"), c.Param("name")
+	if err := a.controller.ResumeRollout(namespace, name); err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+
+	a.logger.Infof("Resumed rollout of deployment %s/%s", namespace, name)
+	c.JSON(200, gin.H{"message": "Rollout resumed"})
+}
+
+// UndoRollout rolls a deployment back to a previous revision
+func (a *API) UndoRollout(c *gin.Context) {
+	var req struct {
+		Revision int64 `json:"revision"` // 0 means the previous revision
+	}
+
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+			return
+		}
+	}
+
+	namespace, name := c.Param("namespace"), c.Param("name")
+	if err := a.controller.UndoRollout(namespace, name, req.Revision); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	a.logger.Infof("Rolled back deployment %s/%s", namespace, name)
+	c.JSON(200, gin.H{"message": "Rollback started"})
+}
+
 func (a *API) ListServices(c *gin.Context) {
 	services := make([]*types.Service, 0, len(a.services))
 	for _, svc := range a.services {
 		services = append(services, svc)
 	}
-	c.JSON(200, services)
+	c.JSON(200, inNamespace(c, services, func(svc *types.Service) string { return svc.Namespace }))
+}
+
+func (a *API) ListConfigMaps(c *gin.Context) {
+	c.JSON(200, inNamespace(c, a.storage.ListConfigMaps(), func(cm *types.ConfigMap) string { return cm.Namespace }))
+}
+
+func (a *API) GetConfigMap(c *gin.Context) {
+	if cm, err := a.storage.GetConfigMap(c.Param("namespace"), c.Param("name")); err == nil {
+		c.JSON(200, cm)
+		return
+	}
+
+	c.JSON(404, gin.H{"error": "Config map not found"})
+}
+
+// ListSecrets lists all secrets without their data
+func (a *API) ListSecrets(c *gin.Context) {
+	c.JSON(200, inNamespace(c, a.storage.ListSecrets(), func(s *types.Secret) string { return s.Namespace }))
+}
+
+// GetSecret returns a secret with the names of its keys but not their values
+func (a *API) GetSecret(c *gin.Context) {
+	secret, err := a.storage.GetSecret(c.Param("namespace"), c.Param("name"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Secret not found"})
+		return
+	}
+
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	c.JSON(200, gin.H{
+		"name":      secret.Name,
+		"namespace": secret.Namespace,
+		"type":      secret.Type,
+		"labels":    secret.Labels,
+		"keys":      keys,
+	})
+}
+
+func (a *API) ListPersistentVolumeClaims(c *gin.Context) {
+	c.JSON(200, inNamespace(c, a.storage.ListPersistentVolumeClaims(), func(pvc *types.PersistentVolumeClaim) string { return pvc.Namespace }))
+}
+
+func (a *API) GetPersistentVolumeClaim(c *gin.Context) {
+	if claim, err := a.storage.GetPersistentVolumeClaim(c.Param("namespace"), c.Param("name")); err == nil {
+		c.JSON(200, claim)
+		return
+	}
+
+	c.JSON(404, gin.H{"error": "Persistent volume claim not found"})
+}
+
+func (a *API) ListPodDisruptionBudgets(c *gin.Context) {
+	c.JSON(200, inNamespace(c, a.storage.ListPodDisruptionBudgets(), func(pdb *types.PodDisruptionBudget) string { return pdb.Namespace }))
+}
+
+func (a *API) GetPodDisruptionBudget(c *gin.Context) {
+	if budget, err := a.storage.GetPodDisruptionBudget(c.Param("namespace"), c.Param("name")); err == nil {
+		c.JSON(200, budget)
+		return
+	}
+
+	c.JSON(404, gin.H{"error": "Pod disruption budget not found"})
 }
 
 func (a *API) ListNodes(c *gin.Context) {
@@ -355,6 +889,156 @@ func (a *API) ListNodes(c *gin.Context) {
 	c.JSON(200, nodes)
 }
 
+// PatchNode changes the labels and taints of a node. Labels set to null are
+// removed, taints replace all taints of the node.
+// Changes of other nodes are forwarded to them and gossiped from there.
+func (a *API) PatchNode(c *gin.Context) {
+	name := c.Param("name")
+	if _, err := a.cluster.GetNode(name); err != nil {
+		c.JSON(404, gin.H{"error": "Node not found"})
+		return
+	}
+
+	var patch cluster.NodePatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := patch.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := a.cluster.PatchNode(name, &patch); err != nil {
+		if errors.Is(err, cluster.ErrMetaTooLarge) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if name != a.cluster.GetLocalNodeName() {
+		c.JSON(202, gin.H{"message": "Node patch sent to " + name})
+		return
+	}
+	node, _ := a.cluster.GetNode(name)
+	c.JSON(200, node)
+}
+
+// RemoveNode removes a failed node that is gone for good, so that it no
+// longer counts towards the quorum. Alive nodes have to leave the cluster.
+func (a *API) RemoveNode(c *gin.Context) {
+	name := c.Param("name")
+	if _, err := a.cluster.GetNode(name); err == nil {
+		c.JSON(409, gin.H{"error": "Node is alive, stop its agent to remove it"})
+		return
+	}
+
+	if err := a.cluster.RemoveNode(name); err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+
+	a.logger.Infof("Removed failed node %s", name)
+	c.JSON(200, a.cluster.GetQuorumStatus())
+}
+
+// CordonNode stops scheduling new pods to a node, its pods keep running
+func (a *API) CordonNode(c *gin.Context) {
+	a.setUnschedulable(c, true)
+}
+
+// UncordonNode lets new pods be scheduled to a node again
+func (a *API) UncordonNode(c *gin.Context) {
+	a.setUnschedulable(c, false)
+}
+
+func (a *API) setUnschedulable(c *gin.Context, unschedulable bool) {
+	name := c.Param("name")
+	if _, err := a.cluster.GetNode(name); err != nil {
+		c.JSON(404, gin.H{"error": "Node not found"})
+		return
+	}
+
+	if err := a.cluster.PatchNode(name, &cluster.NodePatch{Unschedulable: &unschedulable}); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if !a.waitForUnschedulable(name, unschedulable) {
+		c.JSON(504, gin.H{"error": "Timed out waiting for the node to apply the change"})
+		return
+	}
+
+	node, _ := a.cluster.GetNode(name)
+	c.JSON(200, node)
+}
+
+// DrainNode cordons a node and evicts the pods of deployments and stateful
+// sets from it, their replacements are scheduled to other nodes. Responds
+// with 429 while pod disruption budgets keep pods on the node; draining
+// again continues once the replacements are available.
+func (a *API) DrainNode(c *gin.Context) {
+	name := c.Param("name")
+	if _, err := a.cluster.GetNode(name); err != nil {
+		c.JSON(404, gin.H{"error": "Node not found"})
+		return
+	}
+
+	unschedulable := true
+	if err := a.cluster.PatchNode(name, &cluster.NodePatch{Unschedulable: &unschedulable}); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	// Replacements must not be scheduled back to the node
+	if !a.waitForUnschedulable(name, true) {
+		c.JSON(504, gin.H{"error": "Timed out waiting for the node to be cordoned"})
+		return
+	}
+
+	result := a.controller.DrainNode(name)
+	if len(result.Blocked) > 0 {
+		c.JSON(429, gin.H{
+			"error":   "Pod disruption budgets keep pods on the node, retry once the replacements are available",
+			"evicted": result.Evicted,
+			"blocked": result.Blocked,
+		})
+		return
+	}
+
+	a.logger.Infof("Drained node %s, evicted %d pods", name, len(result.Evicted))
+	c.JSON(200, result)
+}
+
+// waitForUnschedulable waits until the local view of a node shows it
+// (un)cordoned. Changes of other nodes arrive through gossip.
+func (a *API) waitForUnschedulable(name string, unschedulable bool) bool {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if node, err := a.cluster.GetNode(name); err == nil && isUnschedulable(node) == unschedulable {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func isUnschedulable(node *types.Node) bool {
+	for _, taint := range node.Taints {
+		if taint.Key == cluster.TaintUnschedulable {
+			return true
+		}
+	}
+	return false
+}
+
+// ListLeases returns the holders of the leases of singleton work
+func (a *API) ListLeases(c *gin.Context) {
+	c.JSON(200, a.cluster.GetLeases())
+}
+
 func (a *API) GetServiceEndpoints(c *gin.Context) {
 	namespace := c.Param("namespace")
 	name := c.Param("name")
@@ -385,10 +1069,18 @@ func (a *API) GetServiceAddresses(c *gin.Context) {
 	})
 }
 
+// Health reports the node as degraded while it is on the minority side of a partition
 func (a *API) Health(c *gin.Context) {
+	quorum := a.cluster.GetQuorumStatus()
+	status := "healthy"
+	if !quorum.HasQuorum {
+		status = "degraded"
+	}
+
 	c.JSON(200, gin.H{
-		"status": "healthy",
+		"status": status,
 		"nodes":  a.cluster.GetNodeCount(),
+		"quorum": quorum,
 	})
 }
 
@@ -512,8 +1204,11 @@ func (a *API) RemoveDNSWhitelistHost(c *gin.Context) {
 // GenerateAPIToken generates a new API token
 func (a *API) GenerateAPIToken(c *gin.Context) {
 	var req struct {
-		Name      string `json:"name"`
-		ExpiresIn int    `json:"expires_in"` // Seconds, 0 means no expiration
+		Name           string   `json:"name"`
+		ExpiresIn      int      `json:"expires_in"`      // Seconds, 0 means no expiration
+		User           string   `json:"user"`            // User the token authenticates as, the caller unless it may impersonate
+		Groups         []string `json:"groups"`          // Groups the token authenticates as, those of the caller unless it may impersonate
+		ServiceAccount string   `json:"service_account"` // namespace/name, instead of user and groups
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -525,6 +1220,7 @@ func (a *API) GenerateAPIToken(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "Token name is required"})
 		return
 	}
+	c.Set(objectKey, req.Name)
 
 	var expiresAt *time.Time
 	if req.ExpiresIn > 0 {
@@ -532,7 +1228,12 @@ func (a *API) GenerateAPIToken(c *gin.Context) {
 		expiresAt = &expiry
 	}
 
-	token, err := a.tokenManager.GenerateToken(req.Name, expiresAt)
+	user, groups, ok := a.tokenSubject(c, req.User, req.Groups, req.ServiceAccount)
+	if !ok {
+		return
+	}
+
+	token, err := a.tokenManager.GenerateUserToken(req.Name, user, groups, expiresAt)
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate token: %v", err)})
 		return
@@ -544,6 +1245,8 @@ func (a *API) GenerateAPIToken(c *gin.Context) {
 		"message":    "Token generated successfully",
 		"token":      token,
 		"name":       req.Name,
+		"user":       user,
+		"groups":     groups,
 		"expires_at": expiresAt,
 	})
 }
@@ -570,20 +1273,92 @@ func (a *API) RevokeAPIToken(c *gin.Context) {
 		return
 	}
 
-	a.logger.Infof("Revoked API token: %s", token)
+	a.logger.Infof("Revoked API token %s", redact(token))
 	c.JSON(200, gin.H{
 		"message": "Token revoked successfully",
 	})
 }
 
+// GenerateJoinToken generates a join token for a worker or a manager
+func (a *API) GenerateJoinToken(c *gin.Context) {
+	if a.joinTokens == nil {
+		c.JSON(404, gin.H{"error": "Join tokens are issued by managers only"})
+		return
+	}
+
+	var req struct {
+		Role      string `json:"role"`       // worker or manager
+		ExpiresIn int    `json:"expires_in"` // Seconds, defaults to 24 hours
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if req.Role == "" {
+		req.Role = security.JoinRoleWorker
+	}
+	c.Set(objectKey, req.Role)
+
+	ttl := security.DefaultJoinTokenTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	token, err := a.joinTokens.GenerateJoinToken(req.Role, ttl)
+	if err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Failed to generate join token: %v", err)})
+		return
+	}
+
+	a.logger.Infof("Generated new %s join token (expires in %v)", req.Role, ttl)
+	c.JSON(201, gin.H{
+		"message":    "Join token generated successfully",
+		"token":      token,
+		"role":       req.Role,
+		"expires_at": time.Now().Add(ttl),
+	})
+}
+
+// ListJoinTokens lists the unexpired join tokens issued by this node
+func (a *API) ListJoinTokens(c *gin.Context) {
+	if a.joinTokens == nil {
+		c.JSON(404, gin.H{"error": "Join tokens are issued by managers only"})
+		return
+	}
+
+	tokens := a.joinTokens.ListTokens()
+	c.JSON(200, gin.H{
+		"tokens": tokens,
+		"count":  len(tokens),
+	})
+}
+
+// RevokeJoinToken revokes a join token on every manager
+func (a *API) RevokeJoinToken(c *gin.Context) {
+	if a.joinTokens == nil {
+		c.JSON(404, gin.H{"error": "Join tokens are issued by managers only"})
+		return
+	}
+
+	if !a.joinTokens.ValidateToken(c.Param("token")) {
+		c.JSON(404, gin.H{"error": "Join token not found or expired"})
+		return
+	}
+	if err := a.joinTokens.RevokeToken(c.Param("token")); err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to revoke join token: %v", err)})
+		return
+	}
+
+	a.logger.Infof("Revoked join token")
+	c.JSON(200, gin.H{
+		"message": "Join token revoked successfully",
+	})
+}
+
 // loadStateFromStorage loads state from persistent storage into memory cache
 func (a *API) loadStateFromStorage() {
-	// Load deployments
+	// Deployments are served from storage directly
 	deployments := a.storage.ListDeployments()
-	for _, dep := range deployments {
-		key := fmt.Sprintf("%s/%s", dep.Namespace, dep.Name)
-		a.deployments[key] = dep
-	}
 
 	// Load services
 	services := a.storage.ListServices()
@@ -609,12 +1384,6 @@ func (a *API) loadStateFromStorage() {
 
 // Helper functions
 
-func generateID() string {
-	b := make([]byte, 8)
-	rand.Read(b)
-	return hex.EncodeToString(b)
-}
-
 func matchesSelector(labels, selector map[string]string) bool {
 	for key, value := range selector {
 		if labels[key] != value {
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/your-server-support/podman-swarm/internal/audit"
+)
+
+// objectKey is the context key of the objects a request acts on, if they
+// are not named by the path
+const objectKey = "audit-object"
+
+// secretParams are the path parameters holding secrets, which are audited by
+// their hash only
+var secretParams = []string{"token"}
+
+// auditRequests returns a handler writing an audit event for every request
+// but health checks once it has been handled
+func (a *API) auditRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a.audit == nil || c.FullPath() == "/api/v1/health" {
+			c.Next()
+			return
+		}
+
+		// The body is hashed while the handler reads it, so that requests
+		// rejected before, e.g. by authentication, are not read at all
+		var body *hashingBody
+		if c.Request.Body != nil {
+			body = &hashingBody{ReadCloser: c.Request.Body, hash: sha256.New()}
+			c.Request.Body = body
+		}
+
+		c.Next()
+
+		var requestHash string
+		if body != nil && body.read > 0 {
+			requestHash = hex.EncodeToString(body.hash.Sum(nil))
+		}
+
+		event := &audit.Event{
+			Type:        audit.TypeAPI,
+			Token:       c.GetString(tokenNameKey),
+			SourceIP:    c.ClientIP(),
+			Verb:        c.Request.Method,
+			Path:        requestPath(c),
+			Object:      requestObject(c),
+			Code:        c.Writer.Status(),
+			RequestHash: requestHash,
+		}
+		if user := requestUser(c); user != nil {
+			event.User = user.Name
+			event.Groups = user.Groups
+		}
+		if err := c.Errors.Last(); err != nil {
+			event.Error = err.Error()
+		}
+		a.audit.Log(event)
+	}
+}
+
+// hashingBody hashes a request body as it is read
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	read int64
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	b.read += int64(n)
+	return n, err
+}
+
+// requestPath returns the path of a request with its secrets redacted
+func requestPath(c *gin.Context) string {
+	path := c.Request.URL.Path
+	for _, name := range secretParams {
+		if value := c.Param(name); value != "" {
+			path = strings.ReplaceAll(path, value, redact(value))
+		}
+	}
+	return path
+}
+
+// requestObject returns the objects set by the handler, otherwise the one
+// named by the path parameters
+func requestObject(c *gin.Context) string {
+	if object := c.GetString(objectKey); object != "" {
+		return object
+	}
+
+	values := make([]string, 0, len(c.Params))
+	for _, param := range c.Params {
+		if slices.Contains(secretParams, param.Key) {
+			values = append(values, redact(param.Value))
+			continue
+		}
+		values = append(values, param.Value)
+	}
+	return strings.Join(values, "/")
+}
+
+// redact replaces a secret by a prefix of its hash, which still relates the
+// events about the same secret
+func redact(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// manifestObjects describes the objects of a manifest as Kind namespace/name
+func manifestObjects(objects []runtime.Object) string {
+	described := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			continue
+		}
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		described = append(described, fmt.Sprintf("%s %s/%s", kind, accessor.GetNamespace(), accessor.GetName()))
+	}
+	return strings.Join(described, ", ")
+}
+
+// GetAuditLog returns the audit events of this node, oldest first. Events are
+// selected by the since and until (RFC 3339), type, user, verb and code query
+// parameters, limit returns the most recent ones (100 by default).
+func (a *API) GetAuditLog(c *gin.Context) {
+	if a.audit == nil {
+		c.JSON(404, gin.H{"error": "Audit log is disabled"})
+		return
+	}
+
+	query := &audit.Query{
+		Type:  c.Query("type"),
+		User:  c.Query("user"),
+		Verb:  c.Query("verb"),
+		Limit: 100,
+	}
+	for param, t := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid %s: %v", param, err)})
+				return
+			}
+			*t = parsed
+		}
+	}
+	for param, n := range map[string]*int{"code": &query.Code, "limit": &query.Limit} {
+		if value := c.Query(param); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid %s: %s", param, value)})
+				return
+			}
+			*n = parsed
+		}
+	}
+
+	events, err := a.audit.Query(query)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to query audit log: %v", err)})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/your-server-support/podman-swarm/internal/audit"
+)
+
+func TestAuditRedactsTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger, err := audit.NewLogger(path, 1<<20, 1, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+
+	a := &API{audit: logger}
+	router := gin.New()
+	router.Use(a.auditRequests())
+	router.DELETE("/api/v1/tokens/:token", func(c *gin.Context) { c.Status(200) })
+	router.DELETE("/api/v1/jointokens/:token", func(c *gin.Context) { c.Status(200) })
+
+	secrets := []string{"c2VjcmV0LWFwaS10b2tlbg==", "eyJpZCI6ImpvaW4ifQ-signature"}
+	for _, target := range []string{"/api/v1/tokens/" + secrets[0], "/api/v1/jointokens/" + secrets[1]} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, target, nil))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	for _, secret := range secrets {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Expected token %s not to appear in the audit log:\n%s", secret, data)
+		}
+	}
+
+	events, err := logger.Query(&audit.Query{})
+	if err != nil {
+		t.Fatalf("Failed to query audit log: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if expected := "/api/v1/tokens/" + redact(secrets[0]); events[0].Path != expected || events[0].Object != redact(secrets[0]) {
+		t.Errorf("Expected the token to be audited by its hash, got path %s and object %s", events[0].Path, events[0].Object)
+	}
+}
+
+func TestAuditHashesBodyReadByHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	logger, err := audit.NewLogger(filepath.Join(t.TempDir(), "audit.log"), 1<<20, 1, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+
+	a := &API{audit: logger}
+	router := gin.New()
+	router.Use(a.auditRequests())
+	router.Use(func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.AbortWithStatus(401)
+		}
+	})
+	router.POST("/api/v1/manifests", func(c *gin.Context) {
+		io.Copy(io.Discard, c.Request.Body)
+		c.Status(201)
+	})
+
+	// Authentication rejects the request before its body is read
+	unread := &countingReader{Reader: strings.NewReader("rejected")}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/manifests", unread))
+	if unread.read > 0 {
+		t.Errorf("Expected the body of an unauthenticated request not to be read, read %d bytes", unread.read)
+	}
+
+	body := "kind: ConfigMap"
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/manifests", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	events, err := logger.Query(&audit.Query{})
+	if err != nil {
+		t.Fatalf("Failed to query audit log: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Code != 401 || events[0].RequestHash != "" {
+		t.Errorf("Expected the rejected request without a hash, got code %d and hash %q", events[0].Code, events[0].RequestHash)
+	}
+	sum := sha256.Sum256([]byte(body))
+	if expected := hex.EncodeToString(sum[:]); events[1].RequestHash != expected {
+		t.Errorf("Expected request hash %s, got %q", expected, events[1].RequestHash)
+	}
+}
+
+// countingReader counts the bytes read from it
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += n
+	return n, err
+}
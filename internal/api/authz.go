@@ -0,0 +1,393 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/your-server-support/podman-swarm/internal/parser"
+	"github.com/your-server-support/podman-swarm/internal/rbac"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// Context keys of the user an authenticated request is made by and the name
+// of the token it authenticated with
+const (
+	userKey      = "user"
+	tokenNameKey = "token-name"
+)
+
+// requestUser returns the user of a request, nil if authentication is disabled
+func requestUser(c *gin.Context) *rbac.User {
+	if user, ok := c.Get(userKey); ok {
+		return user.(*rbac.User)
+	}
+	return nil
+}
+
+// authorize returns a handler letting a request through only if its user may
+// perform verb on resource. The namespace is taken from the path, for lists
+// from the namespace query parameter.
+func (a *API) authorize(verb, resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		namespace := c.Param("namespace")
+		if namespace == "" {
+			namespace = c.Query("namespace")
+		}
+
+		if !a.allowed(c, &rbac.Request{Verb: verb, Resource: resource, Namespace: namespace, Name: c.Param("name")}) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// allowed checks a request against the roles bound to its user and responds
+// with 403 if it is denied. Tokens of deleted service accounts are rejected.
+func (a *API) allowed(c *gin.Context, req *rbac.Request) bool {
+	user := requestUser(c)
+	if user == nil {
+		return true
+	}
+
+	if namespace, name, ok := rbac.ParseServiceAccountUser(user.Name); ok {
+		if _, err := a.storage.GetServiceAccount(namespace, name); err != nil {
+			c.JSON(401, gin.H{"error": fmt.Sprintf("Service account %s/%s not found", namespace, name)})
+			return false
+		}
+	}
+
+	if !a.authorizer.Authorize(user, req) {
+		c.JSON(403, gin.H{"error": fmt.Sprintf("User %s may not %s", user.Name, req)})
+		return false
+	}
+	return true
+}
+
+// inNamespace returns the objects in the namespace given by the namespace
+// query parameter, all objects without it
+func inNamespace[T any](c *gin.Context, objects []*T, namespace func(*T) string) []*T {
+	wanted := c.Query("namespace")
+	if wanted == "" {
+		return objects
+	}
+
+	filtered := make([]*T, 0, len(objects))
+	for _, object := range objects {
+		if namespace(object) == wanted {
+			filtered = append(filtered, object)
+		}
+	}
+	return filtered
+}
+
+// resourceOf returns the resource an applied object is authorized as, empty
+// for kinds that cannot be applied
+func resourceOf(obj runtime.Object) string {
+	switch obj.(type) {
+	case *appsv1.Deployment:
+		return "deployments"
+	case *appsv1.StatefulSet:
+		return "statefulsets"
+	case *appsv1.DaemonSet:
+		return "daemonsets"
+	case *batchv1.Job:
+		return "jobs"
+	case *batchv1.CronJob:
+		return "cronjobs"
+	case *corev1.Service:
+		return "services"
+	case *networkingv1.Ingress:
+		return "ingresses"
+	case *corev1.ConfigMap:
+		return "configmaps"
+	case *corev1.Secret:
+		return "secrets"
+	case *corev1.PersistentVolumeClaim:
+		return "persistentvolumeclaims"
+	case *policyv1.PodDisruptionBudget:
+		return "poddisruptionbudgets"
+	case *corev1.ServiceAccount:
+		return "serviceaccounts"
+	case *rbacv1.Role:
+		return "roles"
+	case *rbacv1.ClusterRole:
+		return "clusterroles"
+	case *rbacv1.RoleBinding:
+		return "rolebindings"
+	case *rbacv1.ClusterRoleBinding:
+		return "clusterrolebindings"
+	}
+	return ""
+}
+
+// authorizeObjects checks that the user may apply all objects of a manifest.
+// Applying creates or replaces objects, so both verbs are needed.
+func (a *API) authorizeObjects(c *gin.Context, objects []runtime.Object) bool {
+	for _, obj := range objects {
+		resource := resourceOf(obj)
+		accessor, err := meta.Accessor(obj)
+		if resource == "" || err != nil {
+			continue
+		}
+
+		// Namespaced RBAC objects are stored in the default namespace
+		// when applied without one, so they are authorized there
+		namespace := accessor.GetNamespace()
+		switch obj.(type) {
+		case *rbacv1.Role, *rbacv1.RoleBinding, *corev1.ServiceAccount:
+			namespace = parser.NamespaceOrDefault(namespace)
+		}
+
+		for _, verb := range []string{"create", "update"} {
+			req := &rbac.Request{Verb: verb, Resource: resource, Namespace: namespace, Name: accessor.GetName()}
+			if !a.allowed(c, req) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// manifestResources returns the resources of the objects a manifest
+// deletion removes
+func (a *API) manifestResources(namespace, name string) []string {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	var resources []string
+	add := func(resource string, err error) {
+		if err == nil {
+			resources = append(resources, resource)
+		}
+	}
+
+	_, err := a.storage.GetDeployment(namespace, name)
+	add("deployments", err)
+	_, err = a.storage.GetStatefulSet(namespace, name)
+	add("statefulsets", err)
+	_, err = a.storage.GetDaemonSet(namespace, name)
+	add("daemonsets", err)
+	_, err = a.storage.GetJob(namespace, name)
+	add("jobs", err)
+	_, err = a.storage.GetCronJob(namespace, name)
+	add("cronjobs", err)
+	if _, ok := a.services[key]; ok {
+		resources = append(resources, "services")
+	}
+	if _, ok := a.ingresses[key]; ok {
+		resources = append(resources, "ingresses")
+	}
+	_, err = a.storage.GetConfigMap(namespace, name)
+	add("configmaps", err)
+	for _, secret := range a.storage.ListSecrets() {
+		if secret.Namespace == namespace && secret.Name == name {
+			resources = append(resources, "secrets")
+		}
+	}
+	_, err = a.storage.GetPersistentVolumeClaim(namespace, name)
+	add("persistentvolumeclaims", err)
+	_, err = a.storage.GetPodDisruptionBudget(namespace, name)
+	add("poddisruptionbudgets", err)
+	_, err = a.storage.GetServiceAccount(namespace, name)
+	add("serviceaccounts", err)
+	_, err = a.storage.GetRole(namespace, name)
+	add("roles", err)
+	_, err = a.storage.GetRoleBinding(namespace, name)
+	add("rolebindings", err)
+
+	return resources
+}
+
+func (a *API) applyRole(obj runtime.Object) error {
+	role, err := a.parser.ParseRole(obj)
+	if err != nil {
+		return err
+	}
+	role.CreatedAt = time.Now().Unix()
+
+	if err := a.storage.SaveRole(role); err != nil {
+		return err
+	}
+
+	a.logger.Infof("Applied role %s/%s with %d rules", role.Namespace, role.Name, len(role.Rules))
+	return nil
+}
+
+func (a *API) applyRoleBinding(obj runtime.Object) error {
+	binding, err := a.parser.ParseRoleBinding(obj)
+	if err != nil {
+		return err
+	}
+	binding.CreatedAt = time.Now().Unix()
+
+	if err := a.storage.SaveRoleBinding(binding); err != nil {
+		return err
+	}
+
+	a.logger.Infof("Applied role binding %s/%s of %s %s", binding.Namespace, binding.Name, binding.RoleRef.Kind, binding.RoleRef.Name)
+	return nil
+}
+
+func (a *API) applyServiceAccount(account *corev1.ServiceAccount) error {
+	sa, err := a.parser.ParseServiceAccount(account)
+	if err != nil {
+		return err
+	}
+	sa.CreatedAt = time.Now().Unix()
+
+	if err := a.storage.SaveServiceAccount(sa); err != nil {
+		return err
+	}
+
+	a.logger.Infof("Applied service account %s/%s", sa.Namespace, sa.Name)
+	return nil
+}
+
+// deleteServiceAccount deletes a service account and revokes its tokens
+func (a *API) deleteServiceAccount(namespace, name string) error {
+	if err := a.storage.DeleteServiceAccount(namespace, name); err != nil {
+		return err
+	}
+
+	user, _ := rbac.ServiceAccountUser(namespace, name)
+	for _, token := range a.tokenManager.ListTokens() {
+		if token.User == user {
+			if err := a.tokenManager.RevokeToken(token.Hash); err != nil {
+				a.logger.Warnf("Failed to revoke token %s of service account %s/%s: %v", token.Name, namespace, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *API) ListRoles(c *gin.Context) {
+	namespace := func(r *types.Role) string { return r.Namespace }
+	c.JSON(200, inNamespace(c, namespaced(a.storage.ListRoles(), namespace), namespace))
+}
+
+func (a *API) ListClusterRoles(c *gin.Context) {
+	c.JSON(200, clusterScoped(a.storage.ListRoles(), func(r *types.Role) string { return r.Namespace }))
+}
+
+func (a *API) ListRoleBindings(c *gin.Context) {
+	namespace := func(b *types.RoleBinding) string { return b.Namespace }
+	c.JSON(200, inNamespace(c, namespaced(a.storage.ListRoleBindings(), namespace), namespace))
+}
+
+func (a *API) ListClusterRoleBindings(c *gin.Context) {
+	c.JSON(200, clusterScoped(a.storage.ListRoleBindings(), func(b *types.RoleBinding) string { return b.Namespace }))
+}
+
+func (a *API) ListServiceAccounts(c *gin.Context) {
+	c.JSON(200, inNamespace(c, a.storage.ListServiceAccounts(), func(sa *types.ServiceAccount) string { return sa.Namespace }))
+}
+
+// DeleteClusterRole deletes a cluster role, the default cluster roles apply again
+func (a *API) DeleteClusterRole(c *gin.Context) {
+	name := c.Param("name")
+	if _, err := a.storage.GetRole("", name); err != nil {
+		c.JSON(404, gin.H{"error": "Cluster role not found"})
+		return
+	}
+	if err := a.storage.DeleteRole("", name); err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to delete cluster role: %v", err)})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Cluster role deleted successfully"})
+}
+
+func (a *API) DeleteClusterRoleBinding(c *gin.Context) {
+	name := c.Param("name")
+	if _, err := a.storage.GetRoleBinding("", name); err != nil {
+		c.JSON(404, gin.H{"error": "Cluster role binding not found"})
+		return
+	}
+	if err := a.storage.DeleteRoleBinding("", name); err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to delete cluster role binding: %v", err)})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Cluster role binding deleted successfully"})
+}
+
+// namespaced returns the objects that live in a namespace
+func namespaced[T any](objects []*T, namespace func(*T) string) []*T {
+	filtered := make([]*T, 0, len(objects))
+	for _, object := range objects {
+		if namespace(object) != "" {
+			filtered = append(filtered, object)
+		}
+	}
+	return filtered
+}
+
+// clusterScoped returns the objects without a namespace
+func clusterScoped[T any](objects []*T, namespace func(*T) string) []*T {
+	filtered := make([]*T, 0, len(objects))
+	for _, object := range objects {
+		if namespace(object) == "" {
+			filtered = append(filtered, object)
+		}
+	}
+	return filtered
+}
+
+// tokenSubject returns the user and groups a new token is bound to, and
+// responds with an error if the caller may not mint tokens for them. Callers
+// mint tokens for their own user, or for an existing service account given as
+// namespace/name. Other users and groups, system:masters included, need the
+// impersonate verb on them.
+func (a *API) tokenSubject(c *gin.Context, user string, groups []string, serviceAccount string) (string, []string, bool) {
+	if serviceAccount != "" {
+		if user != "" || len(groups) > 0 {
+			c.JSON(400, gin.H{"error": "A token is bound either to a service account or to a user and groups"})
+			return "", nil, false
+		}
+
+		namespace, name, ok := strings.Cut(serviceAccount, "/")
+		if !ok {
+			c.JSON(400, gin.H{"error": "Service account has to be given as namespace/name"})
+			return "", nil, false
+		}
+		if _, err := a.storage.GetServiceAccount(namespace, name); err != nil {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Service account %s not found", serviceAccount)})
+			return "", nil, false
+		}
+		// Tokens of a service account act in its namespace
+		if !a.allowed(c, &rbac.Request{Verb: "create", Resource: "tokens", Namespace: namespace, Name: name}) {
+			return "", nil, false
+		}
+
+		user, groups = rbac.ServiceAccountUser(namespace, name)
+		return user, groups, true
+	}
+
+	if user == "" {
+		c.JSON(400, gin.H{"error": "A token has to be bound to a user or a service account"})
+		return "", nil, false
+	}
+
+	caller := requestUser(c)
+	if caller == nil {
+		return user, groups, true
+	}
+	if user != caller.Name && !a.allowed(c, &rbac.Request{Verb: "impersonate", Resource: "users", Name: user}) {
+		return "", nil, false
+	}
+	for _, group := range groups {
+		if !slices.Contains(caller.Groups, group) && !a.allowed(c, &rbac.Request{Verb: "impersonate", Resource: "groups", Name: group}) {
+			return "", nil, false
+		}
+	}
+	return user, groups, true
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/rbac"
+	"github.com/your-server-support/podman-swarm/internal/storage"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestTokenSubject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	stor, err := storage.NewStorage(storage.StorageConfig{DataDir: t.TempDir(), Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if err := stor.SaveServiceAccount(&types.ServiceAccount{Name: "builder", Namespace: "default"}); err != nil {
+		t.Fatalf("Failed to save service account: %v", err)
+	}
+	if err := stor.SaveRole(&types.Role{
+		Name:      "token-creator",
+		Namespace: "default",
+		Rules:     []rbacv1.PolicyRule{{Verbs: []string{"create"}, Resources: []string{"tokens"}}},
+	}); err != nil {
+		t.Fatalf("Failed to save role: %v", err)
+	}
+	if err := stor.SaveRoleBinding(&types.RoleBinding{
+		Name:      "token-creator",
+		Namespace: "default",
+		RoleRef:   rbacv1.RoleRef{Kind: "Role", Name: "token-creator"},
+		Subjects:  []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}},
+	}); err != nil {
+		t.Fatalf("Failed to save role binding: %v", err)
+	}
+	a := &API{storage: stor, authorizer: rbac.NewAuthorizer(stor), logger: logger}
+
+	alice := &rbac.User{Name: "alice", Groups: []string{"developers"}}
+	master := &rbac.User{Name: "default", Groups: []string{rbac.GroupMasters}}
+	tests := []struct {
+		name           string
+		caller         *rbac.User
+		user           string
+		groups         []string
+		serviceAccount string
+		code           int // Response code of a rejected subject, 0 if it is accepted
+	}{
+		{name: "own user", caller: alice, user: "alice", groups: []string{"developers"}},
+		{name: "service account", caller: alice, serviceAccount: "default/builder"},
+		{name: "missing service account", caller: alice, serviceAccount: "default/deployer", code: 400},
+		{name: "empty subject", caller: master, code: 400},
+		{name: "other user", caller: alice, user: "bob", code: 403},
+		{name: "masters group", caller: alice, user: "alice", groups: []string{rbac.GroupMasters}, code: 403},
+		{name: "impersonation by masters", caller: master, user: "bob", groups: []string{"operators"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Set(userKey, tt.caller)
+
+			_, _, ok := a.tokenSubject(c, tt.user, tt.groups, tt.serviceAccount)
+			if tt.code == 0 && !ok {
+				t.Errorf("Expected the subject to be accepted, got %d: %s", recorder.Code, recorder.Body)
+			}
+			if tt.code != 0 && (ok || recorder.Code != tt.code) {
+				t.Errorf("Expected the subject to be rejected with %d, got %d", tt.code, recorder.Code)
+			}
+		})
+	}
+}
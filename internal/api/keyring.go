@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keyRotationTimeout bounds a key rotation, it waits for every member to
+// apply each step
+const keyRotationTimeout = 2 * time.Minute
+
+// GetKeyring lists the fingerprints of the gossip keys and the nodes that installed them
+func (a *API) GetKeyring(c *gin.Context) {
+	status, err := a.cluster.Keyring()
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, status)
+}
+
+// InstallKey installs a base64-encoded 32-byte gossip key on all nodes
+func (a *API) InstallKey(c *gin.Context) {
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	key, err := base64.StdEncoding.DecodeString(req.Key)
+	if err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid key: %v", err)})
+		return
+	}
+	if err := a.cluster.InstallKey(key); err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Failed to install key: %v", err)})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Key installed successfully"})
+}
+
+// UseKey makes an installed key the primary key of all nodes
+func (a *API) UseKey(c *gin.Context) {
+	if err := a.cluster.UseKey(c.Param("fingerprint")); err != nil {
+		c.JSON(409, gin.H{"error": fmt.Sprintf("Failed to use key: %v", err)})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Key is the primary key now"})
+}
+
+// RemoveKey removes a key no node uses as its primary key anymore
+func (a *API) RemoveKey(c *gin.Context) {
+	if err := a.cluster.RemoveKey(c.Param("fingerprint")); err != nil {
+		c.JSON(409, gin.H{"error": fmt.Sprintf("Failed to remove key: %v", err)})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Key removed successfully"})
+}
+
+// RotateKey replaces the gossip keys by a new key, installing it on all nodes
+// before it is used and reencrypting the secrets before the old keys are removed
+func (a *API) RotateKey(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), keyRotationTimeout)
+	defer cancel()
+
+	fingerprint, err := a.cluster.RotateKey(ctx, a.storage.ReencryptSecrets)
+	if err != nil {
+		a.logger.Errorf("Failed to rotate gossip key: %v", err)
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to rotate key: %v", err)})
+		return
+	}
+
+	a.logger.Infof("Rotated gossip key, the primary key is %s", fingerprint)
+	c.JSON(200, gin.H{
+		"message": "Key rotated successfully",
+		"primary": fingerprint,
+	})
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/your-server-support/podman-swarm/internal/rbac"
 	"github.com/your-server-support/podman-swarm/internal/security"
 )
 
@@ -40,12 +41,21 @@ func AuthMiddleware(tokenManager *security.APITokenManager, enabled bool) gin.Ha
 		}
 
 		// Validate token
-		if !tokenManager.ValidateToken(token) {
+		apiToken, err := tokenManager.LookupToken(token)
+		if err != nil {
 			c.JSON(401, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		// Tokens not bound to a user are allowed everything
+		user := &rbac.User{Name: apiToken.User, Groups: apiToken.Groups}
+		if user.Name == "" && len(user.Groups) == 0 {
+			user = &rbac.User{Name: apiToken.Name, Groups: []string{rbac.GroupMasters}}
+		}
+		c.Set(userKey, user)
+		c.Set(tokenNameKey, apiToken.Name)
+
 		c.Next()
 	}
 }
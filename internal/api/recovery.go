@@ -8,72 +8,14 @@ import (
 )
 
 // RecoverDeployments recovers deployments from persistent storage
-// This is called during agent startup to restore cluster state
+// This is called during agent startup to restore cluster state.
+// Containers that survived the agent restart are adopted by the controller,
+// missing ones are recreated.
 func (a *API) RecoverDeployments() error {
 	a.logger.Info("Starting deployment recovery from persistent storage...")
 
 	deployments := a.storage.ListDeployments()
-	recoveredCount := 0
-	failedCount := 0
-
-	for _, dep := range deployments {
-		a.logger.Infof("Recovering deployment: %s/%s", dep.Namespace, dep.Name)
-
-		// Clear existing pods (they will be recreated)
-		dep.Pods = []*types.Pod{}
-
-		// Recreate pods according to desired replicas
-		for i := int32(0); i < dep.DesiredReplicas; i++ {
-			podName := fmt.Sprintf("%s-%d", dep.Name, i)
-			pod := a.parser.ExtractPodFromTemplate(dep.Template, dep.Namespace, podName)
-
-			// Generate pod ID
-			pod.ID = generateID()
-			pod.CreatedAt = time.Now().Unix()
-
-			// Schedule pod
-			nodeName, err := a.scheduler.SchedulePod(pod)
-			if err != nil {
-				a.logger.Errorf("Failed to schedule pod %s during recovery: %v", podName, err)
-				failedCount++
-				continue
-			}
-
-			// Only create pod on this node if it's scheduled here
-			if nodeName == a.cluster.GetLocalNodeName() {
-				containerID, err := a.podman.CreatePod(pod)
-				if err != nil {
-					a.logger.Errorf("Failed to create pod %s during recovery: %v", podName, err)
-					failedCount++
-					continue
-				}
-
-				pod.ID = containerID
-				if err := a.podman.StartPod(containerID); err != nil {
-					a.logger.Errorf("Failed to start pod %s during recovery: %v", podName, err)
-					failedCount++
-					continue
-				}
-
-				// Update pod state
-				state, _ := a.podman.GetPodStatus(containerID)
-				a.scheduler.UpdatePodState(containerID, state)
-
-				a.logger.Infof("Recovered pod %s on node %s", podName, nodeName)
-			}
-
-			dep.Pods = append(dep.Pods, pod)
-		}
-
-		// Update deployment in storage
-		key := fmt.Sprintf("%s/%s", dep.Namespace, dep.Name)
-		a.deployments[key] = dep
-		if err := a.storage.SaveDeployment(dep); err != nil {
-			a.logger.Warnf("Failed to update deployment after recovery: %v", err)
-		}
-
-		recoveredCount++
-	}
+	a.controller.Reconcile()
 
 	// Recover services
 	services := a.storage.ListServices()
@@ -94,7 +36,16 @@ func (a *API) RecoverDeployments() error {
 		a.services[key] = svc
 	}
 
-	a.logger.Infof("Deployment recovery completed: %d recovered, %d failed", recoveredCount, failedCount)
+	failedCount := 0
+	for _, dep := range deployments {
+		for _, pod := range dep.Pods {
+			if pod.NodeName == a.cluster.GetLocalNodeName() && pod.State == types.PodStateFailed {
+				failedCount++
+			}
+		}
+	}
+
+	a.logger.Infof("Deployment recovery completed: %d deployments, %d local pods failed", len(deployments), failedCount)
 
 	if failedCount > 0 {
 		return fmt.Errorf("%d pods failed to recover", failedCount)
@@ -0,0 +1,231 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Types of audit events
+const (
+	TypeAPI     = "api"     // Request to the API
+	TypeJoin    = "join"    // Failed join token validation
+	TypeDecrypt = "decrypt" // Cluster traffic that could not be decrypted
+)
+
+// Event is a line of the audit log
+type Event struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	Token       string    `json:"token,omitempty"` // Name of the API token
+	User        string    `json:"user,omitempty"`
+	Groups      []string  `json:"groups,omitempty"`
+	SourceIP    string    `json:"source_ip,omitempty"`
+	Verb        string    `json:"verb,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	Object      string    `json:"object,omitempty"`
+	Code        int       `json:"code,omitempty"`
+	RequestHash string    `json:"request_hash,omitempty"` // SHA-256 of the request body the handler read
+	Error       string    `json:"error,omitempty"`
+}
+
+// Query selects events of the audit log. Empty fields match all events.
+type Query struct {
+	Since time.Time
+	Until time.Time
+	Type  string
+	User  string
+	Verb  string
+	Code  int
+	Limit int // Most recent events returned, 0 means all
+}
+
+func (q *Query) matches(event *Event) bool {
+	switch {
+	case !q.Since.IsZero() && event.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && event.Time.After(q.Until):
+		return false
+	case q.Type != "" && event.Type != q.Type:
+		return false
+	case q.User != "" && event.User != q.User:
+		return false
+	case q.Verb != "" && event.Verb != q.Verb:
+		return false
+	case q.Code != 0 && event.Code != q.Code:
+		return false
+	}
+	return true
+}
+
+// Logger writes events as JSON lines to a file. The file is rotated when it
+// exceeds the maximum size, keeping a number of backups named file.1 (the
+// most recent) to file.N.
+type Logger struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	logger     *logrus.Logger
+}
+
+func NewLogger(path string, maxSize int64, maxBackups int, logger *logrus.Logger) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	l := &Logger{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		logger:     logger,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Log writes an event, the time is set if missing. A nil logger discards events.
+func (l *Logger) Log(event *Event) {
+	if l == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		l.logger.Warnf("Failed to marshal audit event: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			l.logger.Warnf("Failed to rotate audit log: %v", err)
+		}
+	}
+
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		l.logger.Warnf("Failed to write audit event: %v", err)
+	}
+}
+
+// rotate shifts the backups, dropping the oldest, and starts a new file
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	if l.maxBackups > 0 {
+		for i := l.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(l.backup(i), l.backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(l.path, l.backup(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+func (l *Logger) backup(i int) string {
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
+
+// Query returns the matching events of the file and its backups, oldest first
+func (l *Logger) Query(q *Query) ([]*Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var events []*Event
+	paths := make([]string, 0, l.maxBackups+1)
+	for i := l.maxBackups; i > 0; i-- {
+		paths = append(paths, l.backup(i))
+	}
+	paths = append(paths, l.path)
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var event Event
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				continue
+			}
+			if q.matches(&event) {
+				events = append(events, &event)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+	}
+
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[len(events)-q.Limit:]
+	}
+	return events, nil
+}
+
+// Close closes the file, later events are discarded
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
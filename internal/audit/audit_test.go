@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLoggerRotateAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := NewLogger(path, 300, 2, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer l.Close()
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 10; i++ {
+		code := 200
+		if i%2 == 1 {
+			code = 403
+		}
+		l.Log(&Event{
+			Time: start.Add(time.Duration(i) * time.Minute),
+			Type: TypeAPI,
+			User: "alice",
+			Verb: "POST",
+			Path: "/api/v1/manifests",
+			Code: code,
+		})
+	}
+
+	// Two backups are kept, older events are dropped
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Fatalf("Expected a second backup: %v", err)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected no third backup, got %v", err)
+	}
+
+	events, err := l.Query(&Query{})
+	if err != nil {
+		t.Fatalf("Failed to query audit log: %v", err)
+	}
+	if len(events) == 0 || len(events) >= 10 {
+		t.Fatalf("Expected the oldest events to be rotated away, got %d events", len(events))
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Time.Before(events[i-1].Time) {
+			t.Errorf("Expected events oldest first, got %v before %v", events[i-1].Time, events[i].Time)
+		}
+	}
+	if last := events[len(events)-1]; !last.Time.Equal(start.Add(9 * time.Minute)) {
+		t.Errorf("Expected the most recent event last, got %v", last.Time)
+	}
+
+	denied, err := l.Query(&Query{Code: 403, Limit: 2})
+	if err != nil {
+		t.Fatalf("Failed to query audit log: %v", err)
+	}
+	if len(denied) != 2 || denied[1].Code != 403 || !denied[1].Time.Equal(start.Add(9*time.Minute)) {
+		t.Errorf("Expected the two most recent denied requests, got %+v", denied)
+	}
+
+	if events, _ := l.Query(&Query{Type: TypeJoin}); len(events) != 0 {
+		t.Errorf("Expected no join events, got %d", len(events))
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.Log(&Event{Type: TypeDecrypt})
+}
@@ -0,0 +1,245 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/your-server-support/podman-swarm/internal/audit"
+	"github.com/your-server-support/podman-swarm/internal/security"
+)
+
+// AdmissionPort is the TCP port managers admit joining nodes on
+const AdmissionPort = 7947
+
+// admissionTimeout bounds an admission exchange
+const admissionTimeout = 10 * time.Second
+
+// Admission is handed to a node that presented a valid join token
+type Admission struct {
+	Role       string   `json:"role"`
+	ClusterKey []byte   `json:"cluster_key"`           // Key the cluster was created with, API tokens are hashed with it
+	Keys       [][]byte `json:"keys"`                  // Installed gossip keys, the primary key first
+	JoinSecret []byte   `json:"join_secret,omitempty"` // Secret join tokens are signed with, managers only
+	NodeSecret []byte   `json:"node_secret"`           // Secret the node fetches gossip keys with
+}
+
+// admissionRequest either admits a joining node, or hands a gossip key
+// installed on the manager to a member
+type admissionRequest struct {
+	Node        string              `json:"node"`
+	Proof       *security.JoinProof `json:"proof,omitempty"`
+	KeyProof    *security.NodeProof `json:"key_proof,omitempty"`
+	Fingerprint string              `json:"fingerprint,omitempty"` // Gossip key fetched with the key proof
+}
+
+type admissionResponse struct {
+	Error     string `json:"error,omitempty"`
+	Admission []byte `json:"admission,omitempty"` // Admission encrypted with the key derived from the token
+	Key       []byte `json:"key,omitempty"`       // Gossip key encrypted with the key derived from the node secret
+}
+
+// RequestAdmission presents a join token to the managers at the join
+// addresses before the node joins the memberlist. The token itself is not
+// sent, only a proof of holding it.
+func RequestAdmission(joinAddrs []string, nodeName, token string) (*Admission, error) {
+	proof, key, err := security.NewJoinProof(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, addr := range joinAddrs {
+		admission, err := requestAdmission(admissionAddr(addr), nodeName, proof, key)
+		if err == nil {
+			return admission, nil
+		}
+		lastErr = fmt.Errorf("admission by %s failed: %w", addr, err)
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no join addresses")
+	}
+	return nil, lastErr
+}
+
+func requestAdmission(addr, nodeName string, proof *security.JoinProof, key []byte) (*Admission, error) {
+	resp, err := exchange(addr, &admissionRequest{Node: nodeName, Proof: proof})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a manager holding the join secret derives the same key
+	encryptor, err := security.NewEncryptor(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := encryptor.Decrypt(resp.Admission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt admission: %w", err)
+	}
+
+	var admission Admission
+	if err := json.Unmarshal(data, &admission); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal admission: %w", err)
+	}
+	return &admission, nil
+}
+
+// requestKey fetches a gossip key from a manager with the secret of the node
+func requestKey(addr, nodeName string, secret []byte, fingerprint string) ([]byte, error) {
+	proof, key, err := security.NewNodeProof(nodeName, secret)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := exchange(addr, &admissionRequest{Node: nodeName, KeyProof: proof, Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+
+	encryptor, err := security.NewEncryptor(key)
+	if err != nil {
+		return nil, err
+	}
+	gossipKey, err := encryptor.Decrypt(resp.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+	if security.KeyFingerprint(gossipKey) != fingerprint {
+		return nil, fmt.Errorf("fingerprint %s does not match the key", fingerprint)
+	}
+	return gossipKey, nil
+}
+
+// exchange sends a request to the admission port of a manager and returns its response
+func exchange(addr string, req *admissionRequest) (*admissionResponse, error) {
+	conn, err := net.DialTimeout("tcp", addr, admissionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(admissionTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send admission request: %w", err)
+	}
+
+	var resp admissionResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read admission response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return &resp, nil
+}
+
+// admissionAddr returns the admission address of a join address, which may
+// be given with or without the memberlist port
+func admissionAddr(joinAddr string) string {
+	host := joinAddr
+	if h, _, err := net.SplitHostPort(joinAddr); err == nil {
+		host = h
+	}
+	return net.JoinHostPort(host, fmt.Sprint(AdmissionPort))
+}
+
+// serveAdmission admits the nodes presenting valid join tokens until the
+// listener is closed
+func (c *Cluster) serveAdmission(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go c.admit(conn)
+	}
+}
+
+func (c *Cluster) admit(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(admissionTimeout))
+
+	source := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		source = host
+	}
+
+	var req admissionRequest
+	resp := &admissionResponse{}
+	err := json.NewDecoder(conn).Decode(&req)
+	switch {
+	case err != nil || (req.Proof == nil && req.KeyProof == nil):
+		err = fmt.Errorf("malformed admission request")
+	case req.KeyProof != nil:
+		resp.Key, err = c.encryptedKey(&req)
+	default:
+		resp.Admission, err = c.encryptedAdmission(&req)
+	}
+
+	switch {
+	case err != nil:
+		resp.Error = err.Error()
+		c.logger.Warnf("Rejected node %q from %s: %s", req.Node, source, resp.Error)
+		c.audit.Log(&audit.Event{Type: audit.TypeJoin, SourceIP: source, Object: req.Node, Error: resp.Error})
+	case req.KeyProof != nil:
+		c.logger.Infof("Handed key %s to node %s from %s", req.Fingerprint, req.KeyProof.Node, source)
+	default:
+		c.logger.Infof("Admitted node %s from %s", req.Node, source)
+	}
+
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		c.logger.Warnf("Failed to send admission response to %s: %v", source, err)
+	}
+}
+
+// encryptedAdmission verifies the proof of a joining node and returns its encrypted admission
+func (c *Cluster) encryptedAdmission(req *admissionRequest) ([]byte, error) {
+	claims, key, err := c.tokenManager.VerifyJoinProof(req.Proof)
+	if err != nil {
+		return nil, err
+	}
+
+	admission := &Admission{
+		Role:       claims.Role,
+		ClusterKey: c.clusterKey,
+		Keys:       c.encryptor.Keys(),
+		NodeSecret: security.NodeSecret(c.tokenManager.GetSecret(), req.Node),
+	}
+	if claims.Role == security.JoinRoleManager {
+		admission.JoinSecret = c.tokenManager.GetSecret()
+	}
+	data, err := json.Marshal(admission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal admission: %w", err)
+	}
+
+	encryptor, err := security.NewEncryptor(key)
+	if err != nil {
+		return nil, err
+	}
+	return encryptor.Encrypt(data)
+}
+
+// encryptedKey verifies the proof of a member and returns the gossip key it
+// fetches, encrypted with the key derived from the secret of the member
+func (c *Cluster) encryptedKey(req *admissionRequest) ([]byte, error) {
+	key, err := c.tokenManager.VerifyNodeProof(req.KeyProof)
+	if err != nil {
+		return nil, err
+	}
+	// Removed nodes keep their secret, only members are handed keys
+	if _, err := c.GetNode(req.KeyProof.Node); err != nil {
+		return nil, fmt.Errorf("node %s is not a member", req.KeyProof.Node)
+	}
+	gossipKey := c.encryptor.Key(req.Fingerprint)
+	if gossipKey == nil {
+		return nil, fmt.Errorf("key %s is not installed", req.Fingerprint)
+	}
+
+	encryptor, err := security.NewEncryptor(key)
+	if err != nil {
+		return nil, err
+	}
+	return encryptor.Encrypt(gossipKey)
+}
@@ -0,0 +1,159 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/your-server-support/podman-swarm/internal/security"
+)
+
+func TestAdmission(t *testing.T) {
+	manager := newTestCluster(t, "node-1")
+	manager.tokenManager = security.NewTokenManager([]byte("join-secret"))
+	manager.clusterKey = bytes.Repeat([]byte("g"), 32)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go manager.serveAdmission(listener)
+
+	admit := func(token string) (*Admission, error) {
+		proof, key, err := security.NewJoinProof(token)
+		if err != nil {
+			return nil, err
+		}
+		return requestAdmission(listener.Addr().String(), "node-2", proof, key)
+	}
+
+	worker, err := manager.tokenManager.GenerateJoinToken(security.JoinRoleWorker, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	admission, err := admit(worker)
+	if err != nil {
+		t.Fatalf("Expected worker to be admitted: %v", err)
+	}
+	if !bytes.Equal(admission.ClusterKey, manager.clusterKey) || admission.JoinSecret != nil {
+		t.Errorf("Expected worker to get the cluster key only, got %+v", admission)
+	}
+	if len(admission.Keys) != 1 || !bytes.Equal(admission.Keys[0], manager.encryptor.Keys()[0]) {
+		t.Errorf("Expected worker to get the gossip keys, got %d keys", len(admission.Keys))
+	}
+	if !bytes.Equal(admission.NodeSecret, security.NodeSecret([]byte("join-secret"), "node-2")) {
+		t.Error("Expected worker to get the secret of its node")
+	}
+
+	managerToken, err := manager.tokenManager.GenerateJoinToken(security.JoinRoleManager, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	admission, err = admit(managerToken)
+	if err != nil {
+		t.Fatalf("Expected manager to be admitted: %v", err)
+	}
+	if !bytes.Equal(admission.JoinSecret, []byte("join-secret")) {
+		t.Errorf("Expected manager to get the join secret, got %+v", admission)
+	}
+
+	foreign, err := security.NewTokenManager([]byte("other-secret")).GenerateJoinToken(security.JoinRoleWorker, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if _, err := admit(foreign); err == nil {
+		t.Error("Expected token of another cluster to be rejected")
+	}
+
+	if err := manager.tokenManager.RevokeToken(worker); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if _, err := admit(worker); err == nil {
+		t.Error("Expected revoked token to be rejected")
+	}
+}
+
+func TestAdmissionAddr(t *testing.T) {
+	for addr, expected := range map[string]string{
+		"10.0.0.1":      "10.0.0.1:7947",
+		"10.0.0.1:7946": "10.0.0.1:7947",
+		"[::1]:7946":    "[::1]:7947",
+	} {
+		if got := admissionAddr(addr); got != expected {
+			t.Errorf("Expected admission address %s for %s, got %s", expected, addr, got)
+		}
+	}
+}
+
+// tokenStore stands in for the replicated cluster state
+type tokenStore map[string]*security.APIToken
+
+func (s tokenStore) SaveAPIToken(token *security.APIToken) error {
+	s[token.Hash] = token
+	return nil
+}
+
+func (s tokenStore) DeleteAPIToken(hash string) error {
+	delete(s, hash)
+	return nil
+}
+
+func (s tokenStore) GetAPIToken(hash string) (*security.APIToken, error) {
+	if token, ok := s[hash]; ok {
+		return token, nil
+	}
+	return nil, fmt.Errorf("token not found")
+}
+
+func (s tokenStore) ListAPITokens() []*security.APIToken {
+	var tokens []*security.APIToken
+	for _, token := range s {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func TestAdmittedNodeValidatesAPITokens(t *testing.T) {
+	// The seed was started with an encryption key that is not 32 bytes long
+	seed := newTestCluster(t, "node-1")
+	seed.tokenManager = security.NewTokenManager([]byte("join-secret"))
+	seed.clusterKey = security.DeriveKey([]byte("encryption-key"))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go seed.serveAdmission(listener)
+
+	store := tokenStore{}
+	seedTokens := security.NewAPITokenManager(seed.ClusterKey())
+	seedTokens.SetStore(store)
+	token, err := seedTokens.GenerateToken("default", nil)
+	if err != nil {
+		t.Fatalf("Failed to generate API token: %v", err)
+	}
+
+	joinToken, err := seed.tokenManager.GenerateJoinToken(security.JoinRoleWorker, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate join token: %v", err)
+	}
+	proof, key, err := security.NewJoinProof(joinToken)
+	if err != nil {
+		t.Fatalf("Failed to create proof: %v", err)
+	}
+	admission, err := requestAdmission(listener.Addr().String(), "node-2", proof, key)
+	if err != nil {
+		t.Fatalf("Expected node to be admitted: %v", err)
+	}
+
+	// The admitted node shares the cluster state and restarts with the key it was handed
+	nodeTokens := security.NewAPITokenManager(security.DeriveKey(admission.ClusterKey))
+	nodeTokens.SetStore(store)
+	if !nodeTokens.ValidateToken(token) {
+		t.Error("Expected API token issued on the seed to be valid on the admitted node")
+	}
+}
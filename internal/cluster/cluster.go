@@ -2,28 +2,61 @@ package cluster
 
 import (
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"runtime"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/memberlist"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 
+	"github.com/your-server-support/podman-swarm/internal/audit"
 	"github.com/your-server-support/podman-swarm/internal/security"
 	"github.com/your-server-support/podman-swarm/internal/types"
 )
 
-type MessageHandler func([]byte) error
+// MembershipHandler is called after a node joined, changed its metadata or left the cluster
+type MembershipHandler func(node *types.Node, joined bool)
+
+// StateHandlers exchange state with peers in the periodic push-pull of memberlist
+type StateHandlers struct {
+	Local func() []byte          // Returns the local state sent to a peer
+	Merge func(buf []byte) error // Merges the state received from a peer
+}
 
 type Cluster struct {
-	memberlist     *memberlist.Memberlist
-	delegate       *delegate
-	mu             sync.RWMutex
-	nodes          map[string]*types.Node
-	logger         *logrus.Logger
-	messageHandler MessageHandler
-	encryptor      *security.Encryptor
-	tokenManager   *security.TokenManager
-	tlsConfig      *tls.Config
+	memberlist    *memberlist.Memberlist
+	delegate      *delegate
+	mu            sync.RWMutex
+	nodes         map[string]*types.Node
+	logger        *logrus.Logger
+	localName     string
+	handlers      map[string]MessageHandler
+	broadcasts    *memberlist.TransmitLimitedQueue
+	seenMu        sync.Mutex
+	seen          map[string]time.Time // Ids of received messages
+	seenPruned    time.Time
+	failed        map[string]time.Time // Failed members that still count towards the quorum
+	failedTimeout time.Duration
+	leases        *leaseManager
+	degraded      bool // Lost the quorum
+	memberHandler MembershipHandler
+	leaderFunc    func() bool
+	stateHandlers *StateHandlers
+	encryptor     *security.Encryptor
+	tokenManager  *security.TokenManager
+	tlsConfig     *tls.Config
+	localMeta     NodeMeta
+	audit         *audit.Logger
+	clusterKey    []byte              // Key the cluster was created with, handed to admitted nodes
+	keyring       *memberlist.Keyring // Gossip keys of memberlist, mirrors the keys of the encryptor
+	keyringFile   string
+	nodeSecret    []byte       // Proves the node to the managers it fetches keys from
+	admission     net.Listener // Admits joining nodes on managers
 }
 
 type delegate struct {
@@ -32,83 +65,187 @@ type delegate struct {
 }
 
 func (d *delegate) NodeMeta(limit int) []byte {
+	d.cluster.mu.RLock()
+	meta := d.cluster.localMeta.clone()
+	d.cluster.mu.RUnlock()
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		d.logger.Errorf("Failed to marshal node metadata: %v", err)
+		return []byte{}
+	}
+	if len(data) <= limit {
+		return data
+	}
+
+	// The metadata is kept within memberlist.MetaMaxSize, a smaller limit
+	// drops the custom labels rather than the resources, taints and keys
+	trimmed := meta.withoutCustomLabels()
+	if data, err = json.Marshal(trimmed); err == nil && len(data) <= limit {
+		d.logger.Errorf("Node metadata exceeds limit (%d bytes), advertising it without custom labels", limit)
+		return data
+	}
+	d.logger.Errorf("Node metadata exceeds limit (%d bytes), not advertising it", limit)
 	return []byte{}
 }
 
 func (d *delegate) NotifyMsg(msg []byte) {
-	// Decrypt message if encryption is enabled
-	decryptedMsg := msg
-	if d.cluster.encryptor != nil {
-		decrypted, err := d.cluster.encryptor.Decrypt(msg)
-		if err != nil {
-			d.logger.Warnf("Failed to decrypt message: %v", err)
-			return
-		}
-		decryptedMsg = decrypted
-	}
-
-	d.logger.Debugf("Received message: %s", string(decryptedMsg))
-	if d.cluster.messageHandler != nil {
-		if err := d.cluster.messageHandler(decryptedMsg); err != nil {
-			d.logger.Warnf("Error handling message: %v", err)
+	if err := d.cluster.handleMessage(msg); err != nil {
+		d.logger.Warnf("Error handling message: %v", err)
+		if errors.Is(err, errDecrypt) {
+			d.cluster.audit.Log(&audit.Event{Type: audit.TypeDecrypt, Object: "message", Error: err.Error()})
 		}
 	}
 }
 
+// GetBroadcasts returns the queued messages gossiped along with the memberlist traffic
 func (d *delegate) GetBroadcasts(overhead, limit int) [][]byte {
-	return nil
+	return d.cluster.broadcasts.GetBroadcasts(overhead, limit)
 }
 
+// LocalState returns the state sent to a peer in the periodic push-pull
+// anti-entropy exchange over TCP
 func (d *delegate) LocalState(join bool) []byte {
-	return []byte{}
+	d.cluster.mu.RLock()
+	handlers := d.cluster.stateHandlers
+	d.cluster.mu.RUnlock()
+
+	if handlers == nil {
+		return []byte{}
+	}
+
+	state := handlers.Local()
+	if len(state) == 0 || d.cluster.encryptor == nil {
+		return state
+	}
+
+	encrypted, err := d.cluster.encryptor.Encrypt(state)
+	if err != nil {
+		d.logger.Warnf("Failed to encrypt local state: %v", err)
+		return []byte{}
+	}
+	return encrypted
 }
 
+// MergeRemoteState merges the state received from a peer in the push-pull exchange
 func (d *delegate) MergeRemoteState(buf []byte, join bool) {
+	d.cluster.mu.RLock()
+	handlers := d.cluster.stateHandlers
+	d.cluster.mu.RUnlock()
+
+	if handlers == nil || len(buf) == 0 {
+		return
+	}
+
+	state := buf
+	if d.cluster.encryptor != nil {
+		decrypted, err := d.cluster.encryptor.Decrypt(buf)
+		if err != nil {
+			d.logger.Warnf("Failed to decrypt remote state: %v", err)
+			d.cluster.audit.Log(&audit.Event{Type: audit.TypeDecrypt, Object: "state", Error: err.Error()})
+			return
+		}
+		state = decrypted
+	}
+
+	if err := handlers.Merge(state); err != nil {
+		d.logger.Warnf("Failed to merge remote state: %v", err)
+	}
 }
 
 func (d *delegate) NotifyJoin(node *memberlist.Node) {
 	d.cluster.mu.Lock()
-	defer d.cluster.mu.Unlock()
-
-	// Validate token if token manager is set
-	// Token validation happens during join process, not here
-	// This is just for logging
 
+	// Nodes were admitted with a join token before, only they hold the gossip
+	// key memberlist encrypts the cluster traffic with
 	d.logger.Infof("Node %s joined the cluster", node.Name)
-	d.cluster.nodes[node.Name] = &types.Node{
+	n := &types.Node{
 		Name:    node.Name,
 		Address: node.Addr.String(),
 		Status:  "Ready",
 		Labels:  make(map[string]string),
 	}
+	d.applyMeta(n, node.Meta)
+	d.cluster.nodes[node.Name] = n
+	delete(d.cluster.failed, node.Name)
+	d.cluster.checkQuorum()
+	handler := d.cluster.memberHandler
+	d.cluster.mu.Unlock()
+
+	if handler != nil {
+		handler(n, true)
+	}
 }
 
 func (d *delegate) NotifyLeave(node *memberlist.Node) {
 	d.cluster.mu.Lock()
-	defer d.cluster.mu.Unlock()
 
 	d.logger.Infof("Node %s left the cluster", node.Name)
+	n, ok := d.cluster.nodes[node.Name]
 	delete(d.cluster.nodes, node.Name)
+	if node.State == memberlist.StateDead {
+		d.cluster.failed[node.Name] = time.Now()
+	}
+	d.cluster.checkQuorum()
+	handler := d.cluster.memberHandler
+	d.cluster.mu.Unlock()
+
+	if handler != nil && ok {
+		handler(n, false)
+	}
 }
 
 func (d *delegate) NotifyUpdate(node *memberlist.Node) {
 	d.cluster.mu.Lock()
-	defer d.cluster.mu.Unlock()
 
-	if existing, ok := d.cluster.nodes[node.Name]; ok {
+	existing, ok := d.cluster.nodes[node.Name]
+	if ok {
 		existing.Address = node.Addr.String()
+		d.applyMeta(existing, node.Meta)
+	}
+	handler := d.cluster.memberHandler
+	d.cluster.mu.Unlock()
+
+	// Changed labels may change the placement of pods
+	if handler != nil && ok {
+		handler(existing, true)
+	}
+}
+
+// applyMeta copies the metadata advertised by a node into its node entry
+func (d *delegate) applyMeta(node *types.Node, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	var meta NodeMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		d.logger.Warnf("Failed to decode metadata of node %s: %v", node.Name, err)
+		return
 	}
+
+	meta.applyTo(node)
 }
 
 type ClusterConfig struct {
 	NodeName      string
 	BindAddr      string
 	JoinAddrs     []string
-	JoinToken     string
-	EncryptionKey []byte
+	EncryptionKey []byte   // Key the cluster was created with, handed to the nodes admitted by this node
+	Keyring       [][]byte // Gossip keys, the primary key first, defaults to EncryptionKey
+	KeyringFile   string   // Keyring changes are saved to, if set
 	TLSConfig     *tls.Config
-	TokenManager  *security.TokenManager
-	Logger        *logrus.Logger
+	TokenManager  *security.TokenManager // Validates join tokens, set on managers only
+	NodeSecret    []byte                 // Handed by the manager that admitted the node, derived on managers
+	Capacity      corev1.ResourceList    // Resources of this node
+	Allocatable   corev1.ResourceList    // Resources available to pods, defaults to Capacity
+	Labels        map[string]string      // Labels of this node, matched by node selectors
+	AgentVersion  string
+	// How long failed members count towards the quorum unless they rejoin or
+	// are removed, defaults to DefaultFailedNodeTimeout
+	FailedNodeTimeout time.Duration
+	AuditLog          *audit.Logger // Records failed join token validations and undecryptable traffic
+	Logger            *logrus.Logger
 }
 
 func NewCluster(cfg *ClusterConfig) (*Cluster, error) {
@@ -121,19 +258,70 @@ func NewCluster(cfg *ClusterConfig) (*Cluster, error) {
 	config.LogOutput = cfg.Logger.Writer()
 
 	cluster := &Cluster{
-		nodes:        make(map[string]*types.Node),
-		logger:       cfg.Logger,
-		tokenManager: cfg.TokenManager,
-		tlsConfig:    cfg.TLSConfig,
+		nodes:         make(map[string]*types.Node),
+		localName:     cfg.NodeName,
+		handlers:      make(map[string]MessageHandler),
+		seen:          make(map[string]time.Time),
+		failed:        make(map[string]time.Time),
+		failedTimeout: cfg.FailedNodeTimeout,
+		logger:        cfg.Logger,
+		tokenManager:  cfg.TokenManager,
+		tlsConfig:     cfg.TLSConfig,
+		audit:         cfg.AuditLog,
+		localMeta: NodeMeta{
+			Capacity:     cfg.Capacity,
+			Allocatable:  cfg.Allocatable,
+			Labels:       defaultLabels(cfg.NodeName),
+			AgentVersion: cfg.AgentVersion,
+			OS:           runtime.GOOS,
+			Arch:         runtime.GOARCH,
+		},
+	}
+	if cluster.failedTimeout <= 0 {
+		cluster.failedTimeout = DefaultFailedNodeTimeout
+	}
+	if cluster.localMeta.Allocatable == nil {
+		cluster.localMeta.Allocatable = cfg.Capacity
+	}
+	for key, value := range cfg.Labels {
+		cluster.localMeta.Labels[key] = value
 	}
 
-	// Setup encryption if key is provided
+	// Setup encryption if key is provided. Memberlist drops the traffic of
+	// nodes without a key of the keyring, so only admitted nodes become members.
 	if len(cfg.EncryptionKey) > 0 {
-		encryptor, err := security.NewEncryptor(cfg.EncryptionKey)
+		cluster.clusterKey = security.DeriveKey(cfg.EncryptionKey)
+		keys := cfg.Keyring
+		if len(keys) == 0 {
+			keys = [][]byte{cluster.clusterKey}
+		}
+
+		encryptor, err := security.NewEncryptor(keys[0])
 		if err != nil {
 			return nil, fmt.Errorf("failed to create encryptor: %w", err)
 		}
+		for _, key := range keys[1:] {
+			encryptor.InstallKey(key)
+		}
+		keyring, err := memberlist.NewKeyring(encryptor.Keys(), encryptor.Keys()[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to create keyring: %w", err)
+		}
+
 		cluster.encryptor = encryptor
+		cluster.keyring = keyring
+		cluster.keyringFile = cfg.KeyringFile
+		cluster.nodeSecret = cfg.NodeSecret
+		if cfg.TokenManager != nil {
+			cluster.nodeSecret = security.NodeSecret(cfg.TokenManager.GetSecret(), cfg.NodeName)
+		}
+		cluster.localMeta.Keys = encryptor.Fingerprints()
+		config.Keyring = keyring
+	}
+
+	// Peers schedule by the advertised metadata, it has to fit from the start
+	if _, err := cluster.localMeta.encode(); err != nil {
+		return nil, fmt.Errorf("invalid node labels: %w", err)
 	}
 
 	// Setup TLS transport if TLS config is provided
@@ -148,6 +336,21 @@ func NewCluster(cfg *ClusterConfig) (*Cluster, error) {
 	}
 
 	config.Delegate = cluster.delegate
+	cluster.leases = newLeaseManager(
+		cfg.NodeName,
+		func(node string, payload []byte) error { return cluster.SendTo(MessageLease, node, payload) },
+		cluster.memberNames,
+		cluster.QuorumSize,
+		cfg.Logger,
+	)
+	cluster.handlers[MessageLease] = cluster.leases.handleMessage
+	cluster.handlers[MessageNodePatch] = cluster.handleNodePatch
+	cluster.handlers[MessageNodeRemove] = cluster.handleNodeRemove
+	cluster.handlers[MessageKeyring] = cluster.handleKeyringChange
+	cluster.broadcasts = &memberlist.TransmitLimitedQueue{
+		NumNodes:       func() int { return cluster.memberlist.NumMembers() },
+		RetransmitMult: config.RetransmitMult,
+	}
 	config.Events = cluster.delegate
 
 	list, err := memberlist.Create(config)
@@ -157,15 +360,22 @@ func NewCluster(cfg *ClusterConfig) (*Cluster, error) {
 
 	cluster.memberlist = list
 
-	// Validate join token if provided
-	if len(cfg.JoinAddrs) > 0 {
-		if cfg.TokenManager != nil && cfg.JoinToken != "" {
-			if !cfg.TokenManager.ValidateToken(cfg.JoinToken) {
-				return nil, fmt.Errorf("invalid join token")
-			}
-			cfg.Logger.Infof("Join token validated successfully")
+	// Managers admit nodes with join tokens
+	if cfg.TokenManager != nil && cluster.clusterKey != nil {
+		host := cfg.BindAddr
+		if h, _, err := net.SplitHostPort(cfg.BindAddr); err == nil {
+			host = h
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, fmt.Sprint(AdmissionPort)))
+		if err != nil {
+			list.Shutdown()
+			return nil, fmt.Errorf("failed to listen for admission requests: %w", err)
 		}
+		cluster.admission = listener
+		go cluster.serveAdmission(listener)
+	}
 
+	if len(cfg.JoinAddrs) > 0 {
 		_, err := list.Join(cfg.JoinAddrs)
 		if err != nil {
 			cfg.Logger.Warnf("Failed to join cluster: %v", err)
@@ -176,12 +386,13 @@ func NewCluster(cfg *ClusterConfig) (*Cluster, error) {
 
 	// Add local node
 	cluster.mu.Lock()
-	cluster.nodes[cfg.NodeName] = &types.Node{
+	localNode := &types.Node{
 		Name:    cfg.NodeName,
 		Address: cfg.BindAddr,
 		Status:  "Ready",
-		Labels:  make(map[string]string),
 	}
+	cluster.localMeta.applyTo(localNode)
+	cluster.nodes[cfg.NodeName] = localNode
 	cluster.mu.Unlock()
 
 	return cluster, nil
@@ -215,31 +426,38 @@ func (c *Cluster) GetMembers() []*memberlist.Node {
 	return c.memberlist.Members()
 }
 
-func (c *Cluster) Broadcast(msg []byte) error {
-	// Encrypt message if encryption is enabled
-	sendMsg := msg
-	if c.encryptor != nil {
-		encrypted, err := c.encryptor.Encrypt(msg)
-		if err != nil {
-			return fmt.Errorf("failed to encrypt message: %w", err)
-		}
-		sendMsg = encrypted
-	}
-
-	return c.memberlist.SendBestEffort(nil, sendMsg)
+// ClusterKey returns the key the cluster was created with, the same on every
+// admitted node. API tokens are hashed with it. Nil if encryption is disabled.
+func (c *Cluster) ClusterKey() []byte {
+	return c.clusterKey
 }
 
-func (c *Cluster) Shutdown() error {
-	return c.memberlist.Shutdown()
+// GetEncryptor returns the encryptor derived from the cluster key, nil if encryption is disabled
+func (c *Cluster) GetEncryptor() *security.Encryptor {
+	return c.encryptor
 }
 
-func (c *Cluster) UpdateNodeLabels(nodeName string, labels map[string]string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// leaveTimeout bounds the gossip of queued messages and the leave intent on shutdown
+const leaveTimeout = 5 * time.Second
 
-	if node, ok := c.nodes[nodeName]; ok {
-		node.Labels = labels
+// Shutdown leaves the cluster gracefully. Leases held are released and the
+// queued messages get a chance to be gossiped before the peers are told that
+// the node leaves, so that they do not wait for it to be declared dead.
+func (c *Cluster) Shutdown() error {
+	c.leases.stop()
+	if c.admission != nil {
+		c.admission.Close()
+	}
+
+	deadline := time.Now().Add(leaveTimeout)
+	for c.broadcasts.NumQueued() > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := c.memberlist.Leave(leaveTimeout); err != nil {
+		c.logger.Warnf("Failed to leave the cluster: %v", err)
 	}
+
+	return c.memberlist.Shutdown()
 }
 
 func (c *Cluster) GetNodeCount() int {
@@ -267,25 +485,161 @@ func (c *Cluster) GetLocalNodeAddress() string {
 	return "127.0.0.1"
 }
 
-func (c *Cluster) SetMessageHandler(handler MessageHandler) {
+// SetMembershipHandler sets the handler called when nodes join or leave.
+// The handler runs on the memberlist goroutine and must not block.
+func (c *Cluster) SetMembershipHandler(handler MembershipHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.memberHandler = handler
+}
+
+// SetStateHandlers sets the handlers exchanging state with peers in the
+// periodic push-pull, which also runs when a node joins
+func (c *Cluster) SetStateHandlers(handlers *StateHandlers) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stateHandlers = handlers
+}
+
+// DefaultFailedNodeTimeout is how long failed members count towards the
+// quorum unless they rejoin or are removed
+const DefaultFailedNodeTimeout = 24 * time.Hour
+
+// MessageNodeRemove is the message type of failed nodes removed from the cluster
+const MessageNodeRemove = "node_remove"
+
+// SetLeaderFunc makes IsLeader defer to fn, e.g. to follow the leader
+// elected by the consensus log
+func (c *Cluster) SetLeaderFunc(fn func() bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.messageHandler = handler
+	c.leaderFunc = fn
 }
 
+// IsLeader checks if the local node holds the leader lease, or leads the
+// consensus log when it is enabled
 func (c *Cluster) IsLeader() bool {
-	// In a peer-to-peer cluster, any node can be a leader
-	// For simplicity, we can use the first node alphabetically
-	members := c.memberlist.Members()
-	if len(members) == 0 {
-		return false
+	_, leader := c.LeaderToken()
+	return leader
+}
+
+// LeaderToken returns the fencing token of the leader lease if the local node
+// is the leader. With consensus enabled the log orders the writes of the
+// leader, which then carry no token (0).
+func (c *Cluster) LeaderToken() (uint64, bool) {
+	c.mu.RLock()
+	leaderFunc := c.leaderFunc
+	c.mu.RUnlock()
+	if leaderFunc != nil {
+		return 0, leaderFunc()
 	}
 
-	localName := c.memberlist.LocalNode().Name
+	return c.LeaseToken(LeaseLeader)
+}
+
+// memberNames returns the names of the alive members including the local node
+func (c *Cluster) memberNames() []string {
+	members := c.memberlist.Members()
+	names := make([]string, 0, len(members))
 	for _, member := range members {
-		if member.Name < localName {
-			return false
+		names = append(names, member.Name)
+	}
+	return names
+}
+
+// QuorumStatus tells if the local node sees a majority of the cluster
+type QuorumStatus struct {
+	Members   int  `json:"members"` // Alive members including the local node
+	Failed    int  `json:"failed"`  // Failed members still counting towards the quorum
+	Quorum    int  `json:"quorum"`  // Members forming a majority
+	HasQuorum bool `json:"has_quorum"`
+}
+
+// GetQuorumStatus returns whether the alive members form a majority of the
+// alive and the failed members. Failed members count until they rejoin, are
+// removed or the failed node timeout passed, so that the minority side of a
+// partition cannot reach the quorum. Members that left cleanly do not count.
+func (c *Cluster) GetQuorumStatus() QuorumStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.quorumStatus()
+}
+
+// quorumStatus computes the quorum from the member map, as memberlist must not
+// be called from its callbacks. The caller must hold the lock.
+func (c *Cluster) quorumStatus() QuorumStatus {
+	for name, failedAt := range c.failed {
+		if time.Since(failedAt) > c.failedTimeout {
+			delete(c.failed, name)
 		}
 	}
-	return true
+
+	status := QuorumStatus{Members: len(c.nodes), Failed: len(c.failed)}
+	status.Quorum = (status.Members+status.Failed)/2 + 1
+	status.HasQuorum = status.Members >= status.Quorum
+	return status
+}
+
+// checkQuorum logs when the local node loses or regains the quorum.
+// The caller must hold the lock.
+func (c *Cluster) checkQuorum() {
+	status := c.quorumStatus()
+	if status.HasQuorum == !c.degraded {
+		return
+	}
+
+	c.degraded = !status.HasQuorum
+	if c.degraded {
+		c.logger.Warnf("Lost quorum (%d of %d members alive, %d needed), scheduling is frozen",
+			status.Members, status.Members+status.Failed, status.Quorum)
+	} else {
+		c.logger.Infof("Regained quorum (%d of %d members alive)", status.Members, status.Members+status.Failed)
+	}
+}
+
+// RemoveNode removes a failed node from the cluster, so that it no longer
+// counts towards the quorum on any member. Alive nodes have to leave instead.
+// Removing the nodes on the other side of a partition lets both sides reach
+// the quorum, so only nodes that are gone for good should be removed.
+func (c *Cluster) RemoveNode(name string) error {
+	c.mu.Lock()
+	if _, ok := c.nodes[name]; ok {
+		c.mu.Unlock()
+		return fmt.Errorf("node %s is alive, it has to leave the cluster instead", name)
+	}
+	if _, ok := c.failed[name]; !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("node %s is not a failed member", name)
+	}
+	c.forgetNode(name)
+	c.mu.Unlock()
+
+	return c.Broadcast(MessageNodeRemove, []byte(name))
+}
+
+func (c *Cluster) handleNodeRemove(payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forgetNode(string(payload))
+	return nil
+}
+
+// forgetNode drops a failed node from the quorum. The caller must hold the lock.
+func (c *Cluster) forgetNode(name string) {
+	if _, ok := c.failed[name]; !ok {
+		return
+	}
+	delete(c.failed, name)
+	c.logger.Infof("Removed failed node %s from the cluster", name)
+	c.checkQuorum()
+}
+
+// QuorumSize returns the number of members forming a majority
+func (c *Cluster) QuorumSize() int {
+	return c.GetQuorumStatus().Quorum
+}
+
+// HasQuorum checks if the local node is on the majority side of the cluster
+func (c *Cluster) HasQuorum() bool {
+	return c.GetQuorumStatus().HasQuorum
 }
@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestQuorumStatus(t *testing.T) {
+	c := &Cluster{
+		nodes:         map[string]*types.Node{"node-1": {Name: "node-1"}, "node-2": {Name: "node-2"}},
+		failed:        map[string]time.Time{"node-3": time.Now(), "node-4": time.Now().Add(-2 * DefaultFailedNodeTimeout)},
+		failedTimeout: DefaultFailedNodeTimeout,
+		logger:        logrus.New(),
+	}
+
+	// The failed node counts until the timeout, 2 of 3 members form a majority
+	status := c.GetQuorumStatus()
+	if status.Quorum != 2 || !status.HasQuorum || status.Failed != 1 {
+		t.Errorf("Expected quorum of 2 members, got %+v", status)
+	}
+
+	// The minority side of a partition has no quorum
+	c.failed["node-5"] = time.Now()
+	c.failed["node-6"] = time.Now()
+	if c.HasQuorum() {
+		t.Error("Expected no quorum with 2 of 5 members alive")
+	}
+}
+
+func TestRemovedNodesLeaveQuorum(t *testing.T) {
+	c := &Cluster{
+		nodes:         map[string]*types.Node{"node-1": {Name: "node-1"}},
+		failed:        map[string]time.Time{"node-2": time.Now()},
+		failedTimeout: DefaultFailedNodeTimeout,
+		logger:        logrus.New(),
+	}
+	if c.HasQuorum() {
+		t.Fatal("Expected no quorum with 1 of 2 members alive")
+	}
+
+	// Members of the cluster drop the node removed on another member
+	if err := c.handleNodeRemove([]byte("node-2")); err != nil {
+		t.Fatalf("Failed to handle node removal: %v", err)
+	}
+	if status := c.GetQuorumStatus(); !status.HasQuorum || status.Failed != 0 {
+		t.Errorf("Expected quorum without the removed node, got %+v", status)
+	}
+
+	// Alive nodes cannot be removed
+	if err := c.RemoveNode("node-1"); err == nil {
+		t.Error("Expected removing an alive node to fail")
+	}
+	if err := c.RemoveNode("node-3"); err == nil {
+		t.Error("Expected removing an unknown node to fail")
+	}
+}
+
+func TestFailedNodeTimeout(t *testing.T) {
+	c := &Cluster{
+		nodes:         map[string]*types.Node{"node-1": {Name: "node-1"}},
+		failed:        map[string]time.Time{"node-2": time.Now().Add(-2 * time.Minute)},
+		failedTimeout: time.Minute,
+		logger:        logrus.New(),
+	}
+	if status := c.GetQuorumStatus(); !status.HasQuorum || status.Failed != 0 {
+		t.Errorf("Expected the failed node to stop counting after the timeout, got %+v", status)
+	}
+}
@@ -0,0 +1,307 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/your-server-support/podman-swarm/internal/security"
+)
+
+// MessageKeyring is the message type of keyring changes, applied by every node
+const MessageKeyring = "keyring"
+
+// Keyring changes
+const (
+	KeyringInstall = "install"
+	KeyringUse     = "use"
+	KeyringRemove  = "remove"
+)
+
+// keyringPollInterval is how often the keys advertised by the members are
+// checked while waiting for a keyring change to reach them
+const keyringPollInterval = 500 * time.Millisecond
+
+// KeyringChange installs a gossip key, makes it the primary key or removes it.
+// Keys are never gossiped, as the gossip is encrypted with the keys they
+// replace. The members fetch an installed key from the manager that installed
+// it over the admission port, proving they hold the secret of their node.
+type KeyringChange struct {
+	Op          string `json:"op"`
+	Fingerprint string `json:"fingerprint"`
+	Source      string `json:"source,omitempty"` // Manager an installed key is fetched from
+	Key         []byte `json:"-"`                // Installed key, fetched from the source
+}
+
+// KeyringStatus shows which members installed which keys
+type KeyringStatus struct {
+	Primary string              `json:"primary"` // Primary key of the local node
+	Keys    map[string][]string `json:"keys"`    // Nodes by fingerprint of the keys they installed
+}
+
+// Keyring returns the keys installed on the members
+func (c *Cluster) Keyring() (*KeyringStatus, error) {
+	if c.encryptor == nil {
+		return nil, fmt.Errorf("encryption is disabled")
+	}
+
+	status := &KeyringStatus{
+		Primary: c.encryptor.Fingerprints()[0],
+		Keys:    make(map[string][]string),
+	}
+	for _, node := range c.GetNodes() {
+		for _, fingerprint := range node.Keys {
+			status.Keys[fingerprint] = append(status.Keys[fingerprint], node.Name)
+		}
+	}
+	for _, nodes := range status.Keys {
+		slices.Sort(nodes)
+	}
+	return status, nil
+}
+
+// InstallKey installs a gossip key on all members, it is used for decryption
+// only. Keys are installed on managers, which hand them to the members.
+func (c *Cluster) InstallKey(key []byte) error {
+	if len(key) != 32 {
+		return fmt.Errorf("gossip keys must be 32 bytes, got %d", len(key))
+	}
+	if c.admission == nil {
+		return fmt.Errorf("keys are installed on managers, which hand them to the members")
+	}
+	return c.changeKeyring(&KeyringChange{
+		Op:          KeyringInstall,
+		Fingerprint: security.KeyFingerprint(key),
+		Source:      c.localName,
+		Key:         key,
+	})
+}
+
+// UseKey makes an installed key the primary key of all members. Fails unless
+// every member installed it, as the others could not read the traffic anymore.
+func (c *Cluster) UseKey(fingerprint string) error {
+	for _, node := range c.GetNodes() {
+		if !slices.Contains(node.Keys, fingerprint) {
+			return fmt.Errorf("key %s is not installed on node %s", fingerprint, node.Name)
+		}
+	}
+	return c.changeKeyring(&KeyringChange{Op: KeyringUse, Fingerprint: fingerprint})
+}
+
+// RemoveKey removes a key from all members. Fails if a member still uses it
+// as its primary key.
+func (c *Cluster) RemoveKey(fingerprint string) error {
+	for _, node := range c.GetNodes() {
+		if len(node.Keys) > 0 && node.Keys[0] == fingerprint {
+			return fmt.Errorf("key %s is the primary key of node %s", fingerprint, node.Name)
+		}
+	}
+	return c.changeKeyring(&KeyringChange{Op: KeyringRemove, Fingerprint: fingerprint})
+}
+
+// RotateKey replaces the gossip keys by a new key without downtime. The key is
+// installed on all members first and becomes the primary key once every
+// member can decrypt it. Then reencrypt rewrites the data encrypted at rest
+// and the old keys are removed. Members down during the rotation, or started
+// with a key instead of being admitted with a join token, have to be admitted
+// again with a join token. Returns the fingerprint of the new key.
+func (c *Cluster) RotateKey(ctx context.Context, reencrypt func() error) (string, error) {
+	if c.encryptor == nil {
+		return "", fmt.Errorf("encryption is disabled")
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	fingerprint := security.KeyFingerprint(key)
+	oldKeys := c.encryptor.Fingerprints()
+
+	if err := c.InstallKey(key); err != nil {
+		return "", err
+	}
+	if err := c.waitForKeyring(ctx, func(keys []string) bool { return slices.Contains(keys, fingerprint) }); err != nil {
+		return "", fmt.Errorf("key %s was not installed on all members: %w", fingerprint, err)
+	}
+
+	if err := c.UseKey(fingerprint); err != nil {
+		return "", err
+	}
+	if err := c.waitForKeyring(ctx, func(keys []string) bool { return keys[0] == fingerprint }); err != nil {
+		return "", fmt.Errorf("key %s did not become the primary key of all members: %w", fingerprint, err)
+	}
+
+	if err := reencrypt(); err != nil {
+		return "", fmt.Errorf("failed to reencrypt data: %w", err)
+	}
+
+	for _, old := range oldKeys {
+		if err := c.RemoveKey(old); err != nil {
+			return "", err
+		}
+	}
+	return fingerprint, nil
+}
+
+// waitForKeyring waits until the keys advertised by every member satisfy a condition
+func (c *Cluster) waitForKeyring(ctx context.Context, done func(keys []string) bool) error {
+	ticker := time.NewTicker(keyringPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pending := false
+		for _, node := range c.GetNodes() {
+			if len(node.Keys) == 0 || !done(node.Keys) {
+				pending = true
+				break
+			}
+		}
+		if !pending {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// changeKeyring applies a keyring change locally and gossips it to the other members
+func (c *Cluster) changeKeyring(change *KeyringChange) error {
+	if c.encryptor == nil {
+		return fmt.Errorf("encryption is disabled")
+	}
+	if err := c.applyKeyringChange(change); err != nil {
+		return err
+	}
+	if err := c.advertiseKeys(); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed to marshal keyring change: %w", err)
+	}
+	return c.Broadcast(MessageKeyring, payload)
+}
+
+func (c *Cluster) handleKeyringChange(payload []byte) error {
+	var change KeyringChange
+	if err := json.Unmarshal(payload, &change); err != nil {
+		return fmt.Errorf("failed to unmarshal keyring change: %w", err)
+	}
+	if c.encryptor == nil {
+		return nil
+	}
+	if change.Op == KeyringInstall {
+		if c.encryptor.Key(change.Fingerprint) != nil {
+			// Installed before, e.g. the change was relayed back
+			return nil
+		}
+		// Fetching the key from the manager must not block the memberlist goroutine
+		go func() {
+			if err := c.installFetchedKey(&change); err != nil {
+				c.logger.Errorf("Failed to install key %s: %v", change.Fingerprint, err)
+			}
+		}()
+		return nil
+	}
+	if err := c.applyKeyringChange(&change); err != nil {
+		return err
+	}
+
+	// Gossiping the keys waits for acknowledgements, which must not block
+	// the memberlist goroutine
+	go func() {
+		if err := c.advertiseKeys(); err != nil {
+			c.logger.Warnf("Failed to advertise keys: %v", err)
+		}
+	}()
+	return nil
+}
+
+// installFetchedKey fetches an installed key from its manager and installs it
+func (c *Cluster) installFetchedKey(change *KeyringChange) error {
+	if len(c.nodeSecret) == 0 {
+		return fmt.Errorf("the node was not admitted with a join token and cannot fetch keys, admit it again")
+	}
+	manager, err := c.GetNode(change.Source)
+	if err != nil {
+		return err
+	}
+	key, err := requestKey(admissionAddr(manager.Address), c.localName, c.nodeSecret, change.Fingerprint)
+	if err != nil {
+		return fmt.Errorf("failed to fetch key from %s: %w", change.Source, err)
+	}
+
+	change.Key = key
+	if err := c.applyKeyringChange(change); err != nil {
+		return err
+	}
+	return c.advertiseKeys()
+}
+
+// applyKeyringChange changes the keys of the encryptor and of memberlist and saves them
+func (c *Cluster) applyKeyringChange(change *KeyringChange) error {
+	switch change.Op {
+	case KeyringInstall:
+		if security.KeyFingerprint(change.Key) != change.Fingerprint {
+			return fmt.Errorf("fingerprint %s does not match the key", change.Fingerprint)
+		}
+		c.encryptor.InstallKey(change.Key)
+		if c.keyring != nil {
+			if err := c.keyring.AddKey(security.DeriveKey(change.Key)); err != nil {
+				return fmt.Errorf("failed to install key in memberlist: %w", err)
+			}
+		}
+	case KeyringUse:
+		key := c.encryptor.Key(change.Fingerprint)
+		if err := c.encryptor.UseKey(change.Fingerprint); err != nil {
+			return err
+		}
+		if c.keyring != nil {
+			if err := c.keyring.UseKey(key); err != nil {
+				return fmt.Errorf("failed to use key in memberlist: %w", err)
+			}
+		}
+	case KeyringRemove:
+		key := c.encryptor.Key(change.Fingerprint)
+		if key == nil {
+			// Removed before, e.g. the change was relayed back
+			return nil
+		}
+		if err := c.encryptor.RemoveKey(change.Fingerprint); err != nil {
+			return err
+		}
+		if c.keyring != nil {
+			if err := c.keyring.RemoveKey(key); err != nil {
+				return fmt.Errorf("failed to remove key from memberlist: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown keyring change %q", change.Op)
+	}
+
+	c.logger.Infof("Applied keyring change: %s key %s", change.Op, change.Fingerprint)
+
+	if c.keyringFile != "" {
+		if err := security.WriteKeyring(c.keyringFile, c.encryptor.Keys()); err != nil {
+			c.logger.Warnf("Failed to save keyring: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// advertiseKeys gossips the fingerprints of the installed keys to the peers
+func (c *Cluster) advertiseKeys() error {
+	fingerprints := c.encryptor.Fingerprints()
+	return c.UpdateLocalMeta(func(meta *NodeMeta) {
+		meta.Keys = fingerprints
+	})
+}
@@ -0,0 +1,116 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/memberlist"
+
+	"github.com/your-server-support/podman-swarm/internal/security"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	c := newTestCluster(t, "node-1")
+	keyring, err := memberlist.NewKeyring(nil, c.encryptor.Keys()[0])
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	c.keyring = keyring
+	c.keyringFile = filepath.Join(t.TempDir(), "keyring.json")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	c.admission = listener
+	oldKey := c.encryptor.Fingerprints()[0]
+	c.localMeta.Keys = []string{oldKey}
+	c.nodes["node-1"] = &types.Node{Name: "node-1", Keys: []string{oldKey}}
+	c.nodes["node-2"] = &types.Node{Name: "node-2", Keys: []string{oldKey}}
+
+	newKey := bytes.Repeat([]byte("n"), 32)
+	fingerprint := security.KeyFingerprint(newKey)
+	if err := c.InstallKey(newKey); err != nil {
+		t.Fatalf("Failed to install key: %v", err)
+	}
+	if keys := c.nodes["node-1"].Keys; len(keys) != 2 || keys[0] != oldKey || keys[1] != fingerprint {
+		t.Errorf("Expected the new key to be advertised as secondary key, got %v", keys)
+	}
+
+	// The key is not used before every member installed it
+	if err := c.UseKey(fingerprint); err == nil {
+		t.Error("Expected key missing on node-2 not to be usable")
+	}
+	c.nodes["node-2"].Keys = []string{oldKey, fingerprint}
+	if err := c.UseKey(fingerprint); err != nil {
+		t.Fatalf("Failed to use key: %v", err)
+	}
+	if !bytes.Equal(c.keyring.GetPrimaryKey(), newKey) {
+		t.Error("Expected the new key to be the primary key of memberlist")
+	}
+
+	// The old key is not removed before no member uses it anymore
+	if err := c.RemoveKey(oldKey); err == nil {
+		t.Error("Expected primary key of node-2 not to be removable")
+	}
+	c.nodes["node-2"].Keys = []string{fingerprint, oldKey}
+	if err := c.RemoveKey(oldKey); err != nil {
+		t.Fatalf("Failed to remove key: %v", err)
+	}
+	if len(c.keyring.GetKeys()) != 1 {
+		t.Errorf("Expected the old key to be removed from memberlist, got %d keys", len(c.keyring.GetKeys()))
+	}
+
+	saved, err := security.ReadKeyring(c.keyringFile)
+	if err != nil || len(saved) != 1 || !bytes.Equal(saved[0], newKey) {
+		t.Errorf("Expected the keyring file to hold the new key only, got %d keys (%v)", len(saved), err)
+	}
+}
+
+func TestFetchInstalledKey(t *testing.T) {
+	manager := newTestCluster(t, "node-1")
+	manager.tokenManager = security.NewTokenManager([]byte("join-secret"))
+	manager.nodes["node-2"] = &types.Node{Name: "node-2"}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go manager.serveAdmission(listener)
+
+	key := bytes.Repeat([]byte("n"), 32)
+	fingerprint := security.KeyFingerprint(key)
+	manager.encryptor.InstallKey(key)
+
+	// The keyring change gossiped to the members does not carry the key
+	payload, _ := json.Marshal(&KeyringChange{Op: KeyringInstall, Fingerprint: fingerprint, Source: "node-1", Key: key})
+	if bytes.Contains(payload, []byte(base64.StdEncoding.EncodeToString(key))) {
+		t.Errorf("Expected the key not to be gossiped, got %s", payload)
+	}
+
+	// Members fetch it with the secret handed to them on admission
+	addr := listener.Addr().String()
+	fetched, err := requestKey(addr, "node-2", security.NodeSecret([]byte("join-secret"), "node-2"), fingerprint)
+	if err != nil {
+		t.Fatalf("Failed to fetch key: %v", err)
+	}
+	if !bytes.Equal(fetched, key) {
+		t.Error("Expected the installed key to be handed to the member")
+	}
+
+	if _, err := requestKey(addr, "node-2", security.NodeSecret([]byte("other-secret"), "node-2"), fingerprint); err == nil {
+		t.Error("Expected a member of another cluster to be rejected")
+	}
+	if _, err := requestKey(addr, "node-3", security.NodeSecret([]byte("join-secret"), "node-3"), fingerprint); err == nil {
+		t.Error("Expected a node that is not a member to be rejected")
+	}
+	if _, err := requestKey(addr, "node-2", security.NodeSecret([]byte("join-secret"), "node-2"), "0000000000000000"); err == nil {
+		t.Error("Expected a key that is not installed to be rejected")
+	}
+}
@@ -0,0 +1,420 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Leases of the singleton work in the cluster
+const (
+	LeaseLeader   = "leader"    // Reconciliation of workloads
+	LeaseCronJobs = "cron-jobs" // Scheduling of cron jobs and cleanup of their history
+	LeaseBackup   = "backup"    // Periodic backup of the cluster state
+)
+
+// DefaultLeaseTTL is how long a lease is valid without renewal
+const DefaultLeaseTTL = 15 * time.Second
+
+// MessageLease is the message type of the lease protocol
+const MessageLease = "lease"
+
+const (
+	leaseRequest  = "request"
+	leaseResponse = "response"
+	leaseRelease  = "release"
+)
+
+// Lease is the right of a node to run singleton work until it expires.
+//
+// A node holds a lease while a quorum of the members granted it. Each member
+// grants a lease to one holder at a time until its TTL passed since it
+// received the request. The holder counts the TTL from sending the request,
+// so its lease always expires before the grants.
+type Lease struct {
+	Name      string    `json:"name"`
+	Holder    string    `json:"holder"`
+	Token     uint64    `json:"token"` // Fencing token, increases with every new holder
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (l *Lease) valid(now time.Time) bool {
+	return l != nil && now.Before(l.ExpiresAt)
+}
+
+// leaseMessage is a message of the lease protocol
+type leaseMessage struct {
+	Kind      string        `json:"kind"`
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Candidate string        `json:"candidate"`
+	Token     uint64        `json:"token"`
+	TTL       time.Duration `json:"ttl,omitempty"`
+	Granted   bool          `json:"granted,omitempty"`
+	Holder    string        `json:"holder,omitempty"` // Current holder when denied
+}
+
+// leaseManager acquires leases for the local node and grants leases to the members
+type leaseManager struct {
+	local   string
+	send    func(node string, payload []byte) error
+	members func() []string // Alive members including the local node
+	quorum  func() int
+	logger  *logrus.Logger
+
+	mu      sync.Mutex
+	started time.Time
+	grants  map[string]*Lease // Leases granted by this node, by name
+	held    map[string]*Lease // Leases held by this node, by name
+	tokens  map[string]uint64 // Highest fencing token seen, by name
+	pending map[string]chan *leaseMessage
+	running map[string]bool
+	stopCh  chan struct{}
+}
+
+func newLeaseManager(local string, send func(string, []byte) error, members func() []string, quorum func() int, logger *logrus.Logger) *leaseManager {
+	return &leaseManager{
+		local:   local,
+		send:    send,
+		members: members,
+		quorum:  quorum,
+		logger:  logger,
+		started: time.Now(),
+		grants:  make(map[string]*Lease),
+		held:    make(map[string]*Lease),
+		tokens:  make(map[string]uint64),
+		pending: make(map[string]chan *leaseMessage),
+		running: make(map[string]bool),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// start keeps acquiring and renewing a lease in the background
+func (m *leaseManager) start(name string, ttl time.Duration) {
+	m.mu.Lock()
+	if m.running[name] {
+		m.mu.Unlock()
+		return
+	}
+	m.running[name] = true
+	m.mu.Unlock()
+
+	go func() {
+		for {
+			m.acquire(name, ttl)
+
+			// Jitter keeps competing candidates from splitting the grants again
+			wait := ttl/3 + randDuration(ttl/10)
+			select {
+			case <-time.After(wait):
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops renewing leases and releases the held ones
+func (m *leaseManager) stop() {
+	m.mu.Lock()
+	select {
+	case <-m.stopCh:
+		m.mu.Unlock()
+		return
+	default:
+	}
+	close(m.stopCh)
+
+	var held []*Lease
+	for _, lease := range m.held {
+		if lease.valid(time.Now()) {
+			held = append(held, lease)
+		}
+	}
+	m.held = make(map[string]*Lease)
+	m.mu.Unlock()
+
+	for _, lease := range held {
+		m.release(lease.Name, lease.Token)
+	}
+}
+
+// acquire requests or renews a lease from all members. Returns true if the
+// local node holds the lease afterwards.
+func (m *leaseManager) acquire(name string, ttl time.Duration) bool {
+	now := time.Now()
+
+	m.mu.Lock()
+	held := m.held[name]
+	if !held.valid(now) {
+		held = nil
+	}
+	// Leave a lease granted to another node alone until it expired
+	if grant := m.grants[name]; held == nil && grant.valid(now) && grant.Holder != m.local {
+		m.mu.Unlock()
+		return false
+	}
+	token := m.nextToken(name)
+	if held != nil {
+		token = held.Token
+	}
+	id := newMessageID()
+	members := m.members()
+	responses := make(chan *leaseMessage, len(members))
+	m.pending[id] = responses
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, id)
+		m.mu.Unlock()
+	}()
+
+	req := &leaseMessage{Kind: leaseRequest, ID: id, Name: name, Candidate: m.local, Token: token, TTL: ttl}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		m.logger.Warnf("Failed to marshal lease request: %v", err)
+		return false
+	}
+
+	quorum := m.quorum()
+	granted, answered := 0, 0
+	for _, member := range members {
+		if member == m.local {
+			if m.grant(req).Granted {
+				granted++
+			}
+			answered++
+			continue
+		}
+		go func(member string) {
+			if err := m.send(member, payload); err != nil {
+				m.logger.Debugf("Failed to send lease request to %s: %v", member, err)
+				responses <- &leaseMessage{Kind: leaseResponse, ID: id}
+			}
+		}(member)
+	}
+
+	timeout := time.After(ttl / 3)
+	for granted < quorum && answered < len(members) {
+		select {
+		case resp := <-responses:
+			answered++
+			if resp.Granted {
+				granted++
+			}
+		case <-timeout:
+			answered = len(members)
+		case <-m.stopCh:
+			return false
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if granted >= quorum {
+		if held == nil {
+			m.logger.Infof("Acquired lease %s with token %d", name, token)
+		}
+		// Keep a margin for clocks running at different rates
+		m.held[name] = &Lease{Name: name, Holder: m.local, Token: token, ExpiresAt: now.Add(ttl - ttl/10)}
+		return true
+	}
+
+	if held != nil {
+		m.logger.Warnf("Failed to renew lease %s (%d of %d grants)", name, granted, quorum)
+		return held.valid(time.Now())
+	}
+
+	// Give up the partial grants so that another candidate can win
+	if granted > 0 {
+		go m.release(name, token)
+	}
+	return false
+}
+
+// nextToken returns the fencing token for a new holder. The caller must hold the lock.
+func (m *leaseManager) nextToken(name string) uint64 {
+	token := m.tokens[name]
+	if grant, ok := m.grants[name]; ok && grant.Token > token {
+		token = grant.Token
+	}
+	return token + 1
+}
+
+// grant decides on a lease request
+func (m *leaseManager) grant(req *leaseMessage) *leaseMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	resp := &leaseMessage{Kind: leaseResponse, ID: req.ID, Name: req.Name, Candidate: req.Candidate}
+	if req.Token > m.tokens[req.Name] {
+		m.tokens[req.Name] = req.Token
+	}
+
+	// A restarted node may have forgotten the grants it gave before
+	if now.Sub(m.started) < req.TTL {
+		resp.Token = m.nextToken(req.Name) - 1
+		return resp
+	}
+
+	// Deny other candidates while the lease is granted, and stale tokens.
+	// Two candidates may pick the same token, only the first one gets it.
+	grant := m.grants[req.Name]
+	if grant != nil && grant.Holder != req.Candidate && (grant.valid(now) || req.Token <= grant.Token) ||
+		grant != nil && req.Token < grant.Token {
+		resp.Token = grant.Token
+		resp.Holder = grant.Holder
+		return resp
+	}
+
+	m.grants[req.Name] = &Lease{Name: req.Name, Holder: req.Candidate, Token: req.Token, ExpiresAt: now.Add(req.TTL)}
+	resp.Granted = true
+	resp.Token = req.Token
+	return resp
+}
+
+// release gives up a lease on all members
+func (m *leaseManager) release(name string, token uint64) {
+	msg := &leaseMessage{Kind: leaseRelease, ID: newMessageID(), Name: name, Candidate: m.local, Token: token}
+	m.dropGrant(msg)
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	for _, member := range m.members() {
+		if member == m.local {
+			continue
+		}
+		if err := m.send(member, payload); err != nil {
+			m.logger.Debugf("Failed to release lease %s on %s: %v", name, member, err)
+		}
+	}
+}
+
+// dropGrant removes a grant its holder released
+func (m *leaseManager) dropGrant(msg *leaseMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if grant, ok := m.grants[msg.Name]; ok && grant.Holder == msg.Candidate && grant.Token == msg.Token {
+		// Expire the grant, its token stays to order the next holder
+		grant.ExpiresAt = time.Time{}
+	}
+}
+
+// handleMessage handles a message of the lease protocol
+func (m *leaseManager) handleMessage(payload []byte) error {
+	var msg leaseMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return fmt.Errorf("failed to unmarshal lease message: %w", err)
+	}
+
+	switch msg.Kind {
+	case leaseRequest:
+		resp, err := json.Marshal(m.grant(&msg))
+		if err != nil {
+			return fmt.Errorf("failed to marshal lease response: %w", err)
+		}
+		// Do not block the memberlist goroutine on the connection to the candidate
+		go func() {
+			if err := m.send(msg.Candidate, resp); err != nil {
+				m.logger.Debugf("Failed to send lease response to %s: %v", msg.Candidate, err)
+			}
+		}()
+	case leaseResponse:
+		m.mu.Lock()
+		if msg.Token > m.tokens[msg.Name] {
+			m.tokens[msg.Name] = msg.Token
+		}
+		responses, ok := m.pending[msg.ID]
+		m.mu.Unlock()
+		if ok {
+			select {
+			case responses <- &msg:
+			default:
+			}
+		}
+	case leaseRelease:
+		m.dropGrant(&msg)
+	default:
+		return fmt.Errorf("unknown lease message %q", msg.Kind)
+	}
+	return nil
+}
+
+// holds returns the fencing token of a lease held by the local node
+func (m *leaseManager) holds(name string) (uint64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lease := m.held[name]
+	if !lease.valid(time.Now()) {
+		return 0, false
+	}
+	return lease.Token, true
+}
+
+// list returns the valid leases known to the local node, by name
+func (m *leaseManager) list() []*Lease {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	leases := make([]*Lease, 0, len(m.grants))
+	for name, grant := range m.grants {
+		lease := *grant
+		if held := m.held[name]; held.valid(now) {
+			lease = *held
+		} else if !grant.valid(now) {
+			continue
+		}
+		leases = append(leases, &lease)
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].Name < leases[j].Name })
+	return leases
+}
+
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(n.Int64())
+}
+
+// StartLease keeps acquiring and renewing a lease in the background. The
+// lease is held while HoldsLease returns true.
+func (c *Cluster) StartLease(name string, ttl time.Duration) {
+	c.leases.start(name, ttl)
+}
+
+// HoldsLease checks if the local node holds a lease
+func (c *Cluster) HoldsLease(name string) bool {
+	_, ok := c.leases.holds(name)
+	return ok
+}
+
+// LeaseToken returns the fencing token of a lease held by the local node.
+// Work done under the lease can carry the token, so that writes of a former
+// holder with a lower token are recognized.
+func (c *Cluster) LeaseToken(name string) (uint64, bool) {
+	return c.leases.holds(name)
+}
+
+// GetLeases returns the current holders of the leases as seen by the local node
+func (c *Cluster) GetLeases() []*Lease {
+	return c.leases.list()
+}
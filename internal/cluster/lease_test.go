@@ -0,0 +1,148 @@
+package cluster
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const testLeaseTTL = 300 * time.Millisecond
+
+// testLeases connects lease managers through an in-memory transport
+type testLeases struct {
+	mu       sync.Mutex
+	managers map[string]*leaseManager
+	down     map[string]bool
+}
+
+func newTestLeases(names ...string) *testLeases {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	tl := &testLeases{managers: make(map[string]*leaseManager), down: make(map[string]bool)}
+	for _, name := range names {
+		name := name
+		m := newLeaseManager(name,
+			func(to string, payload []byte) error { return tl.send(name, to, payload) },
+			func() []string { return names },
+			func() int { return len(names)/2 + 1 },
+			logger,
+		)
+		// Skip the grace period after the start
+		m.started = time.Now().Add(-time.Hour)
+		tl.managers[name] = m
+	}
+	return tl
+}
+
+// send delivers a message unless one of the nodes is down
+func (tl *testLeases) send(from, to string, payload []byte) error {
+	tl.mu.Lock()
+	m := tl.managers[to]
+	down := tl.down[from] || tl.down[to]
+	tl.mu.Unlock()
+
+	if down {
+		return fmt.Errorf("node %s unreachable", to)
+	}
+	return m.handleMessage(payload)
+}
+
+func (tl *testLeases) setDown(name string, down bool) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.down[name] = down
+}
+
+func TestLeaseExclusive(t *testing.T) {
+	tl := newTestLeases("node-1", "node-2", "node-3")
+
+	if !tl.managers["node-1"].acquire(LeaseLeader, testLeaseTTL) {
+		t.Fatal("Expected node-1 to acquire the lease")
+	}
+	token, ok := tl.managers["node-1"].holds(LeaseLeader)
+	if !ok || token != 1 {
+		t.Errorf("Expected lease with token 1, got %d (held: %t)", token, ok)
+	}
+
+	if tl.managers["node-2"].acquire(LeaseLeader, testLeaseTTL) {
+		t.Error("Expected node-2 not to acquire a lease held by node-1")
+	}
+
+	// Renewals keep the token
+	if !tl.managers["node-1"].acquire(LeaseLeader, testLeaseTTL) {
+		t.Fatal("Expected node-1 to renew the lease")
+	}
+	if token, _ := tl.managers["node-1"].holds(LeaseLeader); token != 1 {
+		t.Errorf("Expected renewal to keep token 1, got %d", token)
+	}
+
+	leases := tl.managers["node-3"].list()
+	if len(leases) != 1 || leases[0].Holder != "node-1" {
+		t.Errorf("Expected node-3 to see node-1 holding the lease, got %v", leases)
+	}
+}
+
+func TestLeaseFailover(t *testing.T) {
+	tl := newTestLeases("node-1", "node-2", "node-3")
+
+	if !tl.managers["node-1"].acquire(LeaseLeader, testLeaseTTL) {
+		t.Fatal("Expected node-1 to acquire the lease")
+	}
+
+	// node-1 is cut off, it cannot renew while the others wait for the grants to expire
+	tl.setDown("node-1", true)
+	if tl.managers["node-2"].acquire(LeaseLeader, testLeaseTTL) {
+		t.Error("Expected node-2 not to acquire the lease before it expired")
+	}
+	tl.managers["node-1"].acquire(LeaseLeader, testLeaseTTL)
+
+	time.Sleep(testLeaseTTL)
+	if _, ok := tl.managers["node-1"].holds(LeaseLeader); ok {
+		t.Error("Expected the lease of node-1 to expire without quorum")
+	}
+	if !tl.managers["node-2"].acquire(LeaseLeader, testLeaseTTL) {
+		t.Fatal("Expected node-2 to acquire the expired lease")
+	}
+	if token, _ := tl.managers["node-2"].holds(LeaseLeader); token != 2 {
+		t.Errorf("Expected the fencing token to increase to 2, got %d", token)
+	}
+
+	// The former holder rejoins and does not take the lease back
+	tl.setDown("node-1", false)
+	if tl.managers["node-1"].acquire(LeaseLeader, testLeaseTTL) {
+		t.Error("Expected node-1 not to take the lease back")
+	}
+}
+
+func TestLeaseRelease(t *testing.T) {
+	tl := newTestLeases("node-1", "node-2", "node-3")
+
+	if !tl.managers["node-1"].acquire(LeaseBackup, testLeaseTTL) {
+		t.Fatal("Expected node-1 to acquire the lease")
+	}
+	// Let the requests still in flight after reaching the quorum arrive first
+	time.Sleep(50 * time.Millisecond)
+	tl.managers["node-1"].stop()
+
+	if !tl.managers["node-2"].acquire(LeaseBackup, testLeaseTTL) {
+		t.Error("Expected node-2 to acquire the released lease right away")
+	}
+}
+
+func TestLeaseGracePeriod(t *testing.T) {
+	tl := newTestLeases("node-1")
+	tl.managers["node-1"].started = time.Now()
+
+	// A restarted node does not grant leases it may have granted to others before
+	if tl.managers["node-1"].acquire(LeaseLeader, testLeaseTTL) {
+		t.Error("Expected no grants right after the start")
+	}
+	time.Sleep(testLeaseTTL)
+	if !tl.managers["node-1"].acquire(LeaseLeader, testLeaseTTL) {
+		t.Error("Expected the lease to be granted after the grace period")
+	}
+}
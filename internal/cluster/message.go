@@ -0,0 +1,240 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// Types of the messages exchanged between the nodes
+const (
+	MessageServiceUpdate = "service_update" // Endpoint changes of services
+	MessageState         = "state"          // Deltas of the cluster state
+	MessageRaft          = "raft"           // Consensus log replication
+)
+
+// envelopeVersion is the version of the envelope format. Messages of newer
+// versions are dropped, as their format may have changed.
+const envelopeVersion = 1
+
+// seenTTL is how long the ids of received messages are remembered to drop
+// duplicates. Gossiped messages stop circulating well before.
+const seenTTL = 5 * time.Minute
+
+// maxPacketSize is the largest message sent over UDP, memberlist drops the
+// rest of larger packets
+const maxPacketSize = 1200
+
+// MessageHandler handles the payload of a message type
+type MessageHandler func(payload []byte) error
+
+// Envelope wraps every message exchanged between the nodes
+type Envelope struct {
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Sender  string          `json:"sender"`
+	ID      string          `json:"id"`
+	Gossip  bool            `json:"gossip,omitempty"` // Relayed by the receivers until all members have it
+	Payload json.RawMessage `json:"payload"`
+}
+
+// broadcast is a gossiped message in the transmit queue
+type broadcast struct {
+	msg []byte
+}
+
+func (b *broadcast) Invalidates(other memberlist.Broadcast) bool {
+	return false
+}
+
+func (b *broadcast) Message() []byte {
+	return b.msg
+}
+
+func (b *broadcast) Finished() {}
+
+// UniqueBroadcast marks every message as distinct, so that the queue does not
+// compare them
+func (b *broadcast) UniqueBroadcast() {}
+
+// RegisterHandler sets the handler of a message type. The handler runs on
+// the memberlist goroutine and must not block for long.
+func (c *Cluster) RegisterHandler(msgType string, handler MessageHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[msgType] = handler
+}
+
+// Broadcast sends a message to all other members. Messages fitting into a
+// UDP packet are gossiped along with the memberlist traffic, larger messages
+// are sent to each member over TCP.
+func (c *Cluster) Broadcast(msgType string, payload []byte) error {
+	env := c.newEnvelope(msgType, payload)
+	env.Gossip = true
+	data, err := c.encode(env)
+	if err != nil {
+		return err
+	}
+
+	if len(data) <= maxPacketSize {
+		// Drop the message when peers relay it back
+		c.firstSeen(env.ID)
+		c.broadcasts.QueueBroadcast(&broadcast{msg: data})
+		return nil
+	}
+
+	env.Gossip = false
+	if data, err = c.encode(env); err != nil {
+		return err
+	}
+
+	localName := c.memberlist.LocalNode().Name
+	var errs []error
+	for _, member := range c.memberlist.Members() {
+		if member.Name == localName {
+			continue
+		}
+		if err := c.memberlist.SendReliable(member, data); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send message to %s: %w", member.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Broadcaster returns a function broadcasting messages of a type
+func (c *Cluster) Broadcaster(msgType string) func([]byte) error {
+	return func(payload []byte) error {
+		return c.Broadcast(msgType, payload)
+	}
+}
+
+// SendTo sends a message reliably to a single cluster member
+func (c *Cluster) SendTo(msgType, nodeName string, payload []byte) error {
+	var target *memberlist.Node
+	for _, member := range c.memberlist.Members() {
+		if member.Name == nodeName {
+			target = member
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("node %s not found", nodeName)
+	}
+
+	data, err := c.encode(c.newEnvelope(msgType, payload))
+	if err != nil {
+		return err
+	}
+
+	return c.memberlist.SendReliable(target, data)
+}
+
+func (c *Cluster) newEnvelope(msgType string, payload []byte) *Envelope {
+	return &Envelope{
+		Type:    msgType,
+		Version: envelopeVersion,
+		Sender:  c.localName,
+		ID:      newMessageID(),
+		Payload: payload,
+	}
+}
+
+func newMessageID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// encode marshals an envelope and encrypts it if encryption is enabled
+func (c *Cluster) encode(env *Envelope) ([]byte, error) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s message: %w", env.Type, err)
+	}
+
+	if c.encryptor == nil {
+		return data, nil
+	}
+
+	encrypted, err := c.encryptor.Encrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	return encrypted, nil
+}
+
+// errDecrypt is returned for messages that could not be decrypted, e.g.
+// because the sender uses another cluster key
+var errDecrypt = errors.New("failed to decrypt message")
+
+// handleMessage dispatches a received message to the handler of its type.
+// Gossiped messages are relayed unchanged to reach members the sender missed.
+func (c *Cluster) handleMessage(msg []byte) error {
+	data := msg
+	if c.encryptor != nil {
+		decrypted, err := c.encryptor.Decrypt(msg)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errDecrypt, err)
+		}
+		data = decrypted
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	if env.Version > envelopeVersion {
+		c.logger.Debugf("Dropping %s message of newer version %d from %s", env.Type, env.Version, env.Sender)
+		return nil
+	}
+	if !c.firstSeen(env.ID) {
+		return nil
+	}
+
+	if env.Gossip {
+		c.broadcasts.QueueBroadcast(&broadcast{msg: append([]byte(nil), msg...)})
+	}
+
+	c.mu.RLock()
+	handler, ok := c.handlers[env.Type]
+	c.mu.RUnlock()
+
+	if !ok {
+		c.logger.Debugf("No handler for %s message from %s", env.Type, env.Sender)
+		return nil
+	}
+
+	c.logger.Debugf("Received %s message %s from %s", env.Type, env.ID, env.Sender)
+	if err := handler(env.Payload); err != nil {
+		return fmt.Errorf("failed to handle %s message from %s: %w", env.Type, env.Sender, err)
+	}
+	return nil
+}
+
+// firstSeen records a message id. Returns false if the message was seen before.
+func (c *Cluster) firstSeen(id string) bool {
+	c.seenMu.Lock()
+	defer c.seenMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.seenPruned) > seenTTL {
+		for seenID, seenAt := range c.seen {
+			if now.Sub(seenAt) > seenTTL {
+				delete(c.seen, seenID)
+			}
+		}
+		c.seenPruned = now
+	}
+
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+	c.seen[id] = now
+	return true
+}
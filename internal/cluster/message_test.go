@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/sirupsen/logrus"
+
+	"github.com/your-server-support/podman-swarm/internal/security"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// newTestCluster returns a cluster that is not connected to memberlist
+func newTestCluster(t *testing.T, name string) *Cluster {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	encryptor, err := security.NewEncryptor(bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+
+	return &Cluster{
+		nodes:      make(map[string]*types.Node),
+		localName:  name,
+		handlers:   make(map[string]MessageHandler),
+		seen:       make(map[string]time.Time),
+		broadcasts: &memberlist.TransmitLimitedQueue{NumNodes: func() int { return 3 }, RetransmitMult: 4},
+		encryptor:  encryptor,
+		logger:     logger,
+	}
+}
+
+func TestHandleMessage(t *testing.T) {
+	sender := newTestCluster(t, "node-1")
+	receiver := newTestCluster(t, "node-2")
+
+	var received []string
+	receiver.RegisterHandler(MessageState, func(payload []byte) error {
+		received = append(received, string(payload))
+		return nil
+	})
+
+	env := sender.newEnvelope(MessageState, []byte(`{"type":"state_delta"}`))
+	env.Gossip = true
+	data, err := sender.encode(env)
+	if err != nil {
+		t.Fatalf("Failed to encode message: %v", err)
+	}
+
+	// Duplicates are dropped, gossiped messages are relayed once
+	for i := 0; i < 2; i++ {
+		if err := receiver.handleMessage(data); err != nil {
+			t.Fatalf("Failed to handle message: %v", err)
+		}
+	}
+	if len(received) != 1 || received[0] != `{"type":"state_delta"}` {
+		t.Errorf("Expected the payload to be handled once, got %v", received)
+	}
+	if queued := receiver.broadcasts.NumQueued(); queued != 1 {
+		t.Errorf("Expected the message to be relayed, %d queued", queued)
+	}
+
+	// Direct messages are not relayed
+	data, _ = sender.encode(sender.newEnvelope(MessageState, []byte(`{}`)))
+	receiver.handleMessage(data)
+	if queued := receiver.broadcasts.NumQueued(); queued != 1 {
+		t.Errorf("Expected direct message not to be relayed, %d queued", queued)
+	}
+
+	// Messages of unknown types and newer versions are ignored
+	data, _ = sender.encode(sender.newEnvelope("unknown", []byte(`{}`)))
+	if err := receiver.handleMessage(data); err != nil {
+		t.Errorf("Expected message of unknown type to be ignored, got %v", err)
+	}
+	env = sender.newEnvelope(MessageState, []byte(`{}`))
+	env.Version = envelopeVersion + 1
+	data, _ = sender.encode(env)
+	receiver.handleMessage(data)
+	if len(received) != 2 {
+		t.Errorf("Expected message of newer version to be dropped, got %v", received)
+	}
+}
+
+func TestHandleUnencryptedMessage(t *testing.T) {
+	receiver := newTestCluster(t, "node-2")
+	if err := receiver.handleMessage([]byte(`{"type":"state"}`)); err == nil {
+		t.Error("Expected unencrypted message to be rejected")
+	}
+}
+
+func TestHandleMessageDecryptFailure(t *testing.T) {
+	receiver := newTestCluster(t, "node-2")
+
+	if err := receiver.handleMessage([]byte("not encrypted with the cluster key")); !errors.Is(err, errDecrypt) {
+		t.Errorf("Expected a decryption error, got %v", err)
+	}
+}
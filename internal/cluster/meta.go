@@ -0,0 +1,338 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// MessageNodePatch is the message type of label and taint changes sent to the node they apply to
+const MessageNodePatch = "node_patch"
+
+// Well-known labels set on every node
+const (
+	LabelHostname = "kubernetes.io/hostname"
+	LabelOS       = "kubernetes.io/os"
+	LabelArch     = "kubernetes.io/arch"
+	// LabelRolePrefix followed by the role name marks the roles of a node
+	LabelRolePrefix = "node-role.kubernetes.io/"
+)
+
+// TaintUnschedulable marks a cordoned node, no new pods are scheduled to it
+const TaintUnschedulable = "node.kubernetes.io/unschedulable"
+
+// ErrMetaTooLarge is returned for changes making the node metadata exceed memberlist.MetaMaxSize
+var ErrMetaTooLarge = errors.New("node metadata too large")
+
+// metaUpdateTimeout bounds how long a metadata change waits to be gossiped
+const metaUpdateTimeout = 5 * time.Second
+
+// NodeMeta is the metadata a node advertises to its peers through memberlist.
+// It has to fit into memberlist.MetaMaxSize bytes.
+type NodeMeta struct {
+	Capacity      corev1.ResourceList `json:"capacity,omitempty"`
+	Allocatable   corev1.ResourceList `json:"allocatable,omitempty"`
+	Labels        map[string]string   `json:"labels,omitempty"`
+	Taints        []corev1.Taint      `json:"taints,omitempty"`
+	APIAddress    string              `json:"api,omitempty"`
+	AgentVersion  string              `json:"version,omitempty"`
+	OS            string              `json:"os,omitempty"`
+	Arch          string              `json:"arch,omitempty"`
+	PodmanVersion string              `json:"podman,omitempty"`
+	Keys          []string            `json:"keys,omitempty"` // Fingerprints of the gossip keys, the primary key first
+}
+
+// applyTo copies the metadata into the entry of its node
+func (m *NodeMeta) applyTo(node *types.Node) {
+	node.Capacity = m.Capacity
+	node.Allocatable = m.Allocatable
+	node.Labels = maps.Clone(m.Labels)
+	if node.Labels == nil {
+		node.Labels = make(map[string]string)
+	}
+	node.Taints = append([]corev1.Taint(nil), m.Taints...)
+	node.APIAddress = m.APIAddress
+	node.AgentVersion = m.AgentVersion
+	node.OS = m.OS
+	node.Arch = m.Arch
+	node.PodmanVersion = m.PodmanVersion
+	node.Keys = append([]string(nil), m.Keys...)
+}
+
+// metaOf returns the metadata a node advertised
+func metaOf(node *types.Node) NodeMeta {
+	meta := NodeMeta{
+		Capacity:      node.Capacity,
+		Allocatable:   node.Allocatable,
+		APIAddress:    node.APIAddress,
+		AgentVersion:  node.AgentVersion,
+		OS:            node.OS,
+		Arch:          node.Arch,
+		PodmanVersion: node.PodmanVersion,
+	}
+	if len(node.Labels) > 0 {
+		meta.Labels = node.Labels
+	}
+	if len(node.Taints) > 0 {
+		meta.Taints = node.Taints
+	}
+	if len(node.Keys) > 0 {
+		meta.Keys = node.Keys
+	}
+	return meta.clone()
+}
+
+// encode marshals the metadata, failing if it does not fit into
+// memberlist.MetaMaxSize bytes
+func (m *NodeMeta) encode() ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal node metadata: %w", err)
+	}
+	if len(data) > memberlist.MetaMaxSize {
+		return nil, fmt.Errorf("%w: %d bytes exceed %d bytes, remove labels or taints", ErrMetaTooLarge, len(data), memberlist.MetaMaxSize)
+	}
+	return data, nil
+}
+
+// withoutCustomLabels returns the metadata with only the well-known labels and
+// the roles, which keeps the resources, taints and keys peers rely on
+func (m *NodeMeta) withoutCustomLabels() NodeMeta {
+	trimmed := m.clone()
+	for key := range trimmed.Labels {
+		switch {
+		case key == LabelHostname, key == LabelOS, key == LabelArch, strings.HasPrefix(key, LabelRolePrefix):
+		default:
+			delete(trimmed.Labels, key)
+		}
+	}
+	return trimmed
+}
+
+// clone returns a deep copy of the metadata
+func (m *NodeMeta) clone() NodeMeta {
+	cloned := *m
+	cloned.Labels = maps.Clone(m.Labels)
+	cloned.Taints = append([]corev1.Taint(nil), m.Taints...)
+	cloned.Keys = append([]string(nil), m.Keys...)
+	return cloned
+}
+
+func defaultLabels(nodeName string) map[string]string {
+	return map[string]string{
+		LabelHostname: nodeName,
+		LabelOS:       runtime.GOOS,
+		LabelArch:     runtime.GOARCH,
+	}
+}
+
+// NodePatch is a change of the labels and taints of a node. Labels with a nil
+// value are removed, Taints replaces all taints when set.
+type NodePatch struct {
+	Labels        map[string]*string `json:"labels,omitempty"`
+	Taints        *[]corev1.Taint    `json:"taints,omitempty"`
+	Unschedulable *bool              `json:"unschedulable,omitempty"` // Cordons or uncordons the node
+}
+
+// Validate checks the label keys and values
+func (p *NodePatch) Validate() error {
+	for key, value := range p.Labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, ", "))
+		}
+		if value == nil {
+			continue
+		}
+		if errs := validation.IsValidLabelValue(*value); len(errs) > 0 {
+			return fmt.Errorf("invalid value of label %s: %s", key, strings.Join(errs, ", "))
+		}
+	}
+
+	if p.Taints == nil {
+		return nil
+	}
+	for _, taint := range *p.Taints {
+		if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+			return fmt.Errorf("invalid taint key %q: %s", taint.Key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+			return fmt.Errorf("invalid value of taint %s: %s", taint.Key, strings.Join(errs, ", "))
+		}
+		switch taint.Effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return fmt.Errorf("invalid effect %q of taint %s", taint.Effect, taint.Key)
+		}
+	}
+	return nil
+}
+
+// ParseLabels parses comma-separated key=value labels, and roles that become
+// node-role.kubernetes.io/<role> labels
+func ParseLabels(labels, roles string) (map[string]string, error) {
+	patch := &NodePatch{Labels: make(map[string]*string)}
+	for _, label := range strings.Split(labels, ",") {
+		if label = strings.TrimSpace(label); label == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(label, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", label)
+		}
+		patch.Labels[strings.TrimSpace(key)] = &value
+	}
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			empty := ""
+			patch.Labels[LabelRolePrefix+role] = &empty
+		}
+	}
+
+	if err := patch.Validate(); err != nil {
+		return nil, err
+	}
+
+	parsed := make(map[string]string, len(patch.Labels))
+	for key, value := range patch.Labels {
+		parsed[key] = *value
+	}
+	return parsed, nil
+}
+
+// UpdateLocalMeta changes the metadata of the local node and gossips it to the
+// peers. Fails if the metadata no longer fits into memberlist.MetaMaxSize.
+func (c *Cluster) UpdateLocalMeta(update func(meta *NodeMeta)) error {
+	c.mu.Lock()
+	meta := c.localMeta.clone()
+	update(&meta)
+
+	if _, err := meta.encode(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+
+	c.localMeta = meta
+	if node, ok := c.nodes[c.localName]; ok {
+		meta.applyTo(node)
+	}
+	c.mu.Unlock()
+
+	if c.memberlist == nil {
+		return nil
+	}
+	if err := c.memberlist.UpdateNode(metaUpdateTimeout); err != nil {
+		return fmt.Errorf("failed to gossip node metadata: %w", err)
+	}
+	return nil
+}
+
+// PatchNode changes the labels and taints of a node. Changes of other nodes are sent to
+// them, as every node advertises its own labels. Changes making the metadata of
+// the node exceed memberlist.MetaMaxSize are rejected.
+func (c *Cluster) PatchNode(nodeName string, patch *NodePatch) error {
+	if err := patch.Validate(); err != nil {
+		return err
+	}
+
+	if nodeName == c.localName {
+		return c.patchLocalNode(patch)
+	}
+
+	// The node rejects the change as well, check it here to report it
+	c.mu.RLock()
+	node, ok := c.nodes[nodeName]
+	var meta NodeMeta
+	if ok {
+		meta = metaOf(node)
+	}
+	c.mu.RUnlock()
+	if ok {
+		patch.applyTo(&meta)
+		if _, err := meta.encode(); err != nil {
+			return err
+		}
+	}
+
+	payload, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal node patch: %w", err)
+	}
+	return c.SendTo(MessageNodePatch, nodeName, payload)
+}
+
+func (c *Cluster) patchLocalNode(patch *NodePatch) error {
+	return c.UpdateLocalMeta(patch.applyTo)
+}
+
+// applyTo changes the labels and taints of the metadata
+func (p *NodePatch) applyTo(meta *NodeMeta) {
+	if meta.Labels == nil {
+		meta.Labels = make(map[string]string)
+	}
+	for key, value := range p.Labels {
+		if value == nil {
+			delete(meta.Labels, key)
+		} else {
+			meta.Labels[key] = *value
+		}
+	}
+
+	if p.Taints != nil {
+		meta.Taints = append([]corev1.Taint(nil), (*p.Taints)...)
+	}
+	if p.Unschedulable != nil {
+		meta.Taints = removeTaint(meta.Taints, TaintUnschedulable)
+		if *p.Unschedulable {
+			meta.Taints = append(meta.Taints, corev1.Taint{Key: TaintUnschedulable, Effect: corev1.TaintEffectNoSchedule})
+		}
+	}
+	// Pods tolerating a NoExecute taint for a while are evicted relative to its time
+	now := metav1.Now()
+	for i := range meta.Taints {
+		if meta.Taints[i].Effect == corev1.TaintEffectNoExecute && meta.Taints[i].TimeAdded == nil {
+			meta.Taints[i].TimeAdded = &now
+		}
+	}
+}
+
+// removeTaint returns the taints without those with the given key
+func removeTaint(taints []corev1.Taint, key string) []corev1.Taint {
+	kept := taints[:0]
+	for _, taint := range taints {
+		if taint.Key != key {
+			kept = append(kept, taint)
+		}
+	}
+	return kept
+}
+
+// handleNodePatch applies a change sent by another node
+func (c *Cluster) handleNodePatch(payload []byte) error {
+	var patch NodePatch
+	if err := json.Unmarshal(payload, &patch); err != nil {
+		return fmt.Errorf("failed to unmarshal node patch: %w", err)
+	}
+	if err := patch.Validate(); err != nil {
+		return err
+	}
+
+	// Gossiping the update waits for acknowledgements, which must not block
+	// the memberlist goroutine
+	go func() {
+		if err := c.patchLocalNode(&patch); err != nil {
+			c.logger.Warnf("Failed to apply node patch: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/memberlist"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels("zone=eu-1, disk=ssd", "worker,ingress")
+	if err != nil {
+		t.Fatalf("Failed to parse labels: %v", err)
+	}
+	expected := map[string]string{
+		"zone":                            "eu-1",
+		"disk":                            "ssd",
+		"node-role.kubernetes.io/worker":  "",
+		"node-role.kubernetes.io/ingress": "",
+	}
+	if len(labels) != len(expected) {
+		t.Fatalf("Expected %d labels, got %v", len(expected), labels)
+	}
+	for key, value := range expected {
+		if labels[key] != value {
+			t.Errorf("Expected label %s=%q, got %q", key, value, labels[key])
+		}
+	}
+
+	for _, invalid := range []string{"zone", "zone=eu 1", "-zone=eu"} {
+		if _, err := ParseLabels(invalid, ""); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestPatchLocalNode(t *testing.T) {
+	c := newTestCluster(t, "node-1")
+	c.localMeta = NodeMeta{Labels: defaultLabels("node-1"), AgentVersion: "v1.0.0"}
+	c.nodes["node-1"] = &types.Node{Name: "node-1"}
+
+	zone := "eu-1"
+	patch := &NodePatch{Labels: map[string]*string{"zone": &zone, LabelOS: nil}}
+	if err := c.PatchNode("node-1", patch); err != nil {
+		t.Fatalf("Failed to patch node: %v", err)
+	}
+
+	node := c.nodes["node-1"]
+	if node.Labels["zone"] != "eu-1" || node.Labels[LabelHostname] != "node-1" {
+		t.Errorf("Expected the labels to be merged, got %v", node.Labels)
+	}
+	if _, ok := node.Labels[LabelOS]; ok {
+		t.Errorf("Expected label %s to be removed", LabelOS)
+	}
+	if node.AgentVersion != "v1.0.0" {
+		t.Errorf("Expected the rest of the metadata to be kept, got version %q", node.AgentVersion)
+	}
+
+	// The metadata has to fit into a memberlist packet
+	large := strings.Repeat("x", 63)
+	patch = &NodePatch{Labels: make(map[string]*string)}
+	for i := 0; i < 10; i++ {
+		patch.Labels[strings.Repeat("k", i+1)] = &large
+	}
+	if err := c.PatchNode("node-1", patch); err == nil {
+		t.Error("Expected metadata exceeding the size limit to be rejected")
+	}
+	if len(c.localMeta.Labels) != 3 {
+		t.Errorf("Expected the rejected patch not to be applied, got %v", c.localMeta.Labels)
+	}
+}
+
+func TestCordonLocalNode(t *testing.T) {
+	c := newTestCluster(t, "node-1")
+	c.localMeta = NodeMeta{Taints: []corev1.Taint{{Key: "maintenance", Effect: corev1.TaintEffectNoExecute}}}
+	c.nodes["node-1"] = &types.Node{Name: "node-1"}
+
+	unschedulable := true
+	if err := c.PatchNode("node-1", &NodePatch{Unschedulable: &unschedulable}); err != nil {
+		t.Fatalf("Failed to cordon node: %v", err)
+	}
+	taints := c.nodes["node-1"].Taints
+	if len(taints) != 2 || taints[1].Key != TaintUnschedulable || taints[1].Effect != corev1.TaintEffectNoSchedule {
+		t.Fatalf("Expected the unschedulable taint to be added, got %v", taints)
+	}
+	if taints[0].TimeAdded == nil {
+		t.Error("Expected the NoExecute taint to get the time it was added")
+	}
+
+	// Cordoning twice keeps a single taint, uncordoning removes it
+	c.PatchNode("node-1", &NodePatch{Unschedulable: &unschedulable})
+	unschedulable = false
+	if err := c.PatchNode("node-1", &NodePatch{Unschedulable: &unschedulable}); err != nil {
+		t.Fatalf("Failed to uncordon node: %v", err)
+	}
+	if taints := c.nodes["node-1"].Taints; len(taints) != 1 || taints[0].Key != "maintenance" {
+		t.Errorf("Expected only the maintenance taint to remain, got %v", taints)
+	}
+
+	invalid := []corev1.Taint{{Key: "maintenance", Effect: "Sometimes"}}
+	if err := c.PatchNode("node-1", &NodePatch{Taints: &invalid}); err == nil {
+		t.Error("Expected a taint with an unknown effect to be rejected")
+	}
+}
+
+func TestNodeMetaSizeLimit(t *testing.T) {
+	c := newTestCluster(t, "node-1")
+	c.nodes["node-2"] = &types.Node{Name: "node-2", Labels: defaultLabels("node-2")}
+
+	// Patches of other nodes are checked before they are sent
+	large := strings.Repeat("x", 63)
+	patch := &NodePatch{Labels: make(map[string]*string)}
+	for i := 0; i < 10; i++ {
+		patch.Labels[strings.Repeat("k", i+1)] = &large
+	}
+	if err := c.PatchNode("node-2", patch); !errors.Is(err, ErrMetaTooLarge) {
+		t.Error("Expected a patch of another node exceeding the size limit to be rejected")
+	}
+
+	// A smaller limit drops the custom labels, not the metadata peers rely on
+	c.localMeta = NodeMeta{Labels: defaultLabels("node-1"), Keys: []string{"abc"}, AgentVersion: "v1.0.0"}
+	c.localMeta.Labels["zone"] = large
+	d := &delegate{cluster: c, logger: c.logger}
+	full := d.NodeMeta(memberlist.MetaMaxSize)
+	data := d.NodeMeta(len(full) - 1)
+	var meta NodeMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("Expected trimmed metadata, got %q: %v", data, err)
+	}
+	if _, ok := meta.Labels["zone"]; ok || meta.Labels[LabelHostname] != "node-1" || len(meta.Keys) != 1 {
+		t.Errorf("Expected only the custom labels to be dropped, got %+v", meta)
+	}
+}
@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// DetectCapacity returns the CPU and memory capacity of the local host
+func DetectCapacity() corev1.ResourceList {
+	capacity := corev1.ResourceList{
+		corev1.ResourceCPU: *resource.NewQuantity(int64(runtime.NumCPU()), resource.DecimalSI),
+	}
+
+	if memory, err := readMemTotal("/proc/meminfo"); err == nil {
+		capacity[corev1.ResourceMemory] = *resource.NewQuantity(memory, resource.BinarySI)
+	}
+
+	return capacity
+}
+
+// readMemTotal reads the total memory in bytes from a meminfo file
+func readMemTotal(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			var kb int64
+			if _, err := fmt.Sscanf(fields[1], "%d", &kb); err != nil {
+				return 0, fmt.Errorf("invalid MemTotal value: %w", err)
+			}
+			return kb * 1024, nil
+		}
+	}
+
+	return 0, fmt.Errorf("MemTotal not found in %s", path)
+}
@@ -8,25 +8,38 @@ import (
 )
 
 type Config struct {
-	NodeName      string
-	BindAddr      string
-	APIAddr       string
-	PodmanSocket  string
-	DataDir       string
-	JoinAddrs     []string
-	JoinToken     string
-	EncryptionKey string
-	TLSCertFile   string
-	TLSKeyFile    string
-	TLSCAFile     string
-	TLSSkipVerify bool
-	IngressPort      int
-	EnableIngress    bool
-	DNSPort          int
-	ClusterDomain    string
-	UpstreamDNS      []string // Upstream DNS servers for forwarding non-cluster queries
-	APIToken         string   // API token for authentication
-	EnableAPIAuth    bool     // Enable API authentication
+	NodeName          string
+	BindAddr          string
+	APIAddr           string
+	PodmanSocket      string
+	DataDir           string
+	JoinAddrs         []string
+	JoinToken         string // Token presented to a manager on the first join
+	JoinTokenTTL      int    // Hours the join tokens generated at startup are valid
+	EncryptionKey     string
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSCAFile         string
+	TLSSkipVerify     bool
+	IngressPort       int
+	EnableIngress     bool
+	DNSPort           int
+	ClusterDomain     string
+	UpstreamDNS       []string // Upstream DNS servers for forwarding non-cluster queries
+	APIToken          string   // API token for authentication
+	EnableAPIAuth     bool     // Enable API authentication
+	NodeCPU           string   // CPU capacity advertised by this node, detected if empty
+	NodeMemory        string   // Memory capacity advertised by this node, detected if empty
+	NodeLabels        string   // Comma-separated key=value labels of this node
+	NodeRoles         string   // Comma-separated roles of this node, added as node-role.kubernetes.io/<role> labels
+	SchedulerStrategy string   // Node scoring strategy: least-allocated or most-allocated
+	EnableConsensus   bool     // Replicate the cluster state through a Raft log instead of gossip
+	RaftVoters        int      // Maximum number of Raft voters, chosen automatically among the nodes
+	FailedNodeTimeout int      // Minutes failed nodes count towards the quorum unless they are removed
+	DrainOnShutdown   bool     // Move pods to other nodes before the agent exits
+	ShutdownTimeout   int      // Seconds the shutdown may take before pods are killed
+	AuditMaxSize      int      // Megabytes the audit log may grow to before it is rotated
+	AuditMaxBackups   int      // Rotated audit logs kept
 }
 
 func Load() *Config {
@@ -40,6 +53,7 @@ func Load() *Config {
 	flag.StringVar(&cfg.DataDir, "data-dir", getEnv("DATA_DIR", "/var/lib/podman-swarm"), "Data directory")
 	flag.StringVar(&joinStr, "join", getEnv("JOIN", ""), "Comma-separated list of addresses to join")
 	flag.StringVar(&cfg.JoinToken, "join-token", getEnv("JOIN_TOKEN", ""), "Join token for cluster authentication")
+	flag.IntVar(&cfg.JoinTokenTTL, "join-token-ttl", getEnvInt("JOIN_TOKEN_TTL", 24), "Hours the join tokens generated at startup are valid")
 	flag.StringVar(&cfg.EncryptionKey, "encryption-key", getEnv("ENCRYPTION_KEY", ""), "Encryption key for cluster communication")
 	flag.StringVar(&cfg.TLSCertFile, "tls-cert", getEnv("TLS_CERT", ""), "TLS certificate file")
 	flag.StringVar(&cfg.TLSKeyFile, "tls-key", getEnv("TLS_KEY", ""), "TLS key file")
@@ -53,6 +67,20 @@ func Load() *Config {
 	flag.StringVar(&upstreamDNSStr, "upstream-dns", getEnv("UPSTREAM_DNS", "8.8.8.8:53,8.8.4.4:53"), "Comma-separated list of upstream DNS servers (IP:port)")
 	flag.StringVar(&cfg.APIToken, "api-token", getEnv("API_TOKEN", ""), "API token for authentication")
 	flag.BoolVar(&cfg.EnableAPIAuth, "enable-api-auth", getEnvBool("ENABLE_API_AUTH", false), "Enable API authentication")
+	flag.StringVar(&cfg.NodeCPU, "node-cpu", getEnv("NODE_CPU", ""), "CPU capacity of this node (e.g. 4 or 3500m), detected if empty")
+	flag.StringVar(&cfg.NodeMemory, "node-memory", getEnv("NODE_MEMORY", ""), "Memory capacity of this node (e.g. 8Gi), detected if empty")
+	flag.StringVar(&cfg.NodeLabels, "node-labels", getEnv("NODE_LABELS", ""), "Comma-separated key=value labels of this node, matched by node selectors")
+	flag.StringVar(&cfg.NodeRoles, "node-roles", getEnv("NODE_ROLES", ""), "Comma-separated roles of this node (e.g. worker,ingress)")
+	flag.StringVar(&cfg.SchedulerStrategy, "scheduler-strategy", getEnv("SCHEDULER_STRATEGY", "least-allocated"), "Scheduler strategy: least-allocated (spread) or most-allocated (bin-packing)")
+	flag.BoolVar(&cfg.EnableConsensus, "enable-consensus", getEnvBool("ENABLE_CONSENSUS", false), "Replicate the cluster state through a Raft log; the node started without --join bootstraps the cluster")
+	flag.IntVar(&cfg.RaftVoters, "raft-voters", getEnvInt("RAFT_VOTERS", 5), "Maximum number of Raft voters, chosen automatically among the nodes")
+	flag.IntVar(&cfg.FailedNodeTimeout, "failed-node-timeout", getEnvInt("FAILED_NODE_TIMEOUT", 1440), "Minutes failed nodes count towards the quorum, unless they rejoin or are removed")
+
+	flag.BoolVar(&cfg.DrainOnShutdown, "drain-on-shutdown", getEnvBool("DRAIN_ON_SHUTDOWN", false), "Move pods of deployments and stateful sets to other nodes before the agent exits")
+	flag.IntVar(&cfg.ShutdownTimeout, "shutdown-timeout", getEnvInt("SHUTDOWN_TIMEOUT", 60), "Seconds the shutdown may take, pods still running afterwards are killed")
+
+	flag.IntVar(&cfg.AuditMaxSize, "audit-max-size", getEnvInt("AUDIT_MAX_SIZE", 100), "Megabytes the audit log in the data directory may grow to before it is rotated")
+	flag.IntVar(&cfg.AuditMaxBackups, "audit-max-backups", getEnvInt("AUDIT_MAX_BACKUPS", 5), "Rotated audit logs kept")
 
 	flag.Parse()
 
@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/podman"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// Reason of pods whose ConfigMaps or Secrets could not be resolved
+const reasonCreateContainerConfigError = "CreateContainerConfigError"
+
+// Default mode of the files of configMap and secret volumes
+const defaultVolumeFileMode = 0644
+
+// podData resolves the environment of the containers of a pod and the files of
+// its configMap and secret volumes from the cluster state
+func (c *Controller) podData(pod *types.Pod) (*podman.PodData, error) {
+	data := &podman.PodData{
+		Env: make(map[string]map[string]string),
+	}
+
+	containers := append(append([]types.Container{}, pod.InitContainers...), pod.Containers...)
+	for _, container := range containers {
+		env, err := c.containerEnv(pod.Namespace, container)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %w", container.Name, err)
+		}
+		data.Env[container.Name] = env
+	}
+
+	volumes, err := c.podVolumes(pod)
+	if err != nil {
+		return nil, err
+	}
+	data.Volumes = volumes
+
+	return data, nil
+}
+
+// containerEnv resolves the environment variables of a container. Variables
+// set explicitly take precedence over variables from envFrom sources.
+func (c *Controller) containerEnv(namespace string, container types.Container) (map[string]string, error) {
+	env := make(map[string]string)
+
+	for _, source := range container.EnvFrom {
+		var values map[string][]byte
+		var err error
+		switch {
+		case source.ConfigMapRef != nil:
+			values, err = c.configMapData(namespace, source.ConfigMapRef.Name)
+			if err != nil && isOptional(source.ConfigMapRef.Optional) {
+				continue
+			}
+		case source.SecretRef != nil:
+			values, err = c.secretData(namespace, source.SecretRef.Name)
+			if err != nil && isOptional(source.SecretRef.Optional) {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range values {
+			env[source.Prefix+key] = string(value)
+		}
+	}
+
+	for _, e := range container.Env {
+		value, ok, err := c.envValue(namespace, e)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			env[e.Name] = value
+		}
+	}
+
+	return env, nil
+}
+
+// envValue resolves the value of an environment variable.
+// Returns false if an optional reference could not be resolved.
+func (c *Controller) envValue(namespace string, e corev1.EnvVar) (string, bool, error) {
+	if e.ValueFrom == nil {
+		return e.Value, true, nil
+	}
+
+	var values map[string][]byte
+	var key, source string
+	var optional bool
+	var err error
+
+	switch {
+	case e.ValueFrom.ConfigMapKeyRef != nil:
+		ref := e.ValueFrom.ConfigMapKeyRef
+		values, err = c.configMapData(namespace, ref.Name)
+		key, source, optional = ref.Key, "config map "+ref.Name, isOptional(ref.Optional)
+	case e.ValueFrom.SecretKeyRef != nil:
+		ref := e.ValueFrom.SecretKeyRef
+		values, err = c.secretData(namespace, ref.Name)
+		key, source, optional = ref.Key, "secret "+ref.Name, isOptional(ref.Optional)
+	default:
+		// Field and resource references are not supported
+		return e.Value, true, nil
+	}
+
+	if err != nil {
+		if optional {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	value, ok := values[key]
+	if !ok {
+		if optional {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("key %s not found in %s", key, source)
+	}
+
+	return string(value), true, nil
+}
+
+// podVolumes resolves the files of the configMap and secret volumes of a pod
+func (c *Controller) podVolumes(pod *types.Pod) (map[string][]podman.VolumeFile, error) {
+	volumes := make(map[string][]podman.VolumeFile)
+
+	for _, volume := range pod.Volumes {
+		var values map[string][]byte
+		var items []corev1.KeyToPath
+		var defaultMode *int32
+		var optional bool
+		var err error
+
+		switch {
+		case volume.ConfigMap != nil:
+			values, err = c.configMapData(pod.Namespace, volume.ConfigMap.Name)
+			items, defaultMode, optional = volume.ConfigMap.Items, volume.ConfigMap.DefaultMode, isOptional(volume.ConfigMap.Optional)
+		case volume.Secret != nil:
+			values, err = c.secretData(pod.Namespace, volume.Secret.SecretName)
+			items, defaultMode, optional = volume.Secret.Items, volume.Secret.DefaultMode, isOptional(volume.Secret.Optional)
+		default:
+			continue
+		}
+
+		// Missing optional sources are mounted as empty volumes
+		if err != nil && !optional {
+			return nil, fmt.Errorf("volume %s: %w", volume.Name, err)
+		}
+
+		files, err := projectFiles(values, items, defaultMode, optional)
+		if err != nil {
+			return nil, fmt.Errorf("volume %s: %w", volume.Name, err)
+		}
+		volumes[volume.Name] = files
+	}
+
+	return volumes, nil
+}
+
+// hasConfigVolumes reports whether a pod mounts configMap or secret volumes
+func hasConfigVolumes(pod *types.Pod) bool {
+	for _, volume := range pod.Volumes {
+		if volume.ConfigMap != nil || volume.Secret != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// projectFiles returns the files of a volume: one file per key, or only the
+// listed items at their given paths
+func projectFiles(values map[string][]byte, items []corev1.KeyToPath, defaultMode *int32, optional bool) ([]podman.VolumeFile, error) {
+	mode := os.FileMode(defaultVolumeFileMode)
+	if defaultMode != nil {
+		mode = os.FileMode(*defaultMode)
+	}
+
+	var files []podman.VolumeFile
+	if len(items) == 0 {
+		for key, value := range values {
+			files = append(files, podman.VolumeFile{Path: key, Data: value, Mode: mode})
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+		return files, nil
+	}
+
+	for _, item := range items {
+		value, ok := values[item.Key]
+		if !ok {
+			if optional {
+				continue
+			}
+			return nil, fmt.Errorf("key %s not found", item.Key)
+		}
+
+		file := podman.VolumeFile{Path: item.Path, Data: value, Mode: mode}
+		if item.Mode != nil {
+			file.Mode = os.FileMode(*item.Mode)
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// configMapData returns the data and binary data of a config map
+func (c *Controller) configMapData(namespace, name string) (map[string][]byte, error) {
+	cm, err := c.storage.GetConfigMap(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(cm.Data)+len(cm.BinaryData))
+	for key, value := range cm.Data {
+		values[key] = []byte(value)
+	}
+	for key, value := range cm.BinaryData {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// secretData returns the decrypted data of a secret
+func (c *Controller) secretData(namespace, name string) (map[string][]byte, error) {
+	secret, err := c.storage.GetSecret(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data, nil
+}
+
+func isOptional(optional *bool) bool {
+	return optional != nil && *optional
+}
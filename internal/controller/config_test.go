@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/security"
+	"github.com/your-server-support/podman-swarm/internal/storage"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func testConfigController(t *testing.T) *Controller {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	encryptor, _ := security.NewEncryptor([]byte("test-key"))
+	stor, err := storage.NewStorage(storage.StorageConfig{DataDir: t.TempDir(), Encryptor: encryptor, Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	stor.SaveConfigMap(&types.ConfigMap{
+		Name:      "app",
+		Namespace: "default",
+		Data:      map[string]string{"LOG_LEVEL": "debug", "app.yaml": "port: 80"},
+	})
+	stor.SaveSecret(&types.Secret{
+		Name:      "db",
+		Namespace: "default",
+		Data:      map[string][]byte{"password": []byte("s3cr3t")},
+	})
+
+	return &Controller{storage: stor, logger: logger}
+}
+
+func TestContainerEnv(t *testing.T) {
+	c := testConfigController(t)
+	optional := true
+
+	container := types.Container{
+		Name: "web",
+		EnvFrom: []corev1.EnvFromSource{
+			{Prefix: "APP_", ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}}},
+			{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Optional: &optional}},
+		},
+		Env: []corev1.EnvVar{
+			{Name: "APP_LOG_LEVEL", Value: "info"},
+			{Name: "DB_PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "db"},
+				Key:                  "password",
+			}}},
+			{Name: "OPTIONAL", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "app"},
+				Key:                  "missing",
+				Optional:             &optional,
+			}}},
+		},
+	}
+
+	env, err := c.containerEnv("default", container)
+	if err != nil {
+		t.Fatalf("Failed to resolve environment: %v", err)
+	}
+
+	if env["APP_LOG_LEVEL"] != "info" {
+		t.Errorf("Expected explicit variable to take precedence, got %q", env["APP_LOG_LEVEL"])
+	}
+	if env["APP_app.yaml"] != "port: 80" {
+		t.Errorf("Expected prefixed config map key, got %q", env["APP_app.yaml"])
+	}
+	if env["DB_PASSWORD"] != "s3cr3t" {
+		t.Errorf("Expected decrypted secret value, got %q", env["DB_PASSWORD"])
+	}
+	if _, ok := env["OPTIONAL"]; ok {
+		t.Error("Expected missing optional key to be skipped")
+	}
+
+	// A missing required key fails the pod
+	container.Env = append(container.Env, corev1.EnvVar{Name: "REQUIRED", ValueFrom: &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "user"},
+	}})
+	if _, err := c.containerEnv("default", container); err == nil {
+		t.Error("Expected missing required key to fail")
+	}
+}
+
+func TestPodVolumes(t *testing.T) {
+	c := testConfigController(t)
+	mode := int32(0400)
+
+	pod := &types.Pod{
+		Namespace: "default",
+		Volumes: []corev1.Volume{
+			{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "app"},
+				Items:                []corev1.KeyToPath{{Key: "app.yaml", Path: "conf/app.yaml"}},
+			}}},
+			{Name: "credentials", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName:  "db",
+				DefaultMode: &mode,
+			}}},
+			{Name: "scratch", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		},
+	}
+
+	volumes, err := c.podVolumes(pod)
+	if err != nil {
+		t.Fatalf("Failed to resolve volumes: %v", err)
+	}
+
+	if files := volumes["config"]; len(files) != 1 || files[0].Path != "conf/app.yaml" || files[0].Mode != 0644 {
+		t.Errorf("Expected only the listed config map item, got %+v", files)
+	}
+	if files := volumes["credentials"]; len(files) != 1 || string(files[0].Data) != "s3cr3t" || files[0].Mode != 0400 {
+		t.Errorf("Expected the secret key with mode 0400, got %+v", files)
+	}
+	if _, ok := volumes["scratch"]; ok {
+		t.Error("Expected other volume types to be ignored")
+	}
+
+	pod.Volumes[1].Secret.SecretName = "missing"
+	if _, err := c.podVolumes(pod); err == nil {
+		t.Error("Expected missing secret to fail")
+	}
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/your-server-support/podman-swarm/internal/cluster"
+	"github.com/your-server-support/podman-swarm/internal/discovery"
+	"github.com/your-server-support/podman-swarm/internal/parser"
+	"github.com/your-server-support/podman-swarm/internal/podman"
+	"github.com/your-server-support/podman-swarm/internal/prober"
+	"github.com/your-server-support/podman-swarm/internal/scheduler"
+	"github.com/your-server-support/podman-swarm/internal/storage"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// Controller continuously reconciles the workloads stored in the cluster state
+// with the containers actually running on the nodes.
+//
+// Every node runs a controller. The holder of the leader lease converges the
+// pod list of each deployment to its desired replica count and (re)schedules
+// pods, the holder of the cron jobs lease starts the runs of cron jobs, while
+// every node makes its local containers match the pods assigned to it.
+type Controller struct {
+	storage     *storage.Storage
+	scheduler   *scheduler.Scheduler
+	podman      *podman.Client
+	cluster     *cluster.Cluster
+	discovery   *discovery.Discovery
+	parser      *parser.Parser
+	prober      *prober.Manager
+	logger      *logrus.Logger
+	mu          sync.Mutex
+	restarts    map[string]*restartState // pod ID -> restart state of local pods
+	syncCh      chan struct{}
+	reconcileCh chan struct{}
+	stopCh      chan struct{}
+	stopOnce    sync.Once
+}
+
+func NewController(
+	stor *storage.Storage,
+	scheduler *scheduler.Scheduler,
+	podman *podman.Client,
+	cluster *cluster.Cluster,
+	discovery *discovery.Discovery,
+	parser *parser.Parser,
+	logger *logrus.Logger,
+) *Controller {
+	c := &Controller{
+		storage:     stor,
+		scheduler:   scheduler,
+		podman:      podman,
+		cluster:     cluster,
+		discovery:   discovery,
+		parser:      parser,
+		prober:      prober.NewManager(podman, logger),
+		logger:      logger,
+		restarts:    make(map[string]*restartState),
+		syncCh:      make(chan struct{}, 1),
+		reconcileCh: make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
+	}
+
+	// Stop and resume sending traffic to pods as their readiness changes
+	c.prober.SetReadinessHandler(func(pod *types.Pod, ready bool) {
+		discovery.SetPodHealth(pod.ID, ready)
+	})
+	c.prober.SetRestartHandler(c.recordProbeRestart)
+
+	return c
+}
+
+// Start starts the reconciliation loop
+func (c *Controller) Start(interval time.Duration) {
+	go c.watchContainerExits()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.Reconcile()
+			case <-c.syncCh:
+				c.syncLocal()
+			case <-c.reconcileCh:
+				c.Reconcile()
+			case <-c.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the reconciliation loop
+func (c *Controller) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+		c.prober.Stop()
+	})
+}
+
+// Reconcile runs a single reconciliation pass over all workloads
+func (c *Controller) Reconcile() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The minority side of a partition keeps its pods running but schedules
+	// nothing, the majority side replaces the pods it cannot see
+	changed := false
+	hasQuorum := c.cluster.HasQuorum()
+	token, leader := c.cluster.LeaderToken()
+	leader = hasQuorum && leader && c.fence(cluster.LeaseLeader, token)
+	if !hasQuorum {
+		c.logger.Debugf("No quorum, skipping scheduling")
+	}
+	now := time.Now()
+	if leader {
+		c.scheduler.SyncVolumeClaims(c.storage.ListPersistentVolumeClaims())
+		// Evicted pods are replaced by the reconciliation of their workloads below
+		if c.evictTaintedPods(now) {
+			changed = true
+		}
+		for _, dep := range c.storage.ListDeployments() {
+			if c.reconcileDeployment(dep) {
+				changed = true
+			}
+		}
+		for _, set := range c.storage.ListStatefulSets() {
+			if c.reconcileStatefulSet(set) {
+				changed = true
+			}
+		}
+		for _, ds := range c.storage.ListDaemonSets() {
+			if c.reconcileDaemonSet(ds) {
+				changed = true
+			}
+		}
+		c.collectPodStatuses()
+	}
+
+	// Cron jobs first, so that new runs start in the same pass. Only the
+	// holder of the cron jobs lease starts runs, so that none starts twice.
+	if token, ok := c.cluster.LeaseToken(cluster.LeaseCronJobs); hasQuorum && ok && c.fence(cluster.LeaseCronJobs, token) {
+		for _, cj := range c.storage.ListCronJobs() {
+			if c.reconcileCronJob(cj, now, token) {
+				changed = true
+			}
+		}
+	}
+	if leader {
+		for _, job := range c.storage.ListJobs() {
+			if c.reconcileJob(job, now) {
+				changed = true
+			}
+		}
+	}
+
+	if c.syncLocalPods() {
+		changed = true
+	}
+
+	if changed {
+		c.broadcastState()
+	}
+}
+
+// fence checks that no other node took over a lease held by the local node,
+// before the singleton work under it writes to the cluster state. Token 0
+// is not fenced.
+func (c *Controller) fence(lease string, token uint64) bool {
+	if token == 0 {
+		return true
+	}
+	if err := c.storage.Fence(lease, token); err != nil {
+		c.logger.Warnf("Skipping the work of lease %s: %v", lease, err)
+		return false
+	}
+	return true
+}
+
+// HandleMembershipChange runs a reconciliation pass as soon as a node joins
+// or leaves, so that daemon set pods are placed and pods of the node that left
+// are rescheduled without waiting for the next pass
+func (c *Controller) HandleMembershipChange(node *types.Node, joined bool) {
+	c.logger.Debugf("Membership of node %s changed (joined: %t), reconciling", node.Name, joined)
+	c.triggerReconcile()
+}
+
+// triggerReconcile requests a reconciliation pass. Only the pass schedules
+// pods, behind the checks of quorum, leadership and the lease fence.
+func (c *Controller) triggerReconcile() {
+	select {
+	case c.reconcileCh <- struct{}{}:
+	default:
+	}
+}
+
+// syncLocal runs a sync of the local pods outside the regular reconciliation pass
+func (c *Controller) syncLocal() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.syncLocalPods() {
+		c.broadcastState()
+	}
+}
+
+// broadcastState pushes the objects written since the last broadcast to the
+// peers so that the nodes owning new pods pick them up right away
+func (c *Controller) broadcastState() {
+	if err := c.storage.BroadcastState(c.cluster.Broadcaster(cluster.MessageState), c.cluster.GetLocalNodeName()); err != nil {
+		c.logger.Debugf("Failed to broadcast state: %v", err)
+	}
+}
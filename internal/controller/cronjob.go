@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/cluster"
+	"github.com/your-server-support/podman-swarm/internal/cron"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// ApplyCronJob stores an applied cron job. The status of an already applied
+// cron job is kept. Runs are only started by the leader's reconciliation pass.
+func (c *Controller) ApplyCronJob(cj *types.CronJob) error {
+	if _, err := cronSchedule(cj); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cj.CreatedAt = time.Now().Unix()
+	if existing, err := c.storage.GetCronJob(cj.Namespace, cj.Name); err == nil {
+		cj.Active = existing.Active
+		cj.LastScheduleTime = existing.LastScheduleTime
+		cj.LastSuccessfulTime = existing.LastSuccessfulTime
+		cj.CreatedAt = existing.CreatedAt
+	}
+
+	if err := c.storage.SaveCronJob(cj); err != nil {
+		return fmt.Errorf("failed to persist cron job: %w", err)
+	}
+
+	c.broadcastState()
+	return nil
+}
+
+// reconcileCronJob starts the most recent due run of a cron job and removes
+// finished jobs beyond the history limits. It only runs on the holder of the
+// cron jobs lease, whose fencing token is given, and the job of a run is named
+// after its scheduled time, so a run that was already started, e.g. by a
+// previous holder, is not started again.
+// Returns true if the cron job was modified.
+func (c *Controller) reconcileCronJob(cj *types.CronJob, now time.Time, token uint64) bool {
+	key := fmt.Sprintf("%s/%s", cj.Namespace, cj.Name)
+	changed := c.syncCronJobStatus(cj)
+
+	schedule, err := cronSchedule(cj)
+	if err != nil {
+		c.logger.Warnf("Invalid schedule of cron job %s: %v", key, err)
+		return c.saveCronJob(cj, changed)
+	}
+
+	if cj.Suspend {
+		return c.saveCronJob(cj, changed)
+	}
+
+	// Runs missed beyond the starting deadline are not scanned for
+	since := time.Unix(max(cj.LastScheduleTime, cj.CreatedAt), 0)
+	if deadline := cj.StartingDeadlineSeconds; deadline != nil {
+		if earliest := now.Add(-time.Duration(*deadline) * time.Second); earliest.After(since) {
+			since = earliest
+		}
+	}
+	scheduled, err := mostRecentRun(schedule, since, now)
+	if err != nil {
+		c.logger.Warnf("Giving up on the runs of cron job %s since %s: %v, set or decrease its starting deadline", key, since, err)
+		cj.LastScheduleTime = now.Unix()
+		return c.saveCronJob(cj, true)
+	}
+	if scheduled.IsZero() {
+		return c.saveCronJob(cj, changed)
+	}
+
+	// Another node may have taken over the lease during the pass
+	if !c.fence(cluster.LeaseCronJobs, token) {
+		return false
+	}
+
+	if deadline := cj.StartingDeadlineSeconds; deadline != nil && now.Sub(scheduled) > time.Duration(*deadline)*time.Second {
+		c.logger.Warnf("Missed run of cron job %s scheduled at %s", key, scheduled)
+		cj.LastScheduleTime = scheduled.Unix()
+		return c.saveCronJob(cj, true)
+	}
+
+	switch cj.ConcurrencyPolicy {
+	case batchv1.ForbidConcurrent:
+		// The run starts once the active job finished, within the starting deadline
+		if len(cj.Active) > 0 {
+			c.logger.Debugf("Cron job %s is still running, postponing run scheduled at %s", key, scheduled)
+			return c.saveCronJob(cj, changed)
+		}
+	case batchv1.ReplaceConcurrent:
+		for _, name := range cj.Active {
+			if job, err := c.storage.GetJob(cj.Namespace, name); err == nil {
+				c.logger.Infof("Replacing job %s/%s of cron job %s", job.Namespace, job.Name, key)
+				c.deleteJob(job)
+			}
+		}
+		cj.Active = nil
+	}
+
+	c.startCronJobRun(cj, scheduled, now)
+	return c.saveCronJob(cj, true)
+}
+
+// startCronJobRun creates the job of the run of a cron job scheduled at the given time
+func (c *Controller) startCronJobRun(cj *types.CronJob, scheduled, now time.Time) {
+	key := fmt.Sprintf("%s/%s", cj.Namespace, cj.Name)
+	name := fmt.Sprintf("%s-%d", cj.Name, scheduled.Unix()/60)
+	cj.LastScheduleTime = scheduled.Unix()
+
+	if _, err := c.storage.GetJob(cj.Namespace, name); err == nil {
+		return
+	}
+
+	job, err := c.parser.ParseJob(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cj.Namespace,
+			Labels:    cj.JobTemplate.Labels,
+		},
+		Spec: cj.JobTemplate.Spec,
+	})
+	if err != nil {
+		c.logger.Errorf("Failed to create job of cron job %s: %v", key, err)
+		return
+	}
+	job.CronJob = cj.Name
+	job.CreatedAt = now.Unix()
+
+	if err := c.storage.SaveJob(job); err != nil {
+		c.logger.Errorf("Failed to persist job %s/%s: %v", job.Namespace, job.Name, err)
+		return
+	}
+
+	c.logger.Infof("Started job %s/%s of cron job %s scheduled at %s", job.Namespace, job.Name, key, scheduled)
+	cj.Active = append(cj.Active, job.Name)
+	c.reconcileJob(job, now)
+}
+
+// syncCronJobStatus updates the active jobs and the last successful time of a
+// cron job from its jobs and removes finished jobs beyond the history limits.
+// Returns true if the cron job was modified.
+func (c *Controller) syncCronJobStatus(cj *types.CronJob) bool {
+	var active []string
+	var succeeded, failed []*types.Job
+	lastSuccessful := cj.LastSuccessfulTime
+
+	for _, job := range c.storage.ListJobs() {
+		if job.Namespace != cj.Namespace || job.CronJob != cj.Name {
+			continue
+		}
+		switch job.Condition {
+		case types.JobComplete:
+			succeeded = append(succeeded, job)
+			lastSuccessful = max(lastSuccessful, job.CompletionTime)
+		case types.JobFailed:
+			failed = append(failed, job)
+		default:
+			active = append(active, job.Name)
+		}
+	}
+	sort.Strings(active)
+
+	c.pruneJobs(succeeded, cj.SuccessfulJobsHistoryLimit)
+	c.pruneJobs(failed, cj.FailedJobsHistoryLimit)
+
+	changed := !slices.Equal(active, cj.Active) || lastSuccessful != cj.LastSuccessfulTime
+	cj.Active = active
+	cj.LastSuccessfulTime = lastSuccessful
+	return changed
+}
+
+// pruneJobs deletes the jobs that finished first, keeping limit jobs
+func (c *Controller) pruneJobs(jobs []*types.Job, limit int32) {
+	if int32(len(jobs)) <= limit {
+		return
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CompletionTime < jobs[j].CompletionTime })
+	for _, job := range jobs[:int32(len(jobs))-limit] {
+		c.logger.Infof("Removing job %s/%s of cron job %s beyond the history limit", job.Namespace, job.Name, job.CronJob)
+		c.deleteJob(job)
+	}
+}
+
+func (c *Controller) saveCronJob(cj *types.CronJob, changed bool) bool {
+	if changed {
+		if err := c.storage.SaveCronJob(cj); err != nil {
+			c.logger.Warnf("Failed to persist cron job %s/%s: %v", cj.Namespace, cj.Name, err)
+		}
+	}
+	return changed
+}
+
+// cronSchedule parses the schedule of a cron job in its time zone
+func cronSchedule(cj *types.CronJob) (*cron.Schedule, error) {
+	location := time.Local
+	if cj.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(cj.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", cj.TimeZone, err)
+		}
+	}
+	return cron.Parse(cj.Schedule, location)
+}
+
+// maxMissedRuns bounds the runs scanned for the most recent one, as in Kubernetes
+const maxMissedRuns = 100
+
+// mostRecentRun returns the latest scheduled time after since and not after
+// now, or the zero time if no run is due. Fails if more than maxMissedRuns
+// runs were missed.
+func mostRecentRun(schedule *cron.Schedule, since, now time.Time) (time.Time, error) {
+	var scheduled time.Time
+	missed := 0
+	for t := schedule.Next(since); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		if missed++; missed > maxMissedRuns {
+			return time.Time{}, fmt.Errorf("more than %d missed runs", maxMissedRuns)
+		}
+		scheduled = t
+	}
+	return scheduled, nil
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/your-server-support/podman-swarm/internal/cluster"
+	"github.com/your-server-support/podman-swarm/internal/scheduler"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// ApplyDaemonSet stores an applied daemon set and requests a reconciliation
+// pass, which converges it on the leader. Pods of an already applied daemon
+// set are kept.
+func (c *Controller) ApplyDaemonSet(ds *types.DaemonSet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, err := c.storage.GetDaemonSet(ds.Namespace, ds.Name); err == nil {
+		ds.Pods = existing.Pods
+		ds.Replicas = existing.Replicas
+		ds.TemplateHash = existing.TemplateHash
+	}
+
+	if err := c.storage.SaveDaemonSet(ds); err != nil {
+		return fmt.Errorf("failed to persist daemon set: %w", err)
+	}
+
+	c.triggerReconcile()
+	return nil
+}
+
+// reconcileDaemonSet converges a daemon set to one pod on every node matching
+// its node selector and required node affinity whose taints it tolerates. Pods
+// on nodes that left the cluster, no longer match or got a NoExecute taint are
+// removed, nodes without a pod get one, and pods of an older template are
+// replaced by the update strategy.
+// Returns true if the daemon set was modified.
+func (c *Controller) reconcileDaemonSet(ds *types.DaemonSet) bool {
+	changed := false
+	key := fmt.Sprintf("%s/%s", ds.Namespace, ds.Name)
+
+	if hash := templateHash(ds.Template); hash != ds.TemplateHash {
+		ds.TemplateHash = hash
+		changed = true
+	}
+
+	// The nodes that should run a pod, by name. Pods already running on a node
+	// stay unless the node no longer matches or a NoExecute taint evicts them.
+	template := c.parser.ExtractPodFromTemplate(ds.Template, ds.Namespace, ds.Name)
+	addDaemonSetTolerations(template)
+	now := time.Now()
+	members := make(map[string]*types.Node)
+	nodes := make(map[string]*types.Node)
+	for _, node := range c.cluster.GetNodes() {
+		members[node.Name] = node
+		if scheduler.NodeSchedulable(template, node) {
+			nodes[node.Name] = node
+		}
+	}
+
+	// Keep a single pod per matching node
+	pods := make(map[string]*types.Pod, len(ds.Pods))
+	for _, pod := range ds.Pods {
+		node := members[pod.NodeName]
+		if node == nil || pods[pod.NodeName] != nil || !scheduler.NodeMatches(template, node) || scheduler.ShouldEvict(pod, node, now) {
+			c.logger.Infof("Removing pod %s of daemon set %s from node %s", pod.Name, key, pod.NodeName)
+			c.scheduler.RemovePod(pod.ID)
+			changed = true
+			continue
+		}
+		nodes[pod.NodeName] = node
+		pods[pod.NodeName] = pod
+	}
+
+	if c.updateDaemonSet(ds, pods, len(nodes)) {
+		changed = true
+	}
+
+	// Place a pod on every matching node without one
+	for name, node := range nodes {
+		if pods[name] != nil {
+			continue
+		}
+
+		pod := c.newPod(ds.Template, ds.Namespace, fmt.Sprintf("%s-%s", ds.Name, name))
+		pod.TemplateHash = ds.TemplateHash
+		addDaemonSetTolerations(pod)
+		if err := c.schedulePodOnNode(pod, node); err != nil {
+			c.logger.Errorf("Failed to schedule pod of daemon set %s to node %s: %v", key, name, err)
+			continue
+		}
+
+		c.logger.Infof("Scheduled pod %s of daemon set %s to node %s", pod.Name, key, name)
+		pods[name] = pod
+		changed = true
+	}
+
+	live := make([]*types.Pod, 0, len(pods))
+	for _, pod := range pods {
+		live = append(live, pod)
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].NodeName < live[j].NodeName })
+	ds.Pods = live
+
+	if desired := int32(len(nodes)); ds.DesiredReplicas != desired {
+		ds.DesiredReplicas = desired
+		changed = true
+	}
+	if ready := countRunning(live); ds.Replicas != ready {
+		ds.Replicas = ready
+		changed = true
+	}
+
+	if changed {
+		if err := c.storage.SaveDaemonSet(ds); err != nil {
+			c.logger.Warnf("Failed to persist daemon set %s: %v", key, err)
+		}
+	}
+
+	return changed
+}
+
+// updateDaemonSet performs one step of a rolling update. Pods of an older
+// template are removed so that at most maxUnavailable of the desired pods are
+// unavailable, unavailable old pods first. The removed pods are recreated from
+// the current template on the same nodes. Returns true if a pod was removed.
+func (c *Controller) updateDaemonSet(ds *types.DaemonSet, pods map[string]*types.Pod, desired int) bool {
+	if ds.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+		return false
+	}
+
+	maxUnavailable := 1
+	if rolling := ds.UpdateStrategy.RollingUpdate; rolling != nil && rolling.MaxUnavailable != nil {
+		value, err := intstr.GetScaledValueFromIntOrPercent(rolling.MaxUnavailable, desired, true)
+		if err == nil && value > 0 {
+			maxUnavailable = value
+		}
+	}
+
+	unavailable := desired
+	var old []*types.Pod
+	for _, pod := range pods {
+		if isAvailable(pod) {
+			unavailable--
+		}
+		if pod.TemplateHash != ds.TemplateHash {
+			old = append(old, pod)
+		}
+	}
+
+	sort.Slice(old, func(i, j int) bool {
+		if isAvailable(old[i]) != isAvailable(old[j]) {
+			return !isAvailable(old[i])
+		}
+		return old[i].NodeName < old[j].NodeName
+	})
+
+	changed := false
+	for _, pod := range old {
+		if isAvailable(pod) {
+			if unavailable >= maxUnavailable {
+				break
+			}
+			unavailable++
+		}
+
+		c.logger.Infof("Updating pod %s of daemon set %s/%s on node %s", pod.Name, ds.Namespace, ds.Name, pod.NodeName)
+		c.scheduler.RemovePod(pod.ID)
+		delete(pods, pod.NodeName)
+		changed = true
+	}
+
+	return changed
+}
+
+// addDaemonSetTolerations lets daemon set pods run on cordoned nodes, like
+// the daemon set controller of Kubernetes does
+func addDaemonSetTolerations(pod *types.Pod) {
+	// The tolerations may be shared with the template
+	tolerations := pod.Tolerations[:len(pod.Tolerations):len(pod.Tolerations)]
+	pod.Tolerations = append(tolerations, corev1.Toleration{
+		Key:      cluster.TaintUnschedulable,
+		Operator: corev1.TolerationOpExists,
+		Effect:   corev1.TaintEffectNoSchedule,
+	})
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/your-server-support/podman-swarm/internal/scheduler"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestUpdateDaemonSet(t *testing.T) {
+	logger := logrus.New()
+	c := &Controller{scheduler: scheduler.NewScheduler(nil, logger), logger: logger}
+
+	maxUnavailable := intstr.FromString("50%")
+	ds := &types.DaemonSet{
+		Name:         "exporter",
+		Namespace:    "default",
+		TemplateHash: "new",
+		UpdateStrategy: appsv1.DaemonSetUpdateStrategy{
+			Type:          appsv1.RollingUpdateDaemonSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateDaemonSet{MaxUnavailable: &maxUnavailable},
+		},
+	}
+	pods := map[string]*types.Pod{
+		"node-1": {Name: "exporter-node-1", NodeName: "node-1", State: types.PodStateRunning, Ready: true, TemplateHash: "old"},
+		"node-2": {Name: "exporter-node-2", NodeName: "node-2", State: types.PodStateRunning, Ready: true, TemplateHash: "old"},
+		"node-3": {Name: "exporter-node-3", NodeName: "node-3", State: types.PodStateFailed, TemplateHash: "old"},
+		"node-4": {Name: "exporter-node-4", NodeName: "node-4", State: types.PodStateRunning, Ready: true, TemplateHash: "new"},
+	}
+
+	// 50% of 4 nodes allows 2 unavailable pods: the failed pod plus one more
+	if !c.updateDaemonSet(ds, pods, 4) {
+		t.Fatal("Expected pods to be updated")
+	}
+	if pods["node-3"] != nil || pods["node-1"] != nil {
+		t.Error("Expected the unavailable pod and node-1 to be replaced")
+	}
+	if pods["node-2"] == nil || pods["node-4"] == nil {
+		t.Error("Expected node-2 to wait and node-4 to be kept")
+	}
+
+	// Missing pods count as unavailable
+	if c.updateDaemonSet(ds, pods, 4) {
+		t.Error("Expected the update to wait for the replaced pods")
+	}
+
+	ds.UpdateStrategy = appsv1.DaemonSetUpdateStrategy{Type: appsv1.OnDeleteDaemonSetStrategyType}
+	if c.updateDaemonSet(ds, map[string]*types.Pod{"node-1": {NodeName: "node-1", TemplateHash: "old"}}, 1) {
+		t.Error("Expected OnDelete daemon sets not to be updated")
+	}
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// reconcileDeployment converges the pods of a deployment to DesiredReplicas.
+// Pods on nodes that left the cluster are rescheduled, missing replicas are
+// scheduled and surplus replicas are dropped. While pods of an older revision
+// exist, the deployment strategy drives the rollout instead. The nodes owning
+// the pods create or remove the containers on their next pass.
+// Returns true if the deployment was modified.
+func (c *Controller) reconcileDeployment(dep *types.Deployment) bool {
+	changed := ensureRevision(dep)
+	key := fmt.Sprintf("%s/%s", dep.Namespace, dep.Name)
+
+	// Drop pods whose node is no longer a cluster member
+	live := make([]*types.Pod, 0, len(dep.Pods))
+	for _, pod := range dep.Pods {
+		if _, err := c.cluster.GetNode(pod.NodeName); err != nil {
+			c.logger.Warnf("Node %s of pod %s is gone, rescheduling", pod.NodeName, pod.Name)
+			c.scheduler.RemovePod(pod.ID)
+			changed = true
+			continue
+		}
+		live = append(live, pod)
+	}
+
+	newPods, oldPods := splitByRevision(live, dep.TemplateHash)
+	if len(oldPods) > 0 {
+		// A paused rollout is left as is
+		if !dep.Paused {
+			var rolled bool
+			if dep.Strategy.Type == appsv1.RecreateDeploymentStrategyType {
+				live, rolled = c.recreate(dep, newPods, oldPods)
+			} else {
+				live, rolled = c.rollingUpdate(dep, newPods, oldPods)
+			}
+			changed = changed || rolled
+		}
+	} else {
+		var scaled bool
+		live, scaled = c.scaleDeployment(dep, live)
+		changed = changed || scaled
+	}
+
+	sort.Slice(live, func(i, j int) bool { return live[i].Name < live[j].Name })
+	dep.Pods = live
+
+	if ready := countRunning(live); dep.Replicas != ready {
+		dep.Replicas = ready
+		changed = true
+	}
+
+	if changed {
+		if err := c.storage.SaveDeployment(dep); err != nil {
+			c.logger.Warnf("Failed to persist deployment %s: %v", key, err)
+		}
+	}
+
+	return changed
+}
+
+// scaleDeployment converges the number of pods of the current revision to DesiredReplicas
+func (c *Controller) scaleDeployment(dep *types.Deployment, live []*types.Pod) ([]*types.Pod, bool) {
+	changed := false
+	key := fmt.Sprintf("%s/%s", dep.Namespace, dep.Name)
+
+	// Scale down, removing pods that are not running first
+	if int32(len(live)) > dep.DesiredReplicas {
+		sort.SliceStable(live, func(i, j int) bool {
+			return live[i].State == types.PodStateRunning && live[j].State != types.PodStateRunning
+		})
+		for _, pod := range live[dep.DesiredReplicas:] {
+			c.logger.Infof("Removing surplus pod %s of deployment %s", pod.Name, key)
+			c.scheduler.RemovePod(pod.ID)
+		}
+		live = live[:dep.DesiredReplicas]
+		changed = true
+	}
+
+	// Scale up
+	for int32(len(live)) < dep.DesiredReplicas {
+		pod, err := c.scheduleDeploymentPod(dep, live)
+		if err != nil {
+			c.logger.Errorf("Failed to schedule pod of deployment %s: %v", key, err)
+			break
+		}
+		live = append(live, pod)
+		changed = true
+	}
+
+	return live, changed
+}
+
+// scheduleDeploymentPod creates a pod from the current template of a deployment and schedules it
+func (c *Controller) scheduleDeploymentPod(dep *types.Deployment, existing []*types.Pod) (*types.Pod, error) {
+	pod := c.newPod(dep.Template, dep.Namespace, nextPodName(dep.Name, existing))
+	pod.TemplateHash = dep.TemplateHash
+
+	nodeName, err := c.schedulePod(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Infof("Scheduled pod %s of deployment %s/%s to node %s", pod.Name, dep.Namespace, dep.Name, nodeName)
+	return pod, nil
+}
+
+// newPod creates an unscheduled pod from a template
+func (c *Controller) newPod(template corev1.PodTemplateSpec, namespace, name string) *types.Pod {
+	pod := c.parser.ExtractPodFromTemplate(template, namespace, name)
+	pod.ID = generateID()
+	pod.CreatedAt = time.Now().Unix()
+	return pod
+}
+
+// nextPodName returns the lowest free "<name>-<index>" pod name
+func nextPodName(name string, pods []*types.Pod) string {
+	used := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		used[pod.Name] = true
+	}
+
+	for i := 0; ; i++ {
+		podName := fmt.Sprintf("%s-%d", name, i)
+		if !used[podName] {
+			return podName
+		}
+	}
+}
+
+// countRunning returns the number of pods in the Running state
+func countRunning(pods []*types.Pod) int32 {
+	var count int32
+	for _, pod := range pods {
+		if pod.State == types.PodStateRunning {
+			count++
+		}
+	}
+	return count
+}
+
+func generateID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestNextPodName(t *testing.T) {
+	pods := []*types.Pod{
+		{Name: "web-0"},
+		{Name: "web-2"},
+	}
+
+	if name := nextPodName("web", pods); name != "web-1" {
+		t.Errorf("Expected web-1, got %s", name)
+	}
+
+	pods = append(pods, &types.Pod{Name: "web-1"})
+	if name := nextPodName("web", pods); name != "web-3" {
+		t.Errorf("Expected web-3, got %s", name)
+	}
+
+	if name := nextPodName("web", nil); name != "web-0" {
+		t.Errorf("Expected web-0, got %s", name)
+	}
+}
+
+func TestCountRunning(t *testing.T) {
+	pods := []*types.Pod{
+		{Name: "web-0", State: types.PodStateRunning},
+		{Name: "web-1", State: types.PodStatePending},
+		{Name: "web-2", State: types.PodStateRunning},
+		{Name: "web-3", State: types.PodStateFailed},
+	}
+
+	if count := countRunning(pods); count != 2 {
+		t.Errorf("Expected 2 running pods, got %d", count)
+	}
+}
+
+func TestMatchesSelector(t *testing.T) {
+	labels := map[string]string{"app": "web", "tier": "frontend"}
+
+	if !matchesSelector(labels, map[string]string{"app": "web"}) {
+		t.Error("Expected selector to match")
+	}
+
+	if matchesSelector(labels, map[string]string{"app": "db"}) {
+		t.Error("Expected selector not to match")
+	}
+
+	if matchesSelector(labels, nil) {
+		t.Error("Expected empty selector not to match")
+	}
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/your-server-support/podman-swarm/internal/scheduler"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// DrainResult lists the pods a drain evicted and the pods it had to leave
+type DrainResult struct {
+	Evicted []string `json:"evicted"`
+	Blocked []string `json:"blocked"` // Evicting them would violate a pod disruption budget
+}
+
+// disruptionBudgets tracks how many more pods each budget allows to disrupt
+type disruptionBudgets struct {
+	budgets   []*types.PodDisruptionBudget
+	selectors []labels.Selector
+	allowed   []int
+}
+
+// newDisruptionBudgets computes the disruptions the budgets allow given the
+// pods they select. Without minAvailable and maxUnavailable a budget keeps
+// at least one pod available.
+func newDisruptionBudgets(budgets []*types.PodDisruptionBudget, pods []*types.Pod) (*disruptionBudgets, error) {
+	d := &disruptionBudgets{}
+	for _, budget := range budgets {
+		selector, err := metav1.LabelSelectorAsSelector(budget.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector of pod disruption budget %s/%s: %w", budget.Namespace, budget.Name, err)
+		}
+
+		expected, healthy := 0, 0
+		for _, pod := range pods {
+			if pod.Namespace == budget.Namespace && selector.Matches(labels.Set(pod.Labels)) {
+				expected++
+				if isAvailable(pod) {
+					healthy++
+				}
+			}
+		}
+
+		var allowed int
+		switch {
+		case budget.MaxUnavailable != nil:
+			maxUnavailable, err := intstr.GetScaledValueFromIntOrPercent(budget.MaxUnavailable, expected, true)
+			if err != nil {
+				return nil, fmt.Errorf("invalid maxUnavailable of pod disruption budget %s/%s: %w", budget.Namespace, budget.Name, err)
+			}
+			allowed = maxUnavailable - (expected - healthy)
+		case budget.MinAvailable != nil:
+			minAvailable, err := intstr.GetScaledValueFromIntOrPercent(budget.MinAvailable, expected, true)
+			if err != nil {
+				return nil, fmt.Errorf("invalid minAvailable of pod disruption budget %s/%s: %w", budget.Namespace, budget.Name, err)
+			}
+			allowed = healthy - minAvailable
+		default:
+			allowed = healthy - 1
+		}
+
+		d.budgets = append(d.budgets, budget)
+		d.selectors = append(d.selectors, selector)
+		d.allowed = append(d.allowed, allowed)
+	}
+	return d, nil
+}
+
+// allow checks if a pod may be disrupted and counts the disruption against its
+// budgets. Pods that are not available do not count against the budgets.
+// Without budgets every pod may be disrupted.
+func (d *disruptionBudgets) allow(pod *types.Pod) bool {
+	if d == nil {
+		return true
+	}
+
+	var matching []int
+	for i, budget := range d.budgets {
+		if pod.Namespace == budget.Namespace && d.selectors[i].Matches(labels.Set(pod.Labels)) {
+			matching = append(matching, i)
+		}
+	}
+	if !isAvailable(pod) {
+		return true
+	}
+
+	for _, i := range matching {
+		if d.allowed[i] <= 0 {
+			return false
+		}
+	}
+	for _, i := range matching {
+		d.allowed[i]--
+	}
+	return true
+}
+
+// disruptionBudgets returns the budgets of the stored pod disruption budgets
+// over the pods of all workloads
+func (c *Controller) disruptionBudgets() (*disruptionBudgets, error) {
+	return newDisruptionBudgets(c.storage.ListPodDisruptionBudgets(), c.workloadPods())
+}
+
+// evictPods removes the pods of a workload for which evict returns true, as
+// far as the budgets allow. The evicted pods are replaced elsewhere by the
+// next reconciliation of the workload. Returns the remaining pods.
+func (c *Controller) evictPods(kind, key string, pods []*types.Pod, budgets *disruptionBudgets, evict func(*types.Pod) bool, result *DrainResult) []*types.Pod {
+	kept := make([]*types.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if !evict(pod) {
+			kept = append(kept, pod)
+			continue
+		}
+
+		name := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+		if !budgets.allow(pod) {
+			c.logger.Infof("Not evicting pod %s of %s %s from node %s, it would violate a pod disruption budget", pod.Name, kind, key, pod.NodeName)
+			result.Blocked = append(result.Blocked, name)
+			kept = append(kept, pod)
+			continue
+		}
+
+		c.logger.Infof("Evicting pod %s of %s %s from node %s", pod.Name, kind, key, pod.NodeName)
+		c.scheduler.RemovePod(pod.ID)
+		result.Evicted = append(result.Evicted, name)
+	}
+	return kept
+}
+
+// evictWorkloads evicts the pods of deployments and stateful sets for which
+// evict returns true. Pods of daemon sets and jobs are left, like kubectl
+// drain does. The replacements are scheduled by the next reconciliation pass
+// of the leader. Unless honorBudgets is set, pod disruption budgets are not
+// checked.
+func (c *Controller) evictWorkloads(evict func(*types.Pod) bool, honorBudgets bool) *DrainResult {
+	result := &DrainResult{Evicted: []string{}, Blocked: []string{}}
+	var budgets *disruptionBudgets
+	if honorBudgets {
+		var err error
+		if budgets, err = c.disruptionBudgets(); err != nil {
+			c.logger.Warnf("Not evicting pods: %v", err)
+			return result
+		}
+	}
+
+	for _, dep := range c.storage.ListDeployments() {
+		key := fmt.Sprintf("%s/%s", dep.Namespace, dep.Name)
+		evicted := len(result.Evicted)
+		if dep.Pods = c.evictPods("deployment", key, dep.Pods, budgets, evict, result); len(result.Evicted) == evicted {
+			continue
+		}
+		if err := c.storage.SaveDeployment(dep); err != nil {
+			c.logger.Warnf("Failed to persist deployment %s: %v", key, err)
+		}
+	}
+	for _, set := range c.storage.ListStatefulSets() {
+		key := fmt.Sprintf("%s/%s", set.Namespace, set.Name)
+		evicted := len(result.Evicted)
+		if set.Pods = c.evictPods("stateful set", key, set.Pods, budgets, evict, result); len(result.Evicted) == evicted {
+			continue
+		}
+		if err := c.storage.SaveStatefulSet(set); err != nil {
+			c.logger.Warnf("Failed to persist stateful set %s: %v", key, err)
+		}
+	}
+
+	return result
+}
+
+// evictTaintedPods evicts the pods running on nodes with NoExecute taints
+// they do not tolerate. As in Kubernetes, taint evictions are not voluntary
+// disruptions and bypass the pod disruption budgets. Returns true if a pod
+// was evicted.
+func (c *Controller) evictTaintedPods(now time.Time) bool {
+	nodes := make(map[string]*types.Node)
+	tainted := false
+	for _, node := range c.cluster.GetNodes() {
+		nodes[node.Name] = node
+		tainted = tainted || len(node.Taints) > 0
+	}
+	if !tainted {
+		return false
+	}
+
+	result := c.evictWorkloads(func(pod *types.Pod) bool {
+		node := nodes[pod.NodeName]
+		return node != nil && scheduler.ShouldEvict(pod, node, now)
+	}, false)
+	return len(result.Evicted) > 0
+}
+
+// DrainNode evicts the pods of deployments and stateful sets from a node and
+// requests a reconciliation pass to schedule their replacements. The node has
+// to be cordoned first, so that the replacements go elsewhere. Pods whose eviction would violate a
+// pod disruption budget are left; draining again evicts them once enough
+// replacements are available.
+func (c *Controller) DrainNode(nodeName string) *DrainResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := c.evictWorkloads(func(pod *types.Pod) bool {
+		return pod.NodeName == nodeName
+	}, true)
+
+	c.syncLocalPods()
+	c.broadcastState()
+	c.triggerReconcile()
+	return result
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestDisruptionBudgets(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	minAvailable := intstr.FromInt(2)
+	maxUnavailable := intstr.FromString("50%")
+	budgets := []*types.PodDisruptionBudget{
+		{Name: "web", Namespace: "default", Selector: selector, MinAvailable: &minAvailable},
+		{Name: "db", Namespace: "default", Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}, MaxUnavailable: &maxUnavailable},
+	}
+
+	web := func(name string, available bool) *types.Pod {
+		return &types.Pod{Name: name, Namespace: "default", Labels: map[string]string{"app": "web"}, State: types.PodStateRunning, Ready: available}
+	}
+	db := func(name string) *types.Pod {
+		return &types.Pod{Name: name, Namespace: "default", Labels: map[string]string{"app": "db"}, State: types.PodStateRunning, Ready: true}
+	}
+	other := &types.Pod{Name: "cache-0", Namespace: "default", Labels: map[string]string{"app": "cache"}, State: types.PodStateRunning, Ready: true}
+	pods := []*types.Pod{web("web-0", true), web("web-1", true), web("web-2", true), web("web-3", false), db("db-0"), db("db-1"), other}
+
+	d, err := newDisruptionBudgets(budgets, pods)
+	if err != nil {
+		t.Fatalf("Failed to compute budgets: %v", err)
+	}
+
+	// 3 available web pods with minAvailable 2 allow a single disruption
+	if !d.allow(pods[0]) {
+		t.Error("Expected the first web pod to be evicted")
+	}
+	if d.allow(pods[1]) {
+		t.Error("Expected the second web pod to be kept by the budget")
+	}
+	if !d.allow(pods[3]) {
+		t.Error("Expected an unavailable pod to be evicted regardless of the budget")
+	}
+
+	// 50% of 2 db pods allows one disruption
+	if !d.allow(pods[4]) || d.allow(pods[5]) {
+		t.Error("Expected exactly one db pod to be evicted")
+	}
+
+	if !d.allow(other) {
+		t.Error("Expected pods without a budget to be evicted")
+	}
+}
+
+func TestEvictWorkloadsBudgets(t *testing.T) {
+	c, stor := newJobTestController(t)
+
+	minAvailable := intstr.FromInt(2)
+	if err := stor.SavePodDisruptionBudget(&types.PodDisruptionBudget{
+		Name:         "web",
+		Namespace:    "default",
+		Selector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		MinAvailable: &minAvailable,
+	}); err != nil {
+		t.Fatalf("Failed to save budget: %v", err)
+	}
+	pod := func(name string) *types.Pod {
+		return &types.Pod{Name: name, Namespace: "default", NodeName: "node-1", Labels: map[string]string{"app": "web"}, State: types.PodStateRunning, Ready: true}
+	}
+	if err := stor.SaveDeployment(&types.Deployment{Name: "web", Namespace: "default", Pods: []*types.Pod{pod("web-0"), pod("web-1")}}); err != nil {
+		t.Fatalf("Failed to save deployment: %v", err)
+	}
+	onNode := func(pod *types.Pod) bool { return pod.NodeName == "node-1" }
+
+	// Drains keep the pods the budget protects
+	result := c.evictWorkloads(onNode, true)
+	if len(result.Evicted) != 0 || len(result.Blocked) != 2 {
+		t.Errorf("Expected the budget to block both evictions, got %+v", result)
+	}
+
+	// Taint evictions bypass the budget
+	result = c.evictWorkloads(onNode, false)
+	if len(result.Evicted) != 2 || len(result.Blocked) != 0 {
+		t.Errorf("Expected both pods to be evicted, got %+v", result)
+	}
+	if dep, err := stor.GetDeployment("default", "web"); err != nil || len(dep.Pods) != 0 {
+		t.Errorf("Expected the evicted pods to be removed from the deployment, got %+v (%v)", dep, err)
+	}
+}
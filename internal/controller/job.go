@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+const (
+	reasonBackoffLimitExceeded = "BackoffLimitExceeded"
+	reasonDeadlineExceeded     = "DeadlineExceeded"
+)
+
+// ApplyJob stores an applied job and requests a reconciliation pass, which
+// starts it on the leader. The pods and status of an already applied job are
+// kept.
+func (c *Controller) ApplyJob(job *types.Job) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job.CreatedAt = time.Now().Unix()
+	if existing, err := c.storage.GetJob(job.Namespace, job.Name); err == nil {
+		job.Pods = existing.Pods
+		job.Active = existing.Active
+		job.Succeeded = existing.Succeeded
+		job.Failed = existing.Failed
+		job.Condition = existing.Condition
+		job.Reason = existing.Reason
+		job.StartTime = existing.StartTime
+		job.CompletionTime = existing.CompletionTime
+		job.CronJob = existing.CronJob
+		job.CreatedAt = existing.CreatedAt
+	}
+
+	if err := c.storage.SaveJob(job); err != nil {
+		return fmt.Errorf("failed to persist job: %w", err)
+	}
+
+	c.triggerReconcile()
+	return nil
+}
+
+// reconcileJob runs the pods of a job until Completions of them succeeded,
+// at most Parallelism at a time. The job fails once its failed pods and
+// container restarts exceed BackoffLimit, or once it ran for longer than
+// ActiveDeadlineSeconds. Pods still running when a job finishes are removed,
+// finished pods are kept until the job is deleted.
+// Returns true if the job was modified.
+func (c *Controller) reconcileJob(job *types.Job, now time.Time) bool {
+	if job.Condition != "" {
+		return false
+	}
+
+	changed := false
+	key := fmt.Sprintf("%s/%s", job.Namespace, job.Name)
+
+	if job.StartTime == 0 {
+		job.StartTime = now.Unix()
+		changed = true
+	}
+
+	// Unfinished pods whose node is no longer a cluster member are replaced
+	live := make([]*types.Pod, 0, len(job.Pods))
+	var active []*types.Pod
+	var succeeded, failed, restarts int32
+	for _, pod := range job.Pods {
+		switch pod.State {
+		case types.PodStateSucceeded:
+			succeeded++
+		case types.PodStateFailed:
+			failed++
+		default:
+			if _, err := c.cluster.GetNode(pod.NodeName); err != nil {
+				c.logger.Warnf("Node %s of pod %s is gone, replacing", pod.NodeName, pod.Name)
+				c.scheduler.RemovePod(pod.ID)
+				changed = true
+				continue
+			}
+			active = append(active, pod)
+		}
+		restarts += pod.RestartCount
+		live = append(live, pod)
+	}
+
+	switch {
+	case succeeded >= job.Completions:
+		job.Condition = types.JobComplete
+	case failed+restarts > job.BackoffLimit:
+		job.Condition, job.Reason = types.JobFailed, reasonBackoffLimitExceeded
+	case job.ActiveDeadlineSeconds != nil && now.Unix()-job.StartTime >= *job.ActiveDeadlineSeconds:
+		job.Condition, job.Reason = types.JobFailed, reasonDeadlineExceeded
+	}
+
+	if job.Condition != "" {
+		for _, pod := range active {
+			c.scheduler.RemovePod(pod.ID)
+		}
+		live = finishedPods(live)
+		active = nil
+		job.CompletionTime = now.Unix()
+		changed = true
+
+		if job.Condition == types.JobComplete {
+			c.logger.Infof("Job %s completed", key)
+		} else {
+			c.logger.Warnf("Job %s failed: %s", key, job.Reason)
+		}
+	} else {
+		// Start pods up to the parallelism without exceeding the remaining completions
+		want := min(job.Parallelism, job.Completions-succeeded) - int32(len(active))
+		for i := int32(0); i < want; i++ {
+			pod := c.newPod(job.Template, job.Namespace, nextPodName(job.Name, live))
+			nodeName, err := c.schedulePod(pod)
+			if err != nil {
+				c.logger.Errorf("Failed to schedule pod of job %s: %v", key, err)
+				break
+			}
+			c.logger.Infof("Scheduled pod %s of job %s to node %s", pod.Name, key, nodeName)
+			live = append(live, pod)
+			active = append(active, pod)
+			changed = true
+		}
+	}
+	job.Pods = live
+
+	if job.Active != int32(len(active)) || job.Succeeded != succeeded || job.Failed != failed {
+		job.Active, job.Succeeded, job.Failed = int32(len(active)), succeeded, failed
+		changed = true
+	}
+
+	if changed {
+		if err := c.storage.SaveJob(job); err != nil {
+			c.logger.Warnf("Failed to persist job %s: %v", key, err)
+		}
+	}
+
+	return changed
+}
+
+// deleteJob removes a job and its pods
+func (c *Controller) deleteJob(job *types.Job) {
+	for _, pod := range job.Pods {
+		c.scheduler.RemovePod(pod.ID)
+	}
+	if err := c.storage.DeleteJob(job.Namespace, job.Name); err != nil {
+		c.logger.Warnf("Failed to delete job %s/%s: %v", job.Namespace, job.Name, err)
+	}
+}
+
+// finishedPods returns the pods that succeeded or failed
+func finishedPods(pods []*types.Pod) []*types.Pod {
+	var finished []*types.Pod
+	for _, pod := range pods {
+		if pod.State == types.PodStateSucceeded || pod.State == types.PodStateFailed {
+			finished = append(finished, pod)
+		}
+	}
+	return finished
+}
+
+// isFinished checks if a pod ran to completion and must not be started again
+func isFinished(pod *types.Pod) bool {
+	if pod.RestartPolicy == corev1.RestartPolicyAlways {
+		return false
+	}
+	return pod.State == types.PodStateSucceeded ||
+		(pod.State == types.PodStateFailed && pod.RestartPolicy == corev1.RestartPolicyNever)
+}
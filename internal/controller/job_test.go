@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/cluster"
+	"github.com/your-server-support/podman-swarm/internal/cron"
+	"github.com/your-server-support/podman-swarm/internal/parser"
+	"github.com/your-server-support/podman-swarm/internal/scheduler"
+	"github.com/your-server-support/podman-swarm/internal/storage"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func newJobTestController(t *testing.T) (*Controller, *storage.Storage) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	stor, err := storage.NewStorage(storage.StorageConfig{DataDir: t.TempDir(), Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	return &Controller{storage: stor, parser: parser.NewParser(), scheduler: scheduler.NewScheduler(nil, logger), logger: logger}, stor
+}
+
+func TestIsFinished(t *testing.T) {
+	tests := []struct {
+		policy   corev1.RestartPolicy
+		state    types.PodState
+		expected bool
+	}{
+		{corev1.RestartPolicyNever, types.PodStateSucceeded, true},
+		{corev1.RestartPolicyNever, types.PodStateFailed, true},
+		{corev1.RestartPolicyOnFailure, types.PodStateSucceeded, true},
+		{corev1.RestartPolicyOnFailure, types.PodStateFailed, false},
+		{corev1.RestartPolicyAlways, types.PodStateSucceeded, false},
+		{corev1.RestartPolicyNever, types.PodStateRunning, false},
+	}
+
+	for _, tt := range tests {
+		pod := &types.Pod{RestartPolicy: tt.policy, State: tt.state}
+		if got := isFinished(pod); got != tt.expected {
+			t.Errorf("isFinished(%s, %s) = %v, expected %v", tt.policy, tt.state, got, tt.expected)
+		}
+	}
+}
+
+func TestReconcileJobConditions(t *testing.T) {
+	c, stor := newJobTestController(t)
+	now := time.Now()
+
+	job := &types.Job{
+		Name:         "migrate",
+		Namespace:    "default",
+		Completions:  2,
+		Parallelism:  1,
+		BackoffLimit: 1,
+		Pods: []*types.Pod{
+			{Name: "migrate-0", State: types.PodStateSucceeded},
+			{Name: "migrate-1", State: types.PodStateSucceeded},
+		},
+	}
+	if !c.reconcileJob(job, now) {
+		t.Fatal("Expected job to be modified")
+	}
+	if job.Condition != types.JobComplete || job.Succeeded != 2 || job.CompletionTime != now.Unix() {
+		t.Errorf("Expected job to be complete, got %+v", job)
+	}
+	if _, err := stor.GetJob("default", "migrate"); err != nil {
+		t.Errorf("Expected job to be stored: %v", err)
+	}
+
+	// Finished jobs are left alone
+	if c.reconcileJob(job, now) {
+		t.Error("Expected finished job not to be modified")
+	}
+
+	job = &types.Job{
+		Name:         "flaky",
+		Namespace:    "default",
+		Completions:  1,
+		Parallelism:  1,
+		BackoffLimit: 1,
+		Pods: []*types.Pod{
+			{Name: "flaky-0", State: types.PodStateFailed},
+			{Name: "flaky-1", State: types.PodStateFailed, RestartCount: 1},
+		},
+	}
+	c.reconcileJob(job, now)
+	if job.Condition != types.JobFailed || job.Reason != reasonBackoffLimitExceeded || job.Failed != 2 {
+		t.Errorf("Expected backoff limit to be exceeded, got %+v", job)
+	}
+	if len(job.Pods) != 2 {
+		t.Errorf("Expected finished pods to be kept, got %d", len(job.Pods))
+	}
+}
+
+func TestSyncCronJobStatus(t *testing.T) {
+	c, stor := newJobTestController(t)
+
+	cj := &types.CronJob{
+		Name:                       "backup",
+		Namespace:                  "default",
+		SuccessfulJobsHistoryLimit: 1,
+		FailedJobsHistoryLimit:     0,
+	}
+	for _, job := range []*types.Job{
+		{Name: "backup-1", Condition: types.JobComplete, CompletionTime: 100},
+		{Name: "backup-2", Condition: types.JobComplete, CompletionTime: 200},
+		{Name: "backup-3", Condition: types.JobFailed, CompletionTime: 300},
+		{Name: "backup-4"},
+		{Name: "other-1", CompletionTime: 50},
+	} {
+		job.Namespace = "default"
+		if job.Name != "other-1" {
+			job.CronJob = "backup"
+		}
+		if err := stor.SaveJob(job); err != nil {
+			t.Fatalf("Failed to save job: %v", err)
+		}
+	}
+
+	if !c.syncCronJobStatus(cj) {
+		t.Fatal("Expected cron job status to change")
+	}
+	if len(cj.Active) != 1 || cj.Active[0] != "backup-4" {
+		t.Errorf("Expected backup-4 to be active, got %v", cj.Active)
+	}
+	if cj.LastSuccessfulTime != 200 {
+		t.Errorf("Expected last successful time 200, got %d", cj.LastSuccessfulTime)
+	}
+
+	var names []string
+	for _, job := range stor.ListJobs() {
+		names = append(names, job.Name)
+	}
+	for _, name := range []string{"backup-1", "backup-3"} {
+		if _, err := stor.GetJob("default", name); err == nil {
+			t.Errorf("Expected %s to be pruned, got jobs %v", name, names)
+		}
+	}
+	for _, name := range []string{"backup-2", "backup-4", "other-1"} {
+		if _, err := stor.GetJob("default", name); err != nil {
+			t.Errorf("Expected %s to be kept, got jobs %v", name, names)
+		}
+	}
+}
+
+func TestMostRecentRun(t *testing.T) {
+	schedule, err := cron.Parse("*/10 * * * *", time.UTC)
+	if err != nil {
+		t.Fatalf("Failed to parse schedule: %v", err)
+	}
+
+	since := time.Date(2024, 3, 13, 10, 0, 0, 0, time.UTC)
+
+	// Missed runs are collapsed into the latest one
+	now := time.Date(2024, 3, 13, 10, 35, 0, 0, time.UTC)
+	if run, err := mostRecentRun(schedule, since, now); err != nil || !run.Equal(time.Date(2024, 3, 13, 10, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected run at 10:30, got %s (%v)", run, err)
+	}
+
+	if run, err := mostRecentRun(schedule, since, since.Add(5*time.Minute)); err != nil || !run.IsZero() {
+		t.Errorf("Expected no run to be due, got %s (%v)", run, err)
+	}
+
+	// The scan gives up on too many missed runs
+	if _, err := mostRecentRun(schedule, since, since.Add(30*24*time.Hour)); err == nil {
+		t.Error("Expected a month of missed runs to be given up")
+	}
+}
+
+func TestReconcileCronJobMissedRuns(t *testing.T) {
+	c, _ := newJobTestController(t)
+	now := time.Date(2024, 3, 13, 10, 35, 0, 0, time.UTC)
+	since := now.Add(-30 * 24 * time.Hour)
+
+	cj := &types.CronJob{
+		Name:      "report",
+		Namespace: "default",
+		Schedule:  "*/10 * * * *",
+		TimeZone:  "UTC",
+		Suspend:   true,
+		CreatedAt: since.Unix(),
+	}
+
+	// Suspended cron jobs are left alone
+	if c.reconcileCronJob(cj, now, 0) || cj.LastScheduleTime != 0 {
+		t.Errorf("Expected suspended cron job not to be modified, got %+v", cj)
+	}
+
+	// Too many missed runs are given up without starting a job
+	cj.Suspend = false
+	if !c.reconcileCronJob(cj, now, 0) || cj.LastScheduleTime != now.Unix() || len(cj.Active) != 0 {
+		t.Errorf("Expected missed runs to be given up, got %+v", cj)
+	}
+
+	// The starting deadline bounds the scan, so the most recent run is scheduled
+	deadline := int64(3600)
+	cj.LastScheduleTime = 0
+	cj.StartingDeadlineSeconds = &deadline
+	if !c.reconcileCronJob(cj, now, 0) || cj.LastScheduleTime != time.Date(2024, 3, 13, 10, 30, 0, 0, time.UTC).Unix() {
+		t.Errorf("Expected the run at 10:30 to be scheduled, got %+v", cj)
+	}
+}
+
+func TestReconcileCronJobFenced(t *testing.T) {
+	c, stor := newJobTestController(t)
+	now := time.Date(2024, 3, 13, 10, 35, 0, 0, time.UTC)
+
+	cj := &types.CronJob{
+		Name:      "report",
+		Namespace: "default",
+		Schedule:  "*/10 * * * *",
+		TimeZone:  "UTC",
+		CreatedAt: now.Add(-time.Hour).Unix(),
+	}
+
+	// Another node took over the cron jobs lease with a higher token
+	if err := stor.Fence(cluster.LeaseCronJobs, 2); err != nil {
+		t.Fatalf("Failed to accept token: %v", err)
+	}
+	if c.reconcileCronJob(cj, now, 1) || cj.LastScheduleTime != 0 {
+		t.Errorf("Expected the former holder not to schedule a run, got %+v", cj)
+	}
+
+	if !c.reconcileCronJob(cj, now, 2) || cj.LastScheduleTime != time.Date(2024, 3, 13, 10, 30, 0, 0, time.UTC).Unix() {
+		t.Errorf("Expected the holder to schedule the run at 10:30, got %+v", cj)
+	}
+}
@@ -0,0 +1,422 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/containers/podman/v4/pkg/domain/entities"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/podman"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// syncLocalPods makes the Podman pods on this node match the pods assigned to
+// it in the cluster state: missing pods are created, exited containers are
+// restarted and pods that no longer exist are removed. The statuses of the
+// local pods are saved as pod statuses, the workloads are only written by the
+// leader.
+// Returns true if the status of a pod was modified.
+func (c *Controller) syncLocalPods() bool {
+	localNode := c.cluster.GetLocalNodeName()
+
+	// Volumes of claims must exist before the pods using them are created
+	c.syncLocalVolumes()
+
+	containers, err := c.podman.ListManagedContainers()
+	if err != nil {
+		c.logger.Warnf("Failed to list local containers: %v", err)
+		return false
+	}
+
+	// Group the containers by pod. Standalone containers were created before
+	// pods were run as Podman pods and are replaced.
+	existing := make(map[string][]entities.ListContainer)
+	for _, ctr := range containers {
+		if ctr.Pod == "" {
+			c.logger.Infof("Replacing standalone container %s of pod %s", ctr.ID, ctr.Labels[podman.LabelPodName])
+			if err := c.podman.RemoveContainer(ctr.ID); err != nil {
+				c.logger.Warnf("Failed to remove container %s: %v", ctr.ID, err)
+			}
+			continue
+		}
+		podID := ctr.Labels[podman.LabelPodID]
+		existing[podID] = append(existing[podID], ctr)
+	}
+
+	// Pods of this node by ID. Orphaned pods are removed first, so that
+	// recreated stateful set pods can take over the names of their predecessors.
+	pods := c.workloadPods()
+	wanted := make(map[string]bool)
+	for _, pod := range pods {
+		if pod.NodeName == localNode {
+			wanted[pod.ID] = true
+		}
+	}
+
+	// Remove pods that were deleted or moved to another node
+	for podID, ctrs := range existing {
+		if wanted[podID] {
+			continue
+		}
+		ctr := ctrs[0]
+		c.logger.Infof("Removing orphaned pod %s (%s)", ctr.Labels[podman.LabelPodName], ctr.Pod)
+		c.deregisterPod(&types.Pod{
+			ID:        podID,
+			Name:      ctr.Labels[podman.LabelPodName],
+			Namespace: ctr.Labels[podman.LabelNamespace],
+			Labels:    ctr.Labels,
+		})
+		if err := c.podman.StopPod(ctr.Pod); err != nil {
+			c.logger.Warnf("Failed to stop pod %s: %v", ctr.Pod, err)
+		}
+		if err := c.podman.RemovePod(ctr.Pod); err != nil {
+			c.logger.Warnf("Failed to remove pod %s: %v", ctr.Pod, err)
+		}
+	}
+
+	changed := false
+	var runningPods []*types.Pod
+
+	for _, pod := range pods {
+		if pod.NodeName != localNode {
+			continue
+		}
+
+		if c.syncLocalPod(pod, existing[pod.ID]) {
+			changed = true
+			c.savePodStatus(pod)
+		}
+		if pod.State == types.PodStateRunning {
+			runningPods = append(runningPods, pod)
+		}
+	}
+
+	if err := c.podman.PruneVolumes(wanted); err != nil {
+		c.logger.Warnf("Failed to remove volumes of orphaned pods: %v", err)
+	}
+
+	// Forget the restart state of pods that left this node
+	for key, state := range c.restarts {
+		if !wanted[state.podID] {
+			delete(c.restarts, key)
+		}
+	}
+
+	c.prober.Sync(runningPods)
+	c.scheduler.SyncPods(pods)
+
+	return changed
+}
+
+// workloadPods returns the pods of all workloads
+func (c *Controller) workloadPods() []*types.Pod {
+	var pods []*types.Pod
+	for _, dep := range c.storage.ListDeployments() {
+		pods = append(pods, dep.Pods...)
+	}
+	for _, set := range c.storage.ListStatefulSets() {
+		pods = append(pods, set.Pods...)
+	}
+	for _, ds := range c.storage.ListDaemonSets() {
+		pods = append(pods, ds.Pods...)
+	}
+	for _, job := range c.storage.ListJobs() {
+		pods = append(pods, job.Pods...)
+	}
+	return pods
+}
+
+// savePodStatus saves the status of a local pod
+func (c *Controller) savePodStatus(pod *types.Pod) {
+	status := &types.PodStatus{
+		ID:                pod.ID,
+		NodeName:          pod.NodeName,
+		PodmanID:          pod.PodmanID,
+		State:             pod.State,
+		Ready:             pod.Ready,
+		Reason:            pod.Reason,
+		RestartCount:      pod.RestartCount,
+		LastTermination:   pod.LastTermination,
+		ContainerStatuses: pod.ContainerStatuses,
+	}
+	if err := c.storage.SavePodStatus(status); err != nil {
+		c.logger.Warnf("Failed to persist status of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+}
+
+// collectPodStatuses removes the statuses of pods no workload lists any more
+func (c *Controller) collectPodStatuses() {
+	listed := make(map[string]bool)
+	for _, pod := range c.workloadPods() {
+		listed[pod.ID] = true
+	}
+	for _, status := range c.storage.ListPodStatuses() {
+		if listed[status.ID] {
+			continue
+		}
+		if err := c.storage.DeletePodStatus(status.ID); err != nil {
+			c.logger.Warnf("Failed to delete status of pod %s: %v", status.ID, err)
+		}
+	}
+}
+
+// syncLocalPod converges a single pod assigned to this node.
+// Returns true if the pod was modified.
+func (c *Controller) syncLocalPod(pod *types.Pod, ctrs []entities.ListContainer) bool {
+	before := *pod
+
+	switch {
+	case len(ctrs) == 0 && isFinished(pod):
+		// Pods that ran to completion are not started again
+	case len(ctrs) == 0:
+		if err := c.startLocalPod(pod); err != nil {
+			c.logger.Errorf("Failed to create pod %s: %v", pod.Name, err)
+			pod.State = types.PodStateFailed
+		}
+	default:
+		pod.PodmanID = ctrs[0].Pod
+		c.syncContainers(pod, ctrs)
+		c.refreshVolumes(pod)
+	}
+
+	pod.Ready = pod.State == types.PodStateRunning && c.prober.IsReady(pod)
+	if pod.State == types.PodStateRunning {
+		c.registerPod(pod)
+	}
+
+	return pod.State != before.State || pod.PodmanID != before.PodmanID || pod.Ready != before.Ready ||
+		pod.Reason != before.Reason || pod.RestartCount != before.RestartCount ||
+		!reflect.DeepEqual(pod.ContainerStatuses, before.ContainerStatuses)
+}
+
+// startLocalPod creates and starts the Podman pod of a pod on this node
+func (c *Controller) startLocalPod(pod *types.Pod) error {
+	// Retried on the next pass, e.g. once a missing ConfigMap was applied
+	data, err := c.podData(pod)
+	if err != nil {
+		c.logger.Warnf("Failed to resolve configuration of pod %s: %v", pod.Name, err)
+		pod.State = types.PodStatePending
+		pod.Reason = reasonCreateContainerConfigError
+		return nil
+	}
+
+	podmanID, err := c.podman.CreatePod(pod, data)
+	if err != nil {
+		return fmt.Errorf("failed to create pod: %w", err)
+	}
+
+	pod.PodmanID = podmanID
+	pod.ContainerStatuses = nil
+
+	// A failing init container fails the start, the restart policy takes over
+	if err := c.podman.StartPod(podmanID); err != nil {
+		c.logger.Warnf("Failed to start pod %s: %v", pod.Name, err)
+	}
+
+	ctrs, err := c.podman.ListPodContainers(pod.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+	c.syncContainers(pod, ctrs)
+
+	c.logger.Infof("Started pod %s (Podman pod %s)", pod.Name, podmanID)
+	return nil
+}
+
+// syncContainers updates the container statuses and the state of a pod from
+// its containers, and restarts exited containers by the pod's restart policy
+func (c *Controller) syncContainers(pod *types.Pod, ctrs []entities.ListContainer) {
+	byName := make(map[string]entities.ListContainer, len(ctrs))
+	for _, ctr := range ctrs {
+		byName[ctr.Labels[podman.LabelContainer]] = ctr
+	}
+
+	previous := make(map[string]types.ContainerStatus, len(pod.ContainerStatuses))
+	for _, status := range pod.ContainerStatuses {
+		previous[statusKey(status.Name, status.Init)] = status
+	}
+	statuses := make([]types.ContainerStatus, 0, len(pod.InitContainers)+len(pod.Containers))
+
+	notStarted := true
+	for _, container := range pod.Containers {
+		if ctr, ok := byName[container.Name]; ok && !isCreated(ctr.State) {
+			notStarted = false
+		}
+	}
+
+	// Init containers run when the Podman pod starts. If one of them failed,
+	// the containers never started and the whole pod is started again.
+	initFailed, initReason := false, ""
+	for _, container := range pod.InitContainers {
+		status := containerStatus(previous, container.Name, true, byName)
+		if ctr, ok := byName[container.Name]; ok && notStarted && !initFailed && isExited(ctr.State) && ctr.ExitCode != 0 {
+			initFailed = true
+
+			// Failed init containers are retried unless the policy is Never
+			policy := corev1.RestartPolicyOnFailure
+			if pod.RestartPolicy == corev1.RestartPolicyNever {
+				policy = corev1.RestartPolicyNever
+			}
+			initReason = c.handleExitedContainer(pod, &status, ctr, policy, func() error {
+				return c.podman.StartPod(pod.PodmanID)
+			})
+		}
+		statuses = append(statuses, status)
+	}
+
+	// Start pods that were created but never started
+	if notStarted && !initFailed && len(ctrs) > 0 {
+		if err := c.podman.StartPod(pod.PodmanID); err != nil {
+			c.logger.Warnf("Failed to start pod %s: %v", pod.Name, err)
+		}
+	}
+
+	reason := ""
+	for _, container := range pod.Containers {
+		status := containerStatus(previous, container.Name, false, byName)
+		if ctr, ok := byName[container.Name]; ok && !initFailed && isExited(ctr.State) {
+			r := c.handleExitedContainer(pod, &status, ctr, pod.RestartPolicy, func() error {
+				return c.podman.StartContainer(ctr.ID)
+			})
+			if reason == "" {
+				reason = r
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	pod.ContainerStatuses = statuses
+	pod.State = podState(pod, initFailed)
+	pod.Reason = reason
+	if initFailed {
+		pod.Reason = "Init:Error"
+		if initReason != "" {
+			pod.Reason = "Init:" + initReason
+		}
+	}
+
+	// Summarise the restarts and terminations of all containers
+	pod.RestartCount = 0
+	pod.LastTermination = nil
+	for _, status := range statuses {
+		pod.RestartCount += status.RestartCount
+		if t := status.LastTermination; t != nil && (pod.LastTermination == nil || t.FinishedAt >= pod.LastTermination.FinishedAt) {
+			pod.LastTermination = t
+		}
+	}
+}
+
+// refreshVolumes updates the configMap and secret volumes of a running pod
+func (c *Controller) refreshVolumes(pod *types.Pod) {
+	if !hasConfigVolumes(pod) {
+		return
+	}
+
+	volumes, err := c.podVolumes(pod)
+	if err != nil {
+		c.logger.Warnf("Failed to resolve volumes of pod %s: %v", pod.Name, err)
+		return
+	}
+	if err := c.podman.WriteVolumes(pod.ID, volumes); err != nil {
+		c.logger.Warnf("Failed to update volumes of pod %s: %v", pod.Name, err)
+	}
+}
+
+// podState derives the state of a pod from the statuses of its containers
+func podState(pod *types.Pod, initFailed bool) types.PodState {
+	if initFailed {
+		if pod.RestartPolicy == corev1.RestartPolicyNever {
+			return types.PodStateFailed
+		}
+		return types.PodStatePending
+	}
+
+	counts := make(map[types.PodState]int)
+	for _, status := range pod.ContainerStatuses {
+		if status.Init {
+			continue
+		}
+		exitCode := int32(0)
+		if status.LastTermination != nil {
+			exitCode = status.LastTermination.ExitCode
+		}
+		counts[podman.ContainerState(status.State, exitCode)]++
+	}
+
+	switch {
+	case counts[types.PodStateRunning] > 0:
+		return types.PodStateRunning
+	case counts[types.PodStatePending] > 0:
+		return types.PodStatePending
+	case counts[types.PodStateFailed] > 0:
+		return types.PodStateFailed
+	case len(pod.Containers) > 0 && counts[types.PodStateSucceeded] == len(pod.Containers):
+		return types.PodStateSucceeded
+	}
+	return types.PodStateUnknown
+}
+
+// containerStatus returns the current status of a container, keeping the
+// restarts recorded in earlier passes
+func containerStatus(previous map[string]types.ContainerStatus, name string, init bool, byName map[string]entities.ListContainer) types.ContainerStatus {
+	status, ok := previous[statusKey(name, init)]
+	if !ok {
+		status = types.ContainerStatus{Name: name, Init: init}
+	}
+
+	status.ContainerID, status.State = "", ""
+	if ctr, ok := byName[name]; ok {
+		status.ContainerID = ctr.ID
+		status.State = ctr.State
+	}
+	return status
+}
+
+func statusKey(name string, init bool) string {
+	if init {
+		return "init/" + name
+	}
+	return name
+}
+
+func isCreated(state string) bool {
+	return state == "created" || state == "configured" || state == "initialized"
+}
+
+func isExited(state string) bool {
+	return state == "exited" || state == "stopped"
+}
+
+// registerPod (re-)registers a running local pod with the services selecting it.
+// Re-registering on every pass keeps the endpoints fresh in service discovery.
+func (c *Controller) registerPod(pod *types.Pod) {
+	for _, svc := range c.storage.ListServices() {
+		if svc.Namespace == pod.Namespace && matchesSelector(pod.Labels, svc.Selector) {
+			if err := c.discovery.RegisterService(svc, pod); err != nil {
+				c.logger.Warnf("Failed to register service %s for pod %s: %v", svc.Name, pod.Name, err)
+			}
+		}
+	}
+}
+
+// deregisterPod removes a pod from the services selecting it
+func (c *Controller) deregisterPod(pod *types.Pod) {
+	for _, svc := range c.storage.ListServices() {
+		if svc.Namespace == pod.Namespace && matchesSelector(pod.Labels, svc.Selector) {
+			c.discovery.DeregisterService(svc, pod)
+		}
+	}
+}
+
+func matchesSelector(labels, selector map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	for key, value := range selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
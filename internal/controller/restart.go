@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/containers/podman/v4/pkg/domain/entities"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// Crash loop backoff, matching the kubelet
+const (
+	initialBackoff = 10 * time.Second
+	maxBackoff     = 5 * time.Minute
+
+	// A container that ran this long before exiting restarts without backoff
+	backoffResetAfter = 10 * time.Minute
+)
+
+// reasonCrashLoopBackOff is set on pods waiting for their container to be restarted
+const reasonCrashLoopBackOff = "CrashLoopBackOff"
+
+// restartState tracks the restarts of a container of a local pod
+type restartState struct {
+	podID       string
+	lastExit    int64         // ExitedAt of the last handled exit
+	backoff     time.Duration // Delay before the next restart
+	nextRestart time.Time
+}
+
+// handleExitedContainer records the termination of an exited container of a
+// local pod and restarts it if the restart policy says so. Containers that
+// keep exiting are restarted with an exponentially growing delay.
+// Returns the reason the container is waiting, if any.
+func (c *Controller) handleExitedContainer(pod *types.Pod, status *types.ContainerStatus, ctr entities.ListContainer, policy corev1.RestartPolicy, restart func() error) string {
+	key := pod.ID + "/" + statusKey(status.Name, status.Init)
+	state, ok := c.restarts[key]
+	if !ok {
+		state = &restartState{podID: pod.ID}
+		c.restarts[key] = state
+	}
+
+	if ctr.ExitedAt != state.lastExit {
+		state.lastExit = ctr.ExitedAt
+		status.LastTermination = &types.ContainerTermination{
+			ExitCode:   ctr.ExitCode,
+			Reason:     terminationReason(ctr.ExitCode),
+			FinishedAt: ctr.ExitedAt,
+		}
+
+		if time.Duration(ctr.ExitedAt-ctr.StartedAt)*time.Second >= backoffResetAfter {
+			state.backoff = 0
+		}
+		state.nextRestart = time.Now().Add(state.backoff)
+		if state.backoff > 0 {
+			// Come back when the backoff expires instead of waiting for the next pass
+			time.AfterFunc(state.backoff, c.triggerSync)
+		}
+		state.backoff = nextBackoff(state.backoff)
+	}
+
+	if !shouldRestart(policy, ctr.ExitCode) {
+		return ""
+	}
+
+	if time.Now().Before(state.nextRestart) {
+		return reasonCrashLoopBackOff
+	}
+
+	c.logger.Infof("Container %s of pod %s exited with code %d, restarting", status.Name, pod.Name, ctr.ExitCode)
+	if err := restart(); err != nil {
+		c.logger.Warnf("Failed to restart container %s of pod %s: %v", status.Name, pod.Name, err)
+		return ""
+	}
+
+	status.RestartCount++
+	status.State = "running"
+	return ""
+}
+
+// recordProbeRestart counts a restart of a container by the prober
+func (c *Controller) recordProbeRestart(restarted *types.Pod, container string, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, pod := range c.workloadPods() {
+		if pod.ID != restarted.ID {
+			continue
+		}
+
+		termination := &types.ContainerTermination{
+			Reason:     reason,
+			FinishedAt: time.Now().Unix(),
+		}
+		for i := range pod.ContainerStatuses {
+			status := &pod.ContainerStatuses[i]
+			if status.Name == container && !status.Init {
+				status.RestartCount++
+				status.LastTermination = termination
+			}
+		}
+		pod.RestartCount++
+		pod.LastTermination = termination
+
+		c.savePodStatus(pod)
+		c.broadcastState()
+		return
+	}
+}
+
+// watchContainerExits syncs the local pods as soon as a container exits, so
+// that restarts do not wait for the next reconciliation pass
+func (c *Controller) watchContainerExits() {
+	for {
+		err := c.podman.WatchContainerExits(c.stopCh, func(podID string, exitCode int32) {
+			c.logger.Debugf("Container of pod %s exited with code %d", podID, exitCode)
+			c.triggerSync()
+		})
+
+		select {
+		case <-c.stopCh:
+			return
+		default:
+		}
+
+		if err != nil {
+			c.logger.Warnf("Podman event stream failed: %v", err)
+		}
+
+		// Reconnect after a short delay
+		select {
+		case <-time.After(5 * time.Second):
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// triggerSync requests a sync of the local pods
+func (c *Controller) triggerSync() {
+	select {
+	case c.syncCh <- struct{}{}:
+	default:
+	}
+}
+
+// shouldRestart checks if the restart policy restarts a container that exited with exitCode
+func shouldRestart(policy corev1.RestartPolicy, exitCode int32) bool {
+	switch policy {
+	case corev1.RestartPolicyNever:
+		return false
+	case corev1.RestartPolicyOnFailure:
+		return exitCode != 0
+	}
+	return true
+}
+
+// nextBackoff returns the restart delay following the given one
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return initialBackoff
+	}
+	if backoff*2 > maxBackoff {
+		return maxBackoff
+	}
+	return backoff * 2
+}
+
+func terminationReason(exitCode int32) string {
+	if exitCode == 0 {
+		return "Completed"
+	}
+	return "Error"
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containers/podman/v4/pkg/domain/entities"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestShouldRestart(t *testing.T) {
+	tests := []struct {
+		policy   corev1.RestartPolicy
+		exitCode int32
+		expected bool
+	}{
+		{corev1.RestartPolicyAlways, 0, true},
+		{corev1.RestartPolicyAlways, 1, true},
+		{corev1.RestartPolicyOnFailure, 0, false},
+		{corev1.RestartPolicyOnFailure, 137, true},
+		{corev1.RestartPolicyNever, 1, false},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		if result := shouldRestart(tt.policy, tt.exitCode); result != tt.expected {
+			t.Errorf("shouldRestart(%q, %d) = %v, expected %v", tt.policy, tt.exitCode, result, tt.expected)
+		}
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	expected := []time.Duration{
+		10 * time.Second,
+		20 * time.Second,
+		40 * time.Second,
+		80 * time.Second,
+		160 * time.Second,
+		5 * time.Minute,
+		5 * time.Minute,
+	}
+
+	var backoff time.Duration
+	for i, want := range expected {
+		backoff = nextBackoff(backoff)
+		if backoff != want {
+			t.Errorf("Step %d: expected backoff %s, got %s", i, want, backoff)
+		}
+	}
+}
+
+func TestHandleExitedContainerBackoff(t *testing.T) {
+	c := &Controller{
+		restarts: map[string]*restartState{
+			"pod-1/web": {podID: "pod-1", lastExit: 100, backoff: 20 * time.Second},
+		},
+		syncCh: make(chan struct{}, 1),
+		logger: logrus.New(),
+	}
+
+	pod := &types.Pod{ID: "pod-1", Name: "web-0"}
+	status := &types.ContainerStatus{Name: "web"}
+	ctr := entities.ListContainer{ID: "abc", State: "exited", ExitCode: 1, StartedAt: 110, ExitedAt: 120}
+	restarted := false
+	restart := func() error {
+		restarted = true
+		return nil
+	}
+
+	reason := c.handleExitedContainer(pod, status, ctr, corev1.RestartPolicyAlways, restart)
+
+	if reason != reasonCrashLoopBackOff {
+		t.Errorf("Expected reason %s, got %q", reasonCrashLoopBackOff, reason)
+	}
+	if status.LastTermination == nil || status.LastTermination.ExitCode != 1 || status.LastTermination.Reason != "Error" {
+		t.Errorf("Unexpected last termination: %+v", status.LastTermination)
+	}
+	if restarted || status.RestartCount != 0 {
+		t.Errorf("Expected no restart during backoff, got %d", status.RestartCount)
+	}
+	if backoff := c.restarts["pod-1/web"].backoff; backoff != 40*time.Second {
+		t.Errorf("Expected backoff to double to 40s, got %s", backoff)
+	}
+
+	// The same exit is only recorded once
+	termination := status.LastTermination
+	c.handleExitedContainer(pod, status, ctr, corev1.RestartPolicyAlways, restart)
+	if status.LastTermination != termination || c.restarts["pod-1/web"].backoff != 40*time.Second {
+		t.Error("Expected an already handled exit to be ignored")
+	}
+
+	// Restart once the backoff expired
+	c.restarts["pod-1/web"].nextRestart = time.Now().Add(-time.Second)
+	if reason := c.handleExitedContainer(pod, status, ctr, corev1.RestartPolicyAlways, restart); reason != "" {
+		t.Errorf("Expected no waiting reason after restart, got %q", reason)
+	}
+	if !restarted || status.RestartCount != 1 || status.State != "running" {
+		t.Errorf("Expected container to be restarted, got %d restarts in state %q", status.RestartCount, status.State)
+	}
+}
+
+func TestHandleExitedContainerNever(t *testing.T) {
+	c := &Controller{restarts: make(map[string]*restartState), logger: logrus.New()}
+
+	pod := &types.Pod{ID: "pod-1", Name: "job-0"}
+	status := &types.ContainerStatus{Name: "job"}
+	ctr := entities.ListContainer{ID: "abc", State: "exited", ExitCode: 0, StartedAt: 100, ExitedAt: 130}
+
+	reason := c.handleExitedContainer(pod, status, ctr, corev1.RestartPolicyNever, func() error {
+		t.Error("Expected container not to be restarted")
+		return nil
+	})
+
+	if reason != "" || status.RestartCount != 0 {
+		t.Errorf("Expected container not to be restarted, got reason %q and %d restarts", reason, status.RestartCount)
+	}
+	if status.LastTermination == nil || status.LastTermination.Reason != "Completed" {
+		t.Errorf("Unexpected last termination: %+v", status.LastTermination)
+	}
+}
+
+func TestPodState(t *testing.T) {
+	pod := &types.Pod{
+		Containers: []types.Container{{Name: "app"}, {Name: "sidecar"}},
+		ContainerStatuses: []types.ContainerStatus{
+			{Name: "init", Init: true, State: "exited"},
+			{Name: "app", State: "running"},
+			{Name: "sidecar", State: "exited", LastTermination: &types.ContainerTermination{ExitCode: 1}},
+		},
+	}
+
+	if state := podState(pod, false); state != types.PodStateRunning {
+		t.Errorf("Expected Running with one running container, got %s", state)
+	}
+
+	pod.ContainerStatuses[1].State = "exited"
+	if state := podState(pod, false); state != types.PodStateFailed {
+		t.Errorf("Expected Failed with a failed container, got %s", state)
+	}
+
+	pod.ContainerStatuses[2].LastTermination.ExitCode = 0
+	if state := podState(pod, false); state != types.PodStateSucceeded {
+		t.Errorf("Expected Succeeded when all containers completed, got %s", state)
+	}
+
+	if state := podState(pod, true); state != types.PodStatePending {
+		t.Errorf("Expected Pending while init containers are retried, got %s", state)
+	}
+
+	pod.RestartPolicy = corev1.RestartPolicyNever
+	if state := podState(pod, true); state != types.PodStateFailed {
+		t.Errorf("Expected Failed when init containers are not retried, got %s", state)
+	}
+}
@@ -0,0 +1,322 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// ApplyDeployment stores an applied deployment and requests a reconciliation
+// pass, which converges it on the leader. Pods and rollout history of an
+// already applied deployment are kept; a changed template records a new
+// revision which the deployment strategy then rolls out.
+func (c *Controller) ApplyDeployment(dep *types.Deployment) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, err := c.storage.GetDeployment(dep.Namespace, dep.Name); err == nil {
+		dep.Pods = existing.Pods
+		dep.Replicas = existing.Replicas
+		dep.TemplateHash = existing.TemplateHash
+		dep.Revision = existing.Revision
+		dep.Revisions = existing.Revisions
+	}
+	ensureRevision(dep)
+
+	if err := c.storage.SaveDeployment(dep); err != nil {
+		return fmt.Errorf("failed to persist deployment: %w", err)
+	}
+
+	c.triggerReconcile()
+	return nil
+}
+
+// PauseRollout pauses the rollout of a deployment
+func (c *Controller) PauseRollout(namespace, name string) error {
+	return c.updateDeployment(namespace, name, func(dep *types.Deployment) error {
+		dep.Paused = true
+		return nil
+	})
+}
+
+// ResumeRollout resumes a paused rollout
+func (c *Controller) ResumeRollout(namespace, name string) error {
+	return c.updateDeployment(namespace, name, func(dep *types.Deployment) error {
+		dep.Paused = false
+		return nil
+	})
+}
+
+// UndoRollout rolls a deployment back to a previous revision.
+// Revision 0 means the revision before the current one.
+func (c *Controller) UndoRollout(namespace, name string, revision int64) error {
+	return c.updateDeployment(namespace, name, func(dep *types.Deployment) error {
+		target := findRevision(dep, revision)
+		if target == nil {
+			if revision == 0 {
+				return fmt.Errorf("no previous revision to roll back to")
+			}
+			return fmt.Errorf("revision %d not found", revision)
+		}
+
+		c.logger.Infof("Rolling back deployment %s/%s to revision %d", namespace, name, target.Revision)
+		dep.Template = target.Template
+		ensureRevision(dep)
+		return nil
+	})
+}
+
+// updateDeployment applies a change to a stored deployment and requests a
+// reconciliation pass to converge it
+func (c *Controller) updateDeployment(namespace, name string, update func(*types.Deployment) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dep, err := c.storage.GetDeployment(namespace, name)
+	if err != nil {
+		return err
+	}
+
+	if err := update(dep); err != nil {
+		return err
+	}
+
+	if err := c.storage.SaveDeployment(dep); err != nil {
+		return fmt.Errorf("failed to persist deployment: %w", err)
+	}
+
+	c.triggerReconcile()
+	return nil
+}
+
+// GetRolloutStatus returns the rollout progress of a deployment
+func GetRolloutStatus(dep *types.Deployment) *types.RolloutStatus {
+	newPods, oldPods := splitByRevision(dep.Pods, dep.TemplateHash)
+
+	status := &types.RolloutStatus{
+		Revision:  dep.Revision,
+		Desired:   dep.DesiredReplicas,
+		Updated:   int32(len(newPods)),
+		Available: countAvailable(newPods),
+		Old:       int32(len(oldPods)),
+		Paused:    dep.Paused,
+	}
+
+	switch {
+	case status.Updated >= status.Desired && status.Available >= status.Desired && status.Old == 0:
+		status.Complete = true
+		status.Message = fmt.Sprintf("deployment %q successfully rolled out", dep.Name)
+	case dep.Paused:
+		status.Message = fmt.Sprintf("deployment %q is paused", dep.Name)
+	case status.Old > 0:
+		status.Message = fmt.Sprintf("waiting for rollout to finish: %d of %d updated replicas are available, %d old replicas pending termination",
+			status.Available, status.Desired, status.Old)
+	default:
+		status.Message = fmt.Sprintf("waiting for rollout to finish: %d of %d updated replicas are available",
+			status.Available, status.Desired)
+	}
+
+	return status
+}
+
+// rollingUpdate performs one step of a rolling update. Pods of the current
+// revision are created while the total stays within maxSurge above the desired
+// count, and old pods are removed while at least DesiredReplicas-maxUnavailable
+// pods stay available. Unavailable old pods are removed first.
+func (c *Controller) rollingUpdate(dep *types.Deployment, newPods, oldPods []*types.Pod) ([]*types.Pod, bool) {
+	changed := false
+	key := fmt.Sprintf("%s/%s", dep.Namespace, dep.Name)
+	desired := int(dep.DesiredReplicas)
+	maxSurge, maxUnavailable := rollingUpdateLimits(dep)
+
+	// Scale up the current revision
+	for len(newPods) < desired && len(newPods)+len(oldPods) < desired+maxSurge {
+		existing := append(append([]*types.Pod{}, newPods...), oldPods...)
+		pod, err := c.scheduleDeploymentPod(dep, existing)
+		if err != nil {
+			c.logger.Errorf("Failed to schedule pod of deployment %s: %v", key, err)
+			break
+		}
+		newPods = append(newPods, pod)
+		changed = true
+	}
+
+	// Scale down old revisions
+	sort.SliceStable(oldPods, func(i, j int) bool {
+		return !isAvailable(oldPods[i]) && isAvailable(oldPods[j])
+	})
+	available := int(countAvailable(newPods) + countAvailable(oldPods))
+	minAvailable := desired - maxUnavailable
+
+	kept := make([]*types.Pod, 0, len(oldPods))
+	for _, pod := range oldPods {
+		remove := false
+		if !isAvailable(pod) {
+			remove = true
+		} else if available > minAvailable {
+			remove = true
+			available--
+		}
+
+		if !remove {
+			kept = append(kept, pod)
+			continue
+		}
+
+		c.logger.Infof("Rolling update of deployment %s: removing old pod %s", key, pod.Name)
+		c.scheduler.RemovePod(pod.ID)
+		changed = true
+	}
+
+	return append(newPods, kept...), changed
+}
+
+// recreate removes all pods of old revisions. Pods of the current revision are
+// created once no old pods are left.
+func (c *Controller) recreate(dep *types.Deployment, newPods, oldPods []*types.Pod) ([]*types.Pod, bool) {
+	for _, pod := range oldPods {
+		c.logger.Infof("Recreating deployment %s/%s: removing old pod %s", dep.Namespace, dep.Name, pod.Name)
+		c.scheduler.RemovePod(pod.ID)
+	}
+	return newPods, len(oldPods) > 0
+}
+
+// rollingUpdateLimits resolves maxSurge and maxUnavailable against the desired
+// replica count. Both default to 25%, surge rounds up and unavailable rounds
+// down. If both resolve to zero, one pod may be unavailable.
+func rollingUpdateLimits(dep *types.Deployment) (int, int) {
+	defaultValue := intstr.FromString("25%")
+	surge, unavailable := &defaultValue, &defaultValue
+
+	if ru := dep.Strategy.RollingUpdate; ru != nil {
+		if ru.MaxSurge != nil {
+			surge = ru.MaxSurge
+		}
+		if ru.MaxUnavailable != nil {
+			unavailable = ru.MaxUnavailable
+		}
+	}
+
+	desired := int(dep.DesiredReplicas)
+	maxSurge, err := intstr.GetScaledValueFromIntOrPercent(surge, desired, true)
+	if err != nil {
+		maxSurge = 1
+	}
+	maxUnavailable, err := intstr.GetScaledValueFromIntOrPercent(unavailable, desired, false)
+	if err != nil {
+		maxUnavailable = 0
+	}
+
+	if maxSurge == 0 && maxUnavailable == 0 {
+		maxUnavailable = 1
+	}
+
+	return maxSurge, maxUnavailable
+}
+
+// ensureRevision records a new revision if the template of a deployment changed.
+// Returns true if a revision was recorded.
+func ensureRevision(dep *types.Deployment) bool {
+	hash := templateHash(dep.Template)
+	if hash == dep.TemplateHash {
+		return false
+	}
+
+	// Pods created before revisions were tracked belong to the first revision
+	if dep.TemplateHash == "" {
+		for _, pod := range dep.Pods {
+			if pod.TemplateHash == "" {
+				pod.TemplateHash = hash
+			}
+		}
+	}
+
+	// Re-applying an older template moves its revision to the top
+	revisions := make([]types.DeploymentRevision, 0, len(dep.Revisions)+1)
+	for _, rev := range dep.Revisions {
+		if rev.TemplateHash != hash {
+			revisions = append(revisions, rev)
+		}
+	}
+
+	dep.Revision++
+	for _, rev := range dep.Revisions {
+		if rev.Revision >= dep.Revision {
+			dep.Revision = rev.Revision + 1
+		}
+	}
+
+	revisions = append(revisions, types.DeploymentRevision{
+		Revision:     dep.Revision,
+		TemplateHash: hash,
+		Template:     dep.Template,
+		CreatedAt:    time.Now().Unix(),
+	})
+
+	// Keep the current revision plus HistoryLimit old ones
+	if limit := int(dep.HistoryLimit) + 1; dep.HistoryLimit >= 0 && len(revisions) > limit {
+		revisions = revisions[len(revisions)-limit:]
+	}
+
+	dep.Revisions = revisions
+	dep.TemplateHash = hash
+	return true
+}
+
+// findRevision returns a recorded revision, or the one before the current
+// revision if revision is 0
+func findRevision(dep *types.Deployment, revision int64) *types.DeploymentRevision {
+	for i := len(dep.Revisions) - 1; i >= 0; i-- {
+		rev := &dep.Revisions[i]
+		if revision == 0 && rev.TemplateHash != dep.TemplateHash {
+			return rev
+		}
+		if revision != 0 && rev.Revision == revision {
+			return rev
+		}
+	}
+	return nil
+}
+
+// templateHash returns a short hash identifying a pod template
+func templateHash(template corev1.PodTemplateSpec) string {
+	data, _ := json.Marshal(template)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// splitByRevision splits pods into those of the given template hash and the rest
+func splitByRevision(pods []*types.Pod, hash string) (current, old []*types.Pod) {
+	for _, pod := range pods {
+		if pod.TemplateHash == hash {
+			current = append(current, pod)
+		} else {
+			old = append(old, pod)
+		}
+	}
+	return current, old
+}
+
+// isAvailable checks if a pod can serve traffic
+func isAvailable(pod *types.Pod) bool {
+	return pod.State == types.PodStateRunning && pod.Ready
+}
+
+// countAvailable returns the number of available pods
+func countAvailable(pods []*types.Pod) int32 {
+	var count int32
+	for _, pod := range pods {
+		if isAvailable(pod) {
+			count++
+		}
+	}
+	return count
+}
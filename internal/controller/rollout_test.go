@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func testDeployment(image string) *types.Deployment {
+	return &types.Deployment{
+		Name:            "web",
+		Namespace:       "default",
+		DesiredReplicas: 4,
+		HistoryLimit:    2,
+		Template: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "web", Image: image}},
+			},
+		},
+	}
+}
+
+func TestRollingUpdateLimits(t *testing.T) {
+	dep := testDeployment("nginx:1.25")
+
+	surge, unavailable := rollingUpdateLimits(dep)
+	if surge != 1 || unavailable != 1 {
+		t.Errorf("Expected default limits 1/1, got %d/%d", surge, unavailable)
+	}
+
+	zero := intstr.FromInt(0)
+	two := intstr.FromInt(2)
+	dep.Strategy = appsv1.DeploymentStrategy{
+		RollingUpdate: &appsv1.RollingUpdateDeployment{MaxSurge: &two, MaxUnavailable: &zero},
+	}
+	surge, unavailable = rollingUpdateLimits(dep)
+	if surge != 2 || unavailable != 0 {
+		t.Errorf("Expected limits 2/0, got %d/%d", surge, unavailable)
+	}
+
+	dep.Strategy.RollingUpdate.MaxSurge = &zero
+	surge, unavailable = rollingUpdateLimits(dep)
+	if surge != 0 || unavailable != 1 {
+		t.Errorf("Expected limits 0/1 when both are zero, got %d/%d", surge, unavailable)
+	}
+}
+
+func TestEnsureRevision(t *testing.T) {
+	dep := testDeployment("nginx:1.25")
+	dep.Pods = []*types.Pod{{Name: "web-0"}}
+
+	if !ensureRevision(dep) {
+		t.Fatal("Expected first revision to be recorded")
+	}
+	if dep.Revision != 1 || len(dep.Revisions) != 1 {
+		t.Fatalf("Expected revision 1, got %d with %d revisions", dep.Revision, len(dep.Revisions))
+	}
+	if dep.Pods[0].TemplateHash != dep.TemplateHash {
+		t.Error("Expected legacy pod to be adopted by the first revision")
+	}
+
+	if ensureRevision(dep) {
+		t.Error("Expected unchanged template to keep the revision")
+	}
+
+	first := dep.TemplateHash
+	dep.Template.Spec.Containers[0].Image = "nginx:1.26"
+	ensureRevision(dep)
+	if dep.Revision != 2 || dep.TemplateHash == first {
+		t.Errorf("Expected revision 2 with a new hash, got %d", dep.Revision)
+	}
+
+	// Re-applying the first template moves it to the top
+	dep.Template.Spec.Containers[0].Image = "nginx:1.25"
+	ensureRevision(dep)
+	if dep.Revision != 3 || dep.TemplateHash != first {
+		t.Errorf("Expected revision 3 with the first hash, got %d", dep.Revision)
+	}
+	if len(dep.Revisions) != 2 {
+		t.Errorf("Expected 2 revisions, got %d", len(dep.Revisions))
+	}
+
+	// History is limited to HistoryLimit old revisions
+	for _, image := range []string{"nginx:1.27", "nginx:1.28", "nginx:1.29"} {
+		dep.Template.Spec.Containers[0].Image = image
+		ensureRevision(dep)
+	}
+	if len(dep.Revisions) != 3 {
+		t.Errorf("Expected 3 revisions, got %d", len(dep.Revisions))
+	}
+}
+
+func TestFindRevision(t *testing.T) {
+	dep := testDeployment("nginx:1.25")
+	ensureRevision(dep)
+	dep.Template.Spec.Containers[0].Image = "nginx:1.26"
+	ensureRevision(dep)
+
+	prev := findRevision(dep, 0)
+	if prev == nil || prev.Revision != 1 {
+		t.Fatalf("Expected previous revision 1, got %v", prev)
+	}
+
+	if rev := findRevision(dep, 2); rev == nil || rev.TemplateHash != dep.TemplateHash {
+		t.Error("Expected to find the current revision")
+	}
+
+	if rev := findRevision(dep, 7); rev != nil {
+		t.Errorf("Expected unknown revision to be nil, got %d", rev.Revision)
+	}
+}
+
+func TestGetRolloutStatus(t *testing.T) {
+	dep := testDeployment("nginx:1.25")
+	dep.DesiredReplicas = 2
+	ensureRevision(dep)
+
+	dep.Pods = []*types.Pod{
+		{Name: "web-0", TemplateHash: "old", State: types.PodStateRunning, Ready: true},
+		{Name: "web-1", TemplateHash: dep.TemplateHash, State: types.PodStateRunning, Ready: true},
+		{Name: "web-2", TemplateHash: dep.TemplateHash, State: types.PodStatePending},
+	}
+
+	status := GetRolloutStatus(dep)
+	if status.Complete {
+		t.Error("Expected rollout to be in progress")
+	}
+	if status.Updated != 2 || status.Available != 1 || status.Old != 1 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	dep.Pods = dep.Pods[1:]
+	dep.Pods[1].State = types.PodStateRunning
+	dep.Pods[1].Ready = true
+	if status := GetRolloutStatus(dep); !status.Complete {
+		t.Errorf("Expected rollout to be complete: %+v", status)
+	}
+}
+
+func TestApplyDeploymentLeavesSchedulingToReconcile(t *testing.T) {
+	c, stor := newJobTestController(t)
+	c.reconcileCh = make(chan struct{}, 1)
+
+	if err := c.ApplyDeployment(testDeployment("nginx:1.25")); err != nil {
+		t.Fatalf("Failed to apply deployment: %v", err)
+	}
+
+	// Any node may receive the request, only the reconciliation pass of the
+	// leader schedules the pods
+	dep, err := stor.GetDeployment("default", "web")
+	if err != nil {
+		t.Fatalf("Expected deployment to be stored: %v", err)
+	}
+	if len(dep.Pods) != 0 || dep.Revision != 1 {
+		t.Errorf("Expected revision 1 without pods, got revision %d with %d pods", dep.Revision, len(dep.Pods))
+	}
+	select {
+	case <-c.reconcileCh:
+	default:
+		t.Error("Expected a reconciliation pass to be requested")
+	}
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/your-server-support/podman-swarm/internal/cluster"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// defaultTerminationGracePeriod is the time containers get to stop, like in Kubernetes
+const defaultTerminationGracePeriod = 30 * time.Second
+
+// drainRetryInterval is the time between evictions while pod disruption
+// budgets block a drain on shutdown
+const drainRetryInterval = 2 * time.Second
+
+// Shutdown takes the local node out of service before the agent exits. The
+// node is cordoned so that no new pods are scheduled to it and the
+// reconciliation stops. With drain the pods of deployments and stateful sets
+// are moved to other nodes as far as the pod disruption budgets allow before
+// ctx is done. Then the endpoints of the local pods are deregistered and the
+// pods are stopped gracefully. Pods that were not moved are started again
+// when the agent comes back.
+func (c *Controller) Shutdown(ctx context.Context, drain bool) {
+	localNode := c.cluster.GetLocalNodeName()
+	unschedulable := true
+	if err := c.cluster.PatchNode(localNode, &cluster.NodePatch{Unschedulable: &unschedulable}); err != nil {
+		c.logger.Warnf("Failed to cordon node %s: %v", localNode, err)
+	}
+	c.Stop()
+
+	c.mu.Lock()
+	var pods []*types.Pod
+	for _, pod := range c.workloadPods() {
+		if pod.NodeName == localNode && pod.PodmanID != "" {
+			pods = append(pods, pod)
+		}
+	}
+	c.mu.Unlock()
+
+	evicted := make(map[string]bool)
+	if drain {
+		evicted = c.drain(ctx, localNode)
+	}
+
+	// Stop sending traffic to the pods before they are stopped
+	c.mu.Lock()
+	for _, pod := range pods {
+		c.deregisterPod(pod)
+	}
+	c.mu.Unlock()
+
+	c.logger.Infof("Stopping %d local pods", len(pods))
+	var wg sync.WaitGroup
+	for _, pod := range pods {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.terminatePod(ctx, pod, evicted[fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)])
+		}()
+	}
+	wg.Wait()
+}
+
+// drain evicts the pods of deployments and stateful sets from a node until no
+// pod disruption budget blocks an eviction any more or ctx is done. The
+// evicted pods are not removed, the caller stops them gracefully.
+// Returns the evicted pods by namespace/name.
+func (c *Controller) drain(ctx context.Context, nodeName string) map[string]bool {
+	evicted := make(map[string]bool)
+	for {
+		c.mu.Lock()
+		result := c.evictWorkloads(func(pod *types.Pod) bool {
+			return pod.NodeName == nodeName
+		}, true)
+		c.broadcastState()
+		c.mu.Unlock()
+
+		for _, name := range result.Evicted {
+			evicted[name] = true
+		}
+		if len(result.Blocked) == 0 {
+			return evicted
+		}
+
+		c.logger.Infof("Waiting for replacements before evicting %d more pods from node %s", len(result.Blocked), nodeName)
+		select {
+		case <-ctx.Done():
+			c.logger.Warnf("Shutting down without evicting pods %v, their disruption budgets do not allow it", result.Blocked)
+			return evicted
+		case <-time.After(drainRetryInterval):
+		}
+	}
+}
+
+// terminatePod stops a local pod like the kubelet: the preStop hooks run
+// first, then the containers get the rest of the termination grace period to
+// exit before they are killed. The grace period is cut short when ctx is done.
+func (c *Controller) terminatePod(ctx context.Context, pod *types.Pod, remove bool) {
+	deadline := time.Now().Add(terminationGracePeriod(pod))
+	if limit, ok := ctx.Deadline(); ok && limit.Before(deadline) {
+		deadline = limit
+	}
+
+	c.prober.RunPreStopHooks(pod, time.Until(deadline))
+
+	if err := c.podman.StopPodWithTimeout(pod.PodmanID, max(time.Until(deadline), 0)); err != nil {
+		c.logger.Warnf("Failed to stop pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+	if !remove {
+		return
+	}
+	if err := c.podman.RemovePod(pod.PodmanID); err != nil {
+		c.logger.Warnf("Failed to remove pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+}
+
+// terminationGracePeriod returns the time the containers of a pod get to stop
+func terminationGracePeriod(pod *types.Pod) time.Duration {
+	if pod.TerminationGracePeriod != nil && *pod.TerminationGracePeriod >= 0 {
+		return time.Duration(*pod.TerminationGracePeriod) * time.Second
+	}
+	return defaultTerminationGracePeriod
+}
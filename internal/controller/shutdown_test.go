@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestTerminationGracePeriod(t *testing.T) {
+	if period := terminationGracePeriod(&types.Pod{}); period != 30*time.Second {
+		t.Errorf("Expected the default grace period of 30s, got %s", period)
+	}
+
+	seconds := int64(5)
+	if period := terminationGracePeriod(&types.Pod{TerminationGracePeriod: &seconds}); period != 5*time.Second {
+		t.Errorf("Expected the grace period of the pod, got %s", period)
+	}
+
+	// Zero kills the containers right away
+	seconds = 0
+	if period := terminationGracePeriod(&types.Pod{TerminationGracePeriod: &seconds}); period != 0 {
+		t.Errorf("Expected no grace period, got %s", period)
+	}
+}
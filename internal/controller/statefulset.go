@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// Label carrying the name of a stateful set pod, for services selecting a single pod
+const labelStatefulSetPodName = "statefulset.kubernetes.io/pod-name"
+
+// ApplyStatefulSet stores an applied stateful set and requests a
+// reconciliation pass, which converges it on the leader. Pods of an already
+// applied stateful set are kept.
+func (c *Controller) ApplyStatefulSet(set *types.StatefulSet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, err := c.storage.GetStatefulSet(set.Namespace, set.Name); err == nil {
+		set.Pods = existing.Pods
+		set.Replicas = existing.Replicas
+		set.TemplateHash = existing.TemplateHash
+	}
+
+	if err := c.storage.SaveStatefulSet(set); err != nil {
+		return fmt.Errorf("failed to persist stateful set: %w", err)
+	}
+
+	c.triggerReconcile()
+	return nil
+}
+
+// reconcileStatefulSet converges the pods of a stateful set to DesiredReplicas.
+// Pod "<name>-<i>" is only created once pods 0..i-1 are available and surplus
+// pods are removed from the highest ordinal down, one per pass, unless the pod
+// management policy is Parallel. A pod that is lost is recreated under the same
+// name with the same volume claims, which pin it to the node of its volumes.
+// Returns true if the stateful set was modified.
+func (c *Controller) reconcileStatefulSet(set *types.StatefulSet) bool {
+	changed := false
+	key := fmt.Sprintf("%s/%s", set.Namespace, set.Name)
+	ordered := set.PodManagementPolicy != appsv1.ParallelPodManagement
+
+	if hash := templateHash(set.Template); hash != set.TemplateHash {
+		set.TemplateHash = hash
+		changed = true
+	}
+
+	// Index the pods by ordinal, dropping pods whose node is no longer a cluster member
+	pods := make(map[int]*types.Pod, len(set.Pods))
+	for _, pod := range set.Pods {
+		if _, err := c.cluster.GetNode(pod.NodeName); err != nil {
+			c.logger.Warnf("Node %s of pod %s is gone, recreating", pod.NodeName, pod.Name)
+			c.scheduler.RemovePod(pod.ID)
+			changed = true
+			continue
+		}
+		ordinal, ok := podOrdinal(set.Name, pod.Name)
+		if !ok || pods[ordinal] != nil {
+			c.scheduler.RemovePod(pod.ID)
+			changed = true
+			continue
+		}
+		pods[ordinal] = pod
+	}
+
+	// Scale down from the highest ordinal, volume claims are kept
+	for _, ordinal := range descendingOrdinals(pods) {
+		if ordinal < int(set.DesiredReplicas) {
+			break
+		}
+		c.logger.Infof("Removing pod %s of stateful set %s", pods[ordinal].Name, key)
+		c.scheduler.RemovePod(pods[ordinal].ID)
+		delete(pods, ordinal)
+		changed = true
+		if ordered {
+			break
+		}
+	}
+
+	if c.updateStatefulSet(set, pods) {
+		changed = true
+	}
+
+	// Create missing pods in ordinal order
+	for ordinal := 0; ordinal < int(set.DesiredReplicas); ordinal++ {
+		pod := pods[ordinal]
+		if pod == nil {
+			var err error
+			pod, err = c.scheduleStatefulSetPod(set, ordinal)
+			if err != nil {
+				c.logger.Errorf("Failed to schedule pod %s-%d of stateful set %s: %v", set.Name, ordinal, key, err)
+				break
+			}
+			pods[ordinal] = pod
+			changed = true
+		}
+		if ordered && !isAvailable(pod) {
+			break
+		}
+	}
+
+	ordinals := descendingOrdinals(pods)
+	live := make([]*types.Pod, 0, len(ordinals))
+	for i := len(ordinals) - 1; i >= 0; i-- {
+		live = append(live, pods[ordinals[i]])
+	}
+	set.Pods = live
+
+	if ready := countRunning(live); set.Replicas != ready {
+		set.Replicas = ready
+		changed = true
+	}
+
+	if changed {
+		if err := c.storage.SaveStatefulSet(set); err != nil {
+			c.logger.Warnf("Failed to persist stateful set %s: %v", key, err)
+		}
+	}
+
+	return changed
+}
+
+// updateStatefulSet performs one step of a rolling update: the pod with the
+// highest ordinal at or above the partition that runs an old template is
+// removed once all other pods are available, and recreated from the current
+// template. Returns true if a pod was removed.
+func (c *Controller) updateStatefulSet(set *types.StatefulSet, pods map[int]*types.Pod) bool {
+	if set.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return false
+	}
+
+	partition := 0
+	if rolling := set.UpdateStrategy.RollingUpdate; rolling != nil && rolling.Partition != nil {
+		partition = int(*rolling.Partition)
+	}
+
+	for _, ordinal := range descendingOrdinals(pods) {
+		pod := pods[ordinal]
+		if ordinal < partition || pod.TemplateHash == set.TemplateHash {
+			continue
+		}
+
+		for other, p := range pods {
+			if other != ordinal && !isAvailable(p) {
+				return false
+			}
+		}
+
+		c.logger.Infof("Updating pod %s of stateful set %s/%s", pod.Name, set.Namespace, set.Name)
+		c.scheduler.RemovePod(pod.ID)
+		delete(pods, ordinal)
+		return true
+	}
+
+	return false
+}
+
+// scheduleStatefulSetPod creates the pod with the given ordinal from the
+// current template of a stateful set, with its volume claims, and schedules it
+func (c *Controller) scheduleStatefulSetPod(set *types.StatefulSet, ordinal int) (*types.Pod, error) {
+	pod := c.newPod(set.Template, set.Namespace, fmt.Sprintf("%s-%d", set.Name, ordinal))
+	pod.TemplateHash = set.TemplateHash
+	pod.Hostname = pod.Name
+	pod.Subdomain = set.ServiceName
+
+	labels := make(map[string]string, len(pod.Labels)+1)
+	for k, v := range pod.Labels {
+		labels[k] = v
+	}
+	labels[labelStatefulSetPodName] = pod.Name
+	pod.Labels = labels
+
+	// Claim templates replace template volumes of the same name
+	volumes := make([]corev1.Volume, 0, len(pod.Volumes)+len(set.VolumeClaimTemplates))
+	for _, volume := range pod.Volumes {
+		if !hasClaimTemplate(set, volume.Name) {
+			volumes = append(volumes, volume)
+		}
+	}
+	for _, template := range set.VolumeClaimTemplates {
+		claimName, err := c.ensureStatefulSetClaim(set, template, ordinal)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name: template.Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+			},
+		})
+	}
+	pod.Volumes = volumes
+
+	nodeName, err := c.schedulePod(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Infof("Scheduled pod %s of stateful set %s/%s to node %s", pod.Name, set.Namespace, set.Name, nodeName)
+	return pod, nil
+}
+
+// ensureStatefulSetClaim creates the claim "<template>-<name>-<ordinal>" of a
+// stateful set pod unless it exists. Claims outlive their pods and the stateful
+// set, so that a recreated pod gets its volume back.
+func (c *Controller) ensureStatefulSetClaim(set *types.StatefulSet, template corev1.PersistentVolumeClaim, ordinal int) (string, error) {
+	name := fmt.Sprintf("%s-%s-%d", template.Name, set.Name, ordinal)
+	if _, err := c.storage.GetPersistentVolumeClaim(set.Namespace, name); err == nil {
+		return name, nil
+	}
+
+	spec := template.DeepCopy()
+	spec.Name = name
+	spec.Namespace = set.Namespace
+
+	claim, err := c.parser.ParsePersistentVolumeClaim(spec)
+	if err != nil {
+		return "", err
+	}
+	claim.CreatedAt = time.Now().Unix()
+
+	if err := c.storage.SavePersistentVolumeClaim(claim); err != nil {
+		return "", fmt.Errorf("failed to persist volume claim %s: %w", name, err)
+	}
+
+	c.logger.Infof("Created volume claim %s/%s for stateful set %s", set.Namespace, name, set.Name)
+	return name, nil
+}
+
+func hasClaimTemplate(set *types.StatefulSet, name string) bool {
+	for _, template := range set.VolumeClaimTemplates {
+		if template.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// podOrdinal returns the ordinal of a pod named "<name>-<ordinal>"
+func podOrdinal(setName, podName string) (int, bool) {
+	suffix, ok := strings.CutPrefix(podName, setName+"-")
+	if !ok {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(suffix)
+	if err != nil || ordinal < 0 || strconv.Itoa(ordinal) != suffix {
+		return 0, false
+	}
+	return ordinal, true
+}
+
+// descendingOrdinals returns the ordinals of pods, highest first
+func descendingOrdinals(pods map[int]*types.Pod) []int {
+	ordinals := make([]int, 0, len(pods))
+	for ordinal := range pods {
+		ordinals = append(ordinals, ordinal)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ordinals)))
+	return ordinals
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/parser"
+	"github.com/your-server-support/podman-swarm/internal/scheduler"
+	"github.com/your-server-support/podman-swarm/internal/storage"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestPodOrdinal(t *testing.T) {
+	tests := []struct {
+		podName  string
+		ordinal  int
+		expected bool
+	}{
+		{"web-0", 0, true},
+		{"web-12", 12, true},
+		{"web-01", 0, false},
+		{"web--1", 0, false},
+		{"web-a", 0, false},
+		{"web-db-0", 0, false},
+		{"api-0", 0, false},
+	}
+
+	for _, tt := range tests {
+		ordinal, ok := podOrdinal("web", tt.podName)
+		if ok != tt.expected || ordinal != tt.ordinal {
+			t.Errorf("podOrdinal(%q) = %d, %v, expected %d, %v", tt.podName, ordinal, ok, tt.ordinal, tt.expected)
+		}
+	}
+}
+
+func TestUpdateStatefulSet(t *testing.T) {
+	logger := logrus.New()
+	c := &Controller{scheduler: scheduler.NewScheduler(nil, logger), logger: logger}
+
+	partition := int32(1)
+	set := &types.StatefulSet{
+		Name:         "web",
+		Namespace:    "default",
+		TemplateHash: "new",
+		UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+			Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+		},
+	}
+	pods := make(map[int]*types.Pod)
+	for i := 0; i < 3; i++ {
+		pods[i] = &types.Pod{Name: fmt.Sprintf("web-%d", i), State: types.PodStateRunning, Ready: true, TemplateHash: "old"}
+	}
+
+	// The highest ordinal is updated first
+	if !c.updateStatefulSet(set, pods) || pods[2] != nil {
+		t.Fatal("Expected web-2 to be removed for the update")
+	}
+
+	// Updates wait for the other pods to be available
+	pods[2] = &types.Pod{Name: "web-2", State: types.PodStatePending, TemplateHash: "new"}
+	if c.updateStatefulSet(set, pods) {
+		t.Fatal("Expected the update to wait for web-2")
+	}
+
+	// Pods below the partition keep their template
+	pods[2].State, pods[2].Ready = types.PodStateRunning, true
+	if !c.updateStatefulSet(set, pods) || pods[1] != nil {
+		t.Fatal("Expected web-1 to be removed for the update")
+	}
+	pods[1] = &types.Pod{Name: "web-1", State: types.PodStateRunning, Ready: true, TemplateHash: "new"}
+	if c.updateStatefulSet(set, pods) || pods[0] == nil {
+		t.Error("Expected web-0 below the partition not to be updated")
+	}
+
+	set.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+	pods[1].TemplateHash = "old"
+	if c.updateStatefulSet(set, pods) {
+		t.Error("Expected OnDelete stateful sets not to be updated")
+	}
+}
+
+func TestEnsureStatefulSetClaim(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	stor, err := storage.NewStorage(storage.StorageConfig{DataDir: t.TempDir(), Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	c := &Controller{storage: stor, parser: parser.NewParser(), logger: logger}
+
+	set := &types.StatefulSet{Name: "db", Namespace: "default"}
+	template := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+			},
+		},
+	}
+
+	name, err := c.ensureStatefulSetClaim(set, template, 1)
+	if err != nil {
+		t.Fatalf("Failed to create claim: %v", err)
+	}
+	if name != "data-db-1" {
+		t.Errorf("Expected claim data-db-1, got %s", name)
+	}
+
+	claim, err := stor.GetPersistentVolumeClaim("default", "data-db-1")
+	if err != nil {
+		t.Fatalf("Expected claim to be stored: %v", err)
+	}
+	if claim.Phase != corev1.ClaimPending || len(claim.AccessModes) != 1 {
+		t.Errorf("Unexpected claim: %+v", claim)
+	}
+
+	// An existing claim keeps its binding
+	claim.NodeName = "node-2"
+	if err := stor.SavePersistentVolumeClaim(claim); err != nil {
+		t.Fatalf("Failed to save claim: %v", err)
+	}
+	if _, err := c.ensureStatefulSetClaim(set, template, 1); err != nil {
+		t.Fatalf("Failed to ensure claim: %v", err)
+	}
+	if claim, _ := stor.GetPersistentVolumeClaim("default", "data-db-1"); claim.NodeName != "node-2" {
+		t.Errorf("Expected existing claim to be kept, got node %q", claim.NodeName)
+	}
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/podman"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// schedulePod schedules a pod and binds the unbound volume claims it uses to
+// the node it was scheduled to
+func (c *Controller) schedulePod(pod *types.Pod) (string, error) {
+	nodeName, err := c.scheduler.SchedulePod(pod)
+	if err != nil {
+		return "", err
+	}
+
+	c.bindClaims(pod, nodeName)
+	return nodeName, nil
+}
+
+// schedulePodOnNode schedules a pod to the given node and binds the unbound
+// volume claims it uses to that node
+func (c *Controller) schedulePodOnNode(pod *types.Pod, node *types.Node) error {
+	if err := c.scheduler.SchedulePodOnNode(pod, node); err != nil {
+		return err
+	}
+
+	c.bindClaims(pod, node.Name)
+	return nil
+}
+
+// bindClaims binds the unbound volume claims used by a pod to its node
+func (c *Controller) bindClaims(pod *types.Pod, nodeName string) {
+	for _, volume := range pod.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		claim, err := c.storage.GetPersistentVolumeClaim(pod.Namespace, volume.PersistentVolumeClaim.ClaimName)
+		if err != nil || claim.NodeName != "" {
+			continue
+		}
+
+		claim.NodeName = nodeName
+		claim.VolumeName = podman.ClaimVolumeName(claim.Namespace, claim.Name)
+		claim.Phase = corev1.ClaimBound
+		if err := c.storage.SavePersistentVolumeClaim(claim); err != nil {
+			c.logger.Warnf("Failed to persist volume claim %s/%s: %v", claim.Namespace, claim.Name, err)
+		}
+		c.logger.Infof("Bound volume claim %s/%s to node %s", claim.Namespace, claim.Name, nodeName)
+	}
+}
+
+// syncLocalVolumes provisions the Podman volumes of the claims bound to this
+// node. Volumes outlive their claims and are only removed manually.
+func (c *Controller) syncLocalVolumes() {
+	localNode := c.cluster.GetLocalNodeName()
+
+	volumes, err := c.podman.ListManagedVolumes()
+	if err != nil {
+		c.logger.Warnf("Failed to list local volumes: %v", err)
+		return
+	}
+
+	existing := make(map[string]bool, len(volumes))
+	for _, volume := range volumes {
+		existing[volume.Name] = true
+	}
+
+	for _, claim := range c.storage.ListPersistentVolumeClaims() {
+		if claim.NodeName != localNode || claim.VolumeName == "" || existing[claim.VolumeName] {
+			continue
+		}
+		if err := c.podman.CreateVolume(claim); err != nil {
+			c.logger.Warnf("Failed to provision volume of claim %s/%s: %v", claim.Namespace, claim.Name, err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/your-server-support/podman-swarm/internal/cluster"
 	"github.com/your-server-support/podman-swarm/internal/types"
@@ -18,6 +19,7 @@ type ServiceEndpoint struct {
 	Namespace   string
 	PodID       string
 	PodName     string
+	Hostname    string // Set for pods with a DNS name under a headless service
 	NodeName    string
 	Address     string
 	Port        int32
@@ -92,10 +94,19 @@ func (d *Discovery) RegisterService(service *types.Service, pod *types.Pod) erro
 		NodeName:    pod.NodeName,
 		Address:     nodeAddress, // Use actual node address
 		Port:        port,
-		Healthy:     true,
+		Healthy:     pod.Ready,
 		LastSeen:    time.Now(),
 	}
 
+	// Pods get a DNS name of their own under the headless service named by
+	// their subdomain, e.g. the pods of a stateful set
+	if service.ClusterIP == corev1.ClusterIPNone && pod.Subdomain == service.Name {
+		endpoint.Hostname = pod.Hostname
+		if endpoint.Hostname == "" {
+			endpoint.Hostname = pod.Name
+		}
+	}
+
 	d.registry.mu.Lock()
 	defer d.registry.mu.Unlock()
 
@@ -137,6 +148,27 @@ func (d *Discovery) DeregisterService(service *types.Service, pod *types.Pod) er
 	return nil
 }
 
+// SetPodHealth marks the endpoints of a pod healthy or unhealthy, e.g. when
+// the pod passes or fails its readiness probe
+func (d *Discovery) SetPodHealth(podID string, healthy bool) {
+	d.registry.mu.Lock()
+	defer d.registry.mu.Unlock()
+
+	for _, endpoints := range d.registry.services {
+		for _, endpoint := range endpoints {
+			if endpoint.PodID != podID || endpoint.Healthy == healthy {
+				continue
+			}
+			endpoint.Healthy = healthy
+			endpoint.LastSeen = time.Now()
+
+			// Peers replace the endpoint on registration
+			d.broadcastServiceUpdate(endpoint, "register")
+			d.logger.Infof("Marked endpoint of pod %s in service %s as healthy=%t", endpoint.PodName, endpoint.ServiceName, healthy)
+		}
+	}
+}
+
 // GetServiceAddresses returns addresses of healthy service instances
 func (d *Discovery) GetServiceAddresses(serviceName, namespace string) ([]string, error) {
 	key := serviceKey(serviceName, namespace)
@@ -188,6 +220,33 @@ func (d *Discovery) GetServiceEndpoints(serviceName, namespace string) ([]*Servi
 	return result, nil
 }
 
+// GetPodEndpoints returns the healthy endpoints of the pod with the given
+// hostname in a headless service
+func (d *Discovery) GetPodEndpoints(hostname, serviceName, namespace string) ([]*ServiceEndpoint, error) {
+	key := serviceKey(serviceName, namespace)
+
+	d.registry.mu.RLock()
+	defer d.registry.mu.RUnlock()
+
+	endpoints, ok := d.registry.services[key]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", key)
+	}
+
+	result := make([]*ServiceEndpoint, 0, 1)
+	for _, endpoint := range endpoints {
+		if endpoint.Hostname == hostname && endpoint.Healthy && time.Since(endpoint.LastSeen) < 30*time.Second {
+			result = append(result, endpoint)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("pod %s not found in service %s", hostname, key)
+	}
+
+	return result, nil
+}
+
 // broadcastServiceUpdate broadcasts service update to cluster
 func (d *Discovery) broadcastServiceUpdate(endpoint *ServiceEndpoint, action string) {
 	message := map[string]interface{}{
@@ -197,6 +256,7 @@ func (d *Discovery) broadcastServiceUpdate(endpoint *ServiceEndpoint, action str
 		"namespace":   endpoint.Namespace,
 		"podID":       endpoint.PodID,
 		"podName":     endpoint.PodName,
+		"hostname":    endpoint.Hostname,
 		"nodeName":    endpoint.NodeName,
 		"address":     endpoint.Address,
 		"port":        endpoint.Port,
@@ -210,7 +270,7 @@ func (d *Discovery) broadcastServiceUpdate(endpoint *ServiceEndpoint, action str
 		return
 	}
 
-	if err := d.cluster.Broadcast(data); err != nil {
+	if err := d.cluster.Broadcast(cluster.MessageServiceUpdate, data); err != nil {
 		d.logger.Warnf("Failed to broadcast service update: %v", err)
 	}
 }
@@ -230,11 +290,15 @@ func (d *Discovery) HandleServiceUpdate(message []byte) error {
 	key := serviceKey(update["serviceName"].(string), update["namespace"].(string))
 	endpointID := endpointID(update["namespace"].(string), update["serviceName"].(string), update["podID"].(string))
 
+	// Peers running an older version do not send the hostname
+	hostname, _ := update["hostname"].(string)
+
 	endpoint := &ServiceEndpoint{
 		ServiceName: update["serviceName"].(string),
 		Namespace:   update["namespace"].(string),
 		PodID:       update["podID"].(string),
 		PodName:     update["podName"].(string),
+		Hostname:    hostname,
 		NodeName:    update["nodeName"].(string),
 		Address:     update["address"].(string),
 		Port:        int32(update["port"].(float64)),
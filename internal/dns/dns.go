@@ -244,6 +244,7 @@ func (s *Server) handleAQuery(m *dns.Msg, q dns.Question) {
 	// - postgres-service.default.cluster.local
 	// - postgres-service.default.svc.cluster.local
 	// - postgres-service.default
+	// - web-0.nginx.default.svc.cluster.local (pod of a headless service)
 	serviceName, namespace, err := s.parseServiceName(q.Name)
 	if err != nil {
 		s.logger.Debugf("Failed to parse service name %s: %v", q.Name, err)
@@ -253,8 +254,15 @@ func (s *Server) handleAQuery(m *dns.Msg, q dns.Question) {
 	// Get service endpoints from discovery
 	endpoints, err := s.discovery.GetServiceEndpoints(serviceName, namespace)
 	if err != nil {
-		s.logger.Debugf("Service %s.%s not found: %v", serviceName, namespace, err)
-		return
+		// <hostname>.<service> is a pod of a headless service, e.g.
+		// web-0.nginx.default.svc.cluster.local for a stateful set pod
+		if hostname, service, ok := strings.Cut(serviceName, "."); ok {
+			endpoints, err = s.discovery.GetPodEndpoints(hostname, service, namespace)
+		}
+		if err != nil {
+			s.logger.Debugf("Service %s.%s not found: %v", serviceName, namespace, err)
+			return
+		}
 	}
 
 	// Add A records for each healthy endpoint
@@ -343,9 +351,9 @@ func (s *Server) parseServiceName(name string) (serviceName, namespace string, e
 	// Remove trailing dot
 	name = strings.TrimSuffix(name, ".")
 
-	// Remove cluster domain
-	name = strings.TrimSuffix(name, "."+s.clusterDomain)
+	// Remove cluster domain, the longer suffix first
 	name = strings.TrimSuffix(name, ".svc."+s.clusterDomain)
+	name = strings.TrimSuffix(name, "."+s.clusterDomain)
 
 	// Split by dots
 	parts := strings.Split(name, ".")
@@ -367,9 +375,9 @@ func (s *Server) parseSRVName(name string) (portName, protocol, serviceName, nam
 	// Remove trailing dot
 	name = strings.TrimSuffix(name, ".")
 
-	// Remove cluster domain
-	name = strings.TrimSuffix(name, "."+s.clusterDomain)
+	// Remove cluster domain, the longer suffix first
 	name = strings.TrimSuffix(name, ".svc."+s.clusterDomain)
+	name = strings.TrimSuffix(name, "."+s.clusterDomain)
 
 	// Split by dots
 	parts := strings.Split(name, ".")
@@ -6,8 +6,11 @@ import (
 
 	"gopkg.in/yaml.v3"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -66,12 +69,151 @@ func (p *Parser) ParseDeployment(obj runtime.Object) (*types.Deployment, error)
 		Template:        deployment.Spec.Template,
 		Labels:          deployment.Labels,
 		Selector:        deployment.Spec.Selector,
+		Strategy:        deployment.Spec.Strategy,
+		Paused:          deployment.Spec.Paused,
+		HistoryLimit:    10,
 		Pods:            []*types.Pod{},
 	}
 
+	if deployment.Spec.RevisionHistoryLimit != nil {
+		dep.HistoryLimit = *deployment.Spec.RevisionHistoryLimit
+	}
+
 	return dep, nil
 }
 
+// ParseStatefulSet extracts stateful set information
+func (p *Parser) ParseStatefulSet(obj runtime.Object) (*types.StatefulSet, error) {
+	statefulSet, ok := obj.(*appsv1.StatefulSet)
+	if !ok {
+		return nil, fmt.Errorf("object is not a StatefulSet")
+	}
+
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+
+	set := &types.StatefulSet{
+		Name:                 statefulSet.Name,
+		Namespace:            statefulSet.Namespace,
+		DesiredReplicas:      replicas,
+		ServiceName:          statefulSet.Spec.ServiceName,
+		Template:             statefulSet.Spec.Template,
+		VolumeClaimTemplates: statefulSet.Spec.VolumeClaimTemplates,
+		Labels:               statefulSet.Labels,
+		Selector:             statefulSet.Spec.Selector,
+		PodManagementPolicy:  statefulSet.Spec.PodManagementPolicy,
+		UpdateStrategy:       statefulSet.Spec.UpdateStrategy,
+		Pods:                 []*types.Pod{},
+	}
+	if set.PodManagementPolicy == "" {
+		set.PodManagementPolicy = appsv1.OrderedReadyPodManagement
+	}
+	if set.UpdateStrategy.Type == "" {
+		set.UpdateStrategy.Type = appsv1.RollingUpdateStatefulSetStrategyType
+	}
+
+	return set, nil
+}
+
+// ParseDaemonSet extracts daemon set information
+func (p *Parser) ParseDaemonSet(obj runtime.Object) (*types.DaemonSet, error) {
+	daemonSet, ok := obj.(*appsv1.DaemonSet)
+	if !ok {
+		return nil, fmt.Errorf("object is not a DaemonSet")
+	}
+
+	ds := &types.DaemonSet{
+		Name:           daemonSet.Name,
+		Namespace:      daemonSet.Namespace,
+		Template:       daemonSet.Spec.Template,
+		Labels:         daemonSet.Labels,
+		Selector:       daemonSet.Spec.Selector,
+		UpdateStrategy: daemonSet.Spec.UpdateStrategy,
+		Pods:           []*types.Pod{},
+	}
+	if ds.UpdateStrategy.Type == "" {
+		ds.UpdateStrategy.Type = appsv1.RollingUpdateDaemonSetStrategyType
+	}
+
+	return ds, nil
+}
+
+// ParseJob extracts job information. Like the API server, only the restart
+// policies OnFailure and Never are accepted.
+func (p *Parser) ParseJob(obj runtime.Object) (*types.Job, error) {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return nil, fmt.Errorf("object is not a Job")
+	}
+
+	policy := job.Spec.Template.Spec.RestartPolicy
+	if policy != corev1.RestartPolicyOnFailure && policy != corev1.RestartPolicyNever {
+		return nil, fmt.Errorf("job %s: restartPolicy must be OnFailure or Never", job.Name)
+	}
+
+	j := &types.Job{
+		Name:                  job.Name,
+		Namespace:             job.Namespace,
+		Labels:                job.Labels,
+		Template:              job.Spec.Template,
+		Completions:           1,
+		Parallelism:           1,
+		BackoffLimit:          6,
+		ActiveDeadlineSeconds: job.Spec.ActiveDeadlineSeconds,
+		Pods:                  []*types.Pod{},
+	}
+	if job.Spec.Completions != nil {
+		j.Completions = *job.Spec.Completions
+	}
+	if job.Spec.Parallelism != nil {
+		j.Parallelism = *job.Spec.Parallelism
+	}
+	if job.Spec.BackoffLimit != nil {
+		j.BackoffLimit = *job.Spec.BackoffLimit
+	}
+
+	return j, nil
+}
+
+// ParseCronJob extracts cron job information
+func (p *Parser) ParseCronJob(obj runtime.Object) (*types.CronJob, error) {
+	cronJob, ok := obj.(*batchv1.CronJob)
+	if !ok {
+		return nil, fmt.Errorf("object is not a CronJob")
+	}
+
+	cj := &types.CronJob{
+		Name:                       cronJob.Name,
+		Namespace:                  cronJob.Namespace,
+		Labels:                     cronJob.Labels,
+		Schedule:                   cronJob.Spec.Schedule,
+		ConcurrencyPolicy:          cronJob.Spec.ConcurrencyPolicy,
+		StartingDeadlineSeconds:    cronJob.Spec.StartingDeadlineSeconds,
+		SuccessfulJobsHistoryLimit: 3,
+		FailedJobsHistoryLimit:     1,
+		JobTemplate:                cronJob.Spec.JobTemplate,
+	}
+	if cronJob.Spec.TimeZone != nil {
+		cj.TimeZone = *cronJob.Spec.TimeZone
+	}
+	if cronJob.Spec.Suspend != nil {
+		cj.Suspend = *cronJob.Spec.Suspend
+	}
+	if cj.ConcurrencyPolicy == "" {
+		cj.ConcurrencyPolicy = batchv1.AllowConcurrent
+	}
+	if cronJob.Spec.SuccessfulJobsHistoryLimit != nil {
+		cj.SuccessfulJobsHistoryLimit = *cronJob.Spec.SuccessfulJobsHistoryLimit
+	}
+	if cronJob.Spec.FailedJobsHistoryLimit != nil {
+		cj.FailedJobsHistoryLimit = *cronJob.Spec.FailedJobsHistoryLimit
+	}
+
+	return cj, nil
+}
+
 // ParseService extracts service information
 func (p *Parser) ParseService(obj runtime.Object) (*types.Service, error) {
 	service, ok := obj.(*corev1.Service)
@@ -141,6 +283,189 @@ func (p *Parser) ParseIngress(obj runtime.Object) (*types.Ingress, error) {
 	return ing, nil
 }
 
+// ParseConfigMap extracts config map information
+func (p *Parser) ParseConfigMap(obj runtime.Object) (*types.ConfigMap, error) {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return nil, fmt.Errorf("object is not a ConfigMap")
+	}
+
+	cm := &types.ConfigMap{
+		Name:       configMap.Name,
+		Namespace:  configMap.Namespace,
+		Labels:     configMap.Labels,
+		Data:       configMap.Data,
+		BinaryData: configMap.BinaryData,
+	}
+
+	return cm, nil
+}
+
+// ParseSecret extracts secret information, merging stringData into data
+func (p *Parser) ParseSecret(obj runtime.Object) (*types.Secret, error) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil, fmt.Errorf("object is not a Secret")
+	}
+
+	sec := &types.Secret{
+		Name:      secret.Name,
+		Namespace: secret.Namespace,
+		Labels:    secret.Labels,
+		Type:      secret.Type,
+		Data:      make(map[string][]byte, len(secret.Data)+len(secret.StringData)),
+	}
+	if sec.Type == "" {
+		sec.Type = corev1.SecretTypeOpaque
+	}
+
+	for key, value := range secret.Data {
+		sec.Data[key] = value
+	}
+	// Like the API server, stringData takes precedence
+	for key, value := range secret.StringData {
+		sec.Data[key] = []byte(value)
+	}
+
+	return sec, nil
+}
+
+// ParsePersistentVolumeClaim extracts persistent volume claim information
+func (p *Parser) ParsePersistentVolumeClaim(obj runtime.Object) (*types.PersistentVolumeClaim, error) {
+	claim, ok := obj.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return nil, fmt.Errorf("object is not a PersistentVolumeClaim")
+	}
+
+	pvc := &types.PersistentVolumeClaim{
+		Name:        claim.Name,
+		Namespace:   claim.Namespace,
+		Labels:      claim.Labels,
+		AccessModes: claim.Spec.AccessModes,
+		Requests:    claim.Spec.Resources.Requests,
+		Phase:       corev1.ClaimPending,
+	}
+	if claim.Spec.StorageClassName != nil {
+		pvc.StorageClassName = *claim.Spec.StorageClassName
+	}
+
+	return pvc, nil
+}
+
+// ParsePodDisruptionBudget extracts pod disruption budget information
+func (p *Parser) ParsePodDisruptionBudget(obj runtime.Object) (*types.PodDisruptionBudget, error) {
+	budget, ok := obj.(*policyv1.PodDisruptionBudget)
+	if !ok {
+		return nil, fmt.Errorf("object is not a PodDisruptionBudget")
+	}
+	if budget.Spec.MinAvailable != nil && budget.Spec.MaxUnavailable != nil {
+		return nil, fmt.Errorf("pod disruption budget %s sets both minAvailable and maxUnavailable", budget.Name)
+	}
+
+	pdb := &types.PodDisruptionBudget{
+		Name:           budget.Name,
+		Namespace:      budget.Namespace,
+		Labels:         budget.Labels,
+		Selector:       budget.Spec.Selector,
+		MinAvailable:   budget.Spec.MinAvailable,
+		MaxUnavailable: budget.Spec.MaxUnavailable,
+	}
+
+	return pdb, nil
+}
+
+// DefaultNamespace is the namespace of roles, role bindings and service
+// accounts applied without one. An empty namespace would make them
+// cluster-wide.
+const DefaultNamespace = "default"
+
+// NamespaceOrDefault returns the namespace of a namespaced RBAC object
+func NamespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return DefaultNamespace
+	}
+	return namespace
+}
+
+// ParseRole extracts role information from a Role or a ClusterRole
+func (p *Parser) ParseRole(obj runtime.Object) (*types.Role, error) {
+	switch role := obj.(type) {
+	case *rbacv1.Role:
+		return &types.Role{
+			Name:      role.Name,
+			Namespace: NamespaceOrDefault(role.Namespace),
+			Labels:    role.Labels,
+			Rules:     role.Rules,
+		}, nil
+	case *rbacv1.ClusterRole:
+		return &types.Role{
+			Name:   role.Name,
+			Labels: role.Labels,
+			Rules:  role.Rules,
+		}, nil
+	}
+	return nil, fmt.Errorf("object is not a Role or ClusterRole")
+}
+
+// ParseRoleBinding extracts role binding information from a RoleBinding or a
+// ClusterRoleBinding. Cluster role bindings may only refer to cluster roles.
+func (p *Parser) ParseRoleBinding(obj runtime.Object) (*types.RoleBinding, error) {
+	var binding *types.RoleBinding
+	switch b := obj.(type) {
+	case *rbacv1.RoleBinding:
+		binding = &types.RoleBinding{
+			Name:      b.Name,
+			Namespace: NamespaceOrDefault(b.Namespace),
+			Labels:    b.Labels,
+			RoleRef:   b.RoleRef,
+			Subjects:  b.Subjects,
+		}
+	case *rbacv1.ClusterRoleBinding:
+		if b.RoleRef.Kind != "ClusterRole" {
+			return nil, fmt.Errorf("cluster role binding %s refers to a %s instead of a ClusterRole", b.Name, b.RoleRef.Kind)
+		}
+		binding = &types.RoleBinding{
+			Name:     b.Name,
+			Labels:   b.Labels,
+			RoleRef:  b.RoleRef,
+			Subjects: b.Subjects,
+		}
+	default:
+		return nil, fmt.Errorf("object is not a RoleBinding or ClusterRoleBinding")
+	}
+
+	if binding.RoleRef.Kind != "Role" && binding.RoleRef.Kind != "ClusterRole" {
+		return nil, fmt.Errorf("role binding %s refers to unknown kind %q", binding.Name, binding.RoleRef.Kind)
+	}
+	for _, subject := range binding.Subjects {
+		switch subject.Kind {
+		case rbacv1.UserKind, rbacv1.GroupKind:
+		case rbacv1.ServiceAccountKind:
+			if subject.Namespace == "" && binding.Namespace == "" {
+				return nil, fmt.Errorf("service account %s bound by %s needs a namespace", subject.Name, binding.Name)
+			}
+		default:
+			return nil, fmt.Errorf("role binding %s has a subject of unknown kind %q", binding.Name, subject.Kind)
+		}
+	}
+
+	return binding, nil
+}
+
+// ParseServiceAccount extracts service account information
+func (p *Parser) ParseServiceAccount(obj runtime.Object) (*types.ServiceAccount, error) {
+	account, ok := obj.(*corev1.ServiceAccount)
+	if !ok {
+		return nil, fmt.Errorf("object is not a ServiceAccount")
+	}
+
+	return &types.ServiceAccount{
+		Name:      account.Name,
+		Namespace: NamespaceOrDefault(account.Namespace),
+		Labels:    account.Labels,
+	}, nil
+}
+
 // ExtractPodFromTemplate creates a Pod from a PodTemplateSpec
 func (p *Parser) ExtractPodFromTemplate(template corev1.PodTemplateSpec, namespace, podName string) *types.Pod {
 	pod := &types.Pod{
@@ -151,28 +476,67 @@ func (p *Parser) ExtractPodFromTemplate(template corev1.PodTemplateSpec, namespa
 		State:       types.PodStatePending,
 	}
 
-	if len(template.Spec.Containers) > 0 {
-		container := template.Spec.Containers[0]
-		pod.Image = container.Image
-		pod.Ports = container.Ports
-		pod.Env = container.Env
+	for _, container := range template.Spec.InitContainers {
+		pod.InitContainers = append(pod.InitContainers, extractContainer(container))
+	}
+	for _, container := range template.Spec.Containers {
+		pod.Containers = append(pod.Containers, extractContainer(container))
+	}
+	if len(pod.Containers) > 0 {
+		pod.Image = pod.Containers[0].Image
+	}
+	pod.Volumes = template.Spec.Volumes
+	pod.Hostname = template.Spec.Hostname
+	pod.Subdomain = template.Spec.Subdomain
 
-		// Convert volume mounts
-		for _, vm := range container.VolumeMounts {
-			pod.Volumes = append(pod.Volumes, corev1.VolumeMount{
-				Name:      vm.Name,
-				MountPath: vm.MountPath,
-				ReadOnly:  vm.ReadOnly,
-			})
-		}
+	pod.RestartPolicy = template.Spec.RestartPolicy
+	if pod.RestartPolicy == "" {
+		pod.RestartPolicy = corev1.RestartPolicyAlways
 	}
+	pod.TerminationGracePeriod = template.Spec.TerminationGracePeriodSeconds
 
 	// Extract node selector
 	pod.NodeSelector = template.Spec.NodeSelector
 
+	// Extract affinity, topology spread constraints and tolerations
+	pod.Affinity = template.Spec.Affinity
+	pod.TopologySpreadConstraints = template.Spec.TopologySpreadConstraints
+	pod.Tolerations = template.Spec.Tolerations
+
 	return pod
 }
 
+// extractContainer converts a Kubernetes container
+func extractContainer(container corev1.Container) types.Container {
+	c := types.Container{
+		Name:           container.Name,
+		Image:          container.Image,
+		Command:        container.Command,
+		Args:           container.Args,
+		WorkingDir:     container.WorkingDir,
+		Ports:          container.Ports,
+		Env:            container.Env,
+		EnvFrom:        container.EnvFrom,
+		Resources:      container.Resources,
+		LivenessProbe:  container.LivenessProbe,
+		ReadinessProbe: container.ReadinessProbe,
+		StartupProbe:   container.StartupProbe,
+		Lifecycle:      container.Lifecycle,
+	}
+
+	// Convert volume mounts
+	for _, vm := range container.VolumeMounts {
+		c.Volumes = append(c.Volumes, corev1.VolumeMount{
+			Name:      vm.Name,
+			MountPath: vm.MountPath,
+			SubPath:   vm.SubPath,
+			ReadOnly:  vm.ReadOnly,
+		})
+	}
+
+	return c
+}
+
 // ParseYAML parses YAML directly (fallback)
 func (p *Parser) ParseYAML(data []byte, obj interface{}) error {
 	return yaml.Unmarshal(data, obj)
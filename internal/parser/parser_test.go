@@ -4,9 +4,13 @@ import (
 	"testing"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func TestNewParser(t *testing.T) {
@@ -279,6 +283,13 @@ func TestParseDeploymentWithMultipleContainers(t *testing.T) {
 			},
 			Template: corev1.PodTemplateSpec{
 				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{
+						{
+							Name:    "migrate",
+							Image:   "app:latest",
+							Command: []string{"migrate"},
+						},
+					},
 					Containers: []corev1.Container{
 						{
 							Name:  "app",
@@ -299,11 +310,18 @@ func TestParseDeploymentWithMultipleContainers(t *testing.T) {
 		t.Fatalf("Failed to parse deployment: %v", err)
 	}
 
-	// Should use first container
 	pod := parser.ExtractPodFromTemplate(deployment.Template, "default", "test")
 	if pod.Image != "app:latest" {
 		t.Errorf("Expected first container image, got '%s'", pod.Image)
 	}
+
+	if len(pod.Containers) != 2 || pod.Containers[1].Name != "sidecar" || pod.Containers[1].Image != "sidecar:latest" {
+		t.Errorf("Expected containers app and sidecar, got %+v", pod.Containers)
+	}
+
+	if len(pod.InitContainers) != 1 || pod.InitContainers[0].Name != "migrate" || pod.InitContainers[0].Command[0] != "migrate" {
+		t.Errorf("Expected init container migrate, got %+v", pod.InitContainers)
+	}
 }
 
 func TestParseServiceWithMultiplePorts(t *testing.T) {
@@ -344,3 +362,178 @@ func TestParseServiceWithMultiplePorts(t *testing.T) {
 		t.Errorf("Expected name 'multi-port-service', got '%s'", service.Name)
 	}
 }
+
+func TestParseSecret(t *testing.T) {
+	parser := NewParser()
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "db",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			"user":     []byte("admin"),
+			"password": []byte("old"),
+		},
+		StringData: map[string]string{
+			"password": "new",
+		},
+	}
+
+	sec, err := parser.ParseSecret(secret)
+	if err != nil {
+		t.Fatalf("Failed to parse secret: %v", err)
+	}
+
+	if sec.Type != corev1.SecretTypeOpaque {
+		t.Errorf("Expected type Opaque, got '%s'", sec.Type)
+	}
+
+	if string(sec.Data["user"]) != "admin" {
+		t.Errorf("Expected user 'admin', got '%s'", sec.Data["user"])
+	}
+
+	if string(sec.Data["password"]) != "new" {
+		t.Errorf("Expected stringData to take precedence, got '%s'", sec.Data["password"])
+	}
+}
+
+func TestParseStatefulSet(t *testing.T) {
+	parser := NewParser()
+
+	replicas := int32(3)
+	k8sStatefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "db",
+			Namespace: "default",
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: "db",
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: "data"}},
+			},
+		},
+	}
+
+	set, err := parser.ParseStatefulSet(k8sStatefulSet)
+	if err != nil {
+		t.Fatalf("Failed to parse stateful set: %v", err)
+	}
+
+	if set.DesiredReplicas != 3 || set.ServiceName != "db" || len(set.VolumeClaimTemplates) != 1 {
+		t.Errorf("Unexpected stateful set: %+v", set)
+	}
+	if set.PodManagementPolicy != appsv1.OrderedReadyPodManagement {
+		t.Errorf("Expected OrderedReady pod management by default, got %s", set.PodManagementPolicy)
+	}
+	if set.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		t.Errorf("Expected RollingUpdate by default, got %s", set.UpdateStrategy.Type)
+	}
+}
+
+func TestParseJob(t *testing.T) {
+	parser := NewParser()
+
+	k8sJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "migrate",
+			Namespace: "default",
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{{Name: "migrate", Image: "migrate:latest"}},
+				},
+			},
+		},
+	}
+
+	job, err := parser.ParseJob(k8sJob)
+	if err != nil {
+		t.Fatalf("Failed to parse job: %v", err)
+	}
+	if job.Completions != 1 || job.Parallelism != 1 || job.BackoffLimit != 6 {
+		t.Errorf("Unexpected job defaults: %+v", job)
+	}
+
+	k8sJob.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyAlways
+	if _, err := parser.ParseJob(k8sJob); err == nil {
+		t.Error("Expected restart policy Always to be rejected")
+	}
+}
+
+func TestParsePodDisruptionBudget(t *testing.T) {
+	parser := NewParser()
+
+	minAvailable := intstr.FromString("50%")
+	k8sBudget := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		},
+	}
+
+	budget, err := parser.ParsePodDisruptionBudget(k8sBudget)
+	if err != nil {
+		t.Fatalf("Failed to parse pod disruption budget: %v", err)
+	}
+	if budget.MinAvailable.String() != "50%" || budget.Selector.MatchLabels["app"] != "web" {
+		t.Errorf("Unexpected pod disruption budget: %+v", budget)
+	}
+
+	maxUnavailable := intstr.FromInt(1)
+	k8sBudget.Spec.MaxUnavailable = &maxUnavailable
+	if _, err := parser.ParsePodDisruptionBudget(k8sBudget); err == nil {
+		t.Error("Expected minAvailable together with maxUnavailable to be rejected")
+	}
+}
+
+func TestParseRoleBinding(t *testing.T) {
+	parser := NewParser()
+
+	manifest := []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: ci
+  namespace: staging
+subjects:
+- kind: ServiceAccount
+  name: ci
+roleRef:
+  kind: ClusterRole
+  name: edit
+  apiGroup: rbac.authorization.k8s.io
+`)
+	objects, err := parser.ParseManifest(manifest)
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	binding, err := parser.ParseRoleBinding(objects[0])
+	if err != nil {
+		t.Fatalf("Failed to parse role binding: %v", err)
+	}
+	if binding.Namespace != "staging" || binding.RoleRef.Name != "edit" || len(binding.Subjects) != 1 {
+		t.Errorf("Unexpected role binding: %+v", binding)
+	}
+
+	clusterBinding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "ci"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "ci"}},
+		RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "view"},
+	}
+	if _, err := parser.ParseRoleBinding(clusterBinding); err == nil {
+		t.Error("Expected a cluster-wide service account subject without namespace to be rejected")
+	}
+
+	clusterBinding.Subjects[0].Namespace = "staging"
+	clusterBinding.RoleRef.Kind = "Role"
+	if _, err := parser.ParseRoleBinding(clusterBinding); err == nil {
+		t.Error("Expected a cluster role binding referring to a Role to be rejected")
+	}
+}
@@ -1,27 +1,48 @@
 package podman
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	nettypes "github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v4/libpod/define"
+	"github.com/containers/podman/v4/pkg/api/handlers"
 	"github.com/containers/podman/v4/pkg/bindings"
 	"github.com/containers/podman/v4/pkg/bindings/containers"
 	"github.com/containers/podman/v4/pkg/bindings/images"
+	"github.com/containers/podman/v4/pkg/bindings/pods"
+	"github.com/containers/podman/v4/pkg/bindings/system"
 	"github.com/containers/podman/v4/pkg/domain/entities"
 	"github.com/containers/podman/v4/pkg/specgen"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/your-server-support/podman-swarm/internal/types"
 )
 
+// Labels set on every pod and container created by the agent so that they can
+// be matched back to the pods in the cluster state
+const (
+	LabelManaged   = "podman-swarm.managed"
+	LabelPodID     = "podman-swarm.pod-id"
+	LabelPodName   = "podman-swarm.pod-name"
+	LabelNamespace = "podman-swarm.namespace"
+	LabelContainer = "podman-swarm.container" // Name of the container in the pod
+	LabelClaim     = "podman-swarm.claim"     // Name of the claim of a volume
+)
+
 type Client struct {
-	conn   context.Context
-	logger *logrus.Logger
-	dnsIP  string // DNS server IP address for containers
+	conn      context.Context
+	logger    *logrus.Logger
+	dnsIP     string // DNS server IP address for containers
+	volumeDir string // Directory holding the files of configMap and secret volumes
 }
 
 func NewClient(socket string, logger *logrus.Logger) (*Client, error) {
@@ -41,35 +62,134 @@ func (c *Client) SetDNS(dnsIP string) {
 	c.dnsIP = dnsIP
 }
 
-func (c *Client) CreatePod(pod *types.Pod) (string, error) {
-	// Create specgen spec for container
-	s := specgen.NewSpecGenerator(pod.Image, false)
-	s.Name = pod.Name
+// SetVolumeDir sets the directory the files of configMap and secret volumes are written to
+func (c *Client) SetVolumeDir(dir string) {
+	c.volumeDir = dir
+}
 
-	// Set environment variables
-	env := make(map[string]string)
-	for _, e := range pod.Env {
-		env[e.Name] = e.Value
+// CreatePod creates a Podman pod holding the init containers and containers of
+// a pod. The containers share the network, IPC and UTS namespaces of the pod's
+// infra container, ports are published on the pod. Init containers run to
+// completion in order every time the pod starts, before the containers start.
+// The environment and volume files in data are resolved by the caller.
+func (c *Client) CreatePod(pod *types.Pod, data *PodData) (string, error) {
+	if err := c.WriteVolumes(pod.ID, data.Volumes); err != nil {
+		return "", err
+	}
+	if err := c.prepareVolumes(pod); err != nil {
+		return "", err
 	}
-	s.Env = env
 
-	// Set labels
-	s.Labels = pod.Labels
+	spec := specgen.NewPodSpecGenerator()
+	spec.Name = pod.Name
+	spec.Hostname = pod.Hostname
+	spec.Labels = managedLabels(pod)
+	spec.SharedNamespaces = []string{"net", "ipc", "uts"}
 
 	// Set network namespace to bridge (default)
 	netNS, _, _, err := specgen.ParseNetworkFlag([]string{"bridge"}, false)
 	if err == nil {
-		s.NetNS = netNS
+		spec.NetNS = netNS
 	} else {
 		// Fallback to default bridge network
-		s.NetNS = specgen.Namespace{
+		spec.NetNS = specgen.Namespace{
 			NSMode: specgen.Bridge,
 		}
 	}
 
-	// Set port mappings
-	portMappings := []nettypes.PortMapping{}
-	for _, port := range pod.Ports {
+	// Publish the ports of all containers on the pod
+	for _, container := range pod.Containers {
+		spec.PortMappings = append(spec.PortMappings, portMappings(container.Ports)...)
+	}
+
+	// Set DNS servers if configured
+	if c.dnsIP != "" {
+		spec.DNSServer = []net.IP{net.ParseIP(c.dnsIP)}
+		c.logger.Debugf("Setting DNS server for pod %s: %s", pod.Name, c.dnsIP)
+	}
+
+	report, err := pods.CreatePodFromSpec(c.conn, &entities.PodSpec{PodSpecGen: *spec})
+	if err != nil {
+		return "", fmt.Errorf("failed to create pod: %w", err)
+	}
+
+	for _, container := range pod.InitContainers {
+		if err := c.createContainer(report.Id, pod, container, data.Env[container.Name], true); err != nil {
+			c.removePodQuietly(report.Id)
+			return "", err
+		}
+	}
+	for _, container := range pod.Containers {
+		if err := c.createContainer(report.Id, pod, container, data.Env[container.Name], false); err != nil {
+			c.removePodQuietly(report.Id)
+			return "", err
+		}
+	}
+
+	c.logger.Infof("Created pod %s (ID: %s) with %d containers", pod.Name, report.Id, len(pod.InitContainers)+len(pod.Containers))
+
+	return report.Id, nil
+}
+
+// createContainer creates a container of a pod in a Podman pod
+func (c *Client) createContainer(podmanID string, pod *types.Pod, container types.Container, env map[string]string, init bool) error {
+	// Create specgen spec for container
+	s := specgen.NewSpecGenerator(container.Image, false)
+	s.Name = fmt.Sprintf("%s-%s", pod.Name, container.Name)
+	s.Pod = podmanID
+	s.Entrypoint = container.Command
+	s.Command = container.Args
+	s.WorkDir = container.WorkingDir
+	s.Env = env
+	if init {
+		s.InitContainerType = define.AlwaysInitContainer
+	}
+
+	// Set labels
+	labels := managedLabels(pod)
+	labels[LabelContainer] = container.Name
+	s.Labels = labels
+
+	// Set volume mounts
+	if len(container.Volumes) > 0 {
+		mounts, named, err := c.volumeMounts(pod, container)
+		if err != nil {
+			return fmt.Errorf("container %s: %w", container.Name, err)
+		}
+		s.Mounts = mounts
+		s.Volumes = named
+	}
+
+	// Set resource limits
+	s.ResourceLimits = resourceLimits(container.Resources)
+
+	// Create container using specgen
+	response, err := containers.CreateWithSpec(c.conn, s, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create container %s: %w", container.Name, err)
+	}
+
+	c.logger.Debugf("Created container %s (ID: %s)", s.Name, response.ID)
+	return nil
+}
+
+// managedLabels returns the labels of a pod plus the labels identifying it
+func managedLabels(pod *types.Pod) map[string]string {
+	labels := make(map[string]string, len(pod.Labels)+5)
+	for k, v := range pod.Labels {
+		labels[k] = v
+	}
+	labels[LabelManaged] = "true"
+	labels[LabelPodID] = pod.ID
+	labels[LabelPodName] = pod.Name
+	labels[LabelNamespace] = pod.Namespace
+	return labels
+}
+
+// portMappings converts container ports to port mappings published on the host
+func portMappings(ports []corev1.ContainerPort) []nettypes.PortMapping {
+	mappings := []nettypes.PortMapping{}
+	for _, port := range ports {
 		hostPort := port.HostPort
 		if hostPort == 0 {
 			hostPort = port.ContainerPort
@@ -77,7 +197,7 @@ func (c *Client) CreatePod(pod *types.Pod) (string, error) {
 
 		protocol := "tcp"
 		if port.Protocol != "" {
-			protocol = string(port.Protocol)
+			protocol = strings.ToLower(string(port.Protocol))
 		}
 
 		portMapping := nettypes.PortMapping{
@@ -90,69 +210,101 @@ func (c *Client) CreatePod(pod *types.Pod) (string, error) {
 			portMapping.HostIP = port.HostIP
 		}
 
-		portMappings = append(portMappings, portMapping)
+		mappings = append(mappings, portMapping)
 	}
-	s.PortMappings = portMappings
+	return mappings
+}
 
-	// Set volume mounts
-	if len(pod.Volumes) > 0 {
-		mounts := []specs.Mount{}
-		for _, vol := range pod.Volumes {
-			options := []string{}
-			if vol.ReadOnly {
-				options = append(options, "ro")
-			}
+// resourceLimits converts container resource limits to OCI resource limits
+func resourceLimits(resources corev1.ResourceRequirements) *specs.LinuxResources {
+	if len(resources.Limits) == 0 {
+		return nil
+	}
 
-			mount := specs.Mount{
-				Type:        "bind",
-				Destination: vol.MountPath,
-				Options:     options,
-			}
+	limits := &specs.LinuxResources{}
 
-			// Note: Source should be set from pod spec
-			// For now, we'll use the mount path as source if not specified
-			// In a full implementation, you'd map volumes from pod spec
-			if vol.Name != "" {
-				// If volume name is provided, use it as source
-				mount.Source = vol.Name
-			} else {
-				mount.Source = vol.MountPath
-			}
+	if memory, ok := resources.Limits[corev1.ResourceMemory]; ok {
+		limit := memory.Value()
+		limits.Memory = &specs.LinuxMemory{Limit: &limit}
+	}
 
-			mounts = append(mounts, mount)
-		}
-		s.Mounts = mounts
+	if cpu, ok := resources.Limits[corev1.ResourceCPU]; ok {
+		period := uint64(100000)
+		quota := cpu.MilliValue() * int64(period) / 1000
+		limits.CPU = &specs.LinuxCPU{Quota: &quota, Period: &period}
 	}
 
-	// Set DNS servers if configured
-	if c.dnsIP != "" {
-		s.DNSServers = []net.IP{net.ParseIP(c.dnsIP)}
-		c.logger.Debugf("Setting DNS server for container %s: %s", pod.Name, c.dnsIP)
+	return limits
+}
+
+// StartPod starts a Podman pod, running its init containers first
+func (c *Client) StartPod(podmanID string) error {
+	report, err := pods.Start(c.conn, podmanID, nil)
+	if err != nil {
+		return err
 	}
+	if report != nil && len(report.Errs) > 0 {
+		return report.Errs[0]
+	}
+	return nil
+}
 
-	// Create container using specgen
-	response, err := containers.CreateWithSpec(c.conn, s, nil)
+// Version returns the version of the Podman service
+func (c *Client) Version() (string, error) {
+	report, err := system.Version(c.conn, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create container: %w", err)
+		return "", err
 	}
+	if report == nil || report.Server == nil {
+		return "", fmt.Errorf("podman did not report its version")
+	}
+	return report.Server.Version, nil
+}
 
-	c.logger.Infof("Created container %s (ID: %s)", pod.Name, response.ID)
+// StopPod stops all containers of a Podman pod
+func (c *Client) StopPod(podmanID string) error {
+	return c.StopPodWithTimeout(podmanID, 10*time.Second)
+}
 
-	return response.ID, nil
+// StopPodWithTimeout stops a Podman pod, containers still running after the
+// timeout are killed
+func (c *Client) StopPodWithTimeout(podmanID string, timeout time.Duration) error {
+	report, err := pods.Stop(c.conn, podmanID, new(pods.StopOptions).WithTimeout(int(timeout.Seconds())))
+	if err != nil {
+		return err
+	}
+	if report != nil && len(report.Errs) > 0 {
+		return report.Errs[0]
+	}
+	return nil
 }
 
-func (c *Client) StartPod(containerID string) error {
-	return containers.Start(c.conn, containerID, nil)
+// RemovePod removes a Podman pod and all its containers
+func (c *Client) RemovePod(podmanID string) error {
+	report, err := pods.Remove(c.conn, podmanID, new(pods.RemoveOptions).WithForce(true))
+	if err != nil {
+		return err
+	}
+	if report != nil && report.Err != nil {
+		return report.Err
+	}
+	return nil
 }
 
-func (c *Client) StopPod(containerID string) error {
-	timeout := uint(10)
-	return containers.Stop(c.conn, containerID, &containers.StopOptions{
-		Timeout: &timeout,
-	})
+// removePodQuietly removes a partially created Podman pod
+func (c *Client) removePodQuietly(podmanID string) {
+	if err := c.RemovePod(podmanID); err != nil {
+		c.logger.Warnf("Failed to remove pod %s: %v", podmanID, err)
+	}
+}
+
+// StartContainer starts a single container, e.g. to restart an exited container of a pod
+func (c *Client) StartContainer(containerID string) error {
+	return containers.Start(c.conn, containerID, nil)
 }
 
-func (c *Client) RemovePod(containerID string) error {
+// RemoveContainer removes a single container
+func (c *Client) RemoveContainer(containerID string) error {
 	force := true
 	_, err := containers.Remove(c.conn, containerID, &containers.RemoveOptions{
 		Force: &force,
@@ -167,28 +319,88 @@ func (c *Client) GetPodStatus(containerID string) (types.PodState, error) {
 	}
 
 	if data.State != nil {
-		switch data.State.Status {
-		case "running":
-			return types.PodStateRunning, nil
-		case "exited":
-			if data.State.ExitCode == 0 {
-				return types.PodStateSucceeded, nil
-			}
-			return types.PodStateFailed, nil
-		case "created", "configured":
-			return types.PodStatePending, nil
-		}
+		return ContainerState(data.State.Status, data.State.ExitCode), nil
 	}
 
 	return types.PodStateUnknown, nil
 }
 
+// ContainerState maps a Podman container status to a pod state
+func ContainerState(status string, exitCode int32) types.PodState {
+	switch status {
+	case "running":
+		return types.PodStateRunning
+	case "exited", "stopped":
+		if exitCode == 0 {
+			return types.PodStateSucceeded
+		}
+		return types.PodStateFailed
+	case "created", "configured", "initialized":
+		return types.PodStatePending
+	}
+
+	return types.PodStateUnknown
+}
+
 func (c *Client) ListPods() ([]entities.ListContainer, error) {
 	return containers.List(c.conn, &containers.ListOptions{
 		All: &[]bool{true}[0],
 	})
 }
 
+// ListManagedContainers returns all containers created by the agent, including stopped ones
+func (c *Client) ListManagedContainers() ([]entities.ListContainer, error) {
+	return containers.List(c.conn, &containers.ListOptions{
+		All:     &[]bool{true}[0],
+		Filters: map[string][]string{"label": {LabelManaged + "=true"}},
+	})
+}
+
+// ListPodContainers returns the containers of a pod, including stopped ones
+func (c *Client) ListPodContainers(podID string) ([]entities.ListContainer, error) {
+	return containers.List(c.conn, &containers.ListOptions{
+		All:     &[]bool{true}[0],
+		Filters: map[string][]string{"label": {LabelPodID + "=" + podID}},
+	})
+}
+
+// WatchContainerExits calls handler for every managed container that exits,
+// until stopCh is closed or the event stream ends
+func (c *Client) WatchContainerExits(stopCh <-chan struct{}, handler func(podID string, exitCode int32)) error {
+	events := make(chan entities.Event)
+	cancel := make(chan bool, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-stopCh:
+			cancel <- true
+		case <-done:
+		}
+	}()
+
+	options := new(system.EventsOptions).
+		WithStream(true).
+		WithFilters(map[string][]string{
+			"type":  {"container"},
+			"event": {"died"},
+			"label": {LabelManaged + "=true"},
+		})
+
+	result := make(chan error, 1)
+	go func() {
+		result <- system.Events(c.conn, events, cancel, options)
+	}()
+
+	for event := range events {
+		exitCode, _ := strconv.Atoi(event.Actor.Attributes["containerExitCode"])
+		handler(event.Actor.Attributes[LabelPodID], int32(exitCode))
+	}
+
+	return <-result
+}
+
 func (c *Client) PullImage(image string) error {
 	_, err := images.Pull(c.conn, image, &images.PullOptions{})
 	return err
@@ -225,10 +437,75 @@ func (c *Client) GetLogs(containerID string, follow bool) (io.ReadCloser, error)
 	return reader, nil
 }
 
+// Exec runs a command in a container and returns its combined output.
+// A non-zero exit code is returned as an error.
 func (c *Client) Exec(containerID string, command []string) (string, error) {
-	// Podman exec implementation
-	// This would use containers.ExecCreate and containers.ExecStart
-	return "", fmt.Errorf("exec not yet implemented")
+	config := new(handlers.ExecCreateConfig)
+	config.Cmd = command
+	config.AttachStdout = true
+	config.AttachStderr = true
+
+	sessionID, err := containers.ExecCreate(c.conn, containerID, config)
+	if err != nil {
+		return "", fmt.Errorf("failed to create exec session: %w", err)
+	}
+
+	var output bytes.Buffer
+	options := new(containers.ExecStartAndAttachOptions).
+		WithOutputStream(&output).
+		WithErrorStream(&output).
+		WithAttachOutput(true).
+		WithAttachError(true)
+	if err := containers.ExecStartAndAttach(c.conn, sessionID, options); err != nil {
+		return output.String(), fmt.Errorf("failed to run exec session: %w", err)
+	}
+
+	session, err := containers.ExecInspect(c.conn, sessionID, nil)
+	if err != nil {
+		return output.String(), fmt.Errorf("failed to inspect exec session: %w", err)
+	}
+	if session.ExitCode != 0 {
+		return output.String(), fmt.Errorf("command exited with code %d", session.ExitCode)
+	}
+
+	return output.String(), nil
+}
+
+// RestartContainer stops and starts a container again
+func (c *Client) RestartContainer(containerID string) error {
+	timeout := 10
+	return containers.Restart(c.conn, containerID, &containers.RestartOptions{
+		Timeout: &timeout,
+	})
+}
+
+// PodIP returns the IP address of a Podman pod, i.e. of its infra container
+func (c *Client) PodIP(podmanID string) (string, error) {
+	report, err := pods.Inspect(c.conn, podmanID, nil)
+	if err != nil {
+		return "", err
+	}
+	if report.InspectPodData == nil || report.InfraContainerID == "" {
+		return "", fmt.Errorf("pod %s has no infra container", podmanID)
+	}
+
+	data, err := containers.Inspect(c.conn, report.InfraContainerID, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if settings := data.NetworkSettings; settings != nil {
+		if settings.IPAddress != "" {
+			return settings.IPAddress, nil
+		}
+		for _, network := range settings.Networks {
+			if network.IPAddress != "" {
+				return network.IPAddress, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("pod %s has no IP address", podmanID)
 }
 
 // combinedLogReader combines stdout and stderr channels into a single ReadCloser
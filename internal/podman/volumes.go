@@ -0,0 +1,341 @@
+package podman
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/podman/v4/pkg/bindings/volumes"
+	"github.com/containers/podman/v4/pkg/domain/entities"
+	"github.com/containers/podman/v4/pkg/specgen"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// PodData holds the ConfigMap and Secret data consumed by a pod, resolved from
+// the cluster state by the controller
+type PodData struct {
+	Env     map[string]map[string]string // Container name -> environment variables
+	Volumes map[string][]VolumeFile      // Volume name -> files of a configMap or secret volume
+}
+
+// VolumeFile is a file of a configMap or secret volume
+type VolumeFile struct {
+	Path string // Relative to the volume
+	Data []byte
+	Mode os.FileMode
+}
+
+// WriteVolumes writes the files of the configMap and secret volumes of a pod.
+// Files are only rewritten when they changed, files no longer projected are
+// removed, so that running containers see updates of mounted volumes.
+func (c *Client) WriteVolumes(podID string, volumes map[string][]VolumeFile) error {
+	if len(volumes) == 0 {
+		return nil
+	}
+	if c.volumeDir == "" {
+		return fmt.Errorf("volume directory is not configured")
+	}
+
+	for name, files := range volumes {
+		// Only the volumes themselves are accessible to other users, so that
+		// containers running as any user can read them
+		if err := os.MkdirAll(filepath.Join(c.volumeDir, podID), 0700); err != nil {
+			return fmt.Errorf("failed to create volume directory: %w", err)
+		}
+		dir := c.volumePath(podID, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create volume %s: %w", name, err)
+		}
+
+		wanted := make(map[string]bool, len(files))
+		for _, file := range files {
+			if !filepath.IsLocal(file.Path) {
+				return fmt.Errorf("invalid path %q in volume %s", file.Path, name)
+			}
+			path := filepath.Join(dir, file.Path)
+			wanted[path] = true
+
+			if err := writeFile(path, file.Data, file.Mode); err != nil {
+				return fmt.Errorf("failed to write volume %s: %w", name, err)
+			}
+		}
+
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || wanted[path] {
+				return err
+			}
+			return os.Remove(path)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to clean up volume %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// PruneVolumes removes the volume files and emptyDir volumes of all pods not in keep
+func (c *Client) PruneVolumes(keep map[string]bool) error {
+	if c.volumeDir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(c.volumeDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || keep[entry.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.volumeDir, entry.Name())); err != nil {
+			return err
+		}
+		c.logger.Debugf("Removed volumes of pod %s", entry.Name())
+	}
+
+	return nil
+}
+
+// volumeMounts returns the bind and tmpfs mounts and the named volumes of the
+// volumes mounted into a container
+func (c *Client) volumeMounts(pod *types.Pod, container types.Container) ([]specs.Mount, []*specgen.NamedVolume, error) {
+	mounts := []specs.Mount{}
+	var named []*specgen.NamedVolume
+
+	for _, vol := range container.Volumes {
+		source := podVolume(pod, vol.Name)
+		if source == nil {
+			return nil, nil, fmt.Errorf("volume %s not found", vol.Name)
+		}
+		if vol.SubPath != "" && !filepath.IsLocal(vol.SubPath) {
+			return nil, nil, fmt.Errorf("invalid sub path %q of volume %s", vol.SubPath, vol.Name)
+		}
+
+		options := []string{}
+		if vol.ReadOnly {
+			options = append(options, "ro")
+		}
+
+		switch {
+		case source.ConfigMap != nil || source.Secret != nil:
+			// Materialised on the node and always mounted read-only
+			mounts = append(mounts, specs.Mount{
+				Type:        "bind",
+				Source:      filepath.Join(c.volumePath(pod.ID, vol.Name), vol.SubPath),
+				Destination: vol.MountPath,
+				Options:     []string{"ro"},
+			})
+
+		case source.EmptyDir != nil && source.EmptyDir.Medium == corev1.StorageMediumMemory:
+			// Memory backed volumes are a tmpfs per container and not
+			// shared between the containers of a pod
+			if limit := source.EmptyDir.SizeLimit; limit != nil && !limit.IsZero() {
+				options = append(options, fmt.Sprintf("size=%d", limit.Value()))
+			}
+			mounts = append(mounts, specs.Mount{
+				Type:        "tmpfs",
+				Source:      "tmpfs",
+				Destination: vol.MountPath,
+				Options:     options,
+			})
+
+		case source.EmptyDir != nil:
+			dir := filepath.Join(c.volumePath(pod.ID, vol.Name), vol.SubPath)
+			if err := makeSharedDir(dir); err != nil {
+				return nil, nil, fmt.Errorf("failed to create volume %s: %w", vol.Name, err)
+			}
+			mounts = append(mounts, specs.Mount{
+				Type:        "bind",
+				Source:      dir,
+				Destination: vol.MountPath,
+				Options:     options,
+			})
+
+		case source.HostPath != nil:
+			mounts = append(mounts, specs.Mount{
+				Type:        "bind",
+				Source:      filepath.Join(source.HostPath.Path, vol.SubPath),
+				Destination: vol.MountPath,
+				Options:     options,
+			})
+
+		case source.PersistentVolumeClaim != nil:
+			if source.PersistentVolumeClaim.ReadOnly && !vol.ReadOnly {
+				options = append(options, "ro")
+			}
+			named = append(named, &specgen.NamedVolume{
+				Name:    ClaimVolumeName(pod.Namespace, source.PersistentVolumeClaim.ClaimName),
+				Dest:    vol.MountPath,
+				Options: options,
+				SubPath: vol.SubPath,
+			})
+
+		default:
+			return nil, nil, fmt.Errorf("volume %s has an unsupported type", vol.Name)
+		}
+	}
+
+	return mounts, named, nil
+}
+
+// prepareVolumes creates the emptyDir volumes of a pod and the host paths
+// that are created on demand, and checks that required host paths exist
+func (c *Client) prepareVolumes(pod *types.Pod) error {
+	for _, volume := range pod.Volumes {
+		switch {
+		case volume.EmptyDir != nil && volume.EmptyDir.Medium != corev1.StorageMediumMemory:
+			if c.volumeDir == "" {
+				return fmt.Errorf("volume directory is not configured")
+			}
+			if err := os.MkdirAll(filepath.Join(c.volumeDir, pod.ID), 0700); err != nil {
+				return fmt.Errorf("failed to create volume directory: %w", err)
+			}
+			if err := makeSharedDir(c.volumePath(pod.ID, volume.Name)); err != nil {
+				return fmt.Errorf("failed to create volume %s: %w", volume.Name, err)
+			}
+
+		case volume.HostPath != nil:
+			if err := prepareHostPath(volume.HostPath); err != nil {
+				return fmt.Errorf("volume %s: %w", volume.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// prepareHostPath creates or checks a host path by its type
+func prepareHostPath(hostPath *corev1.HostPathVolumeSource) error {
+	pathType := corev1.HostPathUnset
+	if hostPath.Type != nil {
+		pathType = *hostPath.Type
+	}
+
+	switch pathType {
+	case corev1.HostPathDirectoryOrCreate:
+		return os.MkdirAll(hostPath.Path, 0755)
+
+	case corev1.HostPathFileOrCreate:
+		file, err := os.OpenFile(hostPath.Path, os.O_CREATE|os.O_RDONLY, 0644)
+		if err != nil {
+			return err
+		}
+		return file.Close()
+
+	case corev1.HostPathDirectory, corev1.HostPathFile:
+		info, err := os.Stat(hostPath.Path)
+		if err != nil {
+			return fmt.Errorf("host path %s: %w", hostPath.Path, err)
+		}
+		if info.IsDir() != (pathType == corev1.HostPathDirectory) {
+			return fmt.Errorf("host path %s is not a %s", hostPath.Path, strings.ToLower(string(pathType)))
+		}
+	}
+
+	return nil
+}
+
+// makeSharedDir creates a directory writable by the containers of a pod,
+// whichever user they run as
+func makeSharedDir(dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return os.Chmod(dir, 0777)
+}
+
+// ClaimVolumeName returns the name of the Podman volume provisioned for a
+// persistent volume claim. Namespaces cannot contain underscores, which keeps
+// the names unique.
+func ClaimVolumeName(namespace, name string) string {
+	return "pvc-" + namespace + "_" + name
+}
+
+// CreateVolume provisions the Podman named volume of a persistent volume claim.
+// Existing volumes are kept.
+func (c *Client) CreateVolume(claim *types.PersistentVolumeClaim) error {
+	_, err := volumes.Create(c.conn, entities.VolumeCreateOptions{
+		Name: claim.VolumeName,
+		Label: map[string]string{
+			LabelManaged:   "true",
+			LabelNamespace: claim.Namespace,
+			LabelClaim:     claim.Name,
+		},
+		IgnoreIfExists: true,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create volume %s: %w", claim.VolumeName, err)
+	}
+
+	c.logger.Infof("Provisioned volume %s for claim %s/%s", claim.VolumeName, claim.Namespace, claim.Name)
+	return nil
+}
+
+// ListManagedVolumes returns the volumes provisioned for persistent volume claims
+func (c *Client) ListManagedVolumes() ([]*entities.VolumeListReport, error) {
+	return volumes.List(c.conn, new(volumes.ListOptions).WithFilters(map[string][]string{
+		"label": {LabelManaged + "=true"},
+	}))
+}
+
+// RemoveVolume removes a Podman named volume. Volumes in use are not removed.
+func (c *Client) RemoveVolume(name string) error {
+	return volumes.Remove(c.conn, name, nil)
+}
+
+func (c *Client) volumePath(podID, name string) string {
+	return filepath.Join(c.volumeDir, podID, name)
+}
+
+// podVolume returns the volume of a pod with the given name
+func podVolume(pod *types.Pod, name string) *corev1.Volume {
+	for i := range pod.Volumes {
+		if pod.Volumes[i].Name == name {
+			return &pod.Volumes[i]
+		}
+	}
+	return nil
+}
+
+// writeFile atomically replaces a file if its content or mode changed
+func writeFile(path string, data []byte, mode os.FileMode) error {
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm() == mode.Perm() {
+		if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode.Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
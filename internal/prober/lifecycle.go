@@ -0,0 +1,69 @@
+package prober
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// RunPreStopHooks runs the preStop hooks of the containers of a running pod
+// in parallel and waits for them at most the timeout. Failing hooks are only
+// logged, like the kubelet the pod is stopped anyway.
+func (m *Manager) RunPreStopHooks(pod *types.Pod, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for i := range pod.Containers {
+		container := &pod.Containers[i]
+		if container.Lifecycle == nil || container.Lifecycle.PreStop == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.runHook(pod, container, container.Lifecycle.PreStop, timeout); err != nil {
+				m.logger.Warnf("PreStop hook of container %s of pod %s/%s failed: %v", container.Name, pod.Namespace, pod.Name, err)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		m.logger.Warnf("PreStop hooks of pod %s/%s did not finish within %s", pod.Namespace, pod.Name, timeout)
+	}
+}
+
+// runHook runs a lifecycle hook of a container. Hooks sleeping longer than
+// the timeout are cut short.
+func (m *Manager) runHook(pod *types.Pod, container *types.Container, hook *corev1.LifecycleHandler, timeout time.Duration) error {
+	switch {
+	case hook.Exec != nil:
+		id := containerID(pod, container.Name)
+		if id == "" {
+			return fmt.Errorf("container is not running")
+		}
+		return m.probeExec(id, hook.Exec.Command, timeout)
+
+	case hook.HTTPGet != nil:
+		address, err := m.probeAddress(pod, container, hook.HTTPGet.Host, hook.HTTPGet.Port)
+		if err != nil {
+			return err
+		}
+		return probeHTTP(hook.HTTPGet, address, timeout)
+
+	case hook.Sleep != nil:
+		time.Sleep(min(time.Duration(hook.Sleep.Seconds)*time.Second, timeout))
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package prober
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestRunPreStopHooks(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/shutdown" {
+			calls.Add(1)
+		}
+	}))
+	defer server.Close()
+
+	host, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	pod := &types.Pod{Name: "web", Namespace: "default", Containers: []types.Container{
+		{Name: "plain"},
+		{Name: "app", Lifecycle: &corev1.Lifecycle{PreStop: &corev1.LifecycleHandler{
+			HTTPGet: &corev1.HTTPGetAction{Host: host, Port: intstr.FromInt(port), Path: "/shutdown"},
+		}}},
+		{Name: "proxy", Lifecycle: &corev1.Lifecycle{PreStop: &corev1.LifecycleHandler{
+			Sleep: &corev1.SleepAction{Seconds: 60},
+		}}},
+	}}
+
+	m := NewManager(nil, logrus.New())
+	start := time.Now()
+	m.RunPreStopHooks(pod, 200*time.Millisecond)
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected the HTTP hook to be called once, got %d", calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the sleep hook to be cut short by the timeout, took %s", elapsed)
+	}
+}
@@ -0,0 +1,215 @@
+package prober
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// Probe defaults, matching Kubernetes
+const (
+	defaultPeriodSeconds    = 10
+	defaultTimeoutSeconds   = 1
+	defaultSuccessThreshold = 1
+	defaultFailureThreshold = 3
+)
+
+// runProbe runs a single probe against a container of a pod
+func (m *Manager) runProbe(pod *types.Pod, cp *containerProber, probe *corev1.Probe) error {
+	timeout := probeTimeout(probe)
+
+	switch {
+	case probe.Exec != nil:
+		return m.probeExec(cp.containerID, probe.Exec.Command, timeout)
+
+	case probe.HTTPGet != nil:
+		address, err := m.probeAddress(pod, &cp.container, probe.HTTPGet.Host, probe.HTTPGet.Port)
+		if err != nil {
+			return err
+		}
+		return probeHTTP(probe.HTTPGet, address, timeout)
+
+	case probe.TCPSocket != nil:
+		address, err := m.probeAddress(pod, &cp.container, probe.TCPSocket.Host, probe.TCPSocket.Port)
+		if err != nil {
+			return err
+		}
+		return probeTCP(address, timeout)
+	}
+
+	// gRPC probes are not supported and always succeed
+	return nil
+}
+
+// probeExec runs a command in the container, a zero exit code is a success
+func (m *Manager) probeExec(containerID string, command []string, timeout time.Duration) error {
+	result := make(chan error, 1)
+	go func() {
+		_, err := m.podman.Exec(containerID, command)
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("command timed out after %s", timeout)
+	}
+}
+
+// probeHTTP performs an HTTP GET, a status code from 200 to 399 is a success
+func probeHTTP(action *corev1.HTTPGetAction, address string, timeout time.Duration) error {
+	scheme := "http"
+	if action.Scheme == corev1.URISchemeHTTPS {
+		scheme = "https"
+	}
+
+	target := url.URL{Scheme: scheme, Host: address, Path: action.Path}
+	if target.Path == "" {
+		target.Path = "/"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	for _, header := range action.HTTPHeaders {
+		if http.CanonicalHeaderKey(header.Name) == "Host" {
+			req.Host = header.Value
+			continue
+		}
+		req.Header.Add(header.Name, header.Value)
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// Like the kubelet, do not verify certificates of probed containers
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("HTTP probe failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// probeTCP opens a TCP connection, a successful connect is a success
+func probeTCP(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeAddress returns the address to probe a container port on. Ports
+// published on the host are probed there, others on the pod IP.
+func (m *Manager) probeAddress(pod *types.Pod, container *types.Container, host string, port intstr.IntOrString) (string, error) {
+	containerPort, err := resolvePort(container, port)
+	if err != nil {
+		return "", err
+	}
+
+	if host != "" {
+		return net.JoinHostPort(host, strconv.Itoa(int(containerPort))), nil
+	}
+
+	if address, ok := publishedAddress(container, containerPort); ok {
+		return address, nil
+	}
+
+	ip, err := m.podman.PodIP(pod.PodmanID)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(int(containerPort))), nil
+}
+
+// resolvePort resolves a numeric or named probe port to a container port
+func resolvePort(container *types.Container, port intstr.IntOrString) (int32, error) {
+	if port.Type == intstr.Int {
+		return port.IntVal, nil
+	}
+
+	for _, p := range container.Ports {
+		if p.Name == port.StrVal {
+			return p.ContainerPort, nil
+		}
+	}
+
+	// Numeric ports may also be given as strings
+	if value, err := strconv.Atoi(port.StrVal); err == nil {
+		return int32(value), nil
+	}
+
+	return 0, fmt.Errorf("port %q not found in container %s", port.StrVal, container.Name)
+}
+
+// publishedAddress returns the host address a container port is published on
+func publishedAddress(container *types.Container, containerPort int32) (string, bool) {
+	for _, p := range container.Ports {
+		if p.ContainerPort != containerPort || (p.Protocol != "" && p.Protocol != corev1.ProtocolTCP) {
+			continue
+		}
+
+		hostPort := p.HostPort
+		if hostPort == 0 {
+			hostPort = p.ContainerPort
+		}
+
+		hostIP := p.HostIP
+		if hostIP == "" || hostIP == "0.0.0.0" {
+			hostIP = "127.0.0.1"
+		}
+
+		return net.JoinHostPort(hostIP, strconv.Itoa(int(hostPort))), true
+	}
+
+	return "", false
+}
+
+func probePeriod(probe *corev1.Probe) time.Duration {
+	if probe.PeriodSeconds > 0 {
+		return time.Duration(probe.PeriodSeconds) * time.Second
+	}
+	return defaultPeriodSeconds * time.Second
+}
+
+func probeTimeout(probe *corev1.Probe) time.Duration {
+	if probe.TimeoutSeconds > 0 {
+		return time.Duration(probe.TimeoutSeconds) * time.Second
+	}
+	return defaultTimeoutSeconds * time.Second
+}
+
+func successThreshold(probe *corev1.Probe) int32 {
+	if probe.SuccessThreshold > 0 {
+		return probe.SuccessThreshold
+	}
+	return defaultSuccessThreshold
+}
+
+func failureThreshold(probe *corev1.Probe) int32 {
+	if probe.FailureThreshold > 0 {
+		return probe.FailureThreshold
+	}
+	return defaultFailureThreshold
+}
@@ -0,0 +1,169 @@
+package prober
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Probe") != "ready" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "http://")
+	action := &corev1.HTTPGetAction{
+		Path:        "/healthz",
+		HTTPHeaders: []corev1.HTTPHeader{{Name: "X-Probe", Value: "ready"}},
+	}
+
+	if err := probeHTTP(action, address, time.Second); err != nil {
+		t.Errorf("Expected probe to succeed, got %v", err)
+	}
+
+	action.Path = "/other"
+	if err := probeHTTP(action, address, time.Second); err == nil {
+		t.Error("Expected probe to fail on status 503")
+	}
+}
+
+func TestProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+
+	if err := probeTCP(address, time.Second); err != nil {
+		t.Errorf("Expected probe to succeed, got %v", err)
+	}
+
+	listener.Close()
+	if err := probeTCP(address, time.Second); err == nil {
+		t.Error("Expected probe to fail on a closed port")
+	}
+}
+
+func TestResolvePort(t *testing.T) {
+	container := &types.Container{
+		Name:  "web",
+		Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+	}
+
+	tests := []struct {
+		port     intstr.IntOrString
+		expected int32
+		wantErr  bool
+	}{
+		{intstr.FromInt(9090), 9090, false},
+		{intstr.FromString("http"), 8080, false},
+		{intstr.FromString("8081"), 8081, false},
+		{intstr.FromString("metrics"), 0, true},
+	}
+
+	for _, tt := range tests {
+		port, err := resolvePort(container, tt.port)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolvePort(%s): unexpected error %v", tt.port.String(), err)
+		}
+		if port != tt.expected {
+			t.Errorf("resolvePort(%s) = %d, expected %d", tt.port.String(), port, tt.expected)
+		}
+	}
+}
+
+func TestPublishedAddress(t *testing.T) {
+	container := &types.Container{
+		Ports: []corev1.ContainerPort{
+			{ContainerPort: 80},
+			{ContainerPort: 443, HostPort: 8443, HostIP: "10.0.0.5"},
+			{ContainerPort: 53, Protocol: corev1.ProtocolUDP},
+		},
+	}
+
+	if address, ok := publishedAddress(container, 80); !ok || address != "127.0.0.1:80" {
+		t.Errorf("Expected 127.0.0.1:80, got %s", address)
+	}
+	if address, ok := publishedAddress(container, 443); !ok || address != "10.0.0.5:8443" {
+		t.Errorf("Expected 10.0.0.5:8443, got %s", address)
+	}
+	if _, ok := publishedAddress(container, 53); ok {
+		t.Error("Expected UDP port not to be used for probes")
+	}
+	if _, ok := publishedAddress(container, 8080); ok {
+		t.Error("Expected unpublished port not to be found")
+	}
+}
+
+func TestReadinessThresholds(t *testing.T) {
+	var changes []bool
+	m := NewManager(nil, logrus.New())
+	m.SetReadinessHandler(func(pod *types.Pod, ready bool) {
+		changes = append(changes, ready)
+	})
+
+	probe := &corev1.Probe{SuccessThreshold: 2, FailureThreshold: 2}
+	web := &containerProber{container: types.Container{Name: "web", ReadinessProbe: probe}, started: true}
+	sidecar := &containerProber{container: types.Container{Name: "sidecar"}, started: true, ready: true}
+	p := &podProber{pod: types.Pod{Name: "web-0"}, probers: []*containerProber{web, sidecar}}
+
+	m.handleResult(p, web, probeReadiness, probe, 1, 0)
+	if p.isReady() {
+		t.Error("Expected pod to stay unready below the success threshold")
+	}
+
+	m.handleResult(p, web, probeReadiness, probe, 2, 0)
+	if !p.isReady() {
+		t.Error("Expected pod to become ready at the success threshold")
+	}
+
+	m.handleResult(p, web, probeReadiness, probe, 0, 1)
+	if !p.isReady() {
+		t.Error("Expected pod to stay ready below the failure threshold")
+	}
+
+	m.handleResult(p, web, probeReadiness, probe, 0, 2)
+	if p.isReady() {
+		t.Error("Expected pod to become unready at the failure threshold")
+	}
+
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("Expected readiness changes [true false], got %v", changes)
+	}
+}
+
+func TestIsReadyWithoutProber(t *testing.T) {
+	m := NewManager(nil, logrus.New())
+
+	podWith := func(container types.Container) *types.Pod {
+		return &types.Pod{ID: container.Name, Containers: []types.Container{{Name: "app"}, container}}
+	}
+
+	if !m.IsReady(podWith(types.Container{Name: "a"})) {
+		t.Error("Expected pod without probes to be ready")
+	}
+	if !m.IsReady(podWith(types.Container{Name: "b", LivenessProbe: &corev1.Probe{}})) {
+		t.Error("Expected pod with only a liveness probe to be ready")
+	}
+	if m.IsReady(podWith(types.Container{Name: "c", ReadinessProbe: &corev1.Probe{}})) {
+		t.Error("Expected pod with an unprobed readiness probe to be unready")
+	}
+}
@@ -0,0 +1,389 @@
+package prober
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/podman"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+type probeKind string
+
+const (
+	probeStartup   probeKind = "startup"
+	probeLiveness  probeKind = "liveness"
+	probeReadiness probeKind = "readiness"
+)
+
+// ReadinessHandler is called when the readiness of a pod changes
+type ReadinessHandler func(pod *types.Pod, ready bool)
+
+// RestartHandler is called after a container of a pod was restarted
+type RestartHandler func(pod *types.Pod, container string, reason string)
+
+// Manager runs the liveness, readiness and startup probes of the containers
+// of the pods running on the local node. Containers failing their liveness or
+// startup probe are restarted, readiness changes of a pod are reported to the
+// readiness handler. A pod is ready when all its containers are ready.
+type Manager struct {
+	podman      *podman.Client
+	logger      *logrus.Logger
+	mu          sync.Mutex
+	pods        map[string]*podProber // pod ID -> prober
+	onReadiness ReadinessHandler
+	onRestart   RestartHandler
+}
+
+// podProber holds the probe state of a single pod
+type podProber struct {
+	pod        types.Pod
+	containers string // Container IDs the probes were started for
+	mu         sync.Mutex
+	probers    []*containerProber
+	ready      bool // Last reported readiness
+}
+
+// containerProber holds the probe state of a single container
+type containerProber struct {
+	container   types.Container
+	containerID string
+	mu          sync.Mutex
+	started     bool
+	ready       bool
+	stopCh      chan struct{}
+}
+
+func NewManager(podman *podman.Client, logger *logrus.Logger) *Manager {
+	return &Manager{
+		podman: podman,
+		logger: logger,
+		pods:   make(map[string]*podProber),
+	}
+}
+
+// SetReadinessHandler sets the function called on readiness changes
+func (m *Manager) SetReadinessHandler(handler ReadinessHandler) {
+	m.onReadiness = handler
+}
+
+// SetRestartHandler sets the function called after a container was restarted
+func (m *Manager) SetRestartHandler(handler RestartHandler) {
+	m.onRestart = handler
+}
+
+// Sync starts probing the given running pods and stops probing all others.
+// Pods whose containers changed are probed from scratch.
+func (m *Manager) Sync(pods []*types.Pod) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		if !hasProbes(pod) {
+			continue
+		}
+		wanted[pod.ID] = true
+
+		if p, ok := m.pods[pod.ID]; ok {
+			if p.containers == containerIDs(pod) {
+				continue
+			}
+			p.stop()
+		}
+		m.pods[pod.ID] = m.startProber(pod)
+	}
+
+	for podID, p := range m.pods {
+		if !wanted[podID] {
+			p.stop()
+			delete(m.pods, podID)
+		}
+	}
+}
+
+// IsReady reports whether all containers of a running pod pass their readiness
+// probes. Containers without probes are always ready, containers with probes
+// that are not probed yet are not.
+func (m *Manager) IsReady(pod *types.Pod) bool {
+	m.mu.Lock()
+	p, ok := m.pods[pod.ID]
+	m.mu.Unlock()
+
+	if !ok || p.containers != containerIDs(pod) {
+		for _, container := range pod.Containers {
+			if container.ReadinessProbe != nil || container.StartupProbe != nil {
+				return false
+			}
+		}
+		return true
+	}
+	return p.isReady()
+}
+
+// Stop stops all probes
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for podID, p := range m.pods {
+		p.stop()
+		delete(m.pods, podID)
+	}
+}
+
+// startProber starts the probe workers of the containers of a pod
+func (m *Manager) startProber(pod *types.Pod) *podProber {
+	p := &podProber{
+		pod:        *pod,
+		containers: containerIDs(pod),
+	}
+
+	for _, container := range pod.Containers {
+		p.probers = append(p.probers, m.startContainerProber(p, container))
+	}
+	p.ready = p.isReady()
+
+	return p
+}
+
+// startContainerProber starts the probe workers of a container
+func (m *Manager) startContainerProber(p *podProber, container types.Container) *containerProber {
+	cp := &containerProber{
+		container:   container,
+		containerID: containerID(&p.pod, container.Name),
+		started:     container.StartupProbe == nil,
+		stopCh:      make(chan struct{}),
+	}
+	cp.ready = cp.started && container.ReadinessProbe == nil
+
+	if container.StartupProbe != nil {
+		go m.runWorker(p, cp, probeStartup, container.StartupProbe)
+	}
+	if container.LivenessProbe != nil {
+		go m.runWorker(p, cp, probeLiveness, container.LivenessProbe)
+	}
+	if container.ReadinessProbe != nil {
+		go m.runWorker(p, cp, probeReadiness, container.ReadinessProbe)
+	}
+
+	return cp
+}
+
+// runWorker periodically runs a probe until the container prober is stopped.
+// Liveness and readiness probes only run once the startup probe succeeded.
+func (m *Manager) runWorker(p *podProber, cp *containerProber, kind probeKind, probe *corev1.Probe) {
+	select {
+	case <-time.After(time.Duration(probe.InitialDelaySeconds) * time.Second):
+	case <-cp.stopCh:
+		return
+	}
+
+	ticker := time.NewTicker(probePeriod(probe))
+	defer ticker.Stop()
+
+	var successes, failures int32
+	for {
+		started := cp.isStarted()
+		if kind == probeStartup && started {
+			return
+		}
+
+		if kind == probeStartup || started {
+			if err := m.runProbe(&p.pod, cp, probe); err != nil {
+				failures++
+				successes = 0
+				m.logger.Debugf("%s probe of container %s in pod %s failed: %v", kind, cp.container.Name, p.pod.Name, err)
+			} else {
+				successes++
+				failures = 0
+			}
+
+			// The container may have been stopped while the probe ran
+			select {
+			case <-cp.stopCh:
+				return
+			default:
+			}
+
+			if !m.handleResult(p, cp, kind, probe, successes, failures) {
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-cp.stopCh:
+			return
+		}
+	}
+}
+
+// handleResult acts on the consecutive successes and failures of a probe.
+// Returns false if the container was restarted and the worker should stop.
+func (m *Manager) handleResult(p *podProber, cp *containerProber, kind probeKind, probe *corev1.Probe, successes, failures int32) bool {
+	switch kind {
+	case probeStartup:
+		if successes > 0 {
+			cp.setStarted()
+			if cp.container.ReadinessProbe == nil {
+				cp.setReady(true)
+				m.updateReadiness(p)
+			}
+		} else if failures >= failureThreshold(probe) {
+			m.logger.Warnf("Container %s of pod %s failed its startup probe, restarting", cp.container.Name, p.pod.Name)
+			m.restart(p, cp, "StartupProbeFailed")
+			return false
+		}
+
+	case probeLiveness:
+		if failures >= failureThreshold(probe) {
+			m.logger.Warnf("Container %s of pod %s failed its liveness probe, restarting", cp.container.Name, p.pod.Name)
+			m.restart(p, cp, "LivenessProbeFailed")
+			return false
+		}
+
+	case probeReadiness:
+		if successes >= successThreshold(probe) {
+			cp.setReady(true)
+			m.updateReadiness(p)
+		} else if failures >= failureThreshold(probe) {
+			cp.setReady(false)
+			m.updateReadiness(p)
+		}
+	}
+
+	return true
+}
+
+// updateReadiness reports a change of the readiness of a pod
+func (m *Manager) updateReadiness(p *podProber) {
+	ready := p.isReady()
+
+	p.mu.Lock()
+	changed := p.ready != ready
+	p.ready = ready
+	p.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	m.logger.Infof("Pod %s is now %s", p.pod.Name, readinessString(ready))
+	if m.onReadiness != nil {
+		m.onReadiness(&p.pod, ready)
+	}
+}
+
+// restart restarts a container and probes it from scratch
+func (m *Manager) restart(p *podProber, cp *containerProber, reason string) {
+	cp.setReady(false)
+	m.updateReadiness(p)
+
+	if err := m.podman.RestartContainer(cp.containerID); err != nil {
+		m.logger.Errorf("Failed to restart container %s of pod %s: %v", cp.container.Name, p.pod.Name, err)
+	} else if m.onRestart != nil {
+		m.onRestart(&p.pod, cp.container.Name, reason)
+	}
+
+	p.mu.Lock()
+	replaced := false
+	for i, current := range p.probers {
+		if current == cp {
+			close(cp.stopCh)
+			p.probers[i] = m.startContainerProber(p, cp.container)
+			replaced = true
+		}
+	}
+	p.mu.Unlock()
+
+	// Containers without startup and readiness probes are ready right away
+	if replaced {
+		m.updateReadiness(p)
+	}
+}
+
+func (p *podProber) isReady() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, cp := range p.probers {
+		if !cp.isReady() {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *podProber) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, cp := range p.probers {
+		close(cp.stopCh)
+	}
+	p.probers = nil
+}
+
+func (cp *containerProber) isStarted() bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.started
+}
+
+func (cp *containerProber) setStarted() {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.started = true
+}
+
+func (cp *containerProber) isReady() bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.ready
+}
+
+func (cp *containerProber) setReady(ready bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.ready = ready
+}
+
+func hasProbes(pod *types.Pod) bool {
+	for _, container := range pod.Containers {
+		if container.LivenessProbe != nil || container.ReadinessProbe != nil || container.StartupProbe != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// containerID returns the ID of a container of a pod
+func containerID(pod *types.Pod, name string) string {
+	for _, status := range pod.ContainerStatuses {
+		if status.Name == name && !status.Init {
+			return status.ContainerID
+		}
+	}
+	return ""
+}
+
+// containerIDs identifies the containers of a pod
+func containerIDs(pod *types.Pod) string {
+	ids := make([]string, 0, len(pod.Containers))
+	for _, container := range pod.Containers {
+		ids = append(ids, containerID(pod, container.Name))
+	}
+	return strings.Join(ids, ",")
+}
+
+func readinessString(ready bool) string {
+	if ready {
+		return "ready"
+	}
+	return "not ready"
+}
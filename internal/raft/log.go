@@ -0,0 +1,304 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// EntryType is the type of a log entry
+type EntryType string
+
+const (
+	EntryCommand EntryType = "command" // Command applied to the state machine
+	EntryConfig  EntryType = "config"  // New set of voters
+	EntryNoop    EntryType = "noop"    // Appended by a new leader to commit entries of previous terms
+)
+
+// Entry is an entry of the replicated log
+type Entry struct {
+	Index uint64    `json:"index"`
+	Term  uint64    `json:"term"`
+	Type  EntryType `json:"type"`
+	Data  []byte    `json:"data,omitempty"`
+}
+
+// snapshot is the state machine state up to and including Index
+type snapshot struct {
+	Index  uint64   `json:"index"`
+	Term   uint64   `json:"term"`
+	Voters []string `json:"voters"`
+	Data   []byte   `json:"data"`
+}
+
+// hardState is the state a node must not forget across restarts
+type hardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for"`
+}
+
+// logStore keeps the log, the latest snapshot and the hard state on disk.
+// Entries are appended to a JSON lines file which is only rewritten when the
+// log is truncated or compacted.
+type logStore struct {
+	dir      string
+	snapshot *snapshot // nil until the first snapshot
+	entries  []Entry   // Entries following the snapshot
+	file     *os.File
+}
+
+// openLogStore loads the log store from dir, creating it if needed
+func openLogStore(dir string) (*logStore, *hardState, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, nil, fmt.Errorf("failed to create raft directory: %w", err)
+	}
+
+	ls := &logStore{dir: dir}
+	hs := &hardState{}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "state.json")); err == nil {
+		if err := json.Unmarshal(data, hs); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal raft state: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read raft state: %w", err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "snapshot.json")); err == nil {
+		ls.snapshot = &snapshot{}
+		if err := json.Unmarshal(data, ls.snapshot); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal raft snapshot: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read raft snapshot: %w", err)
+	}
+
+	dirty, err := ls.readEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if dirty {
+		if err := ls.rewrite(); err != nil {
+			return nil, nil, err
+		}
+	} else if err := ls.openFile(); err != nil {
+		return nil, nil, err
+	}
+
+	return ls, hs, nil
+}
+
+// readEntries reads the log file, stopping at the first incomplete entry.
+// Returns true if the file has to be rewritten because it ends with such an
+// entry or still contains entries compacted into the snapshot.
+func (ls *logStore) readEntries() (bool, error) {
+	file, err := os.Open(filepath.Join(ls.dir, "log.jsonl"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to open raft log: %w", err)
+	}
+	defer file.Close()
+
+	dirty := false
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return true, nil
+		}
+		if entry.Index <= ls.snapshotIndex() {
+			dirty = true
+			continue
+		}
+		if entry.Index != ls.lastIndex()+1 {
+			return true, nil
+		}
+		ls.entries = append(ls.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return true, nil
+	}
+
+	return dirty, nil
+}
+
+func (ls *logStore) openFile() error {
+	file, err := os.OpenFile(filepath.Join(ls.dir, "log.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open raft log: %w", err)
+	}
+	ls.file = file
+	return nil
+}
+
+func (ls *logStore) close() error {
+	if ls.file == nil {
+		return nil
+	}
+	return ls.file.Close()
+}
+
+func (ls *logStore) snapshotIndex() uint64 {
+	if ls.snapshot == nil {
+		return 0
+	}
+	return ls.snapshot.Index
+}
+
+func (ls *logStore) snapshotTerm() uint64 {
+	if ls.snapshot == nil {
+		return 0
+	}
+	return ls.snapshot.Term
+}
+
+func (ls *logStore) lastIndex() uint64 {
+	if len(ls.entries) > 0 {
+		return ls.entries[len(ls.entries)-1].Index
+	}
+	return ls.snapshotIndex()
+}
+
+func (ls *logStore) lastTerm() uint64 {
+	if len(ls.entries) > 0 {
+		return ls.entries[len(ls.entries)-1].Term
+	}
+	return ls.snapshotTerm()
+}
+
+// term returns the term of the entry at index. Returns false if the entry
+// was compacted into a snapshot or does not exist yet.
+func (ls *logStore) term(index uint64) (uint64, bool) {
+	switch {
+	case index == 0:
+		return 0, true
+	case index == ls.snapshotIndex():
+		return ls.snapshotTerm(), true
+	case index < ls.snapshotIndex() || index > ls.lastIndex():
+		return 0, false
+	}
+	return ls.entries[index-ls.snapshotIndex()-1].Term, true
+}
+
+// slice returns up to max entries starting at index from
+func (ls *logStore) slice(from uint64, max int) []Entry {
+	if from <= ls.snapshotIndex() || from > ls.lastIndex() {
+		return nil
+	}
+
+	start := int(from - ls.snapshotIndex() - 1)
+	end := min(len(ls.entries), start+max)
+	return append([]Entry(nil), ls.entries[start:end]...)
+}
+
+// append writes entries to the end of the log
+func (ls *logStore) append(entries ...Entry) error {
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal log entry: %w", err)
+		}
+		if _, err := ls.file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write log entry: %w", err)
+		}
+	}
+	if err := ls.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync raft log: %w", err)
+	}
+
+	ls.entries = append(ls.entries, entries...)
+	return nil
+}
+
+// truncate removes the entries starting at index from
+func (ls *logStore) truncate(from uint64) error {
+	if from <= ls.snapshotIndex() || from > ls.lastIndex() {
+		return nil
+	}
+
+	ls.entries = ls.entries[:from-ls.snapshotIndex()-1]
+	return ls.rewrite()
+}
+
+// saveSnapshot stores a snapshot and removes the entries it covers. Entries
+// following it are kept if the log contains the last entry of the snapshot.
+func (ls *logStore) saveSnapshot(snap *snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to marshal raft snapshot: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(ls.dir, "snapshot.json"), data); err != nil {
+		return err
+	}
+
+	var kept []Entry
+	if term, ok := ls.term(snap.Index); ok && term == snap.Term && snap.Index >= ls.snapshotIndex() {
+		kept = ls.entries[snap.Index-ls.snapshotIndex():]
+	}
+	ls.snapshot = snap
+	ls.entries = append([]Entry(nil), kept...)
+
+	return ls.rewrite()
+}
+
+// saveState persists the hard state
+func (ls *logStore) saveState(hs *hardState) error {
+	data, err := json.Marshal(hs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal raft state: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(ls.dir, "state.json"), data)
+}
+
+// rewrite replaces the log file with the entries in memory
+func (ls *logStore) rewrite() error {
+	if ls.file != nil {
+		ls.file.Close()
+		ls.file = nil
+	}
+
+	var data []byte
+	for _, entry := range ls.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal log entry: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := writeFileAtomic(filepath.Join(ls.dir, "log.jsonl"), data); err != nil {
+		return err
+	}
+
+	return ls.openFile()
+}
+
+// writeFileAtomic writes a file through a synced temporary file and a rename
+func writeFileAtomic(path string, data []byte) error {
+	tmpFile := path + ".tmp"
+	file, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpFile, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", tmpFile, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync %s: %w", tmpFile, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmpFile, err)
+	}
+
+	if err := os.Rename(tmpFile, path); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", tmpFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,1028 @@
+// Package raft replicates the cluster state through a Raft log.
+//
+// Messages are exchanged over the cluster transport. Every node receives the
+// log, while the voters deciding on commits and leadership are chosen
+// automatically among the cluster members, so all nodes stay equal and no
+// node has to be configured as a server.
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMaxVoters         = 5
+	defaultHeartbeatInterval = 200 * time.Millisecond
+	defaultElectionTimeout   = time.Second
+	defaultSnapshotThreshold = 1024
+
+	maxAppendEntries = 64 // Entries sent to a peer in one message
+)
+
+var (
+	ErrNoLeader       = errors.New("no raft leader elected")
+	ErrTimeout        = errors.New("timed out waiting for the command to be committed")
+	ErrLeadershipLost = errors.New("leadership lost before the command was committed")
+	ErrStopped        = errors.New("raft node stopped")
+)
+
+// Role is the role of a node in the current term
+type Role string
+
+const (
+	RoleFollower  Role = "follower"
+	RoleCandidate Role = "candidate"
+	RoleLeader    Role = "leader"
+)
+
+// FSM is the state machine the committed commands are applied to
+type FSM interface {
+	// Apply applies a committed command
+	Apply(data []byte) error
+	// Snapshot returns the complete state
+	Snapshot() ([]byte, error)
+	// Restore replaces the state with a snapshot
+	Restore(data []byte) error
+}
+
+// Config holds the configuration of a raft node
+type Config struct {
+	NodeName          string
+	DataDir           string                              // Term, log and snapshots are persisted here
+	Bootstrap         bool                                // Start a new cluster with this node as its only voter if nothing is persisted
+	MaxVoters         int                                 // Maximum number of voters, defaults to 5
+	HeartbeatInterval time.Duration                       // Defaults to 200ms
+	ElectionTimeout   time.Duration                       // Randomized between this and twice this, defaults to 1s
+	SnapshotThreshold uint64                              // Applied entries after which the log is compacted, defaults to 1024
+	FSM               FSM                                 // Required
+	Send              func(node string, msg []byte) error // Sends a message to a cluster member, required
+	Members           func() []string                     // Names of the live cluster members
+	Logger            *logrus.Logger
+}
+
+// Status describes the raft state of a node
+type Status struct {
+	Role         Role     `json:"role"`
+	Term         uint64   `json:"term"`
+	Leader       string   `json:"leader"`
+	Voters       []string `json:"voters"`
+	LastIndex    uint64   `json:"last_index"`
+	CommitIndex  uint64   `json:"commit_index"`
+	AppliedIndex uint64   `json:"applied_index"`
+}
+
+// Node is a member of the raft cluster
+type Node struct {
+	cfg    Config
+	logger *logrus.Logger
+	store  *logStore
+
+	mu               sync.Mutex
+	role             Role
+	term             uint64
+	votedFor         string
+	leader           string
+	voters           []string
+	configIndex      uint64 // Index of the entry the voters were read from
+	commitIndex      uint64
+	lastApplied      uint64
+	lastContact      time.Time // Last message from the leader
+	electionDeadline time.Time
+	leaderSince      time.Time
+	votes            map[string]bool
+	nextIndex        map[string]uint64
+	matchIndex       map[string]uint64
+	lastAck          map[string]time.Time
+	snapshotSent     map[string]time.Time
+	pendingRestore   *snapshot
+	waiters          map[uint64][]waiter
+	forwards         map[uint64]chan forwardResult
+	nextForwardID    uint64
+
+	applyCh chan struct{}
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// waiter waits for the entry appended at an index in a term to be applied
+type waiter struct {
+	term uint64
+	ch   chan error
+}
+
+// forwardResult is the answer of the leader to a forwarded command
+type forwardResult struct {
+	index, term uint64
+	err         error
+}
+
+type messageKind string
+
+const (
+	msgVote            messageKind = "vote"
+	msgVoteResponse    messageKind = "vote_response"
+	msgAppend          messageKind = "append"
+	msgAppendResponse  messageKind = "append_response"
+	msgSnapshot        messageKind = "snapshot"
+	msgForward         messageKind = "forward"
+	msgForwardResponse messageKind = "forward_response"
+	messageType                    = "raft"
+)
+
+// message is a raft message. Only the fields of its kind are set.
+type message struct {
+	Type string      `json:"type"` // Always "raft", distinguishes raft messages from other cluster messages
+	Kind messageKind `json:"kind"`
+	From string      `json:"from"`
+	Term uint64      `json:"term"`
+
+	LastLogIndex uint64    `json:"last_log_index,omitempty"`
+	LastLogTerm  uint64    `json:"last_log_term,omitempty"`
+	PrevLogIndex uint64    `json:"prev_log_index,omitempty"`
+	PrevLogTerm  uint64    `json:"prev_log_term,omitempty"`
+	Entries      []Entry   `json:"entries,omitempty"`
+	LeaderCommit uint64    `json:"leader_commit,omitempty"`
+	Snapshot     *snapshot `json:"snapshot,omitempty"`
+	Success      bool      `json:"success,omitempty"`
+	MatchIndex   uint64    `json:"match_index,omitempty"` // Last matching entry, or a hint where to continue on failure
+
+	ID      uint64 `json:"id,omitempty"`
+	Command []byte `json:"command,omitempty"`
+	Index   uint64 `json:"index,omitempty"`
+	LogTerm uint64 `json:"log_term,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewNode creates a raft node from the state persisted in the data directory
+func NewNode(cfg Config) (*Node, error) {
+	if cfg.NodeName == "" || cfg.DataDir == "" {
+		return nil, fmt.Errorf("node name and data directory are required")
+	}
+	if cfg.FSM == nil || cfg.Send == nil {
+		return nil, fmt.Errorf("state machine and transport are required")
+	}
+	if cfg.MaxVoters <= 0 {
+		cfg.MaxVoters = defaultMaxVoters
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if cfg.ElectionTimeout <= 0 {
+		cfg.ElectionTimeout = defaultElectionTimeout
+	}
+	if cfg.SnapshotThreshold == 0 {
+		cfg.SnapshotThreshold = defaultSnapshotThreshold
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = logrus.New()
+	}
+
+	store, hs, err := openLogStore(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{
+		cfg:      cfg,
+		logger:   cfg.Logger,
+		store:    store,
+		role:     RoleFollower,
+		term:     hs.Term,
+		votedFor: hs.VotedFor,
+		waiters:  make(map[uint64][]waiter),
+		forwards: make(map[uint64]chan forwardResult),
+		applyCh:  make(chan struct{}, 1),
+		stopCh:   make(chan struct{}),
+	}
+
+	if snap := store.snapshot; snap != nil {
+		if err := cfg.FSM.Restore(snap.Data); err != nil {
+			store.close()
+			return nil, fmt.Errorf("failed to restore raft snapshot: %w", err)
+		}
+		n.commitIndex = snap.Index
+		n.lastApplied = snap.Index
+	}
+
+	// Only a node without any history may start a new cluster
+	if cfg.Bootstrap && n.term == 0 && store.lastIndex() == 0 {
+		data, _ := json.Marshal([]string{cfg.NodeName})
+		n.term = 1
+		if err := n.persistState(); err != nil {
+			store.close()
+			return nil, err
+		}
+		if err := store.append(Entry{Index: 1, Term: 1, Type: EntryConfig, Data: data}); err != nil {
+			store.close()
+			return nil, err
+		}
+		n.logger.Infof("Bootstrapped raft cluster with voter %s", cfg.NodeName)
+	}
+
+	n.voters, n.configIndex = n.configAt(store.lastIndex())
+	n.resetElectionTimer()
+
+	return n, nil
+}
+
+// Start starts the election and heartbeat timers and applying committed entries
+func (n *Node) Start() {
+	n.wg.Add(2)
+
+	go func() {
+		defer n.wg.Done()
+		ticker := time.NewTicker(n.cfg.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				n.tick()
+			case <-n.stopCh:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer n.wg.Done()
+		for {
+			select {
+			case <-n.applyCh:
+				n.applyCommitted()
+			case <-n.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the node and closes its log
+func (n *Node) Stop() {
+	close(n.stopCh)
+	n.wg.Wait()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.store.close()
+}
+
+// IsLeader checks if this node is the current leader
+func (n *Node) IsLeader() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.role == RoleLeader
+}
+
+// Leader returns the name of the current leader, empty if unknown
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leader
+}
+
+// Status returns the raft state of this node
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return Status{
+		Role:         n.role,
+		Term:         n.term,
+		Leader:       n.leader,
+		Voters:       slices.Clone(n.voters),
+		LastIndex:    n.store.lastIndex(),
+		CommitIndex:  n.commitIndex,
+		AppliedIndex: n.lastApplied,
+	}
+}
+
+// Apply replicates a command and waits until it was applied to the local
+// state machine. Followers forward the command to the leader.
+func (n *Node) Apply(cmd []byte, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	n.mu.Lock()
+	if n.role == RoleLeader {
+		index, err := n.appendEntry(EntryCommand, cmd)
+		if err != nil {
+			n.mu.Unlock()
+			return err
+		}
+		ch := n.wait(index, n.term)
+		n.replicate()
+		n.mu.Unlock()
+		return n.await(ch, time.Until(deadline))
+	}
+
+	if n.leader == "" {
+		n.mu.Unlock()
+		return ErrNoLeader
+	}
+
+	n.nextForwardID++
+	id := n.nextForwardID
+	resultCh := make(chan forwardResult, 1)
+	n.forwards[id] = resultCh
+	n.send(n.leader, &message{Kind: msgForward, ID: id, Command: cmd})
+	n.mu.Unlock()
+
+	var result forwardResult
+	select {
+	case result = <-resultCh:
+	case <-time.After(time.Until(deadline)):
+		n.mu.Lock()
+		delete(n.forwards, id)
+		n.mu.Unlock()
+		return ErrTimeout
+	case <-n.stopCh:
+		return ErrStopped
+	}
+	if result.err != nil {
+		return result.err
+	}
+
+	// Wait for the command to reach the local state machine as well
+	n.mu.Lock()
+	if n.lastApplied >= result.index {
+		n.mu.Unlock()
+		return nil
+	}
+	ch := n.wait(result.index, result.term)
+	n.mu.Unlock()
+	return n.await(ch, time.Until(deadline))
+}
+
+// HandleMessage handles a raft message received from a peer. Other cluster
+// messages are ignored.
+func (n *Node) HandleMessage(data []byte) error {
+	var m message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("failed to unmarshal raft message: %w", err)
+	}
+	if m.Type != messageType {
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if m.Term > n.term {
+		// A node that was removed from the voters or partitioned away keeps
+		// starting elections. Those are ignored while the leader is alive.
+		if m.Kind == msgVote && (n.role == RoleLeader || (n.leader != "" && time.Since(n.lastContact) < n.cfg.ElectionTimeout)) {
+			return nil
+		}
+		n.becomeFollower(m.Term, "")
+	}
+
+	switch m.Kind {
+	case msgVote:
+		n.handleVote(&m)
+	case msgVoteResponse:
+		n.handleVoteResponse(&m)
+	case msgAppend:
+		n.handleAppend(&m)
+	case msgAppendResponse:
+		n.handleAppendResponse(&m)
+	case msgSnapshot:
+		n.handleSnapshot(&m)
+	case msgForward:
+		n.handleForward(&m)
+	case msgForwardResponse:
+		if ch, ok := n.forwards[m.ID]; ok {
+			delete(n.forwards, m.ID)
+			result := forwardResult{index: m.Index, term: m.LogTerm}
+			if m.Error != "" {
+				result.err = errors.New(m.Error)
+			}
+			ch <- result
+		}
+	default:
+		return fmt.Errorf("unknown raft message kind %q", m.Kind)
+	}
+
+	return nil
+}
+
+// tick sends heartbeats as leader and starts an election as voter once the
+// leader was not heard of within the election timeout
+func (n *Node) tick() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if n.role == RoleLeader {
+		// Step down if a majority of the voters was not reachable for an
+		// election timeout, a new leader is likely elected on their side
+		acked := 0
+		for _, voter := range n.voters {
+			if voter == n.cfg.NodeName || now.Sub(n.lastAck[voter]) < n.cfg.ElectionTimeout {
+				acked++
+			}
+		}
+		if acked <= len(n.voters)/2 && now.Sub(n.leaderSince) > n.cfg.ElectionTimeout {
+			n.logger.Warnf("Lost contact to a majority of the raft voters, stepping down")
+			n.becomeFollower(n.term, "")
+			return
+		}
+
+		n.reconfigure()
+		n.replicate()
+		return
+	}
+
+	if now.Before(n.electionDeadline) {
+		return
+	}
+	if !slices.Contains(n.voters, n.cfg.NodeName) {
+		n.resetElectionTimer()
+		return
+	}
+	n.startElection()
+}
+
+func (n *Node) startElection() {
+	n.role = RoleCandidate
+	n.term++
+	n.votedFor = n.cfg.NodeName
+	n.leader = ""
+	if err := n.persistState(); err != nil {
+		n.logger.Errorf("Failed to persist raft state: %v", err)
+	}
+	n.resetElectionTimer()
+
+	n.logger.Infof("Starting raft election for term %d", n.term)
+	n.votes = map[string]bool{n.cfg.NodeName: true}
+	if n.hasQuorum(n.votes) {
+		n.becomeLeader()
+		return
+	}
+
+	for _, voter := range n.voters {
+		if voter != n.cfg.NodeName {
+			n.send(voter, &message{Kind: msgVote, LastLogIndex: n.store.lastIndex(), LastLogTerm: n.store.lastTerm()})
+		}
+	}
+}
+
+func (n *Node) becomeLeader() {
+	n.logger.Infof("Became raft leader for term %d", n.term)
+	n.role = RoleLeader
+	n.leader = n.cfg.NodeName
+	n.leaderSince = time.Now()
+	n.nextIndex = make(map[string]uint64)
+	n.matchIndex = make(map[string]uint64)
+	n.lastAck = make(map[string]time.Time)
+	n.snapshotSent = make(map[string]time.Time)
+
+	// Entries of previous terms are committed along with an entry of this term
+	if _, err := n.appendEntry(EntryNoop, nil); err != nil {
+		n.logger.Errorf("Failed to append raft entry: %v", err)
+	}
+	n.replicate()
+}
+
+// becomeFollower moves to a term, following leader if known
+func (n *Node) becomeFollower(term uint64, leader string) {
+	if term > n.term {
+		n.term = term
+		n.votedFor = ""
+		if err := n.persistState(); err != nil {
+			n.logger.Errorf("Failed to persist raft state: %v", err)
+		}
+	}
+	if n.role == RoleLeader {
+		n.logger.Infof("Stepping down as raft leader in term %d", n.term)
+	}
+
+	n.role = RoleFollower
+	if leader != n.leader && leader != "" {
+		n.logger.Infof("Following raft leader %s in term %d", leader, n.term)
+	}
+	n.leader = leader
+	if leader != "" {
+		n.lastContact = time.Now()
+	}
+	n.resetElectionTimer()
+}
+
+func (n *Node) handleVote(m *message) {
+	granted := false
+	if m.Term == n.term && (n.votedFor == "" || n.votedFor == m.From) && n.isUpToDate(m.LastLogIndex, m.LastLogTerm) {
+		granted = true
+		n.votedFor = m.From
+		if err := n.persistState(); err != nil {
+			n.logger.Errorf("Failed to persist raft state: %v", err)
+			granted = false
+		}
+		n.resetElectionTimer()
+	}
+
+	n.send(m.From, &message{Kind: msgVoteResponse, Success: granted})
+}
+
+func (n *Node) handleVoteResponse(m *message) {
+	if n.role != RoleCandidate || m.Term != n.term || !m.Success {
+		return
+	}
+
+	n.votes[m.From] = true
+	if n.hasQuorum(n.votes) {
+		n.becomeLeader()
+	}
+}
+
+func (n *Node) handleAppend(m *message) {
+	if m.Term < n.term {
+		n.send(m.From, &message{Kind: msgAppendResponse, MatchIndex: n.store.lastIndex()})
+		return
+	}
+	n.becomeFollower(m.Term, m.From)
+
+	// Entries compacted into the snapshot are committed and match
+	prevIndex, prevTerm, entries := m.PrevLogIndex, m.PrevLogTerm, m.Entries
+	if snapIndex := n.store.snapshotIndex(); prevIndex < snapIndex {
+		for len(entries) > 0 && entries[0].Index <= snapIndex {
+			entries = entries[1:]
+		}
+		prevIndex, prevTerm = snapIndex, n.store.snapshotTerm()
+	}
+
+	if term, ok := n.store.term(prevIndex); !ok || term != prevTerm {
+		hint := min(n.store.lastIndex(), prevIndex-1)
+		n.send(m.From, &message{Kind: msgAppendResponse, MatchIndex: hint})
+		return
+	}
+	lastNew := prevIndex + uint64(len(entries))
+
+	// Skip the entries already in the log and drop conflicting ones
+	for len(entries) > 0 {
+		term, ok := n.store.term(entries[0].Index)
+		if !ok {
+			break
+		}
+		if term != entries[0].Term {
+			if err := n.store.truncate(entries[0].Index); err != nil {
+				n.logger.Errorf("Failed to truncate raft log: %v", err)
+				return
+			}
+			break
+		}
+		entries = entries[1:]
+	}
+	if len(entries) > 0 {
+		if err := n.store.append(entries...); err != nil {
+			n.logger.Errorf("Failed to append raft entries: %v", err)
+			return
+		}
+	}
+	n.voters, n.configIndex = n.configAt(n.store.lastIndex())
+
+	if commit := min(m.LeaderCommit, lastNew); commit > n.commitIndex {
+		n.commitIndex = commit
+		n.signalApply()
+	}
+
+	n.send(m.From, &message{Kind: msgAppendResponse, Success: true, MatchIndex: lastNew})
+}
+
+func (n *Node) handleAppendResponse(m *message) {
+	if n.role != RoleLeader || m.Term != n.term {
+		return
+	}
+	n.lastAck[m.From] = time.Now()
+
+	if m.Success {
+		if m.MatchIndex > n.matchIndex[m.From] {
+			n.matchIndex[m.From] = m.MatchIndex
+		}
+		n.nextIndex[m.From] = n.matchIndex[m.From] + 1
+		delete(n.snapshotSent, m.From)
+		n.advanceCommit()
+	} else {
+		n.nextIndex[m.From] = max(1, min(n.peerNextIndex(m.From)-1, m.MatchIndex+1))
+	}
+
+	// Continue right away with a peer that is catching up
+	if n.peerNextIndex(m.From) <= n.store.lastIndex() {
+		n.replicateTo(m.From)
+	}
+}
+
+func (n *Node) handleSnapshot(m *message) {
+	if m.Term < n.term || m.Snapshot == nil {
+		n.send(m.From, &message{Kind: msgAppendResponse, MatchIndex: n.store.lastIndex()})
+		return
+	}
+	n.becomeFollower(m.Term, m.From)
+
+	snap := m.Snapshot
+	if snap.Index > n.commitIndex {
+		n.logger.Infof("Installing raft snapshot at index %d from %s", snap.Index, m.From)
+		if err := n.store.saveSnapshot(snap); err != nil {
+			n.logger.Errorf("Failed to save raft snapshot: %v", err)
+			return
+		}
+		n.voters, n.configIndex = n.configAt(n.store.lastIndex())
+		n.commitIndex = snap.Index
+		n.pendingRestore = snap
+		n.signalApply()
+	}
+
+	n.send(m.From, &message{Kind: msgAppendResponse, Success: true, MatchIndex: snap.Index})
+}
+
+// handleForward appends a command forwarded by a follower and answers once it
+// was applied
+func (n *Node) handleForward(m *message) {
+	if n.role != RoleLeader {
+		n.send(m.From, &message{Kind: msgForwardResponse, ID: m.ID, Error: ErrNoLeader.Error()})
+		return
+	}
+
+	index, err := n.appendEntry(EntryCommand, m.Command)
+	if err != nil {
+		n.send(m.From, &message{Kind: msgForwardResponse, ID: m.ID, Error: err.Error()})
+		return
+	}
+	term := n.term
+	ch := n.wait(index, term)
+	n.replicate()
+
+	go func() {
+		response := &message{Kind: msgForwardResponse, ID: m.ID, Index: index, LogTerm: term}
+		if err := n.await(ch, 2*n.cfg.ElectionTimeout); err != nil {
+			response.Error = err.Error()
+		}
+
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.send(m.From, response)
+	}()
+}
+
+// appendEntry appends an entry to the log of the leader
+func (n *Node) appendEntry(entryType EntryType, data []byte) (uint64, error) {
+	entry := Entry{Index: n.store.lastIndex() + 1, Term: n.term, Type: entryType, Data: data}
+	if err := n.store.append(entry); err != nil {
+		return 0, err
+	}
+	if entryType == EntryConfig {
+		n.voters, n.configIndex = n.configAt(entry.Index)
+	}
+
+	// A single voter commits on its own
+	n.advanceCommit()
+	return entry.Index, nil
+}
+
+// replicate sends the missing entries, or a heartbeat, to every peer
+func (n *Node) replicate() {
+	for _, peer := range n.peers() {
+		n.replicateTo(peer)
+	}
+}
+
+func (n *Node) replicateTo(peer string) {
+	next := n.peerNextIndex(peer)
+
+	if next <= n.store.snapshotIndex() {
+		// Snapshots are large, resend only if the previous one got lost
+		if sent, ok := n.snapshotSent[peer]; ok && time.Since(sent) < n.cfg.ElectionTimeout {
+			return
+		}
+		n.snapshotSent[peer] = time.Now()
+		n.send(peer, &message{Kind: msgSnapshot, Snapshot: n.store.snapshot})
+		return
+	}
+
+	prevTerm, _ := n.store.term(next - 1)
+	n.send(peer, &message{
+		Kind:         msgAppend,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  prevTerm,
+		Entries:      n.store.slice(next, maxAppendEntries),
+		LeaderCommit: n.commitIndex,
+	})
+}
+
+// advanceCommit commits the latest entry of the current term stored on a
+// majority of the voters
+func (n *Node) advanceCommit() {
+	for index := n.store.lastIndex(); index > n.commitIndex; index-- {
+		if term, _ := n.store.term(index); term != n.term {
+			return
+		}
+
+		stored := 0
+		for _, voter := range n.voters {
+			if voter == n.cfg.NodeName || n.matchIndex[voter] >= index {
+				stored++
+			}
+		}
+		if stored > len(n.voters)/2 {
+			n.commitIndex = index
+			n.signalApply()
+			return
+		}
+	}
+}
+
+// reconfigure adjusts the voters to the live cluster members, one voter at a
+// time. Voters that left are removed first, then caught up members are added
+// until MaxVoters is reached. An odd number of voters is kept since an extra
+// voter would not tolerate any additional failure.
+func (n *Node) reconfigure() {
+	if n.cfg.Members == nil || n.configIndex > n.commitIndex {
+		return
+	}
+
+	alive := map[string]bool{n.cfg.NodeName: true}
+	for _, member := range n.cfg.Members() {
+		alive[member] = true
+	}
+
+	voters := slices.Clone(n.voters)
+	for i, voter := range voters {
+		if !alive[voter] {
+			n.logger.Infof("Removing raft voter %s that left the cluster", voter)
+			n.changeVoters(slices.Delete(voters, i, i+1))
+			return
+		}
+	}
+
+	desired := min(n.cfg.MaxVoters, len(alive))
+	if desired > 1 && desired%2 == 0 {
+		desired--
+	}
+
+	switch {
+	case len(voters) < desired:
+		candidates := make([]string, 0, len(alive))
+		for member := range alive {
+			if !slices.Contains(voters, member) && n.matchIndex[member] >= n.commitIndex {
+				candidates = append(candidates, member)
+			}
+		}
+		if len(candidates) == 0 {
+			return
+		}
+		sort.Strings(candidates)
+		n.logger.Infof("Adding raft voter %s", candidates[0])
+		n.changeVoters(append(voters, candidates[0]))
+	case len(voters) > desired:
+		sort.Strings(voters)
+		for i := len(voters) - 1; i >= 0; i-- {
+			if voters[i] != n.cfg.NodeName {
+				n.logger.Infof("Removing raft voter %s", voters[i])
+				n.changeVoters(slices.Delete(voters, i, i+1))
+				return
+			}
+		}
+	}
+}
+
+func (n *Node) changeVoters(voters []string) {
+	sort.Strings(voters)
+	data, err := json.Marshal(voters)
+	if err != nil {
+		n.logger.Errorf("Failed to marshal raft voters: %v", err)
+		return
+	}
+	if _, err := n.appendEntry(EntryConfig, data); err != nil {
+		n.logger.Errorf("Failed to append raft configuration: %v", err)
+	}
+}
+
+// applyCommitted applies committed entries to the state machine and compacts
+// the log once enough entries were applied
+func (n *Node) applyCommitted() {
+	for {
+		n.mu.Lock()
+		if snap := n.pendingRestore; snap != nil {
+			n.pendingRestore = nil
+			n.mu.Unlock()
+
+			if err := n.cfg.FSM.Restore(snap.Data); err != nil {
+				n.logger.Errorf("Failed to restore raft snapshot: %v", err)
+			}
+
+			n.mu.Lock()
+			n.lastApplied = snap.Index
+			for index, waiters := range n.waiters {
+				if index <= snap.Index {
+					for _, w := range waiters {
+						w.ch <- ErrLeadershipLost
+					}
+					delete(n.waiters, index)
+				}
+			}
+			n.mu.Unlock()
+			continue
+		}
+
+		entries := n.store.slice(n.lastApplied+1, int(min(n.commitIndex-n.lastApplied, maxAppendEntries)))
+		n.mu.Unlock()
+		if len(entries) == 0 {
+			break
+		}
+
+		for _, entry := range entries {
+			var err error
+			if entry.Type == EntryCommand {
+				if err = n.cfg.FSM.Apply(entry.Data); err != nil {
+					n.logger.Errorf("Failed to apply raft entry %d: %v", entry.Index, err)
+				}
+			}
+
+			n.mu.Lock()
+			if n.pendingRestore == nil {
+				n.lastApplied = entry.Index
+			}
+			n.finish(entry, err)
+			n.mu.Unlock()
+		}
+	}
+
+	n.compact()
+}
+
+// compact replaces the applied entries with a snapshot once there are enough
+func (n *Node) compact() {
+	n.mu.Lock()
+	index := n.lastApplied
+	if index-n.store.snapshotIndex() < n.cfg.SnapshotThreshold {
+		n.mu.Unlock()
+		return
+	}
+	term, ok := n.store.term(index)
+	voters, _ := n.configAt(index)
+	n.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	// Only this goroutine applies entries, so the state matches index
+	data, err := n.cfg.FSM.Snapshot()
+	if err != nil {
+		n.logger.Errorf("Failed to snapshot state: %v", err)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// A snapshot installed from the leader in the meantime is newer
+	if n.pendingRestore != nil || n.store.snapshotIndex() >= index {
+		return
+	}
+	if err := n.store.saveSnapshot(&snapshot{Index: index, Term: term, Voters: voters, Data: data}); err != nil {
+		n.logger.Errorf("Failed to save raft snapshot: %v", err)
+		return
+	}
+	n.logger.Debugf("Compacted raft log up to index %d", index)
+}
+
+// wait registers a waiter for the entry appended at index in term
+func (n *Node) wait(index, term uint64) chan error {
+	ch := make(chan error, 1)
+	n.waiters[index] = append(n.waiters[index], waiter{term: term, ch: ch})
+	return ch
+}
+
+// finish notifies the waiters of an applied entry. A waiter whose entry was
+// replaced by an entry of another term lost its command.
+func (n *Node) finish(entry Entry, err error) {
+	for _, w := range n.waiters[entry.Index] {
+		if w.term != entry.Term {
+			w.ch <- ErrLeadershipLost
+		} else {
+			w.ch <- err
+		}
+	}
+	delete(n.waiters, entry.Index)
+}
+
+func (n *Node) await(ch chan error, timeout time.Duration) error {
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(timeout):
+		return ErrTimeout
+	case <-n.stopCh:
+		return ErrStopped
+	}
+}
+
+// configAt returns the voters in effect at index, which are those of the
+// latest configuration entry up to index, and the index of that entry
+func (n *Node) configAt(index uint64) ([]string, uint64) {
+	for i := min(index, n.store.lastIndex()); i > n.store.snapshotIndex(); i-- {
+		entry := n.store.entries[i-n.store.snapshotIndex()-1]
+		if entry.Type != EntryConfig {
+			continue
+		}
+		var voters []string
+		if err := json.Unmarshal(entry.Data, &voters); err != nil {
+			n.logger.Errorf("Invalid raft configuration at index %d: %v", entry.Index, err)
+			continue
+		}
+		return voters, entry.Index
+	}
+
+	if n.store.snapshot != nil {
+		return slices.Clone(n.store.snapshot.Voters), n.store.snapshot.Index
+	}
+	return nil, 0
+}
+
+// peers returns the voters and members the leader replicates to
+func (n *Node) peers() []string {
+	peers := make(map[string]bool)
+	for _, voter := range n.voters {
+		peers[voter] = true
+	}
+	if n.cfg.Members != nil {
+		for _, member := range n.cfg.Members() {
+			peers[member] = true
+		}
+	}
+	delete(peers, n.cfg.NodeName)
+
+	names := make([]string, 0, len(peers))
+	for peer := range peers {
+		names = append(names, peer)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n *Node) peerNextIndex(peer string) uint64 {
+	if next, ok := n.nextIndex[peer]; ok {
+		return next
+	}
+	return n.store.lastIndex() + 1
+}
+
+func (n *Node) hasQuorum(votes map[string]bool) bool {
+	granted := 0
+	for _, voter := range n.voters {
+		if votes[voter] {
+			granted++
+		}
+	}
+	return granted > len(n.voters)/2
+}
+
+// isUpToDate checks if a candidate's log is at least as up to date as ours
+func (n *Node) isUpToDate(lastIndex, lastTerm uint64) bool {
+	if lastTerm != n.store.lastTerm() {
+		return lastTerm > n.store.lastTerm()
+	}
+	return lastIndex >= n.store.lastIndex()
+}
+
+func (n *Node) resetElectionTimer() {
+	timeout := n.cfg.ElectionTimeout + time.Duration(rand.Int63n(int64(n.cfg.ElectionTimeout)))
+	n.electionDeadline = time.Now().Add(timeout)
+}
+
+func (n *Node) signalApply() {
+	select {
+	case n.applyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Node) persistState() error {
+	return n.store.saveState(&hardState{Term: n.term, VotedFor: n.votedFor})
+}
+
+// send sends a message in the background, raft tolerates lost messages
+func (n *Node) send(to string, m *message) {
+	m.Type = messageType
+	m.From = n.cfg.NodeName
+	m.Term = n.term
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		n.logger.Errorf("Failed to marshal raft message: %v", err)
+		return
+	}
+
+	go func() {
+		if err := n.cfg.Send(to, data); err != nil {
+			n.logger.Debugf("Failed to send raft %s message to %s: %v", m.Kind, to, err)
+		}
+	}()
+}
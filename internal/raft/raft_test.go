@@ -0,0 +1,254 @@
+package raft
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testFSM records the applied commands
+type testFSM struct {
+	mu      sync.Mutex
+	applied []string
+}
+
+func (f *testFSM) Apply(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.applied = append(f.applied, string(data))
+	return nil
+}
+
+func (f *testFSM) Snapshot() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return json.Marshal(f.applied)
+}
+
+func (f *testFSM) Restore(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return json.Unmarshal(data, &f.applied)
+}
+
+func (f *testFSM) commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.applied)
+}
+
+// testCluster connects raft nodes through an in-memory transport
+type testCluster struct {
+	t     *testing.T
+	mu    sync.Mutex
+	nodes map[string]*Node
+	fsms  map[string]*testFSM
+	down  map[string]bool
+}
+
+func newTestCluster(t *testing.T) *testCluster {
+	return &testCluster{t: t, nodes: make(map[string]*Node), fsms: make(map[string]*testFSM), down: make(map[string]bool)}
+}
+
+func (tc *testCluster) add(name string, bootstrap bool, dataDir string, threshold uint64) *Node {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	fsm := &testFSM{}
+	node, err := NewNode(Config{
+		NodeName:          name,
+		DataDir:           dataDir,
+		Bootstrap:         bootstrap,
+		HeartbeatInterval: 10 * time.Millisecond,
+		ElectionTimeout:   50 * time.Millisecond,
+		SnapshotThreshold: threshold,
+		FSM:               fsm,
+		Send:              tc.send,
+		Members:           tc.members,
+		Logger:            logger,
+	})
+	if err != nil {
+		tc.t.Fatalf("Failed to create node %s: %v", name, err)
+	}
+
+	tc.mu.Lock()
+	tc.nodes[name] = node
+	tc.fsms[name] = fsm
+	delete(tc.down, name)
+	tc.mu.Unlock()
+
+	node.Start()
+	tc.t.Cleanup(func() { tc.stop(name) })
+	return node
+}
+
+func (tc *testCluster) stop(name string) {
+	tc.mu.Lock()
+	node := tc.nodes[name]
+	stopped := tc.down[name]
+	tc.down[name] = true
+	tc.mu.Unlock()
+
+	if !stopped {
+		node.Stop()
+	}
+}
+
+func (tc *testCluster) send(to string, msg []byte) error {
+	tc.mu.Lock()
+	node, ok := tc.nodes[to]
+	down := tc.down[to]
+	tc.mu.Unlock()
+
+	if !ok || down {
+		return fmt.Errorf("node %s unreachable", to)
+	}
+	return node.HandleMessage(msg)
+}
+
+func (tc *testCluster) members() []string {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	var members []string
+	for name := range tc.nodes {
+		if !tc.down[name] {
+			members = append(members, name)
+		}
+	}
+	return members
+}
+
+func (tc *testCluster) leader() *Node {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	for name, node := range tc.nodes {
+		if !tc.down[name] && node.IsLeader() {
+			return node
+		}
+	}
+	return nil
+}
+
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplicationAndVoterSelection(t *testing.T) {
+	tc := newTestCluster(t)
+	tc.add("node-1", true, t.TempDir(), 0)
+	tc.add("node-2", false, t.TempDir(), 0)
+	node3 := tc.add("node-3", false, t.TempDir(), 0)
+
+	eventually(t, "the bootstrap node to lead", func() bool { return tc.nodes["node-1"].IsLeader() })
+	eventually(t, "all nodes to become voters", func() bool { return len(tc.nodes["node-1"].Status().Voters) == 3 })
+
+	// Followers forward commands to the leader and see them applied locally
+	if err := node3.Apply([]byte("a"), time.Second); err != nil {
+		t.Fatalf("Failed to apply on follower: %v", err)
+	}
+	if commands := tc.fsms["node-3"].commands(); !slices.Equal(commands, []string{"a"}) {
+		t.Errorf("Expected command to be applied on node-3, got %v", commands)
+	}
+
+	eventually(t, "all nodes to apply the command", func() bool {
+		for _, fsm := range tc.fsms {
+			if len(fsm.commands()) != 1 {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestLeaderFailover(t *testing.T) {
+	tc := newTestCluster(t)
+	tc.add("node-1", true, t.TempDir(), 0)
+	tc.add("node-2", false, t.TempDir(), 0)
+	tc.add("node-3", false, t.TempDir(), 0)
+
+	eventually(t, "all nodes to become voters", func() bool {
+		leader := tc.leader()
+		return leader != nil && len(leader.Status().Voters) == 3
+	})
+	if err := tc.leader().Apply([]byte("a"), time.Second); err != nil {
+		t.Fatalf("Failed to apply: %v", err)
+	}
+
+	old := tc.leader().Status()
+	for name, node := range tc.nodes {
+		if node.IsLeader() {
+			tc.stop(name)
+		}
+	}
+
+	eventually(t, "a new leader", func() bool {
+		leader := tc.leader()
+		return leader != nil && leader.Status().Term > old.Term
+	})
+	if err := tc.leader().Apply([]byte("b"), time.Second); err != nil {
+		t.Fatalf("Failed to apply after failover: %v", err)
+	}
+
+	eventually(t, "the failed voter to be removed", func() bool {
+		leader := tc.leader()
+		return leader != nil && len(leader.Status().Voters) < 3
+	})
+	for _, name := range tc.members() {
+		eventually(t, "surviving nodes to apply both commands", func() bool {
+			return slices.Equal(tc.fsms[name].commands(), []string{"a", "b"})
+		})
+	}
+}
+
+func TestSnapshotInstallAndRestart(t *testing.T) {
+	tc := newTestCluster(t)
+	dataDir := t.TempDir()
+	leader := tc.add("node-1", true, dataDir, 5)
+	eventually(t, "the bootstrap node to lead", leader.IsLeader)
+
+	var expected []string
+	for i := 0; i < 12; i++ {
+		cmd := fmt.Sprintf("cmd-%d", i)
+		if err := leader.Apply([]byte(cmd), time.Second); err != nil {
+			t.Fatalf("Failed to apply %s: %v", cmd, err)
+		}
+		expected = append(expected, cmd)
+	}
+	eventually(t, "the log to be compacted", func() bool {
+		leader.mu.Lock()
+		defer leader.mu.Unlock()
+		return leader.store.snapshotIndex() > 0
+	})
+
+	// A node joining later catches up through the snapshot
+	tc.add("node-2", false, t.TempDir(), 5)
+	eventually(t, "the new node to catch up", func() bool {
+		return slices.Equal(tc.fsms["node-2"].commands(), expected)
+	})
+
+	// A restarted node restores its snapshot and replays the log
+	tc.stop("node-2")
+	tc.stop("node-1")
+	restarted := tc.add("node-1", true, dataDir, 5)
+	if commands := tc.fsms["node-1"].commands(); len(commands) == 0 || !slices.Equal(commands, expected[:len(commands)]) {
+		t.Errorf("Expected the snapshot to be restored, got %v", commands)
+	}
+	eventually(t, "the restarted node to lead", restarted.IsLeader)
+	eventually(t, "the log to be replayed", func() bool {
+		return slices.Equal(tc.fsms["node-1"].commands(), expected)
+	})
+}
@@ -0,0 +1,184 @@
+package rbac
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// Groups and user names given to API tokens, as in Kubernetes
+const (
+	GroupMasters         = "system:masters"         // Allowed everything, tokens not bound to a user are in it
+	GroupServiceAccounts = "system:serviceaccounts" // All service accounts
+	serviceAccountPrefix = "system:serviceaccount:"
+)
+
+// User is the identity a request is made with
+type User struct {
+	Name   string
+	Groups []string
+}
+
+// Request is an action on a resource. Resources are named like the API paths
+// they are served under, e.g. deployments or nodes. The namespace is empty
+// for cluster-scoped resources and for requests across all namespaces.
+type Request struct {
+	Verb      string // get, list, create, update, patch, delete or impersonate
+	Resource  string
+	Namespace string
+	Name      string
+}
+
+func (r *Request) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s %s", r.Verb, r.Resource)
+	}
+	return fmt.Sprintf("%s %s in namespace %s", r.Verb, r.Resource, r.Namespace)
+}
+
+// Store lists the roles and role bindings, including the cluster-wide ones
+type Store interface {
+	ListRoles() []*types.Role
+	ListRoleBindings() []*types.RoleBinding
+}
+
+// Authorizer decides requests by the roles bound to their users
+type Authorizer struct {
+	store Store
+}
+
+func NewAuthorizer(store Store) *Authorizer {
+	return &Authorizer{store: store}
+}
+
+// ServiceAccountUser returns the user and the groups tokens of a service account authenticate as
+func ServiceAccountUser(namespace, name string) (string, []string) {
+	return serviceAccountPrefix + namespace + ":" + name, []string{GroupServiceAccounts, GroupServiceAccounts + ":" + namespace}
+}
+
+// ParseServiceAccountUser returns the service account of a user name
+func ParseServiceAccountUser(user string) (namespace, name string, ok bool) {
+	rest, ok := strings.CutPrefix(user, serviceAccountPrefix)
+	if !ok {
+		return "", "", false
+	}
+	namespace, name, ok = strings.Cut(rest, ":")
+	return namespace, name, ok && namespace != "" && name != ""
+}
+
+// Authorize checks if a role bound to the user allows the request. Roles
+// bound in a namespace only allow requests in that namespace, cluster role
+// bindings allow requests in all namespaces and on cluster-scoped resources.
+// API groups of the rules are not checked.
+func (a *Authorizer) Authorize(user *User, req *Request) bool {
+	if slices.Contains(user.Groups, GroupMasters) {
+		return true
+	}
+
+	roles := make(map[string]*types.Role)
+	for _, role := range a.store.ListRoles() {
+		roles[role.Namespace+"/"+role.Name] = role
+	}
+
+	for _, binding := range a.store.ListRoleBindings() {
+		if binding.Namespace != "" && binding.Namespace != req.Namespace {
+			continue
+		}
+		if !boundTo(user, binding) {
+			continue
+		}
+
+		var rules []rbacv1.PolicyRule
+		switch binding.RoleRef.Kind {
+		case "Role":
+			if role, ok := roles[binding.Namespace+"/"+binding.RoleRef.Name]; ok && binding.Namespace != "" {
+				rules = role.Rules
+			}
+		case "ClusterRole":
+			if role, ok := roles["/"+binding.RoleRef.Name]; ok {
+				rules = role.Rules
+			} else {
+				rules = defaultClusterRoles[binding.RoleRef.Name]
+			}
+		}
+
+		for i := range rules {
+			if allows(&rules[i], req) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// boundTo checks if a binding names the user, one of its groups or its service account
+func boundTo(user *User, binding *types.RoleBinding) bool {
+	for _, subject := range binding.Subjects {
+		switch subject.Kind {
+		case rbacv1.UserKind:
+			if subject.Name == user.Name {
+				return true
+			}
+		case rbacv1.GroupKind:
+			if slices.Contains(user.Groups, subject.Name) {
+				return true
+			}
+		case rbacv1.ServiceAccountKind:
+			namespace := subject.Namespace
+			if namespace == "" {
+				namespace = binding.Namespace
+			}
+			if name, _ := ServiceAccountUser(namespace, subject.Name); name == user.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allows checks if a rule allows a request
+func allows(rule *rbacv1.PolicyRule, req *Request) bool {
+	if !matches(rule.Verbs, req.Verb, rbacv1.VerbAll) || !matches(rule.Resources, req.Resource, rbacv1.ResourceAll) {
+		return false
+	}
+	return len(rule.ResourceNames) == 0 || req.Name != "" && slices.Contains(rule.ResourceNames, req.Name)
+}
+
+func matches(values []string, value, all string) bool {
+	return slices.Contains(values, all) || slices.Contains(values, value)
+}
+
+// namespacedResources are the resources living in a namespace
+var namespacedResources = []string{
+	"pods", "deployments", "statefulsets", "daemonsets", "jobs", "cronjobs", "services", "ingresses",
+	"configmaps", "secrets", "persistentvolumeclaims", "poddisruptionbudgets", "serviceaccounts",
+	"roles", "rolebindings",
+}
+
+// defaultClusterRoles are used when no cluster role of the name was applied,
+// like the default cluster roles of Kubernetes
+var defaultClusterRoles = map[string][]rbacv1.PolicyRule{
+	// Everything, usually bound cluster-wide
+	"cluster-admin": {{Verbs: []string{rbacv1.VerbAll}, Resources: []string{rbacv1.ResourceAll}}},
+	// Everything in a namespace
+	"admin": {{Verbs: []string{rbacv1.VerbAll}, Resources: namespacedResources}},
+	// Everything in a namespace but roles and role bindings
+	"edit": {{Verbs: []string{rbacv1.VerbAll}, Resources: without(namespacedResources, "roles", "rolebindings")}},
+	// Reading everything in a namespace but secrets, roles and role bindings
+	"view": {{Verbs: []string{"get", "list"}, Resources: without(namespacedResources, "secrets", "roles", "rolebindings")}},
+}
+
+func without(values []string, removed ...string) []string {
+	var kept []string
+	for _, value := range values {
+		if !slices.Contains(removed, value) {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
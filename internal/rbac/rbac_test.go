@@ -0,0 +1,143 @@
+package rbac
+
+import (
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/parser"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+type testStore struct {
+	roles    []*types.Role
+	bindings []*types.RoleBinding
+}
+
+func (s *testStore) ListRoles() []*types.Role               { return s.roles }
+func (s *testStore) ListRoleBindings() []*types.RoleBinding { return s.bindings }
+
+func TestAuthorize(t *testing.T) {
+	store := &testStore{
+		roles: []*types.Role{{
+			Name:      "deployer",
+			Namespace: "staging",
+			Rules:     []rbacv1.PolicyRule{{Verbs: []string{"create", "update"}, Resources: []string{"deployments", "services"}}},
+		}},
+		bindings: []*types.RoleBinding{
+			{
+				Name:      "ci",
+				Namespace: "staging",
+				RoleRef:   rbacv1.RoleRef{Kind: "Role", Name: "deployer"},
+				Subjects:  []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "ci"}},
+			},
+			{
+				Name:     "contractors",
+				RoleRef:  rbacv1.RoleRef{Kind: "ClusterRole", Name: "view"},
+				Subjects: []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "contractors"}},
+			},
+		},
+	}
+	a := NewAuthorizer(store)
+
+	name, groups := ServiceAccountUser("staging", "ci")
+	ci := &User{Name: name, Groups: groups}
+	contractor := &User{Name: "alice", Groups: []string{"contractors"}}
+	admin := &User{Name: "root", Groups: []string{GroupMasters}}
+
+	tests := []struct {
+		user    *User
+		req     Request
+		allowed bool
+	}{
+		{ci, Request{Verb: "create", Resource: "deployments", Namespace: "staging"}, true},
+		{ci, Request{Verb: "create", Resource: "deployments", Namespace: "production"}, false},
+		{ci, Request{Verb: "delete", Resource: "deployments", Namespace: "staging"}, false},
+		{ci, Request{Verb: "create", Resource: "secrets", Namespace: "staging"}, false},
+		{ci, Request{Verb: "list", Resource: "nodes"}, false},
+		{contractor, Request{Verb: "list", Resource: "pods", Namespace: "production"}, true},
+		{contractor, Request{Verb: "list", Resource: "pods"}, true},
+		{contractor, Request{Verb: "get", Resource: "secrets", Namespace: "production"}, false},
+		{contractor, Request{Verb: "update", Resource: "deployments", Namespace: "staging"}, false},
+		{admin, Request{Verb: "delete", Resource: "nodes"}, true},
+		{&User{Name: "nobody"}, Request{Verb: "get", Resource: "pods", Namespace: "staging"}, false},
+	}
+	for _, tt := range tests {
+		if allowed := a.Authorize(tt.user, &tt.req); allowed != tt.allowed {
+			t.Errorf("Expected %s to be allowed=%t for %s, got %t", tt.user.Name, tt.allowed, tt.req.String(), allowed)
+		}
+	}
+
+	// Applied cluster roles replace the default ones
+	store.roles = append(store.roles, &types.Role{
+		Name:  "view",
+		Rules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, Resources: []string{"pods"}, ResourceNames: []string{"web-0"}}},
+	})
+	if a.Authorize(contractor, &Request{Verb: "list", Resource: "pods", Namespace: "production"}) {
+		t.Error("Expected the applied view role to replace the default one")
+	}
+	if !a.Authorize(contractor, &Request{Verb: "get", Resource: "pods", Namespace: "production", Name: "web-0"}) {
+		t.Error("Expected the pod named by the rule to be readable")
+	}
+}
+
+func TestParseServiceAccountUser(t *testing.T) {
+	user, _ := ServiceAccountUser("staging", "ci")
+	namespace, name, ok := ParseServiceAccountUser(user)
+	if !ok || namespace != "staging" || name != "ci" {
+		t.Errorf("Expected service account staging/ci, got %s/%s (%t)", namespace, name, ok)
+	}
+	if _, _, ok := ParseServiceAccountUser("alice"); ok {
+		t.Error("Expected a plain user not to be a service account")
+	}
+}
+
+func TestBindingWithoutNamespaceIsNotClusterWide(t *testing.T) {
+	p := parser.NewParser()
+	objects, err := p.ParseManifest([]byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: admin
+rules:
+- verbs: ["*"]
+  resources: ["*"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: admin
+subjects:
+- kind: User
+  name: mallory
+roleRef:
+  kind: Role
+  name: admin
+  apiGroup: rbac.authorization.k8s.io
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	role, err := p.ParseRole(objects[0])
+	if err != nil {
+		t.Fatalf("Failed to parse role: %v", err)
+	}
+	binding, err := p.ParseRoleBinding(objects[1])
+	if err != nil {
+		t.Fatalf("Failed to parse role binding: %v", err)
+	}
+	if role.Namespace != parser.DefaultNamespace || binding.Namespace != parser.DefaultNamespace {
+		t.Fatalf("Expected role and binding in the default namespace, got %q and %q", role.Namespace, binding.Namespace)
+	}
+
+	a := NewAuthorizer(&testStore{roles: []*types.Role{role}, bindings: []*types.RoleBinding{binding}})
+	mallory := &User{Name: "mallory"}
+	if !a.Authorize(mallory, &Request{Verb: "delete", Resource: "secrets", Namespace: parser.DefaultNamespace}) {
+		t.Error("Expected the role to apply in the default namespace")
+	}
+	if a.Authorize(mallory, &Request{Verb: "delete", Resource: "secrets", Namespace: "production"}) {
+		t.Error("Expected the role not to apply in other namespaces")
+	}
+	if a.Authorize(mallory, &Request{Verb: "delete", Resource: "nodes"}) {
+		t.Error("Expected the role not to apply to cluster-scoped resources")
+	}
+}
@@ -0,0 +1,354 @@
+package scheduler
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// hostnameTopologyKey is the well-known topology key of a single node.
+// Nodes without this label use their name as its value.
+const hostnameTopologyKey = "kubernetes.io/hostname"
+
+// topologyValue returns the value of a topology key on a node
+func topologyValue(node *types.Node, key string) (string, bool) {
+	if value, ok := node.Labels[key]; ok {
+		return value, true
+	}
+	if key == hostnameTopologyKey {
+		return node.Name, true
+	}
+	return "", false
+}
+
+// matchesNodeSelectorRequirement checks a node selector requirement against node labels.
+// Supports In, NotIn, Exists, DoesNotExist, Gt and Lt.
+func matchesNodeSelectorRequirement(node *types.Node, req corev1.NodeSelectorRequirement) bool {
+	value, exists := node.Labels[req.Key]
+
+	switch req.Operator {
+	case corev1.NodeSelectorOpIn:
+		if !exists {
+			return false
+		}
+		for _, v := range req.Values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	case corev1.NodeSelectorOpNotIn:
+		for _, v := range req.Values {
+			if exists && v == value {
+				return false
+			}
+		}
+		return true
+	case corev1.NodeSelectorOpExists:
+		return exists
+	case corev1.NodeSelectorOpDoesNotExist:
+		return !exists
+	case corev1.NodeSelectorOpGt, corev1.NodeSelectorOpLt:
+		if !exists || len(req.Values) != 1 {
+			return false
+		}
+		actual, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		bound, err := strconv.ParseInt(req.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		if req.Operator == corev1.NodeSelectorOpGt {
+			return actual > bound
+		}
+		return actual < bound
+	}
+
+	return false
+}
+
+// matchesNodeSelectorTerm checks if a node matches all requirements of a term
+func matchesNodeSelectorTerm(node *types.Node, term corev1.NodeSelectorTerm) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	for _, req := range term.MatchExpressions {
+		if !matchesNodeSelectorRequirement(node, req) {
+			return false
+		}
+	}
+	for _, req := range term.MatchFields {
+		// metadata.name is the only supported field
+		if req.Key != "metadata.name" {
+			return false
+		}
+		byName := &types.Node{Labels: map[string]string{req.Key: node.Name}}
+		if !matchesNodeSelectorRequirement(byName, req) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesRequiredNodeAffinity checks the required node affinity of a pod.
+// Terms are ORed, the requirements within a term are ANDed.
+func matchesRequiredNodeAffinity(pod *types.Pod, node *types.Node) bool {
+	if pod.Affinity == nil || pod.Affinity.NodeAffinity == nil {
+		return true
+	}
+	required := pod.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		return true
+	}
+	for _, term := range required.NodeSelectorTerms {
+		if matchesNodeSelectorTerm(node, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// preferredNodeAffinityScore sums the weights of the preferred terms a node matches
+func preferredNodeAffinityScore(pod *types.Pod, node *types.Node) int {
+	if pod.Affinity == nil || pod.Affinity.NodeAffinity == nil {
+		return 0
+	}
+	score := 0
+	for _, pref := range pod.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		if matchesNodeSelectorTerm(node, pref.Preference) {
+			score += int(pref.Weight)
+		}
+	}
+	return score
+}
+
+// placement is a snapshot of the nodes and the pods already placed on them
+type placement struct {
+	nodes map[string]*types.Node
+	pods  []*types.Pod
+}
+
+func newPlacement(nodes []*types.Node, pods map[string]*types.Pod, exclude string) *placement {
+	p := &placement{nodes: make(map[string]*types.Node, len(nodes))}
+	for _, node := range nodes {
+		p.nodes[node.Name] = node
+	}
+	for id, pod := range pods {
+		if id == exclude || pod.State == types.PodStateSucceeded || pod.State == types.PodStateFailed {
+			continue
+		}
+		p.pods = append(p.pods, pod)
+	}
+	return p
+}
+
+// countInDomain counts the pods matched by a term that run in the same
+// topology domain as the node
+func (p *placement) countInDomain(pod *types.Pod, term corev1.PodAffinityTerm, node *types.Node) int {
+	value, ok := topologyValue(node, term.TopologyKey)
+	if !ok {
+		return 0
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+	if err != nil || term.LabelSelector == nil {
+		return 0
+	}
+
+	count := 0
+	for _, other := range p.pods {
+		if !termNamespaceMatches(pod, term, other) || !selector.Matches(labels.Set(other.Labels)) {
+			continue
+		}
+		otherNode, ok := p.nodes[other.NodeName]
+		if !ok {
+			continue
+		}
+		if otherValue, ok := topologyValue(otherNode, term.TopologyKey); ok && otherValue == value {
+			count++
+		}
+	}
+	return count
+}
+
+// termNamespaceMatches checks if a pod is in one of the namespaces of an affinity term.
+// An empty namespace list means the namespace of the pod being scheduled,
+// an empty namespace selector means all namespaces.
+func termNamespaceMatches(pod *types.Pod, term corev1.PodAffinityTerm, other *types.Pod) bool {
+	if term.NamespaceSelector != nil && len(term.NamespaceSelector.MatchLabels) == 0 &&
+		len(term.NamespaceSelector.MatchExpressions) == 0 {
+		return true
+	}
+	if len(term.Namespaces) == 0 {
+		return other.Namespace == pod.Namespace
+	}
+	for _, ns := range term.Namespaces {
+		if ns == other.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// podAffinityFeasible checks the required pod affinity and anti-affinity of a pod
+func (p *placement) podAffinityFeasible(pod *types.Pod, node *types.Node) bool {
+	if pod.Affinity == nil {
+		return true
+	}
+
+	if anti := pod.Affinity.PodAntiAffinity; anti != nil {
+		for _, term := range anti.RequiredDuringSchedulingIgnoredDuringExecution {
+			if p.countInDomain(pod, term, node) > 0 {
+				return false
+			}
+		}
+	}
+
+	if affinity := pod.Affinity.PodAffinity; affinity != nil {
+		for _, term := range affinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			if p.countInDomain(pod, term, node) > 0 {
+				continue
+			}
+			// As in Kubernetes, the first pod of a group selecting itself
+			// may be placed anywhere
+			if p.countAnywhere(pod, term) == 0 && selectsPod(term, pod) {
+				continue
+			}
+			return false
+		}
+	}
+
+	return true
+}
+
+// countAnywhere counts the pods matched by a term in the whole cluster
+func (p *placement) countAnywhere(pod *types.Pod, term corev1.PodAffinityTerm) int {
+	selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+	if err != nil || term.LabelSelector == nil {
+		return 0
+	}
+	count := 0
+	for _, other := range p.pods {
+		if termNamespaceMatches(pod, term, other) && selector.Matches(labels.Set(other.Labels)) {
+			count++
+		}
+	}
+	return count
+}
+
+func selectsPod(term corev1.PodAffinityTerm, pod *types.Pod) bool {
+	selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+	if err != nil || term.LabelSelector == nil {
+		return false
+	}
+	return selector.Matches(labels.Set(pod.Labels))
+}
+
+// podAffinityScore adds the weights of preferred pod affinity terms satisfied on
+// the node and subtracts the weights of violated preferred anti-affinity terms
+func (p *placement) podAffinityScore(pod *types.Pod, node *types.Node) int {
+	if pod.Affinity == nil {
+		return 0
+	}
+
+	score := 0
+	if affinity := pod.Affinity.PodAffinity; affinity != nil {
+		for _, pref := range affinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			if p.countInDomain(pod, pref.PodAffinityTerm, node) > 0 {
+				score += int(pref.Weight)
+			}
+		}
+	}
+	if anti := pod.Affinity.PodAntiAffinity; anti != nil {
+		for _, pref := range anti.PreferredDuringSchedulingIgnoredDuringExecution {
+			if p.countInDomain(pod, pref.PodAffinityTerm, node) > 0 {
+				score -= int(pref.Weight)
+			}
+		}
+	}
+	return score
+}
+
+// spreadSkew returns the skew a topology spread constraint would have if the
+// pod were placed on the node, and whether the node has the topology key at all.
+// Domains are the values of the key among the given candidate nodes.
+func (p *placement) spreadSkew(pod *types.Pod, constraint corev1.TopologySpreadConstraint, node *types.Node, candidates []*types.Node) (int, bool) {
+	value, ok := topologyValue(node, constraint.TopologyKey)
+	if !ok {
+		return 0, false
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(constraint.LabelSelector)
+	if err != nil || constraint.LabelSelector == nil {
+		return 0, true
+	}
+
+	counts := make(map[string]int)
+	for _, candidate := range candidates {
+		if v, ok := topologyValue(candidate, constraint.TopologyKey); ok {
+			counts[v] += 0
+		}
+	}
+	for _, other := range p.pods {
+		if other.Namespace != pod.Namespace || !selector.Matches(labels.Set(other.Labels)) {
+			continue
+		}
+		otherNode, ok := p.nodes[other.NodeName]
+		if !ok {
+			continue
+		}
+		if v, ok := topologyValue(otherNode, constraint.TopologyKey); ok {
+			if _, eligible := counts[v]; eligible {
+				counts[v]++
+			}
+		}
+	}
+
+	min := -1
+	for _, count := range counts {
+		if min < 0 || count < min {
+			min = count
+		}
+	}
+	if min < 0 {
+		min = 0
+	}
+
+	return counts[value] + 1 - min, true
+}
+
+// topologySpreadFeasible checks the DoNotSchedule spread constraints of a pod
+func (p *placement) topologySpreadFeasible(pod *types.Pod, node *types.Node, candidates []*types.Node) bool {
+	for _, constraint := range pod.TopologySpreadConstraints {
+		if constraint.WhenUnsatisfiable != corev1.DoNotSchedule {
+			continue
+		}
+		skew, ok := p.spreadSkew(pod, constraint, node, candidates)
+		if !ok || skew > int(constraint.MaxSkew) {
+			return false
+		}
+	}
+	return true
+}
+
+// topologySpreadScore prefers the nodes that keep ScheduleAnyway constraints least skewed
+func (p *placement) topologySpreadScore(pod *types.Pod, node *types.Node, candidates []*types.Node) int {
+	score := 0
+	for _, constraint := range pod.TopologySpreadConstraints {
+		if constraint.WhenUnsatisfiable != corev1.ScheduleAnyway {
+			continue
+		}
+		skew, ok := p.spreadSkew(pod, constraint, node, candidates)
+		if !ok {
+			continue
+		}
+		score -= 10 * skew
+	}
+	return score
+}
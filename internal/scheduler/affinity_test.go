@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestMatchesNodeSelectorRequirement(t *testing.T) {
+	node := &types.Node{Name: "node-1", Labels: map[string]string{"zone": "a", "cores": "8"}}
+
+	tests := []struct {
+		name string
+		req  corev1.NodeSelectorRequirement
+		want bool
+	}{
+		{"In", corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a", "b"}}, true},
+		{"In mismatch", corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"b"}}, false},
+		{"NotIn", corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"b"}}, true},
+		{"NotIn mismatch", corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"a"}}, false},
+		{"Exists", corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpExists}, true},
+		{"Exists missing", corev1.NodeSelectorRequirement{Key: "gpu", Operator: corev1.NodeSelectorOpExists}, false},
+		{"DoesNotExist", corev1.NodeSelectorRequirement{Key: "gpu", Operator: corev1.NodeSelectorOpDoesNotExist}, true},
+		{"Gt", corev1.NodeSelectorRequirement{Key: "cores", Operator: corev1.NodeSelectorOpGt, Values: []string{"4"}}, true},
+		{"Gt mismatch", corev1.NodeSelectorRequirement{Key: "cores", Operator: corev1.NodeSelectorOpGt, Values: []string{"8"}}, false},
+		{"Lt", corev1.NodeSelectorRequirement{Key: "cores", Operator: corev1.NodeSelectorOpLt, Values: []string{"16"}}, true},
+		{"Lt not a number", corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpLt, Values: []string{"16"}}, false},
+	}
+
+	for _, tt := range tests {
+		if got := matchesNodeSelectorRequirement(node, tt.req); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestSelectNodeRequiredNodeAffinity(t *testing.T) {
+	s := newTestScheduler(StrategyLeastAllocated)
+	nodeA := testNode("node-a", "4", "4Gi")
+	nodeA.Labels["zone"] = "a"
+	nodeB := testNode("node-b", "4", "4Gi")
+	nodeB.Labels["zone"] = "b"
+
+	pod := testPod("p1", "100m", "64Mi")
+	pod.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{
+						{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"b"}},
+					},
+				}},
+			},
+		},
+	}
+
+	for i := 0; i < 5; i++ {
+		node, err := s.selectNode(pod, []*types.Node{nodeA, nodeB})
+		if err != nil {
+			t.Fatalf("Failed to select node: %v", err)
+		}
+		if node.Name != "node-b" {
+			t.Errorf("Expected node-b, got %s", node.Name)
+		}
+	}
+}
+
+func antiAffinityPod(id string) *types.Pod {
+	pod := testPod(id, "100m", "64Mi")
+	pod.Namespace = "default"
+	pod.Labels = map[string]string{"app": "web"}
+	pod.Affinity = &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				TopologyKey:   hostnameTopologyKey,
+			}},
+		},
+	}
+	return pod
+}
+
+func TestSelectNodePodAntiAffinity(t *testing.T) {
+	s := newTestScheduler(StrategyMostAllocated)
+	nodes := []*types.Node{
+		testNode("node-1", "4", "4Gi"),
+		testNode("node-2", "4", "4Gi"),
+		testNode("node-3", "4", "4Gi"),
+	}
+
+	used := make(map[string]bool)
+	for _, id := range []string{"web-0", "web-1", "web-2"} {
+		pod := antiAffinityPod(id)
+		node, err := s.selectNode(pod, nodes)
+		if err != nil {
+			t.Fatalf("Failed to select node for %s: %v", id, err)
+		}
+		if used[node.Name] {
+			t.Errorf("Pod %s placed on already used node %s", id, node.Name)
+		}
+		used[node.Name] = true
+		pod.NodeName = node.Name
+		s.pods[pod.ID] = pod
+	}
+
+	if _, err := s.selectNode(antiAffinityPod("web-3"), nodes); err == nil {
+		t.Error("Expected error when every node already runs a replica")
+	}
+}
+
+func TestSelectNodePodAffinity(t *testing.T) {
+	s := newTestScheduler(StrategyLeastAllocated)
+	nodes := []*types.Node{
+		testNode("node-1", "4", "4Gi"),
+		testNode("node-2", "4", "4Gi"),
+	}
+	s.pods["cache"] = &types.Pod{ID: "cache", Namespace: "default", NodeName: "node-2", Labels: map[string]string{"app": "cache"}}
+
+	pod := testPod("web", "100m", "64Mi")
+	pod.Namespace = "default"
+	pod.Affinity = &corev1.Affinity{
+		PodAffinity: &corev1.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cache"}},
+				TopologyKey:   hostnameTopologyKey,
+			}},
+		},
+	}
+
+	node, err := s.selectNode(pod, nodes)
+	if err != nil {
+		t.Fatalf("Failed to select node: %v", err)
+	}
+	if node.Name != "node-2" {
+		t.Errorf("Expected pod next to cache on node-2, got %s", node.Name)
+	}
+}
+
+func TestSelectNodeTopologySpread(t *testing.T) {
+	s := newTestScheduler(StrategyMostAllocated)
+	var nodes []*types.Node
+	for _, n := range []struct{ name, zone string }{{"a1", "a"}, {"a2", "a"}, {"b1", "b"}} {
+		node := testNode(n.name, "4", "4Gi")
+		node.Labels["zone"] = n.zone
+		nodes = append(nodes, node)
+	}
+
+	zones := make(map[string]int)
+	for _, id := range []string{"web-0", "web-1", "web-2", "web-3"} {
+		pod := testPod(id, "100m", "64Mi")
+		pod.Namespace = "default"
+		pod.Labels = map[string]string{"app": "web"}
+		pod.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+			MaxSkew:           1,
+			TopologyKey:       "zone",
+			WhenUnsatisfiable: corev1.DoNotSchedule,
+			LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		}}
+
+		node, err := s.selectNode(pod, nodes)
+		if err != nil {
+			t.Fatalf("Failed to select node for %s: %v", id, err)
+		}
+		pod.NodeName = node.Name
+		s.pods[pod.ID] = pod
+		zones[node.Labels["zone"]]++
+	}
+
+	if zones["a"] != 2 || zones["b"] != 2 {
+		t.Errorf("Expected 2 pods per zone, got %v", zones)
+	}
+}
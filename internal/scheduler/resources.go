@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// resources holds CPU (millicores) and memory (bytes) amounts
+type resources struct {
+	cpu    int64
+	memory int64
+}
+
+func (r resources) add(other resources) resources {
+	return resources{cpu: r.cpu + other.cpu, memory: r.memory + other.memory}
+}
+
+// podRequests returns the resources requested by a pod: the sum of its
+// containers, or the largest init container if that requests more, since init
+// containers run one at a time before the containers start. As in Kubernetes,
+// limits are used when no requests are set.
+func podRequests(pod *types.Pod) resources {
+	var r resources
+	for _, container := range pod.Containers {
+		r = r.add(containerRequests(container.Resources))
+	}
+	for _, container := range pod.InitContainers {
+		init := containerRequests(container.Resources)
+		if init.cpu > r.cpu {
+			r.cpu = init.cpu
+		}
+		if init.memory > r.memory {
+			r.memory = init.memory
+		}
+	}
+	return r
+}
+
+// containerRequests returns the resources requested by a container
+func containerRequests(req corev1.ResourceRequirements) resources {
+	var r resources
+	if q, ok := quantityFor(req, corev1.ResourceCPU); ok {
+		r.cpu = q.MilliValue()
+	}
+	if q, ok := quantityFor(req, corev1.ResourceMemory); ok {
+		r.memory = q.Value()
+	}
+	return r
+}
+
+func quantityFor(req corev1.ResourceRequirements, name corev1.ResourceName) (resource.Quantity, bool) {
+	if q, ok := req.Requests[name]; ok {
+		return q, true
+	}
+	q, ok := req.Limits[name]
+	return q, ok
+}
+
+// fitsNode checks if a request fits into the free resources of a node.
+// Resources a node does not advertise are treated as unlimited.
+func fitsNode(request, allocated resources, allocatable corev1.ResourceList) bool {
+	if q, ok := allocatable[corev1.ResourceCPU]; ok && allocated.cpu+request.cpu > q.MilliValue() {
+		return false
+	}
+	if q, ok := allocatable[corev1.ResourceMemory]; ok && allocated.memory+request.memory > q.Value() {
+		return false
+	}
+	return true
+}
+
+// scoreNode scores a node between 0 and 100 according to the strategy,
+// based on its utilization after placing the request.
+// Nodes without advertised resources get a neutral score of 50.
+func scoreNode(strategy Strategy, request, allocated resources, allocatable corev1.ResourceList) int {
+	var fractions []float64
+	if q, ok := allocatable[corev1.ResourceCPU]; ok && q.MilliValue() > 0 {
+		fractions = append(fractions, float64(allocated.cpu+request.cpu)/float64(q.MilliValue()))
+	}
+	if q, ok := allocatable[corev1.ResourceMemory]; ok && q.Value() > 0 {
+		fractions = append(fractions, float64(allocated.memory+request.memory)/float64(q.Value()))
+	}
+	if len(fractions) == 0 {
+		return 50
+	}
+
+	var sum float64
+	for _, used := range fractions {
+		if used > 1 {
+			used = 1
+		}
+		if strategy == StrategyMostAllocated {
+			sum += used
+		} else {
+			sum += 1 - used
+		}
+	}
+
+	return int(sum / float64(len(fractions)) * 100)
+}
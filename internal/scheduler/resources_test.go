@@ -0,0 +1,233 @@
+package scheduler
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func newTestScheduler(strategy Strategy) *Scheduler {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	return &Scheduler{
+		logger:   logger,
+		pods:     make(map[string]*types.Pod),
+		claims:   make(map[string]string),
+		strategy: strategy,
+		rand:     rand.New(rand.NewSource(1)),
+	}
+}
+
+func testNode(name, cpu, memory string) *types.Node {
+	allocatable := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}
+	return &types.Node{
+		Name:        name,
+		Labels:      map[string]string{},
+		Capacity:    allocatable,
+		Allocatable: allocatable,
+	}
+}
+
+func testPod(id, cpu, memory string) *types.Pod {
+	return &types.Pod{
+		ID:         id,
+		Name:       id,
+		Containers: []types.Container{testContainer(cpu, memory)},
+	}
+}
+
+func testContainer(cpu, memory string) types.Container {
+	return types.Container{
+		Name: "app",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			},
+		},
+	}
+}
+
+func TestPodRequestsFallsBackToLimits(t *testing.T) {
+	pod := &types.Pod{
+		Containers: []types.Container{{
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("500m"),
+					corev1.ResourceMemory: resource.MustParse("256Mi"),
+				},
+			},
+		}},
+	}
+
+	r := podRequests(pod)
+	if r.cpu != 500 {
+		t.Errorf("Expected 500m CPU, got %dm", r.cpu)
+	}
+	if r.memory != 256*1024*1024 {
+		t.Errorf("Expected 256Mi memory, got %d", r.memory)
+	}
+}
+
+func TestFitsNode(t *testing.T) {
+	node := testNode("node-1", "2", "1Gi")
+	request := resources{cpu: 500, memory: 512 * 1024 * 1024}
+
+	if !fitsNode(request, resources{}, node.Allocatable) {
+		t.Error("Expected request to fit on empty node")
+	}
+
+	if fitsNode(request, resources{cpu: 1600}, node.Allocatable) {
+		t.Error("Expected request not to fit when CPU is exhausted")
+	}
+
+	if fitsNode(request, resources{memory: 600 * 1024 * 1024}, node.Allocatable) {
+		t.Error("Expected request not to fit when memory is exhausted")
+	}
+
+	if !fitsNode(request, resources{cpu: 100000}, nil) {
+		t.Error("Expected node without advertised resources to fit anything")
+	}
+}
+
+func TestSelectNodeFiltersInsufficientResources(t *testing.T) {
+	s := newTestScheduler(StrategyLeastAllocated)
+	nodes := []*types.Node{
+		testNode("small", "1", "512Mi"),
+		testNode("big", "8", "16Gi"),
+	}
+
+	node, err := s.selectNode(testPod("p1", "2", "1Gi"), nodes)
+	if err != nil {
+		t.Fatalf("Failed to select node: %v", err)
+	}
+	if node.Name != "big" {
+		t.Errorf("Expected pod to land on big node, got %s", node.Name)
+	}
+
+	if _, err := s.selectNode(testPod("p2", "16", "1Gi"), nodes); err == nil {
+		t.Error("Expected error when no node has enough resources")
+	}
+}
+
+func TestPodRequestsSumsContainers(t *testing.T) {
+	pod := &types.Pod{
+		Containers: []types.Container{
+			testContainer("500m", "256Mi"),
+			testContainer("250m", "128Mi"),
+		},
+		InitContainers: []types.Container{
+			testContainer("100m", "1Gi"),
+		},
+	}
+
+	r := podRequests(pod)
+	if r.cpu != 750 {
+		t.Errorf("Expected 750m CPU, got %dm", r.cpu)
+	}
+	if r.memory != 1024*1024*1024 {
+		t.Errorf("Expected the 1Gi of the init container, got %d", r.memory)
+	}
+}
+
+func TestSelectNodeLeastAllocatedSpreads(t *testing.T) {
+	s := newTestScheduler(StrategyLeastAllocated)
+	nodes := []*types.Node{
+		testNode("node-1", "4", "4Gi"),
+		testNode("node-2", "4", "4Gi"),
+	}
+	s.pods["existing"] = &types.Pod{ID: "existing", NodeName: "node-1", Containers: testPod("", "2", "2Gi").Containers}
+
+	node, err := s.selectNode(testPod("p1", "1", "1Gi"), nodes)
+	if err != nil {
+		t.Fatalf("Failed to select node: %v", err)
+	}
+	if node.Name != "node-2" {
+		t.Errorf("Expected least allocated node-2, got %s", node.Name)
+	}
+}
+
+func TestSelectNodeMostAllocatedPacks(t *testing.T) {
+	s := newTestScheduler(StrategyMostAllocated)
+	nodes := []*types.Node{
+		testNode("node-1", "4", "4Gi"),
+		testNode("node-2", "4", "4Gi"),
+	}
+	s.pods["existing"] = &types.Pod{ID: "existing", NodeName: "node-1", Containers: testPod("", "2", "2Gi").Containers}
+
+	node, err := s.selectNode(testPod("p1", "1", "1Gi"), nodes)
+	if err != nil {
+		t.Fatalf("Failed to select node: %v", err)
+	}
+	if node.Name != "node-1" {
+		t.Errorf("Expected most allocated node-1, got %s", node.Name)
+	}
+}
+
+func TestSelectNodeWithNodeSelector(t *testing.T) {
+	s := newTestScheduler(StrategyLeastAllocated)
+	ssd := testNode("ssd", "1", "1Gi")
+	ssd.Labels["disk"] = "ssd"
+	nodes := []*types.Node{testNode("hdd", "8", "8Gi"), ssd}
+
+	pod := testPod("p1", "100m", "64Mi")
+	pod.NodeSelector = map[string]string{"disk": "ssd"}
+
+	node, err := s.selectNode(pod, nodes)
+	if err != nil {
+		t.Fatalf("Failed to select node: %v", err)
+	}
+	if node.Name != "ssd" {
+		t.Errorf("Expected node matching selector, got %s", node.Name)
+	}
+
+	pod.NodeSelector = map[string]string{"disk": "nvme"}
+	if _, err := s.selectNode(pod, nodes); err == nil {
+		t.Error("Expected error when no node matches selector")
+	}
+}
+
+func TestSchedulePodOnNode(t *testing.T) {
+	s := newTestScheduler(StrategyLeastAllocated)
+	node := testNode("node-1", "1", "1Gi")
+
+	pod := testPod("p1", "500m", "256Mi")
+	if err := s.SchedulePodOnNode(pod, node); err != nil {
+		t.Fatalf("Failed to schedule pod: %v", err)
+	}
+	if pod.NodeName != "node-1" {
+		t.Errorf("Expected pod on node-1, got %q", pod.NodeName)
+	}
+
+	// The node is full
+	if err := s.SchedulePodOnNode(testPod("p2", "800m", "64Mi"), node); err == nil {
+		t.Error("Expected error when the node has insufficient resources")
+	}
+
+	pod = testPod("p3", "100m", "64Mi")
+	pod.NodeSelector = map[string]string{"disk": "ssd"}
+	if err := s.SchedulePodOnNode(pod, node); err == nil {
+		t.Error("Expected error when the node does not match the selector")
+	}
+}
+
+func TestSetStrategy(t *testing.T) {
+	s := newTestScheduler(StrategyLeastAllocated)
+
+	if err := s.SetStrategy(StrategyMostAllocated); err != nil {
+		t.Errorf("Failed to set strategy: %v", err)
+	}
+
+	if err := s.SetStrategy("random"); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+}
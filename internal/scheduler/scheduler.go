@@ -7,77 +7,217 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/your-server-support/podman-swarm/internal/cluster"
 	"github.com/your-server-support/podman-swarm/internal/types"
 )
 
+// Strategy selects how feasible nodes are scored
+type Strategy string
+
+const (
+	// StrategyLeastAllocated prefers nodes with the most free resources (spread)
+	StrategyLeastAllocated Strategy = "least-allocated"
+	// StrategyMostAllocated prefers the fullest nodes that still fit (bin-packing)
+	StrategyMostAllocated Strategy = "most-allocated"
+)
+
 type Scheduler struct {
-	cluster *cluster.Cluster
-	logger  *logrus.Logger
-	mu      sync.RWMutex
-	pods    map[string]*types.Pod // podID -> pod
+	cluster  *cluster.Cluster
+	logger   *logrus.Logger
+	mu       sync.RWMutex
+	pods     map[string]*types.Pod // podID -> pod
+	claims   map[string]string     // namespace/name of volume claim -> node name
+	strategy Strategy
+	rand     *rand.Rand
 }
 
 func NewScheduler(cluster *cluster.Cluster, logger *logrus.Logger) *Scheduler {
 	return &Scheduler{
-		cluster: cluster,
-		logger:  logger,
-		pods:    make(map[string]*types.Pod),
+		cluster:  cluster,
+		logger:   logger,
+		pods:     make(map[string]*types.Pod),
+		claims:   make(map[string]string),
+		strategy: StrategyLeastAllocated,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// SetStrategy sets the node scoring strategy
+func (s *Scheduler) SetStrategy(strategy Strategy) error {
+	switch strategy {
+	case StrategyLeastAllocated, StrategyMostAllocated:
+	default:
+		return fmt.Errorf("unknown scheduler strategy: %s", strategy)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strategy = strategy
+	return nil
+}
+
 // SchedulePod schedules a pod to a node
 func (s *Scheduler) SchedulePod(pod *types.Pod) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Check node selector
-	if len(pod.NodeSelector) > 0 {
-		node, err := s.findNodeBySelector(pod.NodeSelector)
-		if err != nil {
-			return "", fmt.Errorf("no node matches selector: %w", err)
-		}
-		pod.NodeName = node.Name
-		s.pods[pod.ID] = pod
-		return node.Name, nil
+	node, err := s.selectNode(pod, s.cluster.GetNodes())
+	if err != nil {
+		return "", err
 	}
 
-	// Select a random node (simple round-robin or random)
-	nodes := s.cluster.GetNodes()
-	if len(nodes) == 0 {
-		return "", fmt.Errorf("no nodes available")
-	}
+	pod.NodeName = node.Name
+	s.pods[pod.ID] = pod
+	s.bindClaims(pod, node.Name)
+	s.logger.Infof("Scheduled pod %s to node %s", pod.Name, node.Name)
 
-	// Simple random selection (can be improved with resource-based scheduling)
-	rand.Seed(time.Now().UnixNano())
-	selectedNode := nodes[rand.Intn(len(nodes))]
-	pod.NodeName = selectedNode.Name
+	return node.Name, nil
+}
+
+// SchedulePodOnNode schedules a pod to the given node if the node can run it,
+// e.g. a daemon set pod
+func (s *Scheduler) SchedulePodOnNode(pod *types.Pod, node *types.Node) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	if _, err := s.selectNode(pod, []*types.Node{node}); err != nil {
+		return err
+	}
+
+	pod.NodeName = node.Name
 	s.pods[pod.ID] = pod
-	s.logger.Infof("Scheduled pod %s to node %s", pod.Name, selectedNode.Name)
+	s.bindClaims(pod, node.Name)
+	s.logger.Infof("Scheduled pod %s to node %s", pod.Name, node.Name)
 
-	return selectedNode.Name, nil
+	return nil
 }
 
-// findNodeBySelector finds a node that matches the selector
-func (s *Scheduler) findNodeBySelector(selector map[string]string) (*types.Node, error) {
-	nodes := s.cluster.GetNodes()
+// NodeMatches checks if a node satisfies the node selector and the required
+// node affinity of a pod
+func NodeMatches(pod *types.Pod, node *types.Node) bool {
+	return matchesNodeSelector(node, pod.NodeSelector) && matchesRequiredNodeAffinity(pod, node)
+}
+
+// selectNode filters out the nodes that cannot run the pod and returns the
+// best scoring one of the rest. Ties are broken randomly.
+// Must be called with s.mu held.
+func (s *Scheduler) selectNode(pod *types.Pod, nodes []*types.Node) (*types.Node, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no nodes available")
+	}
+
+	// Pods using bound volume claims are pinned to the node of the volumes
+	claimNode, err := s.claimNode(pod)
+	if err != nil {
+		return nil, err
+	}
+	candidates := nodes
+	if claimNode != "" {
+		candidates = filterNodes(nodes, func(node *types.Node) bool {
+			return node.Name == claimNode
+		})
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("node %s of the pod's volume claims is not available", claimNode)
+		}
+	}
+
+	// Check node selector and required node affinity
+	candidates = filterNodes(candidates, func(node *types.Node) bool {
+		return NodeMatches(pod, node)
+	})
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no node matches selector")
+	}
+
+	// Check taints
+	candidates = filterNodes(candidates, func(node *types.Node) bool {
+		return toleratesTaints(pod, node, corev1.TaintEffectNoSchedule) &&
+			toleratesTaints(pod, node, corev1.TaintEffectNoExecute)
+	})
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no node without taints the pod does not tolerate")
+	}
+
+	// Check pod affinity, anti-affinity and topology spread
+	p := newPlacement(nodes, s.pods, pod.ID)
+	candidates = filterNodes(candidates, func(node *types.Node) bool {
+		return p.podAffinityFeasible(pod, node)
+	})
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no node satisfies pod affinity rules")
+	}
+
+	eligible := candidates
+	candidates = filterNodes(candidates, func(node *types.Node) bool {
+		return p.topologySpreadFeasible(pod, node, eligible)
+	})
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no node satisfies topology spread constraints")
+	}
+
+	// Check resources
+	request := podRequests(pod)
+	feasible := filterNodes(candidates, func(node *types.Node) bool {
+		return fitsNode(request, s.allocated(node.Name), node.Allocatable)
+	})
+	if len(feasible) == 0 {
+		return nil, fmt.Errorf("insufficient resources: no node has %dm CPU and %d bytes memory available",
+			request.cpu, request.memory)
+	}
+
+	var best []*types.Node
+	bestScore := 0
+	for i, node := range feasible {
+		score := scoreNode(s.strategy, request, s.allocated(node.Name), node.Allocatable) +
+			preferredNodeAffinityScore(pod, node) +
+			p.podAffinityScore(pod, node) +
+			p.topologySpreadScore(pod, node, eligible) -
+			untoleratedTaints(pod, node, corev1.TaintEffectPreferNoSchedule)*preferNoSchedulePenalty
+		switch {
+		case i == 0 || score > bestScore:
+			best = []*types.Node{node}
+			bestScore = score
+		case score == bestScore:
+			best = append(best, node)
+		}
+	}
+
+	return best[s.rand.Intn(len(best))], nil
+}
 
+// filterNodes returns the nodes for which keep returns true
+func filterNodes(nodes []*types.Node, keep func(*types.Node) bool) []*types.Node {
+	result := make([]*types.Node, 0, len(nodes))
 	for _, node := range nodes {
-		matches := true
-		for key, value := range selector {
-			if node.Labels[key] != value {
-				matches = false
-				break
-			}
+		if keep(node) {
+			result = append(result, node)
 		}
-		if matches {
-			return node, nil
+	}
+	return result
+}
+
+// allocated returns the resources requested by the pods on a node.
+// Must be called with s.mu held.
+func (s *Scheduler) allocated(nodeName string) resources {
+	var total resources
+	for _, pod := range s.pods {
+		if pod.NodeName == nodeName && pod.State != types.PodStateSucceeded && pod.State != types.PodStateFailed {
+			total = total.add(podRequests(pod))
 		}
 	}
+	return total
+}
 
-	return nil, fmt.Errorf("no node matches selector")
+// matchesNodeSelector checks if a node has all labels of the selector
+func matchesNodeSelector(node *types.Node, selector map[string]string) bool {
+	for key, value := range selector {
+		if node.Labels[key] != value {
+			return false
+		}
+	}
+	return true
 }
 
 // GetPod returns a pod by ID
@@ -108,6 +248,18 @@ func (s *Scheduler) GetPodsByNode(nodeName string) []*types.Pod {
 	return result
 }
 
+// SyncPods replaces the tracked pods with the given set.
+// Used by the controller to keep placements learned from the cluster state.
+func (s *Scheduler) SyncPods(pods []*types.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pods = make(map[string]*types.Pod, len(pods))
+	for _, pod := range pods {
+		s.pods[pod.ID] = pod
+	}
+}
+
 // RemovePod removes a pod from the scheduler
 func (s *Scheduler) RemovePod(podID string) {
 	s.mu.Lock()
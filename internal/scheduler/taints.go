@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// preferNoSchedulePenalty is subtracted from the score of a node for every
+// PreferNoSchedule taint the pod does not tolerate
+const preferNoSchedulePenalty = 100
+
+// toleratesTaints checks if a pod tolerates all taints of a node with the given effect
+func toleratesTaints(pod *types.Pod, node *types.Node, effect corev1.TaintEffect) bool {
+	return untoleratedTaints(pod, node, effect) == 0
+}
+
+// untoleratedTaints returns the number of taints with the given effect the pod does not tolerate
+func untoleratedTaints(pod *types.Pod, node *types.Node, effect corev1.TaintEffect) int {
+	count := 0
+	for i := range node.Taints {
+		taint := &node.Taints[i]
+		if taint.Effect == effect && tolerationFor(pod, taint) == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// tolerationFor returns the toleration of a pod matching a taint, nil if there is none
+func tolerationFor(pod *types.Pod, taint *corev1.Taint) *corev1.Toleration {
+	for i := range pod.Tolerations {
+		if pod.Tolerations[i].ToleratesTaint(taint) {
+			return &pod.Tolerations[i]
+		}
+	}
+	return nil
+}
+
+// NodeSchedulable checks if new pods of the template may be placed on a node:
+// the node matches its node selector and required node affinity, and the pod
+// tolerates the NoSchedule and NoExecute taints of the node
+func NodeSchedulable(pod *types.Pod, node *types.Node) bool {
+	return NodeMatches(pod, node) &&
+		toleratesTaints(pod, node, corev1.TaintEffectNoSchedule) &&
+		toleratesTaints(pod, node, corev1.TaintEffectNoExecute)
+}
+
+// ShouldEvict checks if a pod running on a node has to leave it because of a
+// NoExecute taint. A pod tolerating the taint for a limited time is evicted
+// once that time passed since the taint was added.
+func ShouldEvict(pod *types.Pod, node *types.Node, now time.Time) bool {
+	for i := range node.Taints {
+		taint := &node.Taints[i]
+		if taint.Effect != corev1.TaintEffectNoExecute {
+			continue
+		}
+
+		toleration := tolerationFor(pod, taint)
+		if toleration == nil {
+			return true
+		}
+		if toleration.TolerationSeconds == nil || taint.TimeAdded == nil {
+			continue
+		}
+		deadline := taint.TimeAdded.Add(time.Duration(*toleration.TolerationSeconds) * time.Second)
+		if !now.Before(deadline) {
+			return true
+		}
+	}
+	return false
+}
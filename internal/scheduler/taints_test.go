@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func TestSelectNodeTaints(t *testing.T) {
+	s := newTestScheduler(StrategyLeastAllocated)
+	cordoned := testNode("node-1", "4", "4Gi")
+	cordoned.Taints = []corev1.Taint{{Key: "node.kubernetes.io/unschedulable", Effect: corev1.TaintEffectNoSchedule}}
+	preferred := testNode("node-2", "4", "4Gi")
+	preferred.Taints = []corev1.Taint{{Key: "spot", Effect: corev1.TaintEffectPreferNoSchedule}}
+	// Fuller node, only picked because the other one is tainted
+	untainted := testNode("node-3", "4", "4Gi")
+	s.pods["busy"] = &types.Pod{ID: "busy", NodeName: "node-3", Containers: []types.Container{testContainer("2", "2Gi")}}
+
+	node, err := s.selectNode(testPod("web", "100m", "128Mi"), []*types.Node{cordoned, preferred, untainted})
+	if err != nil {
+		t.Fatalf("Failed to select node: %v", err)
+	}
+	if node.Name != "node-3" {
+		t.Errorf("Expected the untainted node-3, got %s", node.Name)
+	}
+
+	if _, err := s.selectNode(testPod("web", "100m", "128Mi"), []*types.Node{cordoned}); err == nil {
+		t.Error("Expected no node when the only node is cordoned")
+	}
+
+	tolerating := testPod("web", "100m", "128Mi")
+	tolerating.Tolerations = []corev1.Toleration{{Key: "node.kubernetes.io/unschedulable", Operator: corev1.TolerationOpExists}}
+	if _, err := s.selectNode(tolerating, []*types.Node{cordoned}); err != nil {
+		t.Errorf("Expected a tolerating pod to be scheduled to the cordoned node: %v", err)
+	}
+}
+
+func TestShouldEvict(t *testing.T) {
+	added := metav1.NewTime(time.Now().Add(-time.Minute))
+	node := testNode("node-1", "4", "4Gi")
+	node.Taints = []corev1.Taint{{Key: "maintenance", Value: "true", Effect: corev1.TaintEffectNoExecute, TimeAdded: &added}}
+
+	pod := testPod("web", "100m", "128Mi")
+	if !ShouldEvict(pod, node, time.Now()) {
+		t.Error("Expected a pod without tolerations to be evicted")
+	}
+
+	seconds := int64(300)
+	pod.Tolerations = []corev1.Toleration{{
+		Key: "maintenance", Operator: corev1.TolerationOpEqual, Value: "true",
+		Effect: corev1.TaintEffectNoExecute, TolerationSeconds: &seconds,
+	}}
+	if ShouldEvict(pod, node, time.Now()) {
+		t.Error("Expected the pod to stay while its toleration lasts")
+	}
+	if !ShouldEvict(pod, node, time.Now().Add(5*time.Minute)) {
+		t.Error("Expected the pod to be evicted after its toleration seconds")
+	}
+
+	pod.Tolerations[0].TolerationSeconds = nil
+	if ShouldEvict(pod, node, time.Now().Add(time.Hour)) {
+		t.Error("Expected a pod tolerating the taint forever to stay")
+	}
+}
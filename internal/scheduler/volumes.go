@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// SyncVolumeClaims replaces the tracked persistent volume claims with the given set.
+// Used by the controller to pin pods to the nodes their claims are bound to.
+func (s *Scheduler) SyncVolumeClaims(claims []*types.PersistentVolumeClaim) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.claims = make(map[string]string, len(claims))
+	for _, claim := range claims {
+		s.claims[claimKey(claim.Namespace, claim.Name)] = claim.NodeName
+	}
+}
+
+// claimNode returns the node all bound claims used by a pod are on, empty if
+// the pod uses no bound claims. Must be called with s.mu held.
+func (s *Scheduler) claimNode(pod *types.Pod) (string, error) {
+	nodeName := ""
+	for _, claim := range podClaims(pod) {
+		node, ok := s.claims[claimKey(pod.Namespace, claim)]
+		if !ok {
+			return "", fmt.Errorf("persistent volume claim %s/%s not found", pod.Namespace, claim)
+		}
+		if node == "" {
+			continue
+		}
+		if nodeName != "" && node != nodeName {
+			return "", fmt.Errorf("persistent volume claims of pod %s are bound to different nodes", pod.Name)
+		}
+		nodeName = node
+	}
+	return nodeName, nil
+}
+
+// bindClaims binds the unbound claims used by a pod to the node it was
+// scheduled to, so that later pods are pinned before the binding is persisted.
+// Must be called with s.mu held.
+func (s *Scheduler) bindClaims(pod *types.Pod, nodeName string) {
+	for _, claim := range podClaims(pod) {
+		if key := claimKey(pod.Namespace, claim); s.claims[key] == "" {
+			s.claims[key] = nodeName
+		}
+	}
+}
+
+// podClaims returns the names of the persistent volume claims used by a pod
+func podClaims(pod *types.Pod) []string {
+	var claims []string
+	for _, volume := range pod.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claims = append(claims, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	return claims
+}
+
+func claimKey(namespace, name string) string {
+	return namespace + "/" + name
+}
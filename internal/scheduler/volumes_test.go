@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+func claimPod(id string, claims ...string) *types.Pod {
+	pod := testPod(id, "100m", "64Mi")
+	pod.Namespace = "default"
+	for _, claim := range claims {
+		pod.Volumes = append(pod.Volumes, corev1.Volume{
+			Name: claim,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+			},
+		})
+	}
+	return pod
+}
+
+func TestSelectNodePinsToClaimNode(t *testing.T) {
+	s := newTestScheduler(StrategyLeastAllocated)
+	nodes := []*types.Node{testNode("node-1", "4", "8Gi"), testNode("node-2", "4", "8Gi"), testNode("node-3", "4", "8Gi")}
+
+	s.SyncVolumeClaims([]*types.PersistentVolumeClaim{
+		{Name: "data", Namespace: "default", NodeName: "node-2"},
+		{Name: "cache", Namespace: "default"},
+	})
+
+	for i := 0; i < 10; i++ {
+		node, err := s.selectNode(claimPod("db", "data", "cache"), nodes)
+		if err != nil {
+			t.Fatalf("Failed to select node: %v", err)
+		}
+		if node.Name != "node-2" {
+			t.Errorf("Expected pod to be pinned to node-2, got %s", node.Name)
+		}
+	}
+
+	if _, err := s.selectNode(claimPod("db", "missing"), nodes); err == nil {
+		t.Error("Expected pod with unknown claim to be unschedulable")
+	}
+
+	if _, err := s.selectNode(claimPod("db", "data"), nodes[:1]); err == nil {
+		t.Error("Expected pod to be unschedulable while the claim's node is gone")
+	}
+}
+
+func TestBindClaims(t *testing.T) {
+	s := newTestScheduler(StrategyLeastAllocated)
+	nodes := []*types.Node{testNode("node-1", "4", "8Gi"), testNode("node-2", "4", "8Gi")}
+
+	s.SyncVolumeClaims([]*types.PersistentVolumeClaim{{Name: "data", Namespace: "default"}})
+
+	first, err := s.selectNode(claimPod("db-0", "data"), nodes)
+	if err != nil {
+		t.Fatalf("Failed to select node: %v", err)
+	}
+	s.bindClaims(claimPod("db-0", "data"), first.Name)
+
+	// Later pods follow the claim before the binding is persisted
+	for i := 0; i < 10; i++ {
+		node, err := s.selectNode(claimPod("db-1", "data"), nodes)
+		if err != nil {
+			t.Fatalf("Failed to select node: %v", err)
+		}
+		if node.Name != first.Name {
+			t.Errorf("Expected pod to follow the claim to %s, got %s", first.Name, node.Name)
+		}
+	}
+}
@@ -10,24 +10,37 @@ import (
 	"time"
 )
 
-// APIToken represents an API authentication token
+// APIToken represents an API authentication token. Only the hash of a token
+// is kept, its value is returned once when it is generated.
 type APIToken struct {
-	Token     string
+	Token     string `json:",omitempty"`
 	Hash      string
 	Name      string
+	User      string   `json:",omitempty"` // User the token authenticates as, e.g. a service account
+	Groups    []string `json:",omitempty"` // Groups of the user
 	CreatedAt time.Time
 	ExpiresAt *time.Time
 }
 
+// TokenStore keeps the API tokens by hash, e.g. in the cluster state so that
+// a token is valid on every node
+type TokenStore interface {
+	SaveAPIToken(token *APIToken) error
+	GetAPIToken(hash string) (*APIToken, error)
+	DeleteAPIToken(hash string) error
+	ListAPITokens() []*APIToken
+}
+
 // APITokenManager manages API authentication tokens
 type APITokenManager struct {
-	mu     sync.RWMutex
-	tokens map[string]*APIToken // token -> APIToken
-	hashes map[string]string    // hash -> token (for fast lookup)
+	mu     sync.Mutex // Serializes writes to the store
+	store  TokenStore
 	secret []byte
 }
 
-// NewAPITokenManager creates a new API token manager
+// NewAPITokenManager creates a new API token manager keeping the tokens in
+// memory until a store is set. The secret has to be the same on all nodes
+// sharing the store.
 func NewAPITokenManager(secret []byte) *APITokenManager {
 	if secret == nil || len(secret) == 0 {
 		// Generate a random secret if not provided
@@ -36,14 +49,31 @@ func NewAPITokenManager(secret []byte) *APITokenManager {
 	}
 
 	return &APITokenManager{
-		tokens: make(map[string]*APIToken),
-		hashes: make(map[string]string),
+		store:  &memoryTokenStore{tokens: make(map[string]*APIToken)},
 		secret: secret,
 	}
 }
 
-// GenerateToken generates a new API token
+// SetStore makes the manager keep its tokens in store. Must be set before the
+// manager is used.
+func (tm *APITokenManager) SetStore(store TokenStore) {
+	tm.store = store
+}
+
+// hash returns the hash a token is stored under
+func (tm *APITokenManager) hash(token string) string {
+	hash := sha256.Sum256(append(append([]byte{}, tm.secret...), token...))
+	return hex.EncodeToString(hash[:])
+}
+
+// GenerateToken generates a new API token not bound to a user
 func (tm *APITokenManager) GenerateToken(name string, expiresAt *time.Time) (string, error) {
+	return tm.GenerateUserToken(name, "", nil, expiresAt)
+}
+
+// GenerateUserToken generates a new API token authenticating as a user
+// with the given groups
+func (tm *APITokenManager) GenerateUserToken(name, user string, groups []string, expiresAt *time.Time) (string, error) {
 	// Generate random token
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
@@ -51,74 +81,100 @@ func (tm *APITokenManager) GenerateToken(name string, expiresAt *time.Time) (str
 	}
 
 	token := base64.URLEncoding.EncodeToString(tokenBytes)
-	
-	// Create hash for storage
-	hash := sha256.Sum256(append(tm.secret, tokenBytes...))
-	hashStr := hex.EncodeToString(hash[:])
+	if err := tm.addToken(name, token, user, groups, expiresAt); err != nil {
+		return "", err
+	}
 
-	apiToken := &APIToken{
-		Token:     token,
-		Hash:      hashStr,
-		Name:      name,
-		CreatedAt: time.Now(),
-		ExpiresAt: expiresAt,
+	return token, nil
+}
+
+// AddToken stores a token chosen by the caller, e.g. one given in the
+// configuration. A token that is already stored is kept as it is.
+func (tm *APITokenManager) AddToken(name, token string, expiresAt *time.Time) error {
+	return tm.addToken(name, token, "", nil, expiresAt)
+}
+
+func (tm *APITokenManager) addToken(name, token, user string, groups []string, expiresAt *time.Time) error {
+	if token == "" {
+		return fmt.Errorf("token must not be empty")
 	}
 
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	tm.tokens[token] = apiToken
-	tm.hashes[hashStr] = token
+	hash := tm.hash(token)
+	if _, err := tm.store.GetAPIToken(hash); err == nil {
+		return nil
+	}
 
-	return token, nil
+	apiToken := &APIToken{
+		Hash:      hash,
+		Name:      name,
+		User:      user,
+		Groups:    groups,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := tm.store.SaveAPIToken(apiToken); err != nil {
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return nil
 }
 
 // ValidateToken validates an API token
 func (tm *APITokenManager) ValidateToken(token string) bool {
-	tm.mu.RLock()
-	defer tm.mu.RUnlock()
+	_, err := tm.LookupToken(token)
+	return err == nil
+}
 
-	t, ok := tm.tokens[token]
-	if !ok {
-		return false
+// LookupToken returns the stored token of a valid API token
+func (tm *APITokenManager) LookupToken(token string) (*APIToken, error) {
+	if token == "" {
+		return nil, fmt.Errorf("token not found")
+	}
+
+	t, err := tm.store.GetAPIToken(tm.hash(token))
+	if err != nil {
+		return nil, err
 	}
 
 	// Check expiration
 	if t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt) {
-		return false
+		return nil, fmt.Errorf("token expired")
 	}
 
-	return true
+	return t, nil
 }
 
-// RevokeToken revokes an API token
+// RevokeToken revokes an API token given by its value or its hash
 func (tm *APITokenManager) RevokeToken(token string) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	t, ok := tm.tokens[token]
-	if !ok {
-		return fmt.Errorf("token not found")
+	hash := tm.hash(token)
+	if _, err := tm.store.GetAPIToken(hash); err != nil {
+		if _, err := tm.store.GetAPIToken(token); err != nil {
+			return fmt.Errorf("token not found")
+		}
+		hash = token
 	}
 
-	delete(tm.hashes, t.Hash)
-	delete(tm.tokens, token)
-
-	return nil
+	return tm.store.DeleteAPIToken(hash)
 }
 
 // ListTokens returns all active tokens
 func (tm *APITokenManager) ListTokens() []*APIToken {
-	tm.mu.RLock()
-	defer tm.mu.RUnlock()
-
-	tokens := make([]*APIToken, 0, len(tm.tokens))
-	for _, token := range tm.tokens {
+	stored := tm.store.ListAPITokens()
+	tokens := make([]*APIToken, 0, len(stored))
+	for _, token := range stored {
 		// Don't include actual token value in list
 		tokens = append(tokens, &APIToken{
 			Token:     "***", // Masked
 			Hash:      token.Hash,
 			Name:      token.Name,
+			User:      token.User,
+			Groups:    token.Groups,
 			CreatedAt: token.CreatedAt,
 			ExpiresAt: token.ExpiresAt,
 		})
@@ -133,14 +189,53 @@ func (tm *APITokenManager) CleanupExpiredTokens() {
 	defer tm.mu.Unlock()
 
 	now := time.Now()
-	for token, t := range tm.tokens {
+	for _, t := range tm.store.ListAPITokens() {
 		if t.ExpiresAt != nil && now.After(*t.ExpiresAt) {
-			delete(tm.hashes, t.Hash)
-			delete(tm.tokens, token)
+			tm.store.DeleteAPIToken(t.Hash)
 		}
 	}
 }
 
+// memoryTokenStore keeps tokens in memory only
+type memoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]*APIToken // hash -> token
+}
+
+func (s *memoryTokenStore) SaveAPIToken(token *APIToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token.Hash] = token
+	return nil
+}
+
+func (s *memoryTokenStore) GetAPIToken(hash string) (*APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, fmt.Errorf("token not found")
+	}
+	return token, nil
+}
+
+func (s *memoryTokenStore) DeleteAPIToken(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, hash)
+	return nil
+}
+
+func (s *memoryTokenStore) ListAPITokens() []*APIToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tokens := make([]*APIToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
 // StartCleanupRoutine starts a routine that periodically cleans up expired tokens
 func (tm *APITokenManager) StartCleanupRoutine() {
 	go func() {
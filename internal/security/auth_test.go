@@ -269,3 +269,56 @@ func TestTokenHash(t *testing.T) {
 		t.Error("Expected token2 to be valid")
 	}
 }
+
+func TestSharedTokenStore(t *testing.T) {
+	// Two nodes sharing the replicated store and the cluster secret
+	store := &memoryTokenStore{tokens: make(map[string]*APIToken)}
+	node1 := NewAPITokenManager([]byte("test-secret"))
+	node1.SetStore(store)
+	node2 := NewAPITokenManager([]byte("test-secret"))
+	node2.SetStore(store)
+
+	token, err := node1.GenerateToken("cli", nil)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if !node2.ValidateToken(token) {
+		t.Error("Expected the token to be valid on the other node")
+	}
+
+	for _, stored := range store.ListAPITokens() {
+		if stored.Token != "" {
+			t.Error("Expected only the hash of the token to be stored")
+		}
+	}
+
+	// Revoking by the listed hash invalidates the token everywhere
+	hash := node2.ListTokens()[0].Hash
+	if err := node2.RevokeToken(hash); err != nil {
+		t.Fatalf("Failed to revoke token by hash: %v", err)
+	}
+	if node1.ValidateToken(token) {
+		t.Error("Expected the revoked token to be invalid on the issuing node")
+	}
+}
+
+func TestAddToken(t *testing.T) {
+	manager := NewAPITokenManager([]byte("test-secret"))
+
+	if err := manager.AddToken("default", "configured-token", nil); err != nil {
+		t.Fatalf("Failed to add token: %v", err)
+	}
+	// Adding the configured token again on restart keeps a single token
+	if err := manager.AddToken("default", "configured-token", nil); err != nil {
+		t.Fatalf("Failed to add token again: %v", err)
+	}
+	if len(manager.ListTokens()) != 1 {
+		t.Errorf("Expected 1 token, got %d", len(manager.ListTokens()))
+	}
+	if !manager.ValidateToken("configured-token") {
+		t.Error("Expected the configured token to be valid")
+	}
+	if err := manager.AddToken("empty", "", nil); err == nil {
+		t.Error("Expected an empty token to be rejected")
+	}
+}
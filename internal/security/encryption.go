@@ -1,41 +1,57 @@
 package security
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"sync"
 )
 
-// Encryptor handles message encryption/decryption
+// Encryptor handles message encryption/decryption. It holds a keyring:
+// messages are encrypted with the primary key and decrypted with any
+// installed key, so that keys can be rotated without downtime.
 type Encryptor struct {
-	key []byte
+	mu   sync.RWMutex
+	keys [][]byte // The primary key first
 }
 
 // NewEncryptor creates a new encryptor with the given key
 func NewEncryptor(key []byte) (*Encryptor, error) {
+	return &Encryptor{keys: [][]byte{DeriveKey(key)}}, nil
+}
+
+// DeriveKey returns the 32-byte AES key used for a key of any length
+func DeriveKey(key []byte) []byte {
 	if len(key) != 32 {
 		// Derive 32-byte key from any input
 		hash := sha256.Sum256(key)
-		key = hash[:]
+		return hash[:]
 	}
+	return key
+}
 
-	return &Encryptor{key: key}, nil
+// KeyFingerprint identifies a key without revealing it
+func KeyFingerprint(key []byte) string {
+	hash := sha256.Sum256(DeriveKey(key))
+	return hex.EncodeToString(hash[:8])
 }
 
 // Encrypt encrypts a message
 func (e *Encryptor) Encrypt(plaintext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(e.key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
-	}
+	e.mu.RLock()
+	key := e.keys[0]
+	e.mu.RUnlock()
 
-	// Create GCM
-	aesGCM, err := cipher.NewGCM(block)
+	aesGCM, err := newGCM(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
 
 	// Create nonce
@@ -49,17 +65,27 @@ func (e *Encryptor) Encrypt(plaintext []byte) ([]byte, error) {
 	return ciphertext, nil
 }
 
-// Decrypt decrypts a message
+// Decrypt decrypts a message with the first installed key that fits
 func (e *Encryptor) Decrypt(ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(e.key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	e.mu.RLock()
+	keys := e.keys
+	e.mu.RUnlock()
+
+	var lastErr error
+	for _, key := range keys {
+		plaintext, err := decrypt(key, ciphertext)
+		if err == nil {
+			return plaintext, nil
+		}
+		lastErr = err
 	}
+	return nil, lastErr
+}
 
-	// Create GCM
-	aesGCM, err := cipher.NewGCM(block)
+func decrypt(key, ciphertext []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
 
 	// Extract nonce
@@ -78,3 +104,140 @@ func (e *Encryptor) Decrypt(ciphertext []byte) ([]byte, error) {
 
 	return plaintext, nil
 }
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	// Create GCM
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aesGCM, nil
+}
+
+// InstallKey adds a key used for decryption. Installing a key twice is a no-op.
+func (e *Encryptor) InstallKey(key []byte) {
+	key = DeriveKey(key)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, installed := range e.keys {
+		if bytes.Equal(installed, key) {
+			return
+		}
+	}
+	e.keys = append(e.keys[:len(e.keys):len(e.keys)], key)
+}
+
+// UseKey makes an installed key the primary key
+func (e *Encryptor) UseKey(fingerprint string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	i := e.index(fingerprint)
+	if i < 0 {
+		return fmt.Errorf("key %s is not installed", fingerprint)
+	}
+
+	keys := make([][]byte, 0, len(e.keys))
+	keys = append(keys, e.keys[i])
+	keys = append(keys, e.keys[:i]...)
+	e.keys = append(keys, e.keys[i+1:]...)
+	return nil
+}
+
+// RemoveKey removes an installed key other than the primary key
+func (e *Encryptor) RemoveKey(fingerprint string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	i := e.index(fingerprint)
+	switch {
+	case i < 0:
+		return fmt.Errorf("key %s is not installed", fingerprint)
+	case i == 0:
+		return fmt.Errorf("key %s is the primary key", fingerprint)
+	}
+
+	keys := make([][]byte, 0, len(e.keys)-1)
+	keys = append(keys, e.keys[:i]...)
+	e.keys = append(keys, e.keys[i+1:]...)
+	return nil
+}
+
+// Key returns an installed key, nil if it is not installed
+func (e *Encryptor) Key(fingerprint string) []byte {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if i := e.index(fingerprint); i >= 0 {
+		return e.keys[i]
+	}
+	return nil
+}
+
+// Keys returns the installed keys, the primary key first
+func (e *Encryptor) Keys() [][]byte {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([][]byte(nil), e.keys...)
+}
+
+// Fingerprints returns the fingerprints of the installed keys, the primary key first
+func (e *Encryptor) Fingerprints() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	fingerprints := make([]string, len(e.keys))
+	for i, key := range e.keys {
+		fingerprints[i] = KeyFingerprint(key)
+	}
+	return fingerprints
+}
+
+func (e *Encryptor) index(fingerprint string) int {
+	for i, key := range e.keys {
+		if KeyFingerprint(key) == fingerprint {
+			return i
+		}
+	}
+	return -1
+}
+
+// ReadKeyring reads the keys saved by WriteKeyring, nil if the file does not exist
+func ReadKeyring(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	var keys [][]byte
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal keyring: %w", err)
+	}
+	return keys, nil
+}
+
+// WriteKeyring saves keys, the primary key first
+func WriteKeyring(path string, keys [][]byte) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to marshal keyring: %w", err)
+	}
+
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		return fmt.Errorf("failed to save keyring: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package security
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptorKeyRotation(t *testing.T) {
+	oldKey := bytes.Repeat([]byte("o"), 32)
+	newKey := bytes.Repeat([]byte("n"), 32)
+
+	encryptor, err := NewEncryptor(oldKey)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	old, err := encryptor.Encrypt([]byte("old"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	if err := encryptor.UseKey(KeyFingerprint(newKey)); err == nil {
+		t.Error("Expected a key that is not installed not to be usable")
+	}
+	encryptor.InstallKey(newKey)
+	encryptor.InstallKey(newKey)
+	if err := encryptor.UseKey(KeyFingerprint(newKey)); err != nil {
+		t.Fatalf("Failed to use key: %v", err)
+	}
+	if fingerprints := encryptor.Fingerprints(); len(fingerprints) != 2 || fingerprints[0] != KeyFingerprint(newKey) {
+		t.Errorf("Expected the new key to be primary, got %v", fingerprints)
+	}
+
+	// Messages encrypted with the old key are still decrypted
+	if plaintext, err := encryptor.Decrypt(old); err != nil || string(plaintext) != "old" {
+		t.Errorf("Expected message of the old key to decrypt, got %q (%v)", plaintext, err)
+	}
+
+	// New messages are encrypted with the new key only
+	current, err := encryptor.Encrypt([]byte("new"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	onlyOld, _ := NewEncryptor(oldKey)
+	if _, err := onlyOld.Decrypt(current); err == nil {
+		t.Error("Expected message of the new key not to decrypt with the old key")
+	}
+
+	if err := encryptor.RemoveKey(KeyFingerprint(newKey)); err == nil {
+		t.Error("Expected the primary key not to be removable")
+	}
+	if err := encryptor.RemoveKey(KeyFingerprint(oldKey)); err != nil {
+		t.Fatalf("Failed to remove key: %v", err)
+	}
+	if _, err := encryptor.Decrypt(old); err == nil {
+		t.Error("Expected message of the removed key not to decrypt")
+	}
+}
+
+func TestKeyringFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+
+	keys, err := ReadKeyring(path)
+	if err != nil || keys != nil {
+		t.Fatalf("Expected no keys without a file, got %v (%v)", keys, err)
+	}
+
+	saved := [][]byte{bytes.Repeat([]byte("a"), 32), bytes.Repeat([]byte("b"), 32)}
+	if err := WriteKeyring(path, saved); err != nil {
+		t.Fatalf("Failed to write keyring: %v", err)
+	}
+	keys, err = ReadKeyring(path)
+	if err != nil || len(keys) != 2 || !bytes.Equal(keys[0], saved[0]) || !bytes.Equal(keys[1], saved[1]) {
+		t.Errorf("Expected saved keys in order, got %v (%v)", keys, err)
+	}
+}
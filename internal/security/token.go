@@ -1,29 +1,77 @@
 package security
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 )
 
+// Roles of join tokens. Managers are also handed the secret join tokens are
+// signed with, so that they can admit nodes themselves.
+const (
+	JoinRoleWorker  = "worker"
+	JoinRoleManager = "manager"
+)
+
+// DefaultJoinTokenTTL is the lifetime of join tokens generated without one
+const DefaultJoinTokenTTL = 24 * time.Hour
+
 // Token represents a join token
 type Token struct {
 	Value     string
-	Hash      string
+	ID        string
+	Role      string
 	CreatedAt time.Time
 	ExpiresAt *time.Time
 }
 
-// TokenManager manages join tokens
+// JoinClaims are the signed contents of a join token
+type JoinClaims struct {
+	ID        string `json:"id"`
+	Role      string `json:"role"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// JoinProof is sent by a joining node in place of its token. It proves that
+// the node holds the token without revealing the signature, which both sides
+// derive the key of the admission response from.
+type JoinProof struct {
+	Claims []byte `json:"claims"`
+	Nonce  []byte `json:"nonce"`
+	Proof  []byte `json:"proof"`
+}
+
+// JoinTokenRevocation revokes a join token by its id until the token expires
+type JoinTokenRevocation struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// RevocationStore keeps the revoked join tokens, e.g. in the cluster state so
+// that a token revoked on one manager is rejected by every manager
+type RevocationStore interface {
+	SaveJoinTokenRevocation(revocation *JoinTokenRevocation) error
+	GetJoinTokenRevocation(id string) (*JoinTokenRevocation, error)
+	DeleteJoinTokenRevocation(id string) error
+	ListJoinTokenRevocations() []*JoinTokenRevocation
+}
+
+// TokenManager manages join tokens. Tokens are the claims followed by their
+// HMAC signature, so any manager holding the secret validates them.
 type TokenManager struct {
+	mu     sync.Mutex
 	tokens map[string]*Token
+	store  RevocationStore
 	secret []byte
 }
 
-// GetSecret returns the secret key (for encryption)
+// GetSecret returns the secret join tokens are signed with
 func (tm *TokenManager) GetSecret() []byte {
 	return tm.secret
 }
@@ -38,28 +86,55 @@ func NewTokenManager(secret []byte) *TokenManager {
 
 	return &TokenManager{
 		tokens: make(map[string]*Token),
+		store:  &memoryRevocationStore{revocations: make(map[string]*JoinTokenRevocation)},
 		secret: secret,
 	}
 }
 
-// GenerateToken generates a new join token
+// SetStore makes the manager keep the revoked tokens in store
+func (tm *TokenManager) SetStore(store RevocationStore) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.store = store
+}
+
+// GenerateToken generates a new worker join token with the default lifetime
 func (tm *TokenManager) GenerateToken() (string, error) {
-	// Generate random token (similar to Docker Swarm format)
-	tokenBytes := make([]byte, 32)
-	if _, err := rand.Read(tokenBytes); err != nil {
+	return tm.GenerateJoinToken(JoinRoleWorker, DefaultJoinTokenTTL)
+}
+
+// GenerateJoinToken generates a join token for a role, valid for ttl
+func (tm *TokenManager) GenerateJoinToken(role string, ttl time.Duration) (string, error) {
+	if role != JoinRoleWorker && role != JoinRoleManager {
+		return "", fmt.Errorf("invalid join token role %q", role)
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
 		return "", fmt.Errorf("failed to generate token: %w", err)
 	}
 
-	token := base64.URLEncoding.EncodeToString(tokenBytes)
-	
-	// Create hash for validation
-	hash := sha256.Sum256(append(tm.secret, tokenBytes...))
-	hashStr := hex.EncodeToString(hash[:])
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims, err := json.Marshal(&JoinClaims{
+		ID:        hex.EncodeToString(idBytes),
+		Role:      role,
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal token claims: %w", err)
+	}
+
+	token := base64.URLEncoding.EncodeToString(append(claims, tm.sign(claims)...))
 
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
 	tm.tokens[token] = &Token{
 		Value:     token,
-		Hash:      hashStr,
-		CreatedAt: time.Now(),
+		ID:        hex.EncodeToString(idBytes),
+		Role:      role,
+		CreatedAt: now,
+		ExpiresAt: &expiresAt,
 	}
 
 	return token, nil
@@ -67,51 +142,221 @@ func (tm *TokenManager) GenerateToken() (string, error) {
 
 // ValidateToken validates a join token
 func (tm *TokenManager) ValidateToken(token string) bool {
-	t, ok := tm.tokens[token]
-	if !ok {
-		// Try to validate against secret
-		tokenBytes, err := base64.URLEncoding.DecodeString(token)
-		if err != nil {
-			return false
-		}
+	claims, signature, err := splitToken(token)
+	if err != nil || !hmac.Equal(signature, tm.sign(claims)) {
+		return false
+	}
+
+	_, err = tm.checkClaims(claims)
+	return err == nil
+}
 
-		hash := sha256.Sum256(append(tm.secret, tokenBytes...))
-		hashStr := hex.EncodeToString(hash[:])
+// RevokeToken revokes a token until it expires. Revocations of expired
+// tokens are dropped, as expired tokens are rejected anyway.
+func (tm *TokenManager) RevokeToken(token string) error {
+	claims, _, err := splitToken(token)
+	if err != nil {
+		return err
+	}
+	var c JoinClaims
+	if err := json.Unmarshal(claims, &c); err != nil {
+		return fmt.Errorf("invalid join token: %w", err)
+	}
 
-		// Check if hash matches
-		for _, storedToken := range tm.tokens {
-			if storedToken.Hash == hashStr {
-				return true
-			}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	delete(tm.tokens, token)
+	if err := tm.store.SaveJoinTokenRevocation(&JoinTokenRevocation{ID: c.ID, ExpiresAt: time.Unix(c.ExpiresAt, 0)}); err != nil {
+		return fmt.Errorf("failed to revoke join token: %w", err)
+	}
+
+	now := time.Now()
+	for _, revocation := range tm.store.ListJoinTokenRevocations() {
+		if now.After(revocation.ExpiresAt) {
+			tm.store.DeleteJoinTokenRevocation(revocation.ID)
 		}
+	}
+	return nil
+}
+
+// ListTokens returns all active tokens generated by this manager
+func (tm *TokenManager) ListTokens() []string {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
 
-		// If no tokens exist, allow first node (bootstrap)
-		if len(tm.tokens) == 0 {
-			return true
+	now := time.Now()
+	tokens := make([]string, 0, len(tm.tokens))
+	for token, t := range tm.tokens {
+		if t.ExpiresAt != nil && now.After(*t.ExpiresAt) {
+			delete(tm.tokens, token)
+			continue
 		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
 
-		return false
+// VerifyJoinProof checks the proof of a joining node. Returns the claims of
+// its token and the key the admission response is encrypted with.
+func (tm *TokenManager) VerifyJoinProof(p *JoinProof) (*JoinClaims, []byte, error) {
+	signature := tm.sign(p.Claims)
+	if !hmac.Equal(p.Proof, proof(signature, p.Nonce)) {
+		return nil, nil, fmt.Errorf("invalid join token")
 	}
 
-	// Check expiration
-	if t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt) {
-		delete(tm.tokens, token)
-		return false
+	claims, err := tm.checkClaims(p.Claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, responseKey(signature, p.Nonce), nil
+}
+
+// NewJoinProof creates the proof of holding a join token. Returns the key the
+// admission response is encrypted with.
+func NewJoinProof(token string) (*JoinProof, []byte, error) {
+	claims, signature, err := splitToken(token)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return true
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return &JoinProof{
+		Claims: claims,
+		Nonce:  nonce,
+		Proof:  proof(signature, nonce),
+	}, responseKey(signature, nonce), nil
 }
 
-// RevokeToken revokes a token
-func (tm *TokenManager) RevokeToken(token string) {
-	delete(tm.tokens, token)
+// NodeSecret derives the secret of a node from the join secret. Managers hand
+// it to the nodes they admit and derive it again to authenticate them.
+func NodeSecret(joinSecret []byte, node string) []byte {
+	mac := hmac.New(sha256.New, joinSecret)
+	mac.Write([]byte("node"))
+	mac.Write([]byte(node))
+	return mac.Sum(nil)
 }
 
-// ListTokens returns all active tokens
-func (tm *TokenManager) ListTokens() []string {
-	tokens := make([]string, 0, len(tm.tokens))
-	for token := range tm.tokens {
-		tokens = append(tokens, token)
+// NodeProof is sent by a member in place of the secret of its node, e.g. to
+// fetch a gossip key from a manager. Both sides derive the key of the
+// response from the secret.
+type NodeProof struct {
+	Node  string `json:"node"`
+	Nonce []byte `json:"nonce"`
+	Proof []byte `json:"proof"`
+}
+
+// NewNodeProof creates the proof of holding the secret of a node. Returns the
+// key the response is encrypted with.
+func NewNodeProof(node string, secret []byte) (*NodeProof, []byte, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
-	return tokens
+	return &NodeProof{Node: node, Nonce: nonce, Proof: proof(secret, nonce)}, responseKey(secret, nonce), nil
+}
+
+// VerifyNodeProof checks the proof of a node. Returns the key the response is
+// encrypted with.
+func (tm *TokenManager) VerifyNodeProof(p *NodeProof) ([]byte, error) {
+	secret := NodeSecret(tm.secret, p.Node)
+	if !hmac.Equal(p.Proof, proof(secret, p.Nonce)) {
+		return nil, fmt.Errorf("invalid proof of node %s", p.Node)
+	}
+	return responseKey(secret, p.Nonce), nil
+}
+
+// checkClaims checks that signed claims are well-formed, not expired and not revoked
+func (tm *TokenManager) checkClaims(data []byte) (*JoinClaims, error) {
+	var claims JoinClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, fmt.Errorf("invalid join token: %w", err)
+	}
+	if claims.Role != JoinRoleWorker && claims.Role != JoinRoleManager {
+		return nil, fmt.Errorf("invalid join token role %q", claims.Role)
+	}
+
+	if time.Now().After(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, fmt.Errorf("join token expired")
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if _, err := tm.store.GetJoinTokenRevocation(claims.ID); err == nil {
+		return nil, fmt.Errorf("join token revoked")
+	}
+
+	return &claims, nil
+}
+
+// memoryRevocationStore keeps revoked tokens in memory only
+type memoryRevocationStore struct {
+	mu          sync.RWMutex
+	revocations map[string]*JoinTokenRevocation // id -> revocation
+}
+
+func (s *memoryRevocationStore) SaveJoinTokenRevocation(revocation *JoinTokenRevocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revocations[revocation.ID] = revocation
+	return nil
+}
+
+func (s *memoryRevocationStore) GetJoinTokenRevocation(id string) (*JoinTokenRevocation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revocation, ok := s.revocations[id]
+	if !ok {
+		return nil, fmt.Errorf("revocation not found")
+	}
+	return revocation, nil
+}
+
+func (s *memoryRevocationStore) DeleteJoinTokenRevocation(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.revocations, id)
+	return nil
+}
+
+func (s *memoryRevocationStore) ListJoinTokenRevocations() []*JoinTokenRevocation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revocations := make([]*JoinTokenRevocation, 0, len(s.revocations))
+	for _, revocation := range s.revocations {
+		revocations = append(revocations, revocation)
+	}
+	return revocations
+}
+
+func (tm *TokenManager) sign(claims []byte) []byte {
+	mac := hmac.New(sha256.New, tm.secret)
+	mac.Write(claims)
+	return mac.Sum(nil)
+}
+
+// splitToken returns the claims and the signature of a token
+func splitToken(token string) ([]byte, []byte, error) {
+	data, err := base64.URLEncoding.DecodeString(token)
+	if err != nil || len(data) <= sha256.Size {
+		return nil, nil, fmt.Errorf("malformed join token")
+	}
+	return data[:len(data)-sha256.Size], data[len(data)-sha256.Size:], nil
+}
+
+func proof(signature, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, signature)
+	mac.Write([]byte("proof"))
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+func responseKey(signature, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, signature)
+	mac.Write([]byte("response"))
+	mac.Write(nonce)
+	return mac.Sum(nil)
 }
@@ -1,7 +1,9 @@
 package security
 
 import (
+	"bytes"
 	"testing"
+	"time"
 )
 
 func TestNewTokenManager(t *testing.T) {
@@ -142,3 +144,63 @@ func TestTokenFormatting(t *testing.T) {
 		}
 	}
 }
+
+func TestJoinTokenExpiryAndRevocation(t *testing.T) {
+	manager := NewTokenManager([]byte("test-secret"))
+
+	expired, err := manager.GenerateJoinToken(JoinRoleWorker, -time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if manager.ValidateToken(expired) {
+		t.Error("Expected expired token to fail validation")
+	}
+
+	token, err := manager.GenerateJoinToken(JoinRoleManager, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if err := manager.RevokeToken(token); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if manager.ValidateToken(token) {
+		t.Error("Expected revoked token to fail validation")
+	}
+
+	if _, err := manager.GenerateJoinToken("admin", time.Hour); err == nil {
+		t.Error("Expected unknown role to be rejected")
+	}
+}
+
+func TestJoinProof(t *testing.T) {
+	manager := NewTokenManager([]byte("test-secret"))
+	token, err := manager.GenerateJoinToken(JoinRoleManager, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	proof, key, err := NewJoinProof(token)
+	if err != nil {
+		t.Fatalf("Failed to create join proof: %v", err)
+	}
+	claims, verifiedKey, err := manager.VerifyJoinProof(proof)
+	if err != nil {
+		t.Fatalf("Failed to verify join proof: %v", err)
+	}
+	if claims.Role != JoinRoleManager {
+		t.Errorf("Expected manager role, got %s", claims.Role)
+	}
+	if !bytes.Equal(key, verifiedKey) {
+		t.Error("Expected both sides to derive the same response key")
+	}
+
+	if _, _, err := NewTokenManager([]byte("other-secret")).VerifyJoinProof(proof); err == nil {
+		t.Error("Expected proof to fail verification with another secret")
+	}
+
+	// Claims cannot be changed without the secret
+	proof.Claims = bytes.Replace(proof.Claims, []byte(JoinRoleManager), []byte(JoinRoleWorker), 1)
+	if _, _, err := manager.VerifyJoinProof(proof); err == nil {
+		t.Error("Expected proof with changed claims to fail verification")
+	}
+}
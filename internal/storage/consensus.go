@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// replicateTimeout bounds how long a write waits for the consensus log
+const replicateTimeout = 10 * time.Second
+
+// Replicator replicates commands through a consensus log. Apply returns once
+// the command was committed and applied to the local storage.
+type Replicator interface {
+	Apply(cmd []byte, timeout time.Duration) error
+}
+
+// Kinds of replicated objects, named like the fields of ClusterState
+const (
+	kindDeployments  = "deployments"
+	kindStatefulSets = "stateful_sets"
+	kindDaemonSets   = "daemon_sets"
+	kindJobs         = "jobs"
+	kindCronJobs     = "cron_jobs"
+	kindServices     = "services"
+	kindIngresses    = "ingresses"
+	kindPods         = "pods"
+	kindPodStatuses  = "pod_statuses"
+	kindConfigMaps   = "config_maps"
+	kindSecrets      = "secrets"
+	kindClaims       = "persistent_volume_claims"
+	kindBudgets      = "pod_disruption_budgets"
+	kindAPITokens    = "api_tokens"
+	kindRoles        = "roles"
+	kindRoleBindings = "role_bindings"
+	kindAccounts     = "service_accounts"
+	kindRevocations  = "join_token_revocations"
+	kindFences       = "fences"
+)
+
+const (
+	opSave   = "save"
+	opDelete = "delete"
+)
+
+// command is a write replicated through the consensus log
+type command struct {
+	Op    string          `json:"op"`
+	Kind  string          `json:"kind"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SetReplicator routes all writes through a consensus log instead of applying
+// them locally. Committed writes reach the storage through FSM, and state
+// sync messages from peers are ignored. Must be set before the storage is used.
+func (s *Storage) SetReplicator(replicator Replicator) {
+	s.replicator = replicator
+}
+
+// replicate submits a write to the consensus log and waits until it was applied
+func (s *Storage) replicate(op, kind, key string, value interface{}) error {
+	cmd := command{Op: op, Kind: kind, Key: key}
+	if value != nil {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s %s: %w", kind, key, err)
+		}
+		cmd.Value = data
+	}
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	if err := s.replicator.Apply(data, replicateTimeout); err != nil {
+		return fmt.Errorf("failed to replicate %s %s: %w", kind, key, err)
+	}
+	return nil
+}
+
+// FSM is the state machine applying the committed writes to the storage
+type FSM struct {
+	s *Storage
+}
+
+// FSM returns the state machine of the storage for the consensus log
+func (s *Storage) FSM() *FSM {
+	return &FSM{s: s}
+}
+
+// Apply applies a committed write
+func (f *FSM) Apply(data []byte) error {
+	var cmd command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return fmt.Errorf("failed to unmarshal command: %w", err)
+	}
+
+	s := f.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects := s.objectMap(cmd.Kind)
+	if objects == nil {
+		return fmt.Errorf("unknown kind %q", cmd.Kind)
+	}
+	if s.staleFence(&cmd) {
+		return nil
+	}
+	if err := objects.apply(&cmd); err != nil {
+		return err
+	}
+
+	s.lastModified = time.Now()
+	return s.persist()
+}
+
+// Snapshot returns the complete state for compacting the consensus log
+func (f *FSM) Snapshot() ([]byte, error) {
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+
+	data, err := json.Marshal(f.s.currentState())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal state: %w", err)
+	}
+	return data, nil
+}
+
+// Restore replaces the state with a snapshot of the consensus log
+func (f *FSM) Restore(data []byte) error {
+	var state ClusterState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to unmarshal state: %w", err)
+	}
+
+	s := f.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setState(&state)
+	return s.persist()
+}
@@ -0,0 +1,370 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/your-server-support/podman-swarm/internal/security"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// TombstoneTTL is how long deletions are remembered. A peer that was away for
+// longer may bring deleted objects back.
+const TombstoneTTL = 24 * time.Hour
+
+// ObjectVersion is the version of a stored object. A deleted object keeps its
+// version as a tombstone, so that the deletion wins over older copies of the
+// object on peers, until the tombstone is garbage collected.
+type ObjectVersion struct {
+	ResourceVersion uint64    `json:"resource_version"` // Lamport clock of the last write
+	Node            string    `json:"node"`             // Node of the last write, orders concurrent writes
+	Deleted         bool      `json:"deleted,omitempty"`
+	ModifiedAt      time.Time `json:"modified_at"`
+}
+
+// newerThan checks if v is a later write than other. Concurrent writes, e.g.
+// on both sides of a network partition, are ordered by the node name, so that
+// every node settles on the same version once they exchanged their state.
+// The pods of a workload are part of its object, so the pods only the losing
+// version listed leave the state and their nodes remove them as orphans. The
+// nodes report the statuses of their pods as objects of their own, which the
+// writes of the workload by the leader do not overwrite.
+func (v *ObjectVersion) newerThan(other *ObjectVersion) bool {
+	if v.ResourceVersion != other.ResourceVersion {
+		return v.ResourceVersion > other.ResourceVersion
+	}
+	return v.Node > other.Node
+}
+
+// Delta is the latest write of a single object
+type Delta struct {
+	Kind    string          `json:"kind"`
+	Key     string          `json:"key"`
+	Version ObjectVersion   `json:"version"`
+	Value   json.RawMessage `json:"value,omitempty"` // Empty for deletions
+}
+
+// objectMap gives uniform access to the objects of one kind
+type objectMap interface {
+	get(key string) (interface{}, bool)
+	keys() []string
+	apply(cmd *command) error
+}
+
+type typedMap[T any] map[string]*T
+
+func (m typedMap[T]) get(key string) (interface{}, bool) {
+	object, ok := m[key]
+	return object, ok
+}
+
+func (m typedMap[T]) keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// apply saves or deletes the object of a command
+func (m typedMap[T]) apply(cmd *command) error {
+	switch cmd.Op {
+	case opSave:
+		object := new(T)
+		if err := json.Unmarshal(cmd.Value, object); err != nil {
+			return fmt.Errorf("failed to unmarshal %s %s: %w", cmd.Kind, cmd.Key, err)
+		}
+		m[cmd.Key] = object
+	case opDelete:
+		delete(m, cmd.Key)
+	default:
+		return fmt.Errorf("unknown operation %q", cmd.Op)
+	}
+	return nil
+}
+
+// clone returns a deep copy of an object. Objects are copied into and out of
+// the storage, so that callers changing what they got do not change the
+// stored state behind the back of its versions and the consensus log. The
+// copy goes through JSON like replicated objects do.
+func clone[T any](object *T) *T {
+	if object == nil {
+		return nil
+	}
+	copied := new(T)
+	data, err := json.Marshal(object)
+	if err == nil {
+		err = json.Unmarshal(data, copied)
+	}
+	if err != nil {
+		// Stored objects are plain data, they always marshal
+		panic(fmt.Sprintf("failed to copy %T: %v", object, err))
+	}
+	return copied
+}
+
+var allKinds = []string{
+	kindDeployments, kindStatefulSets, kindDaemonSets, kindJobs, kindCronJobs, kindServices,
+	kindIngresses, kindPods, kindPodStatuses, kindConfigMaps, kindSecrets, kindClaims, kindBudgets,
+	kindAPITokens, kindRoles, kindRoleBindings, kindAccounts, kindRevocations, kindFences,
+}
+
+// objectMap returns the objects of a kind, nil for unknown kinds.
+// The caller must hold the lock.
+func (s *Storage) objectMap(kind string) objectMap {
+	switch kind {
+	case kindDeployments:
+		return typedMap[types.Deployment](s.deployments)
+	case kindStatefulSets:
+		return typedMap[types.StatefulSet](s.statefulSets)
+	case kindDaemonSets:
+		return typedMap[types.DaemonSet](s.daemonSets)
+	case kindJobs:
+		return typedMap[types.Job](s.jobs)
+	case kindCronJobs:
+		return typedMap[types.CronJob](s.cronJobs)
+	case kindServices:
+		return typedMap[types.Service](s.services)
+	case kindIngresses:
+		return typedMap[types.Ingress](s.ingresses)
+	case kindPods:
+		return typedMap[types.Pod](s.pods)
+	case kindPodStatuses:
+		return typedMap[types.PodStatus](s.podStatuses)
+	case kindConfigMaps:
+		return typedMap[types.ConfigMap](s.configMaps)
+	case kindSecrets:
+		return typedMap[types.Secret](s.secrets)
+	case kindClaims:
+		return typedMap[types.PersistentVolumeClaim](s.claims)
+	case kindBudgets:
+		return typedMap[types.PodDisruptionBudget](s.budgets)
+	case kindAPITokens:
+		return typedMap[security.APIToken](s.apiTokens)
+	case kindRoles:
+		return typedMap[types.Role](s.roles)
+	case kindRoleBindings:
+		return typedMap[types.RoleBinding](s.roleBindings)
+	case kindAccounts:
+		return typedMap[types.ServiceAccount](s.accounts)
+	case kindRevocations:
+		return typedMap[security.JoinTokenRevocation](s.revocations)
+	case kindFences:
+		return typedMap[Fence](s.fences)
+	}
+	return nil
+}
+
+// bumpVersion records a local write of an object and queues it for the next
+// broadcast. The caller must hold the lock.
+func (s *Storage) bumpVersion(kind, key string, deleted bool) {
+	s.clock++
+	versionKey := kind + "/" + key
+	s.versions[versionKey] = &ObjectVersion{
+		ResourceVersion: s.clock,
+		Node:            s.nodeName,
+		Deleted:         deleted,
+		ModifiedAt:      time.Now(),
+	}
+	s.pending[versionKey] = true
+}
+
+// versionUnversioned gives objects stored before versions were tracked, or
+// merged from peers without versions, the lowest version so that any
+// versioned write wins. The caller must hold the lock.
+func (s *Storage) versionUnversioned() {
+	for _, kind := range allKinds {
+		for _, key := range s.objectMap(kind).keys() {
+			if _, ok := s.versions[kind+"/"+key]; !ok {
+				s.versions[kind+"/"+key] = &ObjectVersion{Node: s.nodeName, ModifiedAt: time.Now()}
+			}
+		}
+	}
+}
+
+// GetVersion returns the version of an object, or of its tombstone if it was deleted
+func (s *Storage) GetVersion(kind, namespace, name string) (*ObjectVersion, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	version, ok := s.versions[fmt.Sprintf("%s/%s/%s", kind, namespace, name)]
+	if !ok {
+		return nil, false
+	}
+	copied := *version
+	return &copied, true
+}
+
+// delta builds the delta of an object from its current version.
+// The caller must hold the lock.
+func (s *Storage) delta(versionKey string) (*Delta, error) {
+	version, ok := s.versions[versionKey]
+	if !ok {
+		return nil, nil
+	}
+
+	kind, key, _ := strings.Cut(versionKey, "/")
+	d := &Delta{Kind: kind, Key: key, Version: *version}
+	if version.Deleted {
+		return d, nil
+	}
+
+	objects := s.objectMap(kind)
+	if objects == nil {
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	object, ok := objects.get(key)
+	if !ok {
+		return nil, nil
+	}
+	value, err := json.Marshal(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", versionKey, err)
+	}
+	d.Value = value
+	return d, nil
+}
+
+// takePendingDeltas returns the deltas of the objects written locally since
+// the last call, oldest first
+func (s *Storage) takePendingDeltas() []*Delta {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deltas := make([]*Delta, 0, len(s.pending))
+	for versionKey := range s.pending {
+		d, err := s.delta(versionKey)
+		if err != nil {
+			s.logger.Warnf("Failed to build delta: %v", err)
+			continue
+		}
+		if d != nil {
+			deltas = append(deltas, d)
+		}
+	}
+	s.pending = make(map[string]bool)
+
+	sort.Slice(deltas, func(i, j int) bool {
+		return deltas[i].Version.ResourceVersion < deltas[j].Version.ResourceVersion
+	})
+	return deltas
+}
+
+// ApplyDeltas applies the deltas of a peer that are newer than the local
+// versions. Returns the number of applied deltas.
+func (s *Storage) ApplyDeltas(deltas []*Delta) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	applied := 0
+	for _, d := range deltas {
+		objects := s.objectMap(d.Kind)
+		if objects == nil {
+			s.logger.Debugf("Ignoring delta of unknown kind %q", d.Kind)
+			continue
+		}
+
+		versionKey := d.Kind + "/" + d.Key
+		if local, ok := s.versions[versionKey]; ok && !d.Version.newerThan(local) {
+			continue
+		}
+
+		cmd := &command{Op: opSave, Kind: d.Kind, Key: d.Key, Value: d.Value}
+		if d.Version.Deleted {
+			cmd.Op = opDelete
+		}
+		if s.staleFence(cmd) {
+			// Keep the higher token and make it win over the stale one on the peers
+			s.clock = max(s.clock, d.Version.ResourceVersion)
+			s.bumpVersion(d.Kind, d.Key, false)
+			continue
+		}
+		if err := objects.apply(cmd); err != nil {
+			s.logger.Warnf("Failed to apply delta of %s: %v", versionKey, err)
+			continue
+		}
+
+		version := d.Version
+		s.versions[versionKey] = &version
+		s.clock = max(s.clock, version.ResourceVersion)
+		applied++
+	}
+
+	if applied == 0 {
+		return 0, nil
+	}
+	s.lastModified = time.Now()
+	return applied, s.persist()
+}
+
+// LocalState returns every object and tombstone with its version for the
+// anti-entropy exchange with a peer, nil when writes are replicated through
+// consensus
+func (s *Storage) LocalState() []byte {
+	if s.replicator != nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	deltas := make([]*Delta, 0, len(s.versions))
+	for versionKey := range s.versions {
+		d, err := s.delta(versionKey)
+		if err != nil {
+			s.logger.Warnf("Failed to build delta: %v", err)
+			continue
+		}
+		if d != nil {
+			deltas = append(deltas, d)
+		}
+	}
+	s.mu.RUnlock()
+
+	data, err := json.Marshal(deltas)
+	if err != nil {
+		s.logger.Warnf("Failed to marshal local state: %v", err)
+		return nil
+	}
+	return data
+}
+
+// MergeRemoteState applies the state of a peer received in the anti-entropy exchange
+func (s *Storage) MergeRemoteState(data []byte) error {
+	if s.replicator != nil || len(data) == 0 {
+		return nil
+	}
+
+	var deltas []*Delta
+	if err := json.Unmarshal(data, &deltas); err != nil {
+		return fmt.Errorf("failed to unmarshal remote state: %w", err)
+	}
+
+	applied, err := s.ApplyDeltas(deltas)
+	if applied > 0 {
+		s.logger.Infof("Merged %d objects from peer state", applied)
+	}
+	return err
+}
+
+// CollectTombstones removes the tombstones of objects deleted longer than ttl ago
+func (s *Storage) CollectTombstones(ttl time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collected := 0
+	for versionKey, version := range s.versions {
+		if version.Deleted && time.Since(version.ModifiedAt) > ttl {
+			delete(s.versions, versionKey)
+			collected++
+		}
+	}
+
+	if collected > 0 {
+		if err := s.persist(); err != nil {
+			s.logger.Warnf("Failed to persist state: %v", err)
+		}
+	}
+	return collected
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/your-server-support/podman-swarm/internal/security"
+	"github.com/your-server-support/podman-swarm/internal/types"
+)
+
+// relay broadcasts the pending deltas of one storage to the others
+func relay(t *testing.T, from *Storage, to ...*Storage) {
+	t.Helper()
+	err := from.BroadcastState(func(data []byte) error {
+		for _, s := range to {
+			if err := s.HandleStateSyncMessage(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, from.nodeName)
+	if err != nil {
+		t.Fatalf("Failed to broadcast state: %v", err)
+	}
+}
+
+func TestDeltaSync(t *testing.T) {
+	node1, tmpDir1 := setupTestStorage(t)
+	defer cleanup(tmpDir1)
+	node2, tmpDir2 := setupTestStorage(t)
+	defer cleanup(tmpDir2)
+	node1.nodeName, node2.nodeName = "node-1", "node-2"
+
+	deployment := &types.Deployment{Name: "web", Namespace: "default", Replicas: 2}
+	if err := node1.SaveDeployment(deployment); err != nil {
+		t.Fatalf("Failed to save deployment: %v", err)
+	}
+	relay(t, node1, node2)
+
+	got, err := node2.GetDeployment("default", "web")
+	if err != nil || got.Replicas != 2 {
+		t.Fatalf("Expected deployment to be synced, got %v: %v", got, err)
+	}
+	version, _ := node2.GetVersion(kindDeployments, "default", "web")
+	if version.ResourceVersion != 1 || version.Node != "node-1" {
+		t.Errorf("Expected version 1 of node-1, got %+v", version)
+	}
+
+	// Nothing is sent again without new writes
+	relay(t, node1, node2)
+
+	// A stale delta does not overwrite a later write
+	node2.SaveDeployment(&types.Deployment{Name: "web", Namespace: "default", Replicas: 3})
+	stale := &Delta{Kind: kindDeployments, Key: "default/web", Version: ObjectVersion{ResourceVersion: 1, Node: "node-1"}, Value: []byte(`{"name":"web","namespace":"default","replicas":1}`)}
+	if applied, err := node2.ApplyDeltas([]*Delta{stale}); err != nil || applied != 0 {
+		t.Errorf("Expected stale delta to be ignored, applied %d: %v", applied, err)
+	}
+	if got, _ := node2.GetDeployment("default", "web"); got.Replicas != 3 {
+		t.Errorf("Expected 3 replicas, got %d", got.Replicas)
+	}
+
+	// Deletions are synced as tombstones
+	relay(t, node2, node1)
+	if err := node1.DeleteDeployment("default", "web"); err != nil {
+		t.Fatalf("Failed to delete deployment: %v", err)
+	}
+	relay(t, node1, node2)
+
+	if _, err := node2.GetDeployment("default", "web"); err == nil {
+		t.Error("Expected deployment to be deleted")
+	}
+	version, ok := node2.GetVersion(kindDeployments, "default", "web")
+	if !ok || !version.Deleted {
+		t.Errorf("Expected a tombstone, got %+v", version)
+	}
+}
+
+func TestAntiEntropy(t *testing.T) {
+	node1, tmpDir1 := setupTestStorage(t)
+	defer cleanup(tmpDir1)
+	node2, tmpDir2 := setupTestStorage(t)
+	defer cleanup(tmpDir2)
+	node1.nodeName, node2.nodeName = "node-1", "node-2"
+
+	// Both nodes know the service, node-1 deleted it while the delta was lost
+	service := &types.Service{Name: "web", Namespace: "default"}
+	node1.SaveService(service)
+	relay(t, node1, node2)
+	node1.DeleteService("default", "web")
+	node1.takePendingDeltas()
+
+	node2.SaveConfigMap(&types.ConfigMap{Name: "config", Namespace: "default", Data: map[string]string{"a": "b"}})
+
+	if err := node2.MergeRemoteState(node1.LocalState()); err != nil {
+		t.Fatalf("Failed to merge state of node-1: %v", err)
+	}
+	if err := node1.MergeRemoteState(node2.LocalState()); err != nil {
+		t.Fatalf("Failed to merge state of node-2: %v", err)
+	}
+
+	for _, s := range []*Storage{node1, node2} {
+		if _, err := s.GetService("default", "web"); err == nil {
+			t.Errorf("Expected service to be deleted on %s", s.nodeName)
+		}
+		if _, err := s.GetConfigMap("default", "config"); err != nil {
+			t.Errorf("Expected config map on %s", s.nodeName)
+		}
+	}
+}
+
+func TestCollectTombstones(t *testing.T) {
+	storage, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	storage.SavePod(&types.Pod{Name: "web-1", Namespace: "default"})
+	storage.SavePod(&types.Pod{Name: "web-2", Namespace: "default"})
+	storage.DeletePod("default", "web-1")
+
+	if collected := storage.CollectTombstones(time.Hour); collected != 0 {
+		t.Errorf("Expected no expired tombstones, collected %d", collected)
+	}
+	if collected := storage.CollectTombstones(0); collected != 1 {
+		t.Errorf("Expected 1 collected tombstone, got %d", collected)
+	}
+	if _, ok := storage.GetVersion(kindPods, "default", "web-1"); ok {
+		t.Error("Expected tombstone to be removed")
+	}
+	if _, ok := storage.GetVersion(kindPods, "default", "web-2"); !ok {
+		t.Error("Expected version of live pod to be kept")
+	}
+}
+
+func TestAPITokenSync(t *testing.T) {
+	node1, tmpDir1 := setupTestStorage(t)
+	defer cleanup(tmpDir1)
+	node2, tmpDir2 := setupTestStorage(t)
+	defer cleanup(tmpDir2)
+	node1.nodeName, node2.nodeName = "node-1", "node-2"
+
+	if err := node1.SaveAPIToken(&security.APIToken{Token: "plaintext", Hash: "abc", Name: "cli"}); err == nil {
+		t.Error("Expected a token with its value to be rejected")
+	}
+
+	if err := node1.SaveAPIToken(&security.APIToken{Hash: "abc", Name: "cli"}); err != nil {
+		t.Fatalf("Failed to save API token: %v", err)
+	}
+	relay(t, node1, node2)
+	if token, err := node2.GetAPIToken("abc"); err != nil || token.Name != "cli" {
+		t.Fatalf("Expected the token to be synced, got %v: %v", token, err)
+	}
+
+	// Revocation on any node reaches the others
+	if err := node2.DeleteAPIToken("abc"); err != nil {
+		t.Fatalf("Failed to delete API token: %v", err)
+	}
+	relay(t, node2, node1)
+	if _, err := node1.GetAPIToken("abc"); err == nil {
+		t.Error("Expected the revoked token to be deleted")
+	}
+}
+
+func TestJoinTokenRevocationSync(t *testing.T) {
+	node1, tmpDir1 := setupTestStorage(t)
+	defer cleanup(tmpDir1)
+	node2, tmpDir2 := setupTestStorage(t)
+	defer cleanup(tmpDir2)
+	node1.nodeName, node2.nodeName = "node-1", "node-2"
+
+	manager1 := security.NewTokenManager([]byte("join-secret"))
+	manager1.SetStore(node1)
+	manager2 := security.NewTokenManager([]byte("join-secret"))
+	manager2.SetStore(node2)
+
+	token, err := manager1.GenerateJoinToken(security.JoinRoleWorker, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate join token: %v", err)
+	}
+	if !manager2.ValidateToken(token) {
+		t.Fatal("Expected the token to be valid on every manager")
+	}
+
+	// Revocation on one manager reaches the others
+	if err := manager1.RevokeToken(token); err != nil {
+		t.Fatalf("Failed to revoke join token: %v", err)
+	}
+	relay(t, node1, node2)
+	if manager2.ValidateToken(token) {
+		t.Error("Expected the revoked token to be rejected by the other manager")
+	}
+}
+
+func TestFenceTwoHolders(t *testing.T) {
+	node1, tmpDir1 := setupTestStorage(t)
+	defer cleanup(tmpDir1)
+	node2, tmpDir2 := setupTestStorage(t)
+	defer cleanup(tmpDir2)
+	node1.nodeName, node2.nodeName = "node-1", "node-2"
+
+	// Both nodes believe to hold the lease, e.g. node-1 missed that it expired
+	// and node-2 took it over with a higher token
+	if err := node2.Fence("cron-jobs", 2); err != nil {
+		t.Fatalf("Failed to accept token 2: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := node1.SaveDeployment(&types.Deployment{Name: "web", Namespace: "default", DesiredReplicas: int32(i)}); err != nil {
+			t.Fatalf("Failed to save deployment: %v", err)
+		}
+	}
+	if err := node1.Fence("cron-jobs", 1); err != nil {
+		t.Fatalf("Expected token 1 to be accepted before the takeover is known: %v", err)
+	}
+
+	// The fence of node-1 is the later write but does not lower the token
+	relay(t, node1, node2)
+	if fence, err := node2.GetFence("cron-jobs"); err != nil || fence.Token != 2 || fence.Holder != "node-2" {
+		t.Errorf("Expected token 2 of node-2 to be kept, got %+v (%v)", fence, err)
+	}
+	if err := node2.Fence("cron-jobs", 1); !errors.Is(err, ErrFenced) {
+		t.Errorf("Expected token 1 to be rejected, got %v", err)
+	}
+
+	// Once node-1 learns about the higher token, it stops writing
+	relay(t, node2, node1)
+	if err := node1.Fence("cron-jobs", 1); !errors.Is(err, ErrFenced) {
+		t.Errorf("Expected the former holder to be fenced, got %v", err)
+	}
+	if err := node2.Fence("cron-jobs", 2); err != nil {
+		t.Errorf("Expected the current holder to keep writing: %v", err)
+	}
+}
+
+func TestPodStatusSync(t *testing.T) {
+	leader, tmpDir1 := setupTestStorage(t)
+	defer cleanup(tmpDir1)
+	node, tmpDir2 := setupTestStorage(t)
+	defer cleanup(tmpDir2)
+	leader.nodeName, node.nodeName = "node-1", "node-2"
+
+	pod := &types.Pod{ID: "a", Name: "web-0", Namespace: "default", NodeName: "node-2"}
+	leader.SaveDeployment(&types.Deployment{Name: "web", Namespace: "default", DesiredReplicas: 2, Pods: []*types.Pod{pod}})
+	relay(t, leader, node)
+
+	// The node reports the status of its pod while the leader schedules
+	// another one, neither write overwrites the other
+	if err := node.SavePodStatus(&types.PodStatus{ID: "a", NodeName: "node-2", PodmanID: "p", State: types.PodStateRunning, Ready: true}); err != nil {
+		t.Fatalf("Failed to save pod status: %v", err)
+	}
+	dep, _ := leader.GetDeployment("default", "web")
+	dep.Pods = append(dep.Pods, &types.Pod{ID: "b", Name: "web-1", Namespace: "default", NodeName: "node-1"})
+	leader.SaveDeployment(dep)
+	relay(t, node, leader)
+	relay(t, leader, node)
+
+	for _, s := range []*Storage{leader, node} {
+		dep, err := s.GetDeployment("default", "web")
+		if err != nil || len(dep.Pods) != 2 {
+			t.Fatalf("Expected both pods on %s, got %+v (%v)", s.nodeName, dep, err)
+		}
+		if dep.Pods[0].State != types.PodStateRunning || !dep.Pods[0].Ready || dep.Pods[0].PodmanID != "p" {
+			t.Errorf("Expected the reported status on %s, got %+v", s.nodeName, dep.Pods[0])
+		}
+	}
+
+	// The status reported by a node the pod was moved away from is ignored
+	dep, _ = leader.GetDeployment("default", "web")
+	dep.Pods[0] = &types.Pod{ID: "a", Name: "web-0", Namespace: "default", NodeName: "node-1"}
+	leader.SaveDeployment(dep)
+	if dep, _ := leader.GetDeployment("default", "web"); dep.Pods[0].State != "" {
+		t.Errorf("Expected the status of node-2 to be ignored, got %s", dep.Pods[0].State)
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFenced is returned to the former holder of a lease once another node
+// took it over
+var ErrFenced = errors.New("lease was taken over")
+
+// Fence is the highest fencing token accepted for the singleton work under a
+// lease. It only increases, also when concurrent writes are merged.
+type Fence struct {
+	Lease  string `json:"lease"`
+	Holder string `json:"holder"`
+	Token  uint64 `json:"token"`
+}
+
+// Fence accepts the fencing token of a lease held by the local node before
+// the singleton work under it writes to the cluster state. Fails with
+// ErrFenced if a higher token was accepted, so that a former holder that
+// missed the takeover stops writing.
+func (s *Storage) Fence(lease string, token uint64) error {
+	s.mu.Lock()
+	if err := s.checkFence(lease, token); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if fence := s.fences[lease]; fence != nil && fence.Token == token {
+		// Accepted before
+		s.mu.Unlock()
+		return nil
+	}
+
+	fence := &Fence{Lease: lease, Holder: s.nodeName, Token: token}
+	if s.replicator != nil {
+		s.mu.Unlock()
+		if err := s.replicate(opSave, kindFences, lease, fence); err != nil {
+			return err
+		}
+
+		// A higher token may have been committed first
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.checkFence(lease, token)
+	}
+	defer s.mu.Unlock()
+
+	s.fences[lease] = fence
+	s.bumpVersion(kindFences, lease, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetFence returns the highest fencing token accepted for a lease
+func (s *Storage) GetFence(lease string) (*Fence, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fence, ok := s.fences[lease]
+	if !ok {
+		return nil, fmt.Errorf("fence not found")
+	}
+
+	return clone(fence), nil
+}
+
+// checkFence fails if a higher token than token was accepted for a lease.
+// The caller must hold the lock.
+func (s *Storage) checkFence(lease string, token uint64) error {
+	if fence := s.fences[lease]; fence != nil && fence.Token > token {
+		return fmt.Errorf("%w: token %d is below token %d of %s", ErrFenced, token, fence.Token, fence.Holder)
+	}
+	return nil
+}
+
+// staleFence checks if a write of a fence would lower its token.
+// The caller must hold the lock.
+func (s *Storage) staleFence(cmd *command) bool {
+	if cmd.Kind != kindFences || cmd.Op != opSave {
+		return false
+	}
+
+	var fence Fence
+	if err := json.Unmarshal(cmd.Value, &fence); err != nil {
+		return false
+	}
+	return s.checkFence(cmd.Key, fence.Token) != nil
+}
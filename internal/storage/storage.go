@@ -10,6 +10,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/your-server-support/podman-swarm/internal/security"
 	"github.com/your-server-support/podman-swarm/internal/types"
 )
 
@@ -19,16 +20,39 @@ type Storage struct {
 	logger       *logrus.Logger
 	mu           sync.RWMutex
 	deployments  map[string]*types.Deployment
+	statefulSets map[string]*types.StatefulSet
+	daemonSets   map[string]*types.DaemonSet
+	jobs         map[string]*types.Job
+	cronJobs     map[string]*types.CronJob
 	services     map[string]*types.Service
 	ingresses    map[string]*types.Ingress
 	pods         map[string]*types.Pod
+	podStatuses  map[string]*types.PodStatus // Pod ID -> status reported by the node running the pod
+	configMaps   map[string]*types.ConfigMap
+	secrets      map[string]*types.Secret // Encrypted
+	claims       map[string]*types.PersistentVolumeClaim
+	budgets      map[string]*types.PodDisruptionBudget
+	apiTokens    map[string]*security.APIToken // Hash -> token without its value
+	roles        map[string]*types.Role        // Cluster roles are stored under /name
+	roleBindings map[string]*types.RoleBinding // Cluster role bindings are stored under /name
+	accounts     map[string]*types.ServiceAccount
+	revocations  map[string]*security.JoinTokenRevocation // Id -> revoked join token
+	fences       map[string]*Fence                        // Lease -> highest accepted fencing token
+	encryptor    *security.Encryptor
+	replicator   Replicator // Replicates writes through consensus, nil to sync by gossip
+	nodeName     string
+	versions     map[string]*ObjectVersion // "kind/namespace/name" -> version, including tombstones
+	clock        uint64                    // Highest resource version seen
+	pending      map[string]bool           // Versions changed locally since the last broadcast
 	lastModified time.Time
 }
 
 // StorageConfig holds storage configuration
 type StorageConfig struct {
-	DataDir string
-	Logger  *logrus.Logger
+	DataDir   string
+	Encryptor *security.Encryptor // Encrypts secrets at rest, required to store secrets
+	NodeName  string              // Recorded in the versions of local writes
+	Logger    *logrus.Logger
 }
 
 // NewStorage creates a new storage instance
@@ -43,12 +67,31 @@ func NewStorage(config StorageConfig) (*Storage, error) {
 	}
 
 	s := &Storage{
-		dataDir:     config.DataDir,
-		logger:      config.Logger,
-		deployments: make(map[string]*types.Deployment),
-		services:    make(map[string]*types.Service),
-		ingresses:   make(map[string]*types.Ingress),
-		pods:        make(map[string]*types.Pod),
+		dataDir:      config.DataDir,
+		logger:       config.Logger,
+		deployments:  make(map[string]*types.Deployment),
+		statefulSets: make(map[string]*types.StatefulSet),
+		daemonSets:   make(map[string]*types.DaemonSet),
+		jobs:         make(map[string]*types.Job),
+		cronJobs:     make(map[string]*types.CronJob),
+		services:     make(map[string]*types.Service),
+		ingresses:    make(map[string]*types.Ingress),
+		pods:         make(map[string]*types.Pod),
+		podStatuses:  make(map[string]*types.PodStatus),
+		configMaps:   make(map[string]*types.ConfigMap),
+		secrets:      make(map[string]*types.Secret),
+		claims:       make(map[string]*types.PersistentVolumeClaim),
+		budgets:      make(map[string]*types.PodDisruptionBudget),
+		apiTokens:    make(map[string]*security.APIToken),
+		roles:        make(map[string]*types.Role),
+		roleBindings: make(map[string]*types.RoleBinding),
+		accounts:     make(map[string]*types.ServiceAccount),
+		revocations:  make(map[string]*security.JoinTokenRevocation),
+		fences:       make(map[string]*Fence),
+		encryptor:    config.Encryptor,
+		nodeName:     config.NodeName,
+		versions:     make(map[string]*ObjectVersion),
+		pending:      make(map[string]bool),
 	}
 
 	// Load existing state
@@ -62,228 +105,1197 @@ func NewStorage(config StorageConfig) (*Storage, error) {
 
 // SaveDeployment saves a deployment to persistent storage
 func (s *Storage) SaveDeployment(deployment *types.Deployment) error {
+	key := fmt.Sprintf("%s/%s", deployment.Namespace, deployment.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindDeployments, key, deployment)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deployments[key] = clone(deployment)
+	s.bumpVersion(kindDeployments, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetDeployment retrieves a deployment from storage
+func (s *Storage) GetDeployment(namespace, name string) (*types.Deployment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	deployment, ok := s.deployments[key]
+	if !ok {
+		return nil, fmt.Errorf("deployment not found: %s/%s", namespace, name)
+	}
+
+	copied := clone(deployment)
+	s.applyPodStatuses(copied.Pods)
+	return copied, nil
+}
+
+// DeleteDeployment removes a deployment from storage
+func (s *Storage) DeleteDeployment(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindDeployments, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.deployments, key)
+	s.bumpVersion(kindDeployments, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListDeployments returns all deployments
+func (s *Storage) ListDeployments() []*types.Deployment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deployments := make([]*types.Deployment, 0, len(s.deployments))
+	for _, d := range s.deployments {
+		copied := clone(d)
+		s.applyPodStatuses(copied.Pods)
+		deployments = append(deployments, copied)
+	}
+
+	return deployments
+}
+
+// SaveStatefulSet saves a stateful set to persistent storage
+func (s *Storage) SaveStatefulSet(statefulSet *types.StatefulSet) error {
+	key := fmt.Sprintf("%s/%s", statefulSet.Namespace, statefulSet.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindStatefulSets, key, statefulSet)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statefulSets[key] = clone(statefulSet)
+	s.bumpVersion(kindStatefulSets, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetStatefulSet retrieves a stateful set from storage
+func (s *Storage) GetStatefulSet(namespace, name string) (*types.StatefulSet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	statefulSet, ok := s.statefulSets[key]
+	if !ok {
+		return nil, fmt.Errorf("stateful set not found: %s/%s", namespace, name)
+	}
+
+	copied := clone(statefulSet)
+	s.applyPodStatuses(copied.Pods)
+	return copied, nil
+}
+
+// DeleteStatefulSet removes a stateful set from storage
+func (s *Storage) DeleteStatefulSet(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindStatefulSets, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.statefulSets, key)
+	s.bumpVersion(kindStatefulSets, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListStatefulSets returns all stateful sets
+func (s *Storage) ListStatefulSets() []*types.StatefulSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statefulSets := make([]*types.StatefulSet, 0, len(s.statefulSets))
+	for _, set := range s.statefulSets {
+		copied := clone(set)
+		s.applyPodStatuses(copied.Pods)
+		statefulSets = append(statefulSets, copied)
+	}
+
+	return statefulSets
+}
+
+// SaveDaemonSet saves a daemon set to persistent storage
+func (s *Storage) SaveDaemonSet(daemonSet *types.DaemonSet) error {
+	key := fmt.Sprintf("%s/%s", daemonSet.Namespace, daemonSet.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindDaemonSets, key, daemonSet)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.daemonSets[key] = clone(daemonSet)
+	s.bumpVersion(kindDaemonSets, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetDaemonSet retrieves a daemon set from storage
+func (s *Storage) GetDaemonSet(namespace, name string) (*types.DaemonSet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	daemonSet, ok := s.daemonSets[key]
+	if !ok {
+		return nil, fmt.Errorf("daemon set not found: %s/%s", namespace, name)
+	}
+
+	copied := clone(daemonSet)
+	s.applyPodStatuses(copied.Pods)
+	return copied, nil
+}
+
+// DeleteDaemonSet removes a daemon set from storage
+func (s *Storage) DeleteDaemonSet(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindDaemonSets, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.daemonSets, key)
+	s.bumpVersion(kindDaemonSets, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListDaemonSets returns all daemon sets
+func (s *Storage) ListDaemonSets() []*types.DaemonSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	daemonSets := make([]*types.DaemonSet, 0, len(s.daemonSets))
+	for _, ds := range s.daemonSets {
+		copied := clone(ds)
+		s.applyPodStatuses(copied.Pods)
+		daemonSets = append(daemonSets, copied)
+	}
+
+	return daemonSets
+}
+
+// SaveJob saves a job to persistent storage
+func (s *Storage) SaveJob(job *types.Job) error {
+	key := fmt.Sprintf("%s/%s", job.Namespace, job.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindJobs, key, job)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[key] = clone(job)
+	s.bumpVersion(kindJobs, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetJob retrieves a job from storage
+func (s *Storage) GetJob(namespace, name string) (*types.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	job, ok := s.jobs[key]
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s/%s", namespace, name)
+	}
+
+	copied := clone(job)
+	s.applyPodStatuses(copied.Pods)
+	return copied, nil
+}
+
+// DeleteJob removes a job from storage
+func (s *Storage) DeleteJob(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindJobs, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, key)
+	s.bumpVersion(kindJobs, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListJobs returns all jobs
+func (s *Storage) ListJobs() []*types.Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]*types.Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		copied := clone(job)
+		s.applyPodStatuses(copied.Pods)
+		jobs = append(jobs, copied)
+	}
+
+	return jobs
+}
+
+// SaveCronJob saves a cron job to persistent storage
+func (s *Storage) SaveCronJob(cronJob *types.CronJob) error {
+	key := fmt.Sprintf("%s/%s", cronJob.Namespace, cronJob.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindCronJobs, key, cronJob)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cronJobs[key] = clone(cronJob)
+	s.bumpVersion(kindCronJobs, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetCronJob retrieves a cron job from storage
+func (s *Storage) GetCronJob(namespace, name string) (*types.CronJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	cronJob, ok := s.cronJobs[key]
+	if !ok {
+		return nil, fmt.Errorf("cron job not found: %s/%s", namespace, name)
+	}
+
+	return clone(cronJob), nil
+}
+
+// DeleteCronJob removes a cron job from storage
+func (s *Storage) DeleteCronJob(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindCronJobs, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cronJobs, key)
+	s.bumpVersion(kindCronJobs, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListCronJobs returns all cron jobs
+func (s *Storage) ListCronJobs() []*types.CronJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cronJobs := make([]*types.CronJob, 0, len(s.cronJobs))
+	for _, cronJob := range s.cronJobs {
+		cronJobs = append(cronJobs, clone(cronJob))
+	}
+
+	return cronJobs
+}
+
+// SaveService saves a service to persistent storage
+func (s *Storage) SaveService(service *types.Service) error {
+	key := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindServices, key, service)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.services[key] = clone(service)
+	s.bumpVersion(kindServices, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetService retrieves a service from storage
+func (s *Storage) GetService(namespace, name string) (*types.Service, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	service, ok := s.services[key]
+	if !ok {
+		return nil, fmt.Errorf("service not found: %s/%s", namespace, name)
+	}
+
+	return clone(service), nil
+}
+
+// DeleteService removes a service from storage
+func (s *Storage) DeleteService(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindServices, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.services, key)
+	s.bumpVersion(kindServices, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListServices returns all services
+func (s *Storage) ListServices() []*types.Service {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	services := make([]*types.Service, 0, len(s.services))
+	for _, svc := range s.services {
+		services = append(services, clone(svc))
+	}
+
+	return services
+}
+
+// SaveIngress saves an ingress to persistent storage
+func (s *Storage) SaveIngress(ingress *types.Ingress) error {
+	key := fmt.Sprintf("%s/%s", ingress.Namespace, ingress.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindIngresses, key, ingress)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ingresses[key] = clone(ingress)
+	s.bumpVersion(kindIngresses, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetIngress retrieves an ingress from storage
+func (s *Storage) GetIngress(namespace, name string) (*types.Ingress, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	ingress, ok := s.ingresses[key]
+	if !ok {
+		return nil, fmt.Errorf("ingress not found: %s/%s", namespace, name)
+	}
+
+	return clone(ingress), nil
+}
+
+// DeleteIngress removes an ingress from storage
+func (s *Storage) DeleteIngress(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindIngresses, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.ingresses, key)
+	s.bumpVersion(kindIngresses, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListIngresses returns all ingresses
+func (s *Storage) ListIngresses() []*types.Ingress {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ingresses := make([]*types.Ingress, 0, len(s.ingresses))
+	for _, ing := range s.ingresses {
+		ingresses = append(ingresses, clone(ing))
+	}
+
+	return ingresses
+}
+
+// SavePod saves a pod to persistent storage
+func (s *Storage) SavePod(pod *types.Pod) error {
+	key := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindPods, key, pod)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pods[key] = clone(pod)
+	s.bumpVersion(kindPods, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetPod retrieves a pod from storage
+func (s *Storage) GetPod(namespace, name string) (*types.Pod, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	pod, ok := s.pods[key]
+	if !ok {
+		return nil, fmt.Errorf("pod not found: %s/%s", namespace, name)
+	}
+
+	return clone(pod), nil
+}
+
+// DeletePod removes a pod from storage
+func (s *Storage) DeletePod(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindPods, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pods, key)
+	s.bumpVersion(kindPods, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListPods returns all pods
+func (s *Storage) ListPods() []*types.Pod {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pods := make([]*types.Pod, 0, len(s.pods))
+	for _, pod := range s.pods {
+		pods = append(pods, clone(pod))
+	}
+
+	return pods
+}
+
+// SavePodStatus saves the status of a pod reported by the node running it
+func (s *Storage) SavePodStatus(status *types.PodStatus) error {
+	if s.replicator != nil {
+		return s.replicate(opSave, kindPodStatuses, status.ID, status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.podStatuses[status.ID] = clone(status)
+	s.bumpVersion(kindPodStatuses, status.ID, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// DeletePodStatus removes the status of a pod by the pod ID
+func (s *Storage) DeletePodStatus(id string) error {
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindPodStatuses, id, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.podStatuses, id)
+	s.bumpVersion(kindPodStatuses, id, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListPodStatuses returns the statuses of all pods
+func (s *Storage) ListPodStatuses() []*types.PodStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make([]*types.PodStatus, 0, len(s.podStatuses))
+	for _, status := range s.podStatuses {
+		statuses = append(statuses, clone(status))
+	}
+
+	return statuses
+}
+
+// applyPodStatuses sets the status of the pods of a workload to the statuses
+// reported by the nodes running them. Statuses of a node a pod was moved away
+// from are ignored. The caller must hold the lock.
+func (s *Storage) applyPodStatuses(pods []*types.Pod) {
+	for _, pod := range pods {
+		status, ok := s.podStatuses[pod.ID]
+		if !ok || status.NodeName != pod.NodeName {
+			continue
+		}
+		pod.PodmanID = status.PodmanID
+		pod.State = status.State
+		pod.Ready = status.Ready
+		pod.Reason = status.Reason
+		pod.RestartCount = status.RestartCount
+		pod.LastTermination = clone(status.LastTermination)
+		pod.ContainerStatuses = *clone(&status.ContainerStatuses)
+	}
+}
+
+// SaveConfigMap saves a config map to persistent storage
+func (s *Storage) SaveConfigMap(configMap *types.ConfigMap) error {
+	key := fmt.Sprintf("%s/%s", configMap.Namespace, configMap.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindConfigMaps, key, configMap)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.configMaps[key] = clone(configMap)
+	s.bumpVersion(kindConfigMaps, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetConfigMap retrieves a config map from storage
+func (s *Storage) GetConfigMap(namespace, name string) (*types.ConfigMap, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	configMap, ok := s.configMaps[key]
+	if !ok {
+		return nil, fmt.Errorf("config map not found: %s/%s", namespace, name)
+	}
+
+	return clone(configMap), nil
+}
+
+// DeleteConfigMap removes a config map from storage
+func (s *Storage) DeleteConfigMap(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindConfigMaps, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.configMaps, key)
+	s.bumpVersion(kindConfigMaps, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListConfigMaps returns all config maps
+func (s *Storage) ListConfigMaps() []*types.ConfigMap {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	configMaps := make([]*types.ConfigMap, 0, len(s.configMaps))
+	for _, cm := range s.configMaps {
+		configMaps = append(configMaps, clone(cm))
+	}
+
+	return configMaps
+}
+
+// SaveSecret encrypts a secret and saves it to persistent storage.
+// The plaintext data is neither persisted nor replicated.
+func (s *Storage) SaveSecret(secret *types.Secret) error {
+	if s.encryptor == nil {
+		return fmt.Errorf("secret encryption is not configured")
+	}
+
+	data, err := json.Marshal(secret.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret data: %w", err)
+	}
+	encrypted, err := s.encryptor.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	stored := clone(secret)
+	stored.Data = nil
+	stored.EncryptedData = encrypted
+
+	key := fmt.Sprintf("%s/%s", secret.Namespace, secret.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindSecrets, key, stored)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.secrets[key] = stored
+	s.bumpVersion(kindSecrets, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetSecret retrieves and decrypts a secret from storage
+func (s *Storage) GetSecret(namespace, name string) (*types.Secret, error) {
+	s.mu.RLock()
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	stored, ok := s.secrets[key]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("secret not found: %s/%s", namespace, name)
+	}
+	if s.encryptor == nil {
+		return nil, fmt.Errorf("secret encryption is not configured")
+	}
+
+	data, err := s.encryptor.Decrypt(stored.EncryptedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret %s: %w", key, err)
+	}
+
+	secret := clone(stored)
+	secret.EncryptedData = nil
+	if err := json.Unmarshal(data, &secret.Data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret data: %w", err)
+	}
+
+	return secret, nil
+}
+
+// ReencryptSecrets encrypts all secrets again with the primary key, so that
+// the keys they were encrypted with before can be removed
+func (s *Storage) ReencryptSecrets() error {
+	for _, stored := range s.ListSecrets() {
+		secret, err := s.GetSecret(stored.Namespace, stored.Name)
+		if err != nil {
+			return err
+		}
+		if err := s.SaveSecret(secret); err != nil {
+			return fmt.Errorf("failed to save secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+	}
+	return nil
+}
+
+// DeleteSecret removes a secret from storage
+func (s *Storage) DeleteSecret(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindSecrets, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.secrets, key)
+	s.bumpVersion(kindSecrets, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListSecrets returns all secrets without their data
+func (s *Storage) ListSecrets() []*types.Secret {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	secrets := make([]*types.Secret, 0, len(s.secrets))
+	for _, stored := range s.secrets {
+		secret := clone(stored)
+		secret.EncryptedData = nil
+		secrets = append(secrets, secret)
+	}
+
+	return secrets
+}
+
+// SavePersistentVolumeClaim saves a persistent volume claim to persistent storage
+func (s *Storage) SavePersistentVolumeClaim(claim *types.PersistentVolumeClaim) error {
+	key := fmt.Sprintf("%s/%s", claim.Namespace, claim.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindClaims, key, claim)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.claims[key] = clone(claim)
+	s.bumpVersion(kindClaims, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetPersistentVolumeClaim retrieves a persistent volume claim from storage
+func (s *Storage) GetPersistentVolumeClaim(namespace, name string) (*types.PersistentVolumeClaim, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	claim, ok := s.claims[key]
+	if !ok {
+		return nil, fmt.Errorf("persistent volume claim not found: %s/%s", namespace, name)
+	}
+
+	return clone(claim), nil
+}
+
+// DeletePersistentVolumeClaim removes a persistent volume claim from storage
+func (s *Storage) DeletePersistentVolumeClaim(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindClaims, key, nil)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	key := fmt.Sprintf("%s/%s", deployment.Namespace, deployment.Name)
-	s.deployments[key] = deployment
+	delete(s.claims, key)
+	s.bumpVersion(kindClaims, key, true)
 	s.lastModified = time.Now()
 
 	return s.persist()
 }
 
-// GetDeployment retrieves a deployment from storage
-func (s *Storage) GetDeployment(namespace, name string) (*types.Deployment, error) {
+// ListPersistentVolumeClaims returns all persistent volume claims
+func (s *Storage) ListPersistentVolumeClaims() []*types.PersistentVolumeClaim {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	claims := make([]*types.PersistentVolumeClaim, 0, len(s.claims))
+	for _, claim := range s.claims {
+		claims = append(claims, clone(claim))
+	}
+
+	return claims
+}
+
+// SavePodDisruptionBudget saves a pod disruption budget to persistent storage
+func (s *Storage) SavePodDisruptionBudget(budget *types.PodDisruptionBudget) error {
+	key := fmt.Sprintf("%s/%s", budget.Namespace, budget.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindBudgets, key, budget)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.budgets[key] = clone(budget)
+	s.bumpVersion(kindBudgets, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetPodDisruptionBudget retrieves a pod disruption budget from storage
+func (s *Storage) GetPodDisruptionBudget(namespace, name string) (*types.PodDisruptionBudget, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	key := fmt.Sprintf("%s/%s", namespace, name)
-	deployment, ok := s.deployments[key]
+	budget, ok := s.budgets[key]
 	if !ok {
-		return nil, fmt.Errorf("deployment not found: %s/%s", namespace, name)
+		return nil, fmt.Errorf("pod disruption budget not found: %s/%s", namespace, name)
 	}
 
-	return deployment, nil
+	return clone(budget), nil
 }
 
-// DeleteDeployment removes a deployment from storage
-func (s *Storage) DeleteDeployment(namespace, name string) error {
+// DeletePodDisruptionBudget removes a pod disruption budget from storage
+func (s *Storage) DeletePodDisruptionBudget(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindBudgets, key, nil)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	key := fmt.Sprintf("%s/%s", namespace, name)
-	delete(s.deployments, key)
+	delete(s.budgets, key)
+	s.bumpVersion(kindBudgets, key, true)
 	s.lastModified = time.Now()
 
 	return s.persist()
 }
 
-// ListDeployments returns all deployments
-func (s *Storage) ListDeployments() []*types.Deployment {
+// ListPodDisruptionBudgets returns all pod disruption budgets
+func (s *Storage) ListPodDisruptionBudgets() []*types.PodDisruptionBudget {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	deployments := make([]*types.Deployment, 0, len(s.deployments))
-	for _, d := range s.deployments {
-		deployments = append(deployments, d)
+	budgets := make([]*types.PodDisruptionBudget, 0, len(s.budgets))
+	for _, budget := range s.budgets {
+		budgets = append(budgets, clone(budget))
 	}
 
-	return deployments
+	return budgets
 }
 
-// SaveService saves a service to persistent storage
-func (s *Storage) SaveService(service *types.Service) error {
+// SaveAPIToken saves an API token to persistent storage. Only the hash of
+// the token is stored.
+func (s *Storage) SaveAPIToken(token *security.APIToken) error {
+	if token.Token != "" {
+		return fmt.Errorf("refusing to store the value of API token %s", token.Name)
+	}
+	if s.replicator != nil {
+		return s.replicate(opSave, kindAPITokens, token.Hash, token)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	key := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
-	s.services[key] = service
+	s.apiTokens[token.Hash] = clone(token)
+	s.bumpVersion(kindAPITokens, token.Hash, false)
 	s.lastModified = time.Now()
 
 	return s.persist()
 }
 
-// GetService retrieves a service from storage
-func (s *Storage) GetService(namespace, name string) (*types.Service, error) {
+// GetAPIToken retrieves an API token by its hash
+func (s *Storage) GetAPIToken(hash string) (*security.APIToken, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	key := fmt.Sprintf("%s/%s", namespace, name)
-	service, ok := s.services[key]
+	token, ok := s.apiTokens[hash]
 	if !ok {
-		return nil, fmt.Errorf("service not found: %s/%s", namespace, name)
+		return nil, fmt.Errorf("API token not found")
 	}
 
-	return service, nil
+	return clone(token), nil
 }
 
-// DeleteService removes a service from storage
-func (s *Storage) DeleteService(namespace, name string) error {
+// DeleteAPIToken removes an API token by its hash
+func (s *Storage) DeleteAPIToken(hash string) error {
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindAPITokens, hash, nil)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	key := fmt.Sprintf("%s/%s", namespace, name)
-	delete(s.services, key)
+	delete(s.apiTokens, hash)
+	s.bumpVersion(kindAPITokens, hash, true)
 	s.lastModified = time.Now()
 
 	return s.persist()
 }
 
-// ListServices returns all services
-func (s *Storage) ListServices() []*types.Service {
+// ListAPITokens returns all API tokens
+func (s *Storage) ListAPITokens() []*security.APIToken {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	services := make([]*types.Service, 0, len(s.services))
-	for _, svc := range s.services {
-		services = append(services, svc)
+	tokens := make([]*security.APIToken, 0, len(s.apiTokens))
+	for _, token := range s.apiTokens {
+		tokens = append(tokens, clone(token))
 	}
 
-	return services
+	return tokens
 }
 
-// SaveIngress saves an ingress to persistent storage
-func (s *Storage) SaveIngress(ingress *types.Ingress) error {
+// SaveJoinTokenRevocation saves the revocation of a join token
+func (s *Storage) SaveJoinTokenRevocation(revocation *security.JoinTokenRevocation) error {
+	if s.replicator != nil {
+		return s.replicate(opSave, kindRevocations, revocation.ID, revocation)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	key := fmt.Sprintf("%s/%s", ingress.Namespace, ingress.Name)
-	s.ingresses[key] = ingress
+	s.revocations[revocation.ID] = clone(revocation)
+	s.bumpVersion(kindRevocations, revocation.ID, false)
 	s.lastModified = time.Now()
 
 	return s.persist()
 }
 
-// GetIngress retrieves an ingress from storage
-func (s *Storage) GetIngress(namespace, name string) (*types.Ingress, error) {
+// GetJoinTokenRevocation retrieves the revocation of a join token by its id
+func (s *Storage) GetJoinTokenRevocation(id string) (*security.JoinTokenRevocation, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	key := fmt.Sprintf("%s/%s", namespace, name)
-	ingress, ok := s.ingresses[key]
+	revocation, ok := s.revocations[id]
 	if !ok {
-		return nil, fmt.Errorf("ingress not found: %s/%s", namespace, name)
+		return nil, fmt.Errorf("join token revocation not found")
 	}
 
-	return ingress, nil
+	return clone(revocation), nil
 }
 
-// DeleteIngress removes an ingress from storage
-func (s *Storage) DeleteIngress(namespace, name string) error {
+// DeleteJoinTokenRevocation removes the revocation of a join token by its id
+func (s *Storage) DeleteJoinTokenRevocation(id string) error {
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindRevocations, id, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.revocations, id)
+	s.bumpVersion(kindRevocations, id, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListJoinTokenRevocations returns the revocations of join tokens
+func (s *Storage) ListJoinTokenRevocations() []*security.JoinTokenRevocation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revocations := make([]*security.JoinTokenRevocation, 0, len(s.revocations))
+	for _, revocation := range s.revocations {
+		revocations = append(revocations, clone(revocation))
+	}
+
+	return revocations
+}
+
+// SaveRole saves a role to persistent storage, cluster roles have no namespace
+func (s *Storage) SaveRole(role *types.Role) error {
+	key := fmt.Sprintf("%s/%s", role.Namespace, role.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindRoles, key, role)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.roles[key] = clone(role)
+	s.bumpVersion(kindRoles, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetRole retrieves a role from storage
+func (s *Storage) GetRole(namespace, name string) (*types.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	key := fmt.Sprintf("%s/%s", namespace, name)
-	delete(s.ingresses, key)
+	role, ok := s.roles[key]
+	if !ok {
+		return nil, fmt.Errorf("role not found: %s/%s", namespace, name)
+	}
+
+	return clone(role), nil
+}
+
+// DeleteRole removes a role from storage
+func (s *Storage) DeleteRole(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindRoles, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.roles, key)
+	s.bumpVersion(kindRoles, key, true)
 	s.lastModified = time.Now()
 
 	return s.persist()
 }
 
-// ListIngresses returns all ingresses
-func (s *Storage) ListIngresses() []*types.Ingress {
+// ListRoles returns all roles including the cluster roles
+func (s *Storage) ListRoles() []*types.Role {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	ingresses := make([]*types.Ingress, 0, len(s.ingresses))
-	for _, ing := range s.ingresses {
-		ingresses = append(ingresses, ing)
+	roles := make([]*types.Role, 0, len(s.roles))
+	for _, role := range s.roles {
+		roles = append(roles, clone(role))
 	}
 
-	return ingresses
+	return roles
 }
 
-// SavePod saves a pod to persistent storage
-func (s *Storage) SavePod(pod *types.Pod) error {
+// SaveRoleBinding saves a role binding to persistent storage, cluster role bindings have no namespace
+func (s *Storage) SaveRoleBinding(binding *types.RoleBinding) error {
+	key := fmt.Sprintf("%s/%s", binding.Namespace, binding.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindRoleBindings, key, binding)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	key := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
-	s.pods[key] = pod
+	s.roleBindings[key] = clone(binding)
+	s.bumpVersion(kindRoleBindings, key, false)
 	s.lastModified = time.Now()
 
 	return s.persist()
 }
 
-// GetPod retrieves a pod from storage
-func (s *Storage) GetPod(namespace, name string) (*types.Pod, error) {
+// GetRoleBinding retrieves a role binding from storage
+func (s *Storage) GetRoleBinding(namespace, name string) (*types.RoleBinding, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	key := fmt.Sprintf("%s/%s", namespace, name)
-	pod, ok := s.pods[key]
+	binding, ok := s.roleBindings[key]
 	if !ok {
-		return nil, fmt.Errorf("pod not found: %s/%s", namespace, name)
+		return nil, fmt.Errorf("role binding not found: %s/%s", namespace, name)
 	}
 
-	return pod, nil
+	return clone(binding), nil
 }
 
-// DeletePod removes a pod from storage
-func (s *Storage) DeletePod(namespace, name string) error {
+// DeleteRoleBinding removes a role binding from storage
+func (s *Storage) DeleteRoleBinding(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindRoleBindings, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.roleBindings, key)
+	s.bumpVersion(kindRoleBindings, key, true)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// ListRoleBindings returns all role bindings including the cluster role bindings
+func (s *Storage) ListRoleBindings() []*types.RoleBinding {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roleBindings := make([]*types.RoleBinding, 0, len(s.roleBindings))
+	for _, binding := range s.roleBindings {
+		roleBindings = append(roleBindings, clone(binding))
+	}
+
+	return roleBindings
+}
+
+// SaveServiceAccount saves a service account to persistent storage
+func (s *Storage) SaveServiceAccount(account *types.ServiceAccount) error {
+	key := fmt.Sprintf("%s/%s", account.Namespace, account.Name)
+	if s.replicator != nil {
+		return s.replicate(opSave, kindAccounts, key, account)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.accounts[key] = clone(account)
+	s.bumpVersion(kindAccounts, key, false)
+	s.lastModified = time.Now()
+
+	return s.persist()
+}
+
+// GetServiceAccount retrieves a service account from storage
+func (s *Storage) GetServiceAccount(namespace, name string) (*types.ServiceAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	key := fmt.Sprintf("%s/%s", namespace, name)
-	delete(s.pods, key)
+	account, ok := s.accounts[key]
+	if !ok {
+		return nil, fmt.Errorf("service account not found: %s/%s", namespace, name)
+	}
+
+	return clone(account), nil
+}
+
+// DeleteServiceAccount removes a service account from storage
+func (s *Storage) DeleteServiceAccount(namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if s.replicator != nil {
+		return s.replicate(opDelete, kindAccounts, key, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.accounts, key)
+	s.bumpVersion(kindAccounts, key, true)
 	s.lastModified = time.Now()
 
 	return s.persist()
 }
 
-// ListPods returns all pods
-func (s *Storage) ListPods() []*types.Pod {
+// ListServiceAccounts returns all service accounts
+func (s *Storage) ListServiceAccounts() []*types.ServiceAccount {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	pods := make([]*types.Pod, 0, len(s.pods))
-	for _, pod := range s.pods {
-		pods = append(pods, pod)
+	accounts := make([]*types.ServiceAccount, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, clone(account))
 	}
 
-	return pods
+	return accounts
 }
 
 // ClusterState represents the complete cluster state
 type ClusterState struct {
-	Deployments  map[string]*types.Deployment `json:"deployments"`
-	Services     map[string]*types.Service    `json:"services"`
-	Ingresses    map[string]*types.Ingress    `json:"ingresses"`
-	Pods         map[string]*types.Pod        `json:"pods"`
-	LastModified time.Time                    `json:"last_modified"`
-	Version      int                          `json:"version"`
+	Deployments  map[string]*types.Deployment             `json:"deployments"`
+	StatefulSets map[string]*types.StatefulSet            `json:"stateful_sets"`
+	DaemonSets   map[string]*types.DaemonSet              `json:"daemon_sets"`
+	Jobs         map[string]*types.Job                    `json:"jobs"`
+	CronJobs     map[string]*types.CronJob                `json:"cron_jobs"`
+	Services     map[string]*types.Service                `json:"services"`
+	Ingresses    map[string]*types.Ingress                `json:"ingresses"`
+	Pods         map[string]*types.Pod                    `json:"pods"`
+	PodStatuses  map[string]*types.PodStatus              `json:"pod_statuses"`
+	ConfigMaps   map[string]*types.ConfigMap              `json:"config_maps"`
+	Secrets      map[string]*types.Secret                 `json:"secrets"`
+	Claims       map[string]*types.PersistentVolumeClaim  `json:"persistent_volume_claims"`
+	Budgets      map[string]*types.PodDisruptionBudget    `json:"pod_disruption_budgets"`
+	APITokens    map[string]*security.APIToken            `json:"api_tokens"`
+	Roles        map[string]*types.Role                   `json:"roles"`
+	RoleBindings map[string]*types.RoleBinding            `json:"role_bindings"`
+	Accounts     map[string]*types.ServiceAccount         `json:"service_accounts"`
+	Revocations  map[string]*security.JoinTokenRevocation `json:"join_token_revocations"`
+	Fences       map[string]*Fence                        `json:"fences"`
+	Versions     map[string]*ObjectVersion                `json:"versions,omitempty"`
+	LastModified time.Time                                `json:"last_modified"`
+	Version      int                                      `json:"version"`
 }
 
 // persist writes the current state to disk
 func (s *Storage) persist() error {
-	state := ClusterState{
-		Deployments:  s.deployments,
-		Services:     s.services,
-		Ingresses:    s.ingresses,
-		Pods:         s.pods,
-		LastModified: s.lastModified,
-		Version:      1,
-	}
+	state := s.currentState()
 
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
@@ -327,11 +1339,40 @@ func (s *Storage) Load() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.setState(&state)
+	s.logger.Infof("Loaded state: %d deployments, %d stateful sets, %d daemon sets, %d jobs, %d cron jobs, %d services, %d ingresses, %d pods, %d config maps, %d secrets, %d volume claims, %d disruption budgets, %d API tokens, %d roles, %d role bindings, %d service accounts, %d revoked join tokens",
+		len(s.deployments), len(s.statefulSets), len(s.daemonSets), len(s.jobs), len(s.cronJobs), len(s.services), len(s.ingresses), len(s.pods), len(s.configMaps), len(s.secrets), len(s.claims), len(s.budgets), len(s.apiTokens), len(s.roles), len(s.roleBindings), len(s.accounts), len(s.revocations))
+
+	return nil
+}
+
+// setState replaces the stored objects with those of state
+func (s *Storage) setState(state *ClusterState) {
 	s.deployments = state.Deployments
 	if s.deployments == nil {
 		s.deployments = make(map[string]*types.Deployment)
 	}
 
+	s.statefulSets = state.StatefulSets
+	if s.statefulSets == nil {
+		s.statefulSets = make(map[string]*types.StatefulSet)
+	}
+
+	s.daemonSets = state.DaemonSets
+	if s.daemonSets == nil {
+		s.daemonSets = make(map[string]*types.DaemonSet)
+	}
+
+	s.jobs = state.Jobs
+	if s.jobs == nil {
+		s.jobs = make(map[string]*types.Job)
+	}
+
+	s.cronJobs = state.CronJobs
+	if s.cronJobs == nil {
+		s.cronJobs = make(map[string]*types.CronJob)
+	}
+
 	s.services = state.Services
 	if s.services == nil {
 		s.services = make(map[string]*types.Service)
@@ -347,86 +1388,119 @@ func (s *Storage) Load() error {
 		s.pods = make(map[string]*types.Pod)
 	}
 
-	s.lastModified = state.LastModified
+	s.podStatuses = state.PodStatuses
+	if s.podStatuses == nil {
+		s.podStatuses = make(map[string]*types.PodStatus)
+	}
 
-	s.logger.Infof("Loaded state: %d deployments, %d services, %d ingresses, %d pods",
-		len(s.deployments), len(s.services), len(s.ingresses), len(s.pods))
+	s.configMaps = state.ConfigMaps
+	if s.configMaps == nil {
+		s.configMaps = make(map[string]*types.ConfigMap)
+	}
 
-	return nil
-}
+	s.secrets = state.Secrets
+	if s.secrets == nil {
+		s.secrets = make(map[string]*types.Secret)
+	}
 
-// GetState returns the current cluster state for synchronization
-func (s *Storage) GetState() *ClusterState {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.claims = state.Claims
+	if s.claims == nil {
+		s.claims = make(map[string]*types.PersistentVolumeClaim)
+	}
 
-	return &ClusterState{
-		Deployments:  s.deployments,
-		Services:     s.services,
-		Ingresses:    s.ingresses,
-		Pods:         s.pods,
-		LastModified: s.lastModified,
-		Version:      1,
+	s.budgets = state.Budgets
+	if s.budgets == nil {
+		s.budgets = make(map[string]*types.PodDisruptionBudget)
 	}
-}
 
-// MergeState merges incoming state with local state
-// Used for peer-to-peer synchronization
-func (s *Storage) MergeState(incomingState *ClusterState) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.apiTokens = state.APITokens
+	if s.apiTokens == nil {
+		s.apiTokens = make(map[string]*security.APIToken)
+	}
 
-	// Simple merge strategy: use incoming state if it's newer
-	if incomingState.LastModified.After(s.lastModified) {
-		s.logger.Infof("Merging newer state from peer (incoming: %s, local: %s)",
-			incomingState.LastModified, s.lastModified)
+	s.roles = state.Roles
+	if s.roles == nil {
+		s.roles = make(map[string]*types.Role)
+	}
 
-		// Merge deployments
-		for key, deployment := range incomingState.Deployments {
-			s.deployments[key] = deployment
-		}
+	s.roleBindings = state.RoleBindings
+	if s.roleBindings == nil {
+		s.roleBindings = make(map[string]*types.RoleBinding)
+	}
 
-		// Merge services
-		for key, service := range incomingState.Services {
-			s.services[key] = service
-		}
+	s.accounts = state.Accounts
+	if s.accounts == nil {
+		s.accounts = make(map[string]*types.ServiceAccount)
+	}
 
-		// Merge ingresses
-		for key, ingress := range incomingState.Ingresses {
-			s.ingresses[key] = ingress
-		}
+	s.revocations = state.Revocations
+	if s.revocations == nil {
+		s.revocations = make(map[string]*security.JoinTokenRevocation)
+	}
 
-		// Note: Pods are typically node-specific, so we might want different logic here
-		// For now, we'll merge them as well
-		for key, pod := range incomingState.Pods {
-			if existing, ok := s.pods[key]; !ok || pod.CreatedAt > existing.CreatedAt {
-				s.pods[key] = pod
-			}
-		}
+	s.fences = state.Fences
+	if s.fences == nil {
+		s.fences = make(map[string]*Fence)
+	}
 
-		s.lastModified = time.Now()
-		return s.persist()
+	s.versions = state.Versions
+	if s.versions == nil {
+		s.versions = make(map[string]*ObjectVersion)
+	}
+	s.clock = 0
+	for _, version := range s.versions {
+		s.clock = max(s.clock, version.ResourceVersion)
 	}
+	s.versionUnversioned()
 
-	return nil
+	s.lastModified = state.LastModified
 }
 
-// Backup creates a backup of the current state
-func (s *Storage) Backup() error {
+// GetState returns the current cluster state for synchronization
+func (s *Storage) GetState() *ClusterState {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	timestamp := time.Now().Format("20060102-150405")
-	backupFile := filepath.Join(s.dataDir, fmt.Sprintf("state-backup-%s.json", timestamp))
+	return s.currentState()
+}
 
-	state := ClusterState{
+// currentState returns the current cluster state, the caller must hold the lock
+func (s *Storage) currentState() *ClusterState {
+	return &ClusterState{
 		Deployments:  s.deployments,
+		StatefulSets: s.statefulSets,
+		DaemonSets:   s.daemonSets,
+		Jobs:         s.jobs,
+		CronJobs:     s.cronJobs,
 		Services:     s.services,
 		Ingresses:    s.ingresses,
 		Pods:         s.pods,
+		PodStatuses:  s.podStatuses,
+		ConfigMaps:   s.configMaps,
+		Secrets:      s.secrets,
+		Claims:       s.claims,
+		Budgets:      s.budgets,
+		APITokens:    s.apiTokens,
+		Roles:        s.roles,
+		RoleBindings: s.roleBindings,
+		Accounts:     s.accounts,
+		Revocations:  s.revocations,
+		Fences:       s.fences,
+		Versions:     s.versions,
 		LastModified: s.lastModified,
 		Version:      1,
 	}
+}
+
+// Backup creates a backup of the current state
+func (s *Storage) Backup() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	timestamp := time.Now().Format("20060102-150405")
+	backupFile := filepath.Join(s.dataDir, fmt.Sprintf("state-backup-%s.json", timestamp))
+
+	state := s.currentState()
 
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
@@ -1,12 +1,15 @@
 package storage
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/your-server-support/podman-swarm/internal/security"
 	"github.com/your-server-support/podman-swarm/internal/types"
 )
 
@@ -220,42 +223,26 @@ func TestBackup(t *testing.T) {
 	}
 }
 
-func TestMergeState(t *testing.T) {
+func TestFullStateSyncIgnored(t *testing.T) {
 	storage, tmpDir := setupTestStorage(t)
 	defer cleanup(tmpDir)
 
-	// Create local state
-	localDeployment := &types.Deployment{
-		Name:      "local",
-		Namespace: "default",
-	}
-	storage.SaveDeployment(localDeployment)
+	storage.SaveDeployment(&types.Deployment{Name: "web", Namespace: "default", DesiredReplicas: 2})
+	storage.SaveDeployment(&types.Deployment{Name: "deleted", Namespace: "default"})
+	storage.DeleteDeployment("default", "deleted")
 
-	// Create incoming state (newer)
-	time.Sleep(10 * time.Millisecond) // Ensure newer timestamp
-	incomingState := &ClusterState{
-		Deployments: map[string]*types.Deployment{
-			"default/remote": {
-				Name:      "remote",
-				Namespace: "default",
-			},
-		},
-		Services:     make(map[string]*types.Service),
-		Ingresses:    make(map[string]*types.Ingress),
-		Pods:         make(map[string]*types.Pod),
-		LastModified: time.Now(),
-		Version:      1,
+	// The full state of a peer without object versions neither brings deleted
+	// objects back nor rolls back newer ones
+	msg := []byte(`{"type":"state_sync","state":{"deployments":{"default/deleted":{"name":"deleted","namespace":"default"},"default/web":{"name":"web","namespace":"default","desired_replicas":1}},"last_modified":"2100-01-01T00:00:00Z"}}`)
+	if err := storage.HandleStateSyncMessage(msg); err != nil {
+		t.Fatalf("Failed to handle state sync: %v", err)
 	}
 
-	err := storage.MergeState(incomingState)
-	if err != nil {
-		t.Errorf("Failed to merge state: %v", err)
+	if _, err := storage.GetDeployment("default", "deleted"); err == nil {
+		t.Error("Expected the deleted deployment to stay deleted")
 	}
-
-	// Verify both deployments exist
-	deployments := storage.ListDeployments()
-	if len(deployments) != 2 {
-		t.Errorf("Expected 2 deployments after merge, got %d", len(deployments))
+	if dep, err := storage.GetDeployment("default", "web"); err != nil || dep.DesiredReplicas != 2 {
+		t.Errorf("Expected the newer deployment to be kept, got %+v (%v)", dep, err)
 	}
 }
 
@@ -399,3 +386,268 @@ func TestSavePod(t *testing.T) {
 		t.Errorf("Expected state %v, got %v", types.PodStateRunning, retrieved.State)
 	}
 }
+
+func TestSaveConfigMap(t *testing.T) {
+	storage, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	configMap := &types.ConfigMap{
+		Name:      "app-config",
+		Namespace: "default",
+		Data:      map[string]string{"LOG_LEVEL": "debug"},
+	}
+
+	if err := storage.SaveConfigMap(configMap); err != nil {
+		t.Errorf("Failed to save config map: %v", err)
+	}
+
+	retrieved, err := storage.GetConfigMap("default", "app-config")
+	if err != nil {
+		t.Fatalf("Failed to get config map: %v", err)
+	}
+
+	if retrieved.Data["LOG_LEVEL"] != "debug" {
+		t.Errorf("Expected LOG_LEVEL=debug, got %s", retrieved.Data["LOG_LEVEL"])
+	}
+
+	storage.DeleteConfigMap("default", "app-config")
+	if _, err := storage.GetConfigMap("default", "app-config"); err == nil {
+		t.Error("Expected config map to be deleted")
+	}
+}
+
+func TestSecretEncryptedAtRest(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer cleanup(tmpDir)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	encryptor, _ := security.NewEncryptor([]byte("test-key"))
+	storage, err := NewStorage(StorageConfig{DataDir: tmpDir, Encryptor: encryptor, Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	secret := &types.Secret{
+		Name:      "db",
+		Namespace: "default",
+		Data:      map[string][]byte{"password": []byte("s3cr3t-value")},
+	}
+	if err := storage.SaveSecret(secret); err != nil {
+		t.Fatalf("Failed to save secret: %v", err)
+	}
+
+	// Neither the state file nor the replicated state holds the plaintext
+	data, err := os.ReadFile(filepath.Join(tmpDir, "state.json"))
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if bytes.Contains(data, []byte("s3cr3t-value")) || bytes.Contains(data, []byte("czNjcjN0LXZhbHVl")) {
+		t.Error("Secret data persisted in plaintext")
+	}
+	if stored := storage.GetState().Secrets["default/db"]; stored.Data != nil || len(stored.EncryptedData) == 0 {
+		t.Error("Expected replicated secret to be encrypted")
+	}
+
+	// Reload from disk and decrypt
+	reloaded, err := NewStorage(StorageConfig{DataDir: tmpDir, Encryptor: encryptor, Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to reload storage: %v", err)
+	}
+	retrieved, err := reloaded.GetSecret("default", "db")
+	if err != nil {
+		t.Fatalf("Failed to get secret: %v", err)
+	}
+	if string(retrieved.Data["password"]) != "s3cr3t-value" {
+		t.Errorf("Expected decrypted password, got %q", retrieved.Data["password"])
+	}
+
+	if secrets := reloaded.ListSecrets(); len(secrets) != 1 || secrets[0].Data != nil || secrets[0].EncryptedData != nil {
+		t.Error("Expected listed secrets to omit their data")
+	}
+}
+
+func TestReencryptSecrets(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "storage-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer cleanup(tmpDir)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	oldKey := bytes.Repeat([]byte("o"), 32)
+	newKey := bytes.Repeat([]byte("n"), 32)
+	encryptor, _ := security.NewEncryptor(oldKey)
+	storage, err := NewStorage(StorageConfig{DataDir: tmpDir, Encryptor: encryptor, Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	secret := &types.Secret{Name: "db", Namespace: "default", Data: map[string][]byte{"password": []byte("x")}}
+	if err := storage.SaveSecret(secret); err != nil {
+		t.Fatalf("Failed to save secret: %v", err)
+	}
+
+	encryptor.InstallKey(newKey)
+	if err := encryptor.UseKey(security.KeyFingerprint(newKey)); err != nil {
+		t.Fatalf("Failed to use key: %v", err)
+	}
+	if err := storage.ReencryptSecrets(); err != nil {
+		t.Fatalf("Failed to reencrypt secrets: %v", err)
+	}
+
+	// The old key can be removed without losing the secret
+	if err := encryptor.RemoveKey(security.KeyFingerprint(oldKey)); err != nil {
+		t.Fatalf("Failed to remove key: %v", err)
+	}
+	retrieved, err := storage.GetSecret("default", "db")
+	if err != nil {
+		t.Fatalf("Failed to get secret: %v", err)
+	}
+	if string(retrieved.Data["password"]) != "x" {
+		t.Errorf("Expected decrypted password, got %q", retrieved.Data["password"])
+	}
+}
+
+func TestSaveSecretWithoutEncryptor(t *testing.T) {
+	storage, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	secret := &types.Secret{Name: "db", Namespace: "default", Data: map[string][]byte{"password": []byte("x")}}
+	if err := storage.SaveSecret(secret); err == nil {
+		t.Error("Expected saving a secret without encryptor to fail")
+	}
+}
+
+// fakeReplicator commits commands right away
+type fakeReplicator struct {
+	fsm      *FSM
+	commands int
+}
+
+func (r *fakeReplicator) Apply(cmd []byte, timeout time.Duration) error {
+	r.commands++
+	return r.fsm.Apply(cmd)
+}
+
+func TestReplicatedWrites(t *testing.T) {
+	storage, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	replicator := &fakeReplicator{fsm: storage.FSM()}
+	storage.SetReplicator(replicator)
+
+	deployment := &types.Deployment{Name: "web", Namespace: "default", DesiredReplicas: 2}
+	if err := storage.SaveDeployment(deployment); err != nil {
+		t.Fatalf("Failed to save deployment: %v", err)
+	}
+	stored, err := storage.GetDeployment("default", "web")
+	if err != nil {
+		t.Fatalf("Expected deployment to be applied: %v", err)
+	}
+	if stored == deployment || stored.DesiredReplicas != 2 {
+		t.Errorf("Expected a decoded copy of the deployment, got %+v", stored)
+	}
+
+	if err := storage.DeleteDeployment("default", "web"); err != nil {
+		t.Fatalf("Failed to delete deployment: %v", err)
+	}
+	if _, err := storage.GetDeployment("default", "web"); err == nil {
+		t.Error("Expected deployment to be deleted")
+	}
+	if replicator.commands != 2 {
+		t.Errorf("Expected 2 replicated commands, got %d", replicator.commands)
+	}
+
+	// Gossiped state is ignored while the consensus log is the source of truth
+	msg := []byte(`{"type":"state_sync","state":{"deployments":{"default/other":{"Name":"other","Namespace":"default"}},"last_modified":"2100-01-01T00:00:00Z"}}`)
+	if err := storage.HandleStateSyncMessage(msg); err != nil {
+		t.Fatalf("Failed to handle state sync: %v", err)
+	}
+	if _, err := storage.GetDeployment("default", "other"); err == nil {
+		t.Error("Expected gossiped state to be ignored")
+	}
+
+	// A fencing token committed after a higher one does not lower it
+	if err := storage.Fence("backup", 2); err != nil {
+		t.Fatalf("Failed to accept token: %v", err)
+	}
+	if err := replicator.fsm.Apply([]byte(`{"op":"save","kind":"fences","key":"backup","value":{"lease":"backup","holder":"node-1","token":1}}`)); err != nil {
+		t.Fatalf("Failed to apply command: %v", err)
+	}
+	if fence, err := storage.GetFence("backup"); err != nil || fence.Token != 2 {
+		t.Errorf("Expected token 2 to be kept, got %+v (%v)", fence, err)
+	}
+}
+
+// failingReplicator fails every command, like a cluster without a leader
+type failingReplicator struct{}
+
+func (failingReplicator) Apply(cmd []byte, timeout time.Duration) error {
+	return fmt.Errorf("no leader")
+}
+
+func TestFailedReplicationKeepsState(t *testing.T) {
+	storage, tmpDir := setupTestStorage(t)
+	defer cleanup(tmpDir)
+
+	storage.SetReplicator(&fakeReplicator{fsm: storage.FSM()})
+	deployment := &types.Deployment{Name: "web", Namespace: "default", Pods: []*types.Pod{{ID: "a", Name: "web-0"}}}
+	if err := storage.SaveDeployment(deployment); err != nil {
+		t.Fatalf("Failed to save deployment: %v", err)
+	}
+
+	// Changes of a write that was not committed are not visible
+	storage.SetReplicator(failingReplicator{})
+	changed, err := storage.GetDeployment("default", "web")
+	if err != nil {
+		t.Fatalf("Failed to get deployment: %v", err)
+	}
+	changed.Pods[0].State = types.PodStateRunning
+	changed.Pods = append(changed.Pods, &types.Pod{ID: "b", Name: "web-1"})
+	if err := storage.SaveDeployment(changed); err == nil {
+		t.Fatal("Expected the write to fail")
+	}
+
+	stored, _ := storage.GetDeployment("default", "web")
+	if len(stored.Pods) != 1 || stored.Pods[0].State != "" {
+		t.Errorf("Expected the stored deployment to be unchanged, got %+v", stored.Pods)
+	}
+	for _, listed := range storage.ListDeployments() {
+		listed.Pods[0].State = types.PodStateRunning
+	}
+	if stored, _ := storage.GetDeployment("default", "web"); stored.Pods[0].State != "" {
+		t.Error("Expected listed deployments to be copies")
+	}
+}
+
+func TestFSMSnapshotRestore(t *testing.T) {
+	source, sourceDir := setupTestStorage(t)
+	defer cleanup(sourceDir)
+	target, targetDir := setupTestStorage(t)
+	defer cleanup(targetDir)
+
+	source.SaveService(&types.Service{Name: "web", Namespace: "default"})
+	target.SaveDeployment(&types.Deployment{Name: "stale", Namespace: "default"})
+
+	data, err := source.FSM().Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	if err := target.FSM().Restore(data); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+
+	if _, err := target.GetService("default", "web"); err != nil {
+		t.Errorf("Expected service to be restored: %v", err)
+	}
+	if len(target.ListDeployments()) != 0 {
+		t.Error("Expected restore to replace the existing state")
+	}
+}
@@ -8,31 +8,59 @@ import (
 
 // StateSyncMessage represents a state synchronization message
 type StateSyncMessage struct {
-	Type      string        `json:"type"`      // "state_sync", "state_request"
-	State     *ClusterState `json:"state"`     // Full state for sync
-	Timestamp time.Time     `json:"timestamp"` // Message timestamp
-	NodeName  string        `json:"node_name"` // Originating node
+	Type      string    `json:"type"`             // "state_delta", "state_request"
+	Deltas    []*Delta  `json:"deltas,omitempty"` // Changed objects
+	Timestamp time.Time `json:"timestamp"`        // Message timestamp
+	NodeName  string    `json:"node_name"`        // Originating node
 }
 
-// BroadcastState broadcasts the current state to all nodes
+// maxDeltaMessageSize keeps batches of deltas within a UDP packet.
+// Larger objects are sent in a message of their own.
+const maxDeltaMessageSize = 1200
+
+// BroadcastState broadcasts the objects written locally since the last
+// broadcast as deltas. Nothing is sent when writes are replicated through consensus.
 func (s *Storage) BroadcastState(broadcast func([]byte) error, nodeName string) error {
-	s.mu.RLock()
-	state := s.GetState()
-	s.mu.RUnlock()
+	if s.replicator != nil {
+		return nil
+	}
 
-	msg := StateSyncMessage{
-		Type:      "state_sync",
-		State:     state,
-		Timestamp: time.Now(),
-		NodeName:  nodeName,
+	deltas := s.takePendingDeltas()
+	var firstErr error
+	send := func(batch []*Delta) {
+		msg := StateSyncMessage{
+			Type:      "state_delta",
+			Deltas:    batch,
+			Timestamp: time.Now(),
+			NodeName:  nodeName,
+		}
+
+		data, err := json.Marshal(msg)
+		if err == nil {
+			err = broadcast(data)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to broadcast state delta: %w", err)
+		}
 	}
 
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal state sync message: %w", err)
+	// Batch small deltas into messages of up to maxDeltaMessageSize
+	var batch []*Delta
+	size := 0
+	for _, d := range deltas {
+		deltaSize := len(d.Kind) + len(d.Key) + len(d.Value) + 160 // Version and message fields
+		if len(batch) > 0 && size+deltaSize > maxDeltaMessageSize {
+			send(batch)
+			batch, size = nil, 0
+		}
+		batch = append(batch, d)
+		size += deltaSize
+	}
+	if len(batch) > 0 {
+		send(batch)
 	}
 
-	return broadcast(data)
+	return firstErr
 }
 
 // HandleStateSyncMessage handles incoming state synchronization messages
@@ -42,12 +70,23 @@ func (s *Storage) HandleStateSyncMessage(data []byte) error {
 		return fmt.Errorf("failed to unmarshal state sync message: %w", err)
 	}
 
+	// The consensus log is the source of truth when enabled
+	if s.replicator != nil {
+		return nil
+	}
+
 	switch msg.Type {
-	case "state_sync":
-		// Merge incoming state
-		if msg.State != nil {
-			return s.MergeState(msg.State)
+	case "state_delta":
+		applied, err := s.ApplyDeltas(msg.Deltas)
+		if applied > 0 {
+			s.logger.Debugf("Applied %d deltas from node %s", applied, msg.NodeName)
 		}
+		return err
+	case "state_sync":
+		// The full state of peers that do not send deltas yet has no object
+		// versions, merging it could bring deleted objects back and roll back
+		// newer ones. Those peers have to be upgraded.
+		s.logger.Warnf("Ignoring full state of node %s, it does not send versioned deltas", msg.NodeName)
 	case "state_request":
 		// Another node is requesting our state
 		// This would trigger a BroadcastState call
@@ -57,13 +96,31 @@ func (s *Storage) HandleStateSyncMessage(data []byte) error {
 	return nil
 }
 
-// StartPeriodicBackup starts periodic backup routine
-func (s *Storage) StartPeriodicBackup(interval time.Duration) {
+// Flush broadcasts the local writes not sent yet and writes the state to
+// disk, e.g. before the node leaves the cluster
+func (s *Storage) Flush(broadcast func([]byte) error, nodeName string) error {
+	if err := s.BroadcastState(broadcast, nodeName); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.persist()
+}
+
+// StartPeriodicBackup starts periodic backup routine. Backups are only taken
+// while shouldRun returns true, e.g. on the holder of the backup lease, or
+// always if it is nil. A backup only writes to the local disk, so it is not
+// fenced.
+func (s *Storage) StartPeriodicBackup(interval time.Duration, shouldRun func() bool) {
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
 		for range ticker.C {
+			if shouldRun != nil && !shouldRun() {
+				continue
+			}
 			if err := s.Backup(); err != nil {
 				s.logger.Errorf("Failed to create backup: %v", err)
 			}
@@ -71,7 +128,9 @@ func (s *Storage) StartPeriodicBackup(interval time.Duration) {
 	}()
 }
 
-// StartPeriodicSync starts periodic state synchronization
+// StartPeriodicSync starts periodic state synchronization. Local writes not
+// broadcast yet are sent as deltas and expired tombstones are collected.
+// Peers repair lost deltas through the anti-entropy exchange.
 func (s *Storage) StartPeriodicSync(interval time.Duration, broadcast func([]byte) error, nodeName string) {
 	go func() {
 		ticker := time.NewTicker(interval)
@@ -81,6 +140,9 @@ func (s *Storage) StartPeriodicSync(interval time.Duration, broadcast func([]byt
 			if err := s.BroadcastState(broadcast, nodeName); err != nil {
 				s.logger.Debugf("Failed to broadcast state: %v", err)
 			}
+			if collected := s.CollectTombstones(TombstoneTTL); collected > 0 {
+				s.logger.Debugf("Collected %d tombstones", collected)
+			}
 		}
 	}()
 }
@@ -1,9 +1,13 @@
 package types
 
 import (
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // PodState represents the state of a pod
@@ -19,48 +23,220 @@ const (
 
 // Pod represents a pod in the cluster
 type Pod struct {
-	ID          string
-	Name        string
-	Namespace   string
-	NodeName    string
-	State       PodState
-	Image       string
-	Labels      map[string]string
-	Annotations map[string]string
-	Ports       []corev1.ContainerPort
-	Env         []corev1.EnvVar
-	Volumes     []corev1.VolumeMount
-	NodeSelector map[string]string
-	CreatedAt   int64
+	ID                        string
+	PodmanID                  string // Podman pod ID, set by the node running the pod
+	Name                      string
+	Namespace                 string
+	NodeName                  string
+	State                     PodState
+	Image                     string // Image of the first container
+	Labels                    map[string]string
+	Annotations               map[string]string
+	Containers                []Container
+	InitContainers            []Container // Run to completion in order before the containers start
+	Volumes                   []corev1.Volume
+	Hostname                  string // Hostname of the pod, defaults to the pod name
+	Subdomain                 string // Headless service the pod gets a DNS name under
+	NodeSelector              map[string]string
+	Affinity                  *corev1.Affinity
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint
+	Tolerations               []corev1.Toleration
+	RestartPolicy             corev1.RestartPolicy
+	TerminationGracePeriod    *int64                // Seconds the containers get to stop, defaults to 30
+	Ready                     bool                  // Running and passing its readiness probes
+	Reason                    string                // Reason for the current state, e.g. CrashLoopBackOff
+	RestartCount              int32                 // Restarts of all containers
+	LastTermination           *ContainerTermination // Last termination of any container
+	ContainerStatuses         []ContainerStatus
+	TemplateHash              string // Hash of the template the pod was created from
+	CreatedAt                 int64
+}
+
+// Container represents a container of a pod
+type Container struct {
+	Name           string
+	Image          string
+	Command        []string // Entrypoint
+	Args           []string
+	WorkingDir     string
+	Ports          []corev1.ContainerPort
+	Env            []corev1.EnvVar
+	EnvFrom        []corev1.EnvFromSource
+	Volumes        []corev1.VolumeMount
+	Resources      corev1.ResourceRequirements
+	LivenessProbe  *corev1.Probe
+	ReadinessProbe *corev1.Probe
+	StartupProbe   *corev1.Probe
+	Lifecycle      *corev1.Lifecycle // Only the preStop hook is run
+}
+
+// ContainerStatus is the observed state of a container of a pod
+type ContainerStatus struct {
+	Name            string
+	ContainerID     string
+	State           string // Podman container state
+	Init            bool
+	RestartCount    int32
+	LastTermination *ContainerTermination
+}
+
+// ContainerTermination describes how a container last terminated
+type ContainerTermination struct {
+	ExitCode   int32
+	Reason     string
+	FinishedAt int64
+}
+
+// PodStatus is the status of a pod reported by the node running it. It is
+// stored apart from the workload owning the pod, so that the nodes reporting
+// statuses and the leader scheduling pods do not overwrite each other's writes.
+type PodStatus struct {
+	ID                string // ID of the pod
+	NodeName          string // Node that reported the status
+	PodmanID          string
+	State             PodState
+	Ready             bool
+	Reason            string
+	RestartCount      int32
+	LastTermination   *ContainerTermination
+	ContainerStatuses []ContainerStatus
 }
 
 // Deployment represents a deployment
 type Deployment struct {
-	Name         string
-	Namespace    string
-	Replicas     int32
+	Name            string
+	Namespace       string
+	Replicas        int32
 	DesiredReplicas int32
-	Pods         []*Pod
+	Pods            []*Pod
+	Template        corev1.PodTemplateSpec
+	Labels          map[string]string
+	Selector        *metav1.LabelSelector
+	Strategy        appsv1.DeploymentStrategy
+	Paused          bool
+	TemplateHash    string               // Hash of the current template
+	Revision        int64                // Current revision
+	HistoryLimit    int32                // Number of old revisions to keep
+	Revisions       []DeploymentRevision // Rollout history, oldest first
+}
+
+// DeploymentRevision is a recorded template of a deployment
+type DeploymentRevision struct {
+	Revision     int64
+	TemplateHash string
 	Template     corev1.PodTemplateSpec
-	Labels       map[string]string
-	Selector     *metav1.LabelSelector
+	CreatedAt    int64
+}
+
+// RolloutStatus describes the progress of a deployment rollout
+type RolloutStatus struct {
+	Revision  int64
+	Desired   int32
+	Updated   int32 // Pods of the current revision
+	Available int32 // Available pods of the current revision
+	Old       int32 // Pods of previous revisions
+	Paused    bool
+	Complete  bool
+	Message   string
+}
+
+// StatefulSet represents a stateful set. Pods are named "<name>-<ordinal>"
+// and keep their name, volume claims and DNS name when they are recreated.
+type StatefulSet struct {
+	Name                 string
+	Namespace            string
+	Replicas             int32
+	DesiredReplicas      int32
+	ServiceName          string // Headless service governing the DNS names of the pods
+	Pods                 []*Pod // Ordered by ordinal
+	Template             corev1.PodTemplateSpec
+	VolumeClaimTemplates []corev1.PersistentVolumeClaim
+	Labels               map[string]string
+	Selector             *metav1.LabelSelector
+	PodManagementPolicy  appsv1.PodManagementPolicyType
+	UpdateStrategy       appsv1.StatefulSetUpdateStrategy
+	TemplateHash         string // Hash of the current template
+}
+
+// DaemonSet represents a daemon set, which runs one pod on every node
+// matching its node selector and node affinity
+type DaemonSet struct {
+	Name            string
+	Namespace       string
+	Replicas        int32 // Running pods
+	DesiredReplicas int32 // Matching nodes
+	Pods            []*Pod
+	Template        corev1.PodTemplateSpec
+	Labels          map[string]string
+	Selector        *metav1.LabelSelector
+	UpdateStrategy  appsv1.DaemonSetUpdateStrategy
+	TemplateHash    string // Hash of the current template
+}
+
+// JobConditionType is the terminal condition of a job
+type JobConditionType string
+
+const (
+	JobComplete JobConditionType = "Complete"
+	JobFailed   JobConditionType = "Failed"
+)
+
+// Job represents a job, which runs pods until Completions of them succeeded
+type Job struct {
+	Name                  string
+	Namespace             string
+	Labels                map[string]string
+	Template              corev1.PodTemplateSpec
+	Completions           int32
+	Parallelism           int32
+	BackoffLimit          int32  // Failed pods and container restarts before the job fails
+	ActiveDeadlineSeconds *int64 // Run time after which the job fails
+	CronJob               string // Name of the cron job that created the job
+	Pods                  []*Pod
+	Active                int32 // Pods that did not finish yet
+	Succeeded             int32
+	Failed                int32
+	Condition             JobConditionType // Empty while the job runs
+	Reason                string           // Reason of a failed job, e.g. BackoffLimitExceeded
+	StartTime             int64
+	CompletionTime        int64 // Time the job completed or failed
+	CreatedAt             int64
+}
+
+// CronJob represents a cron job, which creates jobs on a cron schedule
+type CronJob struct {
+	Name                       string
+	Namespace                  string
+	Labels                     map[string]string
+	Schedule                   string
+	TimeZone                   string
+	Suspend                    bool
+	ConcurrencyPolicy          batchv1.ConcurrencyPolicy
+	StartingDeadlineSeconds    *int64 // Missed runs older than this are skipped
+	SuccessfulJobsHistoryLimit int32
+	FailedJobsHistoryLimit     int32
+	JobTemplate                batchv1.JobTemplateSpec
+	Active                     []string // Names of the running jobs
+	LastScheduleTime           int64    // Scheduled time of the last run
+	LastSuccessfulTime         int64
+	CreatedAt                  int64
 }
 
 // Service represents a Kubernetes service
 type Service struct {
-	Name        string
-	Namespace   string
-	Type        corev1.ServiceType
-	Selector    map[string]string
-	Ports       []corev1.ServicePort
-	ClusterIP   string
-	Labels      map[string]string
+	Name      string
+	Namespace string
+	Type      corev1.ServiceType
+	Selector  map[string]string
+	Ports     []corev1.ServicePort
+	ClusterIP string
+	Labels    map[string]string
 }
 
 // IngressRule represents an ingress rule
 type IngressRule struct {
-	Host        string
-	Paths       []IngressPath
+	Host  string
+	Paths []IngressPath
 }
 
 // IngressPath represents an ingress path
@@ -80,14 +256,101 @@ type Ingress struct {
 	Annotations map[string]string
 }
 
+// ConfigMap represents a Kubernetes config map
+type ConfigMap struct {
+	Name       string
+	Namespace  string
+	Labels     map[string]string
+	Data       map[string]string
+	BinaryData map[string][]byte
+	CreatedAt  int64
+}
+
+// Secret represents a Kubernetes secret. The data is only held in memory,
+// storage keeps and replicates it encrypted with the cluster key.
+type Secret struct {
+	Name          string
+	Namespace     string
+	Labels        map[string]string
+	Type          corev1.SecretType
+	Data          map[string][]byte
+	EncryptedData []byte
+	CreatedAt     int64
+}
+
+// PersistentVolumeClaim represents a claim for a Podman named volume. The
+// volume is provisioned on the node of the first pod using the claim, later
+// pods using the claim are pinned to that node.
+type PersistentVolumeClaim struct {
+	Name             string
+	Namespace        string
+	Labels           map[string]string
+	AccessModes      []corev1.PersistentVolumeAccessMode
+	StorageClassName string
+	Requests         corev1.ResourceList
+	Phase            corev1.PersistentVolumeClaimPhase
+	NodeName         string // Node the volume is provisioned on, empty until bound
+	VolumeName       string // Podman volume name, set when bound
+	CreatedAt        int64
+}
+
+// PodDisruptionBudget limits how many of the pods it selects voluntary
+// disruptions, like draining a node, take down at the same time
+type PodDisruptionBudget struct {
+	Name           string
+	Namespace      string
+	Labels         map[string]string
+	Selector       *metav1.LabelSelector
+	MinAvailable   *intstr.IntOrString // Pods that have to stay available, a number or a percentage
+	MaxUnavailable *intstr.IntOrString // Pods that may be unavailable, a number or a percentage
+	CreatedAt      int64
+}
+
+// Role grants access to resources in its namespace. Cluster roles have no
+// namespace and may be bound cluster-wide or in a namespace.
+type Role struct {
+	Name      string
+	Namespace string // Empty for cluster roles
+	Labels    map[string]string
+	Rules     []rbacv1.PolicyRule
+	CreatedAt int64
+}
+
+// RoleBinding grants the permissions of a role to users, groups and service
+// accounts in its namespace. Cluster role bindings have no namespace and
+// grant the permissions in all namespaces.
+type RoleBinding struct {
+	Name      string
+	Namespace string // Empty for cluster role bindings
+	Labels    map[string]string
+	RoleRef   rbacv1.RoleRef
+	Subjects  []rbacv1.Subject
+	CreatedAt int64
+}
+
+// ServiceAccount is an identity API tokens can be issued for
+type ServiceAccount struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+	CreatedAt int64
+}
+
 // Node represents a node in the cluster
 type Node struct {
-	Name        string
-	Address     string
-	Status      string
-	Labels      map[string]string
-	Capacity    corev1.ResourceList
-	Allocatable corev1.ResourceList
+	Name          string
+	Address       string
+	Status        string
+	Labels        map[string]string
+	Taints        []corev1.Taint
+	Capacity      corev1.ResourceList
+	Allocatable   corev1.ResourceList
+	APIAddress    string // Address of the API server of the node
+	AgentVersion  string
+	OS            string
+	Arch          string
+	PodmanVersion string
+	Keys          []string // Fingerprints of the gossip keys, the primary key first
 }
 
 // DNSWhitelist represents a DNS whitelist configuration